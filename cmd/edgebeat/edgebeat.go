@@ -12,13 +12,24 @@ import (
 
 	"github.com/jilanisayyad/edgebeat/pkg/config"
 	"github.com/jilanisayyad/edgebeat/pkg/controller"
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
+	"github.com/jilanisayyad/edgebeat/pkg/gps"
 	"github.com/jilanisayyad/edgebeat/pkg/handler"
+	"github.com/jilanisayyad/edgebeat/pkg/modbus"
 	"github.com/jilanisayyad/edgebeat/pkg/mqtt"
+	"github.com/jilanisayyad/edgebeat/pkg/opcua"
+	"github.com/jilanisayyad/edgebeat/pkg/sink"
+	"github.com/jilanisayyad/edgebeat/pkg/snmp"
+	"github.com/jilanisayyad/edgebeat/pkg/sysfs"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
 	"go.uber.org/zap"
 )
 
 const defaultConfigPath = "configs/config.yaml"
 
+// version is overridden at build time via -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
 	configPath := flag.String("config", defaultConfigPath, "path to config file")
 	flag.Parse()
@@ -48,8 +59,15 @@ func main() {
 
 	store := controller.NewStore()
 
+	sinks := sink.NewFanout(logger)
+	defer func() {
+		if err := sinks.Close(); err != nil {
+			logger.Error("sink close failed", zap.Error(err))
+		}
+	}()
+
 	// Initialize MQTT publisher if enabled
-	var publisher *mqtt.Publisher
+	var brokers *mqtt.Group
 	if cfg.MQTT.Enabled {
 		mqttCfg := mqtt.Config{
 			Broker:   cfg.MQTT.Broker,
@@ -58,24 +76,183 @@ func main() {
 			Username: cfg.MQTT.Username,
 			Password: cfg.MQTT.Password,
 			QoS:      cfg.MQTT.QoS,
+
+			Brokers:    cfg.MQTT.Brokers,
+			BrokerMode: cfg.MQTT.BrokerMode,
+
+			ProtocolVersion:      cfg.MQTT.ProtocolVersion,
+			ContentType:          cfg.MQTT.ContentType,
+			MessageExpirySeconds: cfg.MQTT.MessageExpirySeconds,
+			TopicAlias:           cfg.MQTT.TopicAlias,
+			UserProperties: map[string]string{
+				"hostname":       hostname(),
+				"agent_version":  version,
+				"schema_version": utils.SchemaVersion,
+			},
+
+			PayloadFormat: cfg.MQTT.PayloadFormat,
+			Sparkplug: mqtt.SparkplugConfig{
+				GroupID:    cfg.MQTT.Sparkplug.GroupID,
+				EdgeNodeID: cfg.MQTT.Sparkplug.EdgeNodeID,
+			},
+		}
+		if mqttCfg.Sparkplug.EdgeNodeID == "" {
+			mqttCfg.Sparkplug.EdgeNodeID = nodeID(cfg.MQTT.ClientID)
+		}
+		if cfg.MQTT.HomeAssistant.Enabled {
+			haNode := cfg.MQTT.HomeAssistant.NodeID
+			if haNode == "" {
+				haNode = nodeID(cfg.MQTT.ClientID)
+			}
+			statePrefix := cfg.MQTT.HomeAssistant.StateTopicPrefix
+			if statePrefix == "" {
+				statePrefix = "edgebeat/" + haNode
+			}
+			mqttCfg.HomeAssistant = mqtt.HomeAssistantConfig{
+				Enabled:         true,
+				DiscoveryPrefix: cfg.MQTT.HomeAssistant.DiscoveryPrefix,
+				NodeID:          haNode,
+				StatePrefix:     statePrefix,
+				SoftwareVersion: version,
+			}
 		}
 		var err error
-		publisher, err = mqtt.NewPublisher(ctx, mqttCfg, logger)
+		brokers, err = mqtt.NewGroup(ctx, mqttCfg, logger)
 		if err != nil {
 			logger.Fatal("mqtt initialization failed", zap.Error(err))
 		}
-		defer func() {
-			if err := publisher.Close(); err != nil {
-				logger.Error("mqtt close failed", zap.Error(err))
+		// Sparkplug B encodes the JSON payload itself.
+		var enc encoding.Encoder
+		if cfg.MQTT.PayloadFormat != mqtt.PayloadSparkplugB {
+			if enc, err = encoding.Lookup(cfg.MQTT.PayloadFormat); err != nil {
+				logger.Fatal("mqtt initialization failed", zap.Error(err))
 			}
-		}()
+		}
+		// Report by exception saves data on the MQTT link; other sinks keep
+		// receiving every full snapshot.
+		var pub sink.PayloadPublisher = brokers
+		if cfg.ReportByException.Enabled {
+			pub = controller.NewExceptionPublisher(brokers, controller.ExceptionConfig{
+				AbsoluteDeadband: cfg.ReportByException.AbsoluteDeadband,
+				PercentDeadband:  cfg.ReportByException.PercentDeadband,
+				Heartbeat:        time.Duration(cfg.ReportByException.HeartbeatMinutes) * time.Minute,
+			}, logger)
+		}
+		sinks.Add("mqtt", "mqtt", sink.FromPublisher(pub, enc), sink.RetryPolicy{MaxAttempts: 1})
+	}
+
+	for _, sinkCfg := range cfg.Sinks {
+		s, err := sink.New(ctx, sinkCfg, logger)
+		if err != nil {
+			logger.Fatal("sink initialization failed", zap.Error(err))
+		}
+		sinks.Add(sinkCfg.Name, sinkCfg.Type, s, sink.PolicyFromConfig(sinkCfg))
+	}
+
+	var publisher controller.Publisher
+	if sinks.Len() > 0 {
+		publisher = sinks
+	}
+
+	var runOpts []controller.Option
+	live := make(map[string]handler.IntegrationStatusSource)
+	if cfg.Integrations.Modbus.Enabled {
+		poller, err := newModbusPoller(cfg.Integrations.Modbus, logger)
+		if err != nil {
+			logger.Fatal("modbus initialization failed", zap.Error(err))
+		}
+		defer poller.Close()
+		runOpts = append(runOpts, controller.WithCollectors(poller))
+		live["modbus"] = poller
+	}
+
+	if cfg.Integrations.OPCUA.Enabled {
+		client, err := newOPCUAClient(cfg.Integrations.OPCUA, logger)
+		if err != nil {
+			logger.Fatal("opcua initialization failed", zap.Error(err))
+		}
+		defer client.Close()
+		runOpts = append(runOpts, controller.WithCollectors(client))
+		live["opcua"] = client
+	}
+
+	if cfg.Integrations.SNMP.Enabled {
+		poller, err := newSNMPPoller(cfg.Integrations.SNMP, logger)
+		if err != nil {
+			logger.Fatal("snmp initialization failed", zap.Error(err))
+		}
+		defer poller.Close()
+		runOpts = append(runOpts, controller.WithCollectors(poller))
+		live["snmp"] = poller
+	}
+
+	if cfg.Integrations.GPS.Enabled {
+		collector, err := newGPSCollector(cfg.Integrations.GPS, logger)
+		if err != nil {
+			logger.Fatal("gps initialization failed", zap.Error(err))
+		}
+		defer collector.Close()
+		runOpts = append(runOpts, controller.WithCollectors(collector))
+	}
+
+	if cfg.Integrations.OneWire.Enabled {
+		collector, err := newOneWireCollector(cfg.Integrations.OneWire)
+		if err != nil {
+			logger.Fatal("onewire initialization failed", zap.Error(err))
+		}
+		runOpts = append(runOpts, controller.WithCollectors(collector))
+	}
+
+	if cfg.Integrations.IIO.Enabled {
+		collector, err := newIIOCollector(cfg.Integrations.IIO)
+		if err != nil {
+			logger.Fatal("iio initialization failed", zap.Error(err))
+		}
+		runOpts = append(runOpts, controller.WithCollectors(collector))
+	}
+
+	if cfg.Integrations.ModbusServer.Enabled {
+		srv, err := newModbusServer(cfg.Integrations.ModbusServer, logger)
+		if err != nil {
+			logger.Fatal("modbus server initialization failed", zap.Error(err))
+		}
+		defer srv.Close()
+		store.OnUpdate(srv.Update)
+		logger.Info("modbus server listening", zap.String("address", srv.Addr().String()))
+	}
+
+	if cfg.Integrations.OPCUA.Server.Enabled {
+		srv, err := newOPCUAServer(cfg.Integrations.OPCUA, logger)
+		if err != nil {
+			logger.Fatal("opcua server initialization failed", zap.Error(err))
+		}
+		defer srv.Close()
+		store.OnUpdate(srv.Update)
+		logger.Info("opcua server listening", zap.String("endpoint", srv.Endpoint()))
+	}
+
+	if cfg.Integrations.SNMPAgent.Enabled {
+		agent, err := newSNMPAgent(cfg.Integrations.SNMPAgent, logger)
+		if err != nil {
+			logger.Fatal("snmp agent initialization failed", zap.Error(err))
+		}
+		defer agent.Close()
+		store.OnUpdate(agent.Update)
+		logger.Info("snmp agent listening", zap.String("address", agent.Addr().String()))
 	}
 
-	go controller.Run(ctx, logger, time.Duration(cfg.FrequencySeconds)*time.Second, store, publisher)
+	go controller.Run(ctx, logger, time.Duration(cfg.FrequencySeconds)*time.Second, store, publisher, runOpts...)
 
 	// Setup HTTP handlers
 	mux := http.NewServeMux()
 	h := handler.New(store, cfg.Integrations)
+	if brokers != nil {
+		h.SetBrokerStatusSource(brokers)
+	}
+	h.SetSinkStatusSource(sinks)
+	for name, src := range live {
+		h.SetIntegrationStatusSource(name, src)
+	}
 	h.RegisterRoutes(mux, "")
 
 	endpoints := []string{
@@ -88,11 +265,15 @@ func main() {
 		"/metrics/system",
 		"/metrics/sensors",
 		"/integrations",
+		"/integrations/{name}/test",
+		"/mqtt/brokers",
+		"/sinks",
 		"/data/fabricate",
 		"/ping",
 	}
 
 	logger.Info("starting edgebeat",
+		zap.String("version", version),
 		zap.String("address", cfg.Rest.Address),
 		zap.Int("frequency_seconds", cfg.FrequencySeconds),
 		zap.Strings("endpoints", endpoints),
@@ -123,3 +304,193 @@ func main() {
 		logger.Error("server shutdown", zap.Error(err))
 	}
 }
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+// nodeID picks a stable identifier for the device: the configured MQTT client
+// id when set, otherwise the hostname.
+func nodeID(clientID string) string {
+	if clientID != "" {
+		return clientID
+	}
+	return hostname()
+}
+
+// newModbusPoller creates the poller for the configured device and register
+// map.
+func newModbusPoller(cfg config.ModbusConfig, logger *zap.Logger) (*modbus.Poller, error) {
+	registers := make([]modbus.Register, len(cfg.Registers))
+	for i, r := range cfg.Registers {
+		registers[i] = modbus.Register{
+			Name:      r.Name,
+			Function:  r.FunctionCode,
+			Address:   r.Address,
+			DataType:  r.DataType,
+			Scale:     r.Scale,
+			ByteOrder: r.ByteOrder,
+			WordOrder: r.WordOrder,
+			Unit:      r.Unit,
+		}
+	}
+	return modbus.NewPoller(modbus.Config{
+		Mode: cfg.Mode,
+		Host: cfg.Host,
+		Port: cfg.Port,
+		Serial: modbus.SerialConfig{
+			Port:     cfg.SerialPort,
+			BaudRate: cfg.BaudRate,
+			DataBits: cfg.DataBits,
+			Parity:   cfg.Parity,
+			StopBits: cfg.StopBits,
+		},
+		UnitID:    cfg.UnitID,
+		Timeout:   time.Duration(cfg.TimeoutMS) * time.Millisecond,
+		Registers: registers,
+	}, logger.With(zap.String("integration", "modbus")))
+}
+
+// newOPCUAClient creates the client for the configured server and nodes.
+func newOPCUAClient(cfg config.OPCUAConfig, logger *zap.Logger) (*opcua.Client, error) {
+	nodes := make([]opcua.Node, len(cfg.Nodes))
+	for i, n := range cfg.Nodes {
+		nodes[i] = opcua.Node{Name: n.Name, NodeID: n.NodeID}
+	}
+	return opcua.NewClient(opcua.Config{
+		Endpoint:           cfg.Endpoint,
+		SecurityPolicy:     cfg.SecurityPolicy,
+		SecurityMode:       cfg.SecurityMode,
+		CertificateFile:    cfg.CertificateFile,
+		PrivateKeyFile:     cfg.PrivateKeyFile,
+		Username:           cfg.Username,
+		Password:           cfg.Password,
+		Nodes:              nodes,
+		Subscribe:          cfg.Subscribe,
+		PublishingInterval: time.Duration(cfg.PublishingIntervalMS) * time.Millisecond,
+		Timeout:            time.Duration(cfg.TimeoutMS) * time.Millisecond,
+	}, logger.With(zap.String("integration", "opcua")))
+}
+
+// newSNMPPoller creates the poller for the configured targets and objects.
+func newSNMPPoller(cfg config.SNMPConfig, logger *zap.Logger) (*snmp.Poller, error) {
+	targets := make([]snmp.Target, len(cfg.Targets))
+	for i, t := range cfg.Targets {
+		objects := make([]snmp.Object, len(t.Objects))
+		for j, o := range t.Objects {
+			objects[j] = snmp.Object{Name: o.Name, OID: o.OID, Walk: o.Walk, Scale: o.Scale, Unit: o.Unit}
+		}
+		targets[i] = snmp.Target{
+			Name:      t.Name,
+			Host:      t.Host,
+			Port:      t.Port,
+			Version:   t.Version,
+			Community: t.Community,
+			User: snmp.User{
+				Name:         t.User.Name,
+				AuthProtocol: t.User.AuthProtocol,
+				AuthPassword: t.User.AuthPassword,
+				PrivProtocol: t.User.PrivProtocol,
+				PrivPassword: t.User.PrivPassword,
+			},
+			Objects: objects,
+		}
+	}
+	return snmp.NewPoller(snmp.PollerConfig{
+		Targets: targets,
+		Timeout: time.Duration(cfg.TimeoutMS) * time.Millisecond,
+		Retries: cfg.Retries,
+	}, logger.With(zap.String("integration", "snmp")))
+}
+
+// newGPSCollector starts reading the configured receiver.
+func newGPSCollector(cfg config.GPSConfig, logger *zap.Logger) (*gps.Collector, error) {
+	return gps.NewCollector(gps.Config{
+		SerialPort: cfg.SerialPort,
+		BaudRate:   cfg.BaudRate,
+		File:       cfg.File,
+		MaxAge:     time.Duration(cfg.MaxAgeSeconds) * time.Second,
+	}, logger.With(zap.String("integration", "gps")))
+}
+
+// newOneWireCollector reads the configured 1-Wire thermometers.
+func newOneWireCollector(cfg config.OneWireConfig) (*sysfs.OneWireCollector, error) {
+	sensors := make([]sysfs.OneWireSensor, len(cfg.Sensors))
+	for i, s := range cfg.Sensors {
+		sensors[i] = sysfs.OneWireSensor{Name: s.Name, ID: s.ID}
+	}
+	return sysfs.NewOneWireCollector(sysfs.OneWireConfig{Root: cfg.SysfsRoot, Sensors: sensors})
+}
+
+// newIIOCollector reads the configured IIO channels.
+func newIIOCollector(cfg config.IIOConfig) (*sysfs.IIOCollector, error) {
+	sensors := make([]sysfs.IIOSensor, len(cfg.Sensors))
+	for i, s := range cfg.Sensors {
+		sensors[i] = sysfs.IIOSensor{Name: s.Name, Device: s.Device, Channel: s.Channel}
+	}
+	return sysfs.NewIIOCollector(sysfs.IIOConfig{Root: cfg.SysfsRoot, Sensors: sensors})
+}
+
+// newModbusServer starts the server that maps snapshot metrics to registers.
+func newModbusServer(cfg config.ModbusServerConfig, logger *zap.Logger) (*modbus.Server, error) {
+	registers := make([]modbus.MetricRegister, len(cfg.Registers))
+	for i, r := range cfg.Registers {
+		registers[i] = modbus.MetricRegister{
+			Metric: r.Metric,
+			Key:    r.Key,
+			Register: modbus.Register{
+				Function:  r.FunctionCode,
+				Address:   r.Address,
+				DataType:  r.DataType,
+				Scale:     r.Scale,
+				ByteOrder: r.ByteOrder,
+				WordOrder: r.WordOrder,
+			},
+		}
+	}
+	return modbus.NewServer(modbus.ServerConfig{
+		Address:   cfg.Address,
+		UnitID:    cfg.UnitID,
+		Registers: registers,
+	}, logger.With(zap.String("integration", "modbus_server")))
+}
+
+// newOPCUAServer starts the server that exposes the snapshot as a node tree,
+// secured like the OPC UA client.
+func newOPCUAServer(cfg config.OPCUAConfig, logger *zap.Logger) (*opcua.Server, error) {
+	return opcua.NewServer(opcua.ServerConfig{
+		Address:         cfg.Server.Address,
+		SecurityPolicy:  cfg.SecurityPolicy,
+		SecurityMode:    cfg.SecurityMode,
+		CertificateFile: cfg.CertificateFile,
+		PrivateKeyFile:  cfg.PrivateKeyFile,
+	}, logger.With(zap.String("integration", "opcua_server")))
+}
+
+// newSNMPAgent starts the agent that serves the snapshot to SNMP managers.
+func newSNMPAgent(cfg config.SNMPAgentConfig, logger *zap.Logger) (*snmp.Agent, error) {
+	users := make([]snmp.User, len(cfg.Users))
+	for i, u := range cfg.Users {
+		users[i] = snmp.User{
+			Name:         u.Name,
+			AuthProtocol: u.AuthProtocol,
+			AuthPassword: u.AuthPassword,
+			PrivProtocol: u.PrivProtocol,
+			PrivPassword: u.PrivPassword,
+		}
+	}
+	return snmp.NewAgent(snmp.AgentConfig{
+		Address:   cfg.Address,
+		Community: cfg.Community,
+		Users:     users,
+		EngineID:  cfg.EngineID,
+		BootsFile: cfg.BootsFile,
+		Contact:   cfg.Contact,
+		Location:  cfg.Location,
+		Version:   version,
+	}, logger.With(zap.String("integration", "snmp_agent")))
+}
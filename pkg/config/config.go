@@ -3,30 +3,65 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	DefaultFrequencySeconds = 60
-	MinFrequencySeconds     = 1
-	MaxFrequencySeconds     = 180
-	DefaultRestAddress      = ":8080"
-	DefaultRestPath         = "/health"
-	DefaultMQTTQoS          = 1
-	DefaultModbusMode       = "tcp"
-	DefaultModbusPort       = 502
-	DefaultModbusUnitID     = 1
-	DefaultOpcuaEndpoint    = "opc.tcp://localhost:4840"
-	DefaultOpcuaPolicy      = "None"
-	DefaultOpcuaMode        = "None"
+	DefaultFrequencySeconds  = 60
+	MinFrequencySeconds      = 1
+	MaxFrequencySeconds      = 180
+	DefaultRestAddress       = ":8080"
+	DefaultRestPath          = "/health"
+	DefaultMQTTQoS           = 1
+	DefaultMQTTProtocol      = "3.1.1"
+	DefaultMQTTContentType   = "application/json"
+	DefaultMQTTPayload       = "json"
+	DefaultMQTTBrokerMode    = "failover"
+	DefaultSparkplugGroupID  = "edgebeat"
+	DefaultHADiscoveryPrefix = "homeassistant"
+	DefaultHeartbeatMinutes  = 15
+	DefaultSinkEncoder       = "json"
+	DefaultSinkTimeout       = 10
+	DefaultSinkAttempts      = 3
+	DefaultSinkBackoffMS     = 500
+	DefaultSinkMaxBackoffMS  = 5000
+	DefaultSinkQueueSize     = 16
+	DefaultModbusMode        = "tcp"
+	DefaultModbusPort        = 502
+	DefaultModbusUnitID      = 1
+	DefaultModbusTimeoutMS   = 2000
+	DefaultModbusBaudRate    = 19200
+	DefaultModbusDataBits    = 8
+	DefaultModbusParity      = "even"
+	DefaultModbusStopBits    = 1
+	DefaultModbusServerAddr  = ":1502"
+	DefaultOpcuaEndpoint     = "opc.tcp://localhost:4840"
+	DefaultOpcuaPolicy       = "None"
+	DefaultOpcuaMode         = "None"
+	DefaultOpcuaTimeoutMS    = 5000
+	DefaultOpcuaPublishingMS = 1000
+	DefaultOpcuaServerAddr   = ":4840"
+	DefaultSNMPAgentAddr     = ":1161"
+	DefaultSNMPBootsFile     = "/var/lib/edgebeat/snmp_engine_boots"
+	DefaultSNMPPort          = 161
+	DefaultSNMPTimeoutMS     = 2000
+	DefaultSNMPRetries       = 1
+	DefaultGPSBaudRate       = 9600
+	DefaultGPSMaxAgeSeconds  = 10
+	DefaultSysfsRoot         = "/sys"
 )
 
 type Config struct {
-	FrequencySeconds int               `yaml:"frequency_seconds"`
-	Rest             RestConfig        `yaml:"rest"`
-	MQTT             MQTTConfig        `yaml:"mqtt"`
-	Integrations     IntegrationConfig `yaml:"integrations"`
+	FrequencySeconds  int                     `yaml:"frequency_seconds"`
+	Rest              RestConfig              `yaml:"rest"`
+	MQTT              MQTTConfig              `yaml:"mqtt"`
+	Sinks             []SinkConfig            `yaml:"sinks"`
+	ReportByException ReportByExceptionConfig `yaml:"report_by_exception"`
+	Integrations      IntegrationConfig       `yaml:"integrations"`
 }
 
 type RestConfig struct {
@@ -42,30 +77,414 @@ type MQTTConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	QoS      byte   `yaml:"qos"`
+
+	// Brokers replaces Broker when more than one broker is used. BrokerMode
+	// is failover (first connected broker in list order) or fanout (all).
+	Brokers    []string `yaml:"brokers"`
+	BrokerMode string   `yaml:"broker_mode"`
+
+	// MQTT 5 only settings; ignored when protocol_version is 3.1.1.
+	ProtocolVersion      string `yaml:"protocol_version"`
+	ContentType          string `yaml:"content_type"`
+	MessageExpirySeconds uint32 `yaml:"message_expiry_seconds"`
+	TopicAlias           bool   `yaml:"topic_alias"`
+
+	PayloadFormat string              `yaml:"payload_format"`
+	Sparkplug     SparkplugConfig     `yaml:"sparkplug"`
+	HomeAssistant HomeAssistantConfig `yaml:"home_assistant"`
+}
+
+type SparkplugConfig struct {
+	GroupID string `yaml:"group_id"`
+	// EdgeNodeID defaults to the MQTT client id, then the hostname.
+	EdgeNodeID string `yaml:"edge_node_id"`
+}
+
+type HomeAssistantConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	// NodeID defaults to the MQTT client id, then the hostname.
+	NodeID string `yaml:"node_id"`
+	// StateTopicPrefix defaults to edgebeat/<node_id>.
+	StateTopicPrefix string `yaml:"state_topic_prefix"`
+}
+
+// SinkConfig describes one additional output next to MQTT. Type selects the
+// implementation; the type specific settings live in the matching sub-struct.
+type SinkConfig struct {
+	Name           string      `yaml:"name"`
+	Type           string      `yaml:"type"`
+	Encoder        string      `yaml:"encoder"`
+	TimeoutSeconds int         `yaml:"timeout_seconds"`
+	Retry          RetryConfig `yaml:"retry"`
+	QueueSize      int         `yaml:"queue_size"`
+
+	InfluxDB    InfluxDBConfig    `yaml:"influxdb"`
+	RemoteWrite RemoteWriteConfig `yaml:"remote_write"`
+	OTLP        OTLPConfig        `yaml:"otlp"`
+	Webhook     WebhookConfig     `yaml:"webhook"`
+	File        FileConfig        `yaml:"file"`
+	StatsD      StatsDConfig      `yaml:"statsd"`
+	Graphite    GraphiteConfig    `yaml:"graphite"`
+	NATS        NATSConfig        `yaml:"nats"`
+	Syslog      SyslogConfig      `yaml:"syslog"`
+}
+
+type RetryConfig struct {
+	// MaxAttempts includes the first attempt; 1 disables retries.
+	MaxAttempts      int `yaml:"max_attempts"`
+	InitialBackoffMS int `yaml:"initial_backoff_ms"`
+	MaxBackoffMS     int `yaml:"max_backoff_ms"`
+}
+
+type InfluxDBConfig struct {
+	// URL is the server root, e.g. http://localhost:8086; the v2 write path
+	// is appended.
+	URL       string `yaml:"url"`
+	Org       string `yaml:"org"`
+	Bucket    string `yaml:"bucket"`
+	Token     string `yaml:"token"`
+	Precision string `yaml:"precision"`
+	// BatchSize is the number of snapshots sent per request.
+	BatchSize int  `yaml:"batch_size"`
+	MaxLines  int  `yaml:"max_buffered_lines"`
+	Gzip      bool `yaml:"gzip"`
+}
+
+type RemoteWriteConfig struct {
+	// URL is the full remote write endpoint, e.g.
+	// http://prometheus:9090/api/v1/write.
+	URL string `yaml:"url"`
+	// ExternalLabels are added to every series and override the default
+	// job and instance labels.
+	ExternalLabels map[string]string `yaml:"external_labels"`
+	// BatchSize is the number of snapshots sent per request.
+	BatchSize   int    `yaml:"batch_size"`
+	MaxSamples  int    `yaml:"max_buffered_samples"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	BearerToken string `yaml:"bearer_token"`
+}
+
+type OTLPConfig struct {
+	// URL is the collector's OTLP/HTTP endpoint, e.g. http://collector:4318;
+	// /v1/metrics is appended when the URL has no path.
+	URL string `yaml:"url"`
+	// Protocol is http/protobuf or http/json.
+	Protocol string            `yaml:"protocol"`
+	Headers  map[string]string `yaml:"headers"`
+	// ResourceAttributes are added to the attributes derived from the host.
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	Gzip               bool              `yaml:"gzip"`
+}
+
+type WebhookConfig struct {
+	// URLs each receive every snapshot.
+	URLs    []string          `yaml:"urls"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	// Template is a Go text/template rendered with the snapshot as body.
+	// When empty the snapshot is sent in the sink's encoder format.
+	Template    string `yaml:"template"`
+	ContentType string `yaml:"content_type"`
+	BearerToken string `yaml:"bearer_token"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	// HMACSecret enables an HMAC-SHA256 signature of the body in HMACHeader.
+	HMACSecret string `yaml:"hmac_secret"`
+	HMACHeader string `yaml:"hmac_header"`
+}
+
+type FileConfig struct {
+	// Path is the active file; rotated files are kept next to it.
+	Path string `yaml:"path"`
+	// Format is jsonl or csv.
+	Format                string `yaml:"format"`
+	MaxSizeMB             int    `yaml:"max_size_mb"`
+	RotateIntervalMinutes int    `yaml:"rotate_interval_minutes"`
+	Compress              bool   `yaml:"compress"`
+	// MaxTotalMB caps the active and all rotated files together; the oldest
+	// rotated files are deleted first.
+	MaxTotalMB int `yaml:"max_total_mb"`
+}
+
+type StatsDConfig struct {
+	// Address is the host:port of the StatsD daemon.
+	Address string `yaml:"address"`
+	// Prefix is put in front of every metric path; {hostname} is replaced
+	// by the host name.
+	Prefix string `yaml:"prefix"`
+	// MaxPacketSize bounds the size of a datagram holding several metrics.
+	MaxPacketSize int `yaml:"max_packet_size"`
+}
+
+type NATSConfig struct {
+	// URL is one server URL or a comma separated list.
+	URL string `yaml:"url"`
+	// Subject may contain {hostname}.
+	Subject         string `yaml:"subject"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	Token           string `yaml:"token"`
+	CredentialsFile string `yaml:"credentials_file"`
+	// JetStream waits for the stream's acknowledgement of every publish.
+	JetStream bool   `yaml:"jetstream"`
+	Stream    string `yaml:"stream"`
+}
+
+type GraphiteConfig struct {
+	// Address is the host:port of the Carbon plaintext receiver.
+	Address string `yaml:"address"`
+	// Prefix is put in front of every metric path; {hostname} is replaced
+	// by the host name.
+	Prefix string `yaml:"prefix"`
+}
+
+type SyslogConfig struct {
+	// Network is udp, tcp or unix.
+	Network string `yaml:"network"`
+	// Address is host:port for udp and tcp and a socket path for unix.
+	Address string `yaml:"address"`
+	// Facility is a name such as daemon or local0.
+	Facility string `yaml:"facility"`
+	AppName  string `yaml:"app_name"`
+}
+
+type ReportByExceptionConfig struct {
+	Enabled          bool    `yaml:"enabled"`
+	AbsoluteDeadband float64 `yaml:"absolute_deadband"`
+	PercentDeadband  float64 `yaml:"percent_deadband"`
+	HeartbeatMinutes int     `yaml:"heartbeat_minutes"`
 }
 
 type IntegrationConfig struct {
-	Modbus ModbusConfig `yaml:"modbus"`
-	OPCUA  OPCUAConfig  `yaml:"opcua"`
+	Modbus       ModbusConfig       `yaml:"modbus"`
+	ModbusServer ModbusServerConfig `yaml:"modbus_server"`
+	OPCUA        OPCUAConfig        `yaml:"opcua"`
+	SNMP         SNMPConfig         `yaml:"snmp"`
+	SNMPAgent    SNMPAgentConfig    `yaml:"snmp_agent"`
+	GPS          GPSConfig          `yaml:"gps"`
+	OneWire      OneWireConfig      `yaml:"onewire"`
+	IIO          IIOConfig          `yaml:"iio"`
 }
 
 type ModbusConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Mode is tcp or rtu. Host and Port address a TCP device, the serial
+	// settings an RTU device.
+	Mode string `yaml:"mode"`
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	SerialPort string `yaml:"serial_port"`
+	BaudRate   int    `yaml:"baud_rate"`
+	// DataBits must be 8, RTU frames carry binary bytes.
+	DataBits int `yaml:"data_bits"`
+	// Parity is none, even or odd.
+	Parity   string `yaml:"parity"`
+	StopBits int    `yaml:"stop_bits"`
+
+	UnitID    int              `yaml:"unit_id"`
+	TimeoutMS int              `yaml:"timeout_ms"`
+	Registers []ModbusRegister `yaml:"registers"`
+	Notes     string           `yaml:"notes"`
+}
+
+// ModbusRegister is one value of the register map polled on every collection.
+type ModbusRegister struct {
+	Name string `yaml:"name"`
+	// FunctionCode is 1 (coils), 2 (discrete inputs), 3 (holding registers,
+	// the default) or 4 (input registers).
+	FunctionCode byte   `yaml:"function_code"`
+	Address      uint16 `yaml:"address"`
+	// DataType is bool, int16, uint16, int32, uint32, int64, uint64,
+	// float32 or float64.
+	DataType string `yaml:"data_type"`
+	// Scale multiplies the decoded value; 0 means 1.
+	Scale float64 `yaml:"scale"`
+	// ByteOrder and WordOrder are big (default) or little.
+	ByteOrder string `yaml:"byte_order"`
+	WordOrder string `yaml:"word_order"`
+	Unit      string `yaml:"unit"`
+}
+
+// ModbusServerConfig serves snapshot metrics to Modbus TCP clients such as
+// PLCs.
+type ModbusServerConfig struct {
 	Enabled bool   `yaml:"enabled"`
-	Mode    string `yaml:"mode"`
-	Host    string `yaml:"host"`
-	Port    int    `yaml:"port"`
-	UnitID  int    `yaml:"unit_id"`
-	Notes   string `yaml:"notes"`
+	Address string `yaml:"address"`
+	// UnitID restricts the server to one unit id; 0 answers every unit.
+	UnitID    int                    `yaml:"unit_id"`
+	Registers []ModbusServerRegister `yaml:"registers"`
+}
+
+// ModbusServerRegister maps one metric to holding or input registers.
+type ModbusServerRegister struct {
+	// Metric is cpu_percent, memory_percent, disk_percent, temperature or
+	// uptime_seconds. Key is the mountpoint of disk_percent (default "/")
+	// and the sensor key of temperature.
+	Metric string `yaml:"metric"`
+	Key    string `yaml:"key"`
+	// FunctionCode is 3 (holding registers, the default) or 4 (input
+	// registers).
+	FunctionCode byte   `yaml:"function_code"`
+	Address      uint16 `yaml:"address"`
+	// DataType and the orders are those of ModbusRegister. The value is
+	// divided by Scale, so scale 0.1 serves 42.5 as 425.
+	DataType  string  `yaml:"data_type"`
+	Scale     float64 `yaml:"scale"`
+	ByteOrder string  `yaml:"byte_order"`
+	WordOrder string  `yaml:"word_order"`
 }
 
 type OPCUAConfig struct {
-	Enabled        bool   `yaml:"enabled"`
-	Endpoint       string `yaml:"endpoint"`
+	Enabled  bool   `yaml:"enabled"`
+	Endpoint string `yaml:"endpoint"`
+	// SecurityPolicy is None, Basic128Rsa15, Basic256, Basic256Sha256,
+	// Aes128_Sha256_RsaOaep or Aes256_Sha256_RsaPss. SecurityMode is None,
+	// Sign or SignAndEncrypt; only policy None goes with mode None.
 	SecurityPolicy string `yaml:"security_policy"`
 	SecurityMode   string `yaml:"security_mode"`
-	Username       string `yaml:"username"`
-	Password       string `yaml:"password"`
-	Notes          string `yaml:"notes"`
+	// CertificateFile and PrivateKeyFile hold the PEM or DER client
+	// certificate and key. Without them a self-signed certificate is
+	// generated when the security mode needs one.
+	CertificateFile string `yaml:"certificate_file"`
+	PrivateKeyFile  string `yaml:"private_key_file"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	// Nodes are read on every collection, or monitored when Subscribe is
+	// set, in which case the server publishes changes every
+	// PublishingIntervalMS and a collection takes the latest values.
+	Nodes                []OPCUANode `yaml:"nodes"`
+	Subscribe            bool        `yaml:"subscribe"`
+	PublishingIntervalMS int         `yaml:"publishing_interval_ms"`
+	TimeoutMS            int         `yaml:"timeout_ms"`
+	Notes                string      `yaml:"notes"`
+	// Server serves the snapshot to OPC UA clients such as MES tools, with
+	// the security policy, mode and certificate above.
+	Server OPCUAServerConfig `yaml:"server"`
+}
+
+// OPCUAServerConfig is the embedded OPC UA server. Address is host:port;
+// without a host it listens on every IPv4 interface.
+type OPCUAServerConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+}
+
+// SNMPConfig polls neighbouring SNMP devices, such as switches and UPS
+// units, on every collection. Targets are polled concurrently.
+type SNMPConfig struct {
+	Enabled   bool `yaml:"enabled"`
+	TimeoutMS int  `yaml:"timeout_ms"`
+	// Retries is how often an unanswered request is sent again.
+	Retries int          `yaml:"retries"`
+	Targets []SNMPTarget `yaml:"targets"`
+	Notes   string       `yaml:"notes"`
+}
+
+// SNMPTarget is one device. Version is 2c, which uses Community, or 3,
+// which uses User.
+type SNMPTarget struct {
+	Name      string       `yaml:"name"`
+	Host      string       `yaml:"host"`
+	Port      int          `yaml:"port"`
+	Version   string       `yaml:"version"`
+	Community string       `yaml:"community"`
+	User      SNMPUser     `yaml:"user"`
+	Objects   []SNMPObject `yaml:"objects"`
+}
+
+// SNMPObject is one value read from a target. With Walk set, every instance
+// below OID is read and named Name.<index>, such as if_in_octets.3.
+type SNMPObject struct {
+	Name string `yaml:"name"`
+	OID  string `yaml:"oid"`
+	Walk bool   `yaml:"walk"`
+	// Scale multiplies numeric values; 0 means 1.
+	Scale float64 `yaml:"scale"`
+	Unit  string  `yaml:"unit"`
+}
+
+// SNMPAgentConfig serves snapshot metrics to SNMP managers. The default
+// port 1161 needs no privileges; use :161 for managers that cannot change it.
+type SNMPAgentConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+	// Community grants SNMPv2c read access; leave it empty to allow only
+	// the SNMPv3 users.
+	Community string     `yaml:"community"`
+	Users     []SNMPUser `yaml:"users"`
+	// EngineID is the hex snmpEngineID; it is derived from the host name
+	// when empty.
+	EngineID string `yaml:"engine_id"`
+	// BootsFile counts the starts of the agent for SNMPv3.
+	BootsFile string `yaml:"boots_file"`
+	Contact   string `yaml:"contact"`
+	Location  string `yaml:"location"`
+}
+
+// SNMPUser is an SNMPv3 user. AuthProtocol is MD5, SHA, SHA224, SHA256,
+// SHA384 or SHA512; PrivProtocol is empty (no encryption), DES, AES,
+// AES192, AES256, AES192C or AES256C. Passwords need 8 characters.
+type SNMPUser struct {
+	Name         string `yaml:"name"`
+	AuthProtocol string `yaml:"auth_protocol"`
+	AuthPassword string `yaml:"auth_password"`
+	PrivProtocol string `yaml:"priv_protocol"`
+	PrivPassword string `yaml:"priv_password"`
+}
+
+// GPSConfig reads the position of an NMEA 0183 receiver from SerialPort, or
+// from File, such as a recorded log, a pipe or a device set up elsewhere.
+type GPSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	SerialPort string `yaml:"serial_port"`
+	BaudRate   int    `yaml:"baud_rate"`
+	File       string `yaml:"file"`
+	// MaxAgeSeconds is how long the last position counts as a fix when the
+	// receiver stops sending.
+	MaxAgeSeconds int `yaml:"max_age_seconds"`
+}
+
+// OneWireConfig reads 1-Wire thermometers, such as DS18B20 probes, from the
+// w1 bus driver in sysfs. Without sensors every thermometer on the bus is
+// reported under its device id.
+type OneWireConfig struct {
+	Enabled   bool            `yaml:"enabled"`
+	SysfsRoot string          `yaml:"sysfs_root"`
+	Sensors   []OneWireSensor `yaml:"sensors"`
+}
+
+// OneWireSensor names a thermometer by its device id, such as
+// 28-0316a2794aff.
+type OneWireSensor struct {
+	Name string `yaml:"name"`
+	ID   string `yaml:"id"`
+}
+
+// IIOConfig reads Industrial I/O devices, such as I2C environmental sensors
+// and ADCs, from sysfs. Without sensors every input channel of every device
+// is reported.
+type IIOConfig struct {
+	Enabled   bool        `yaml:"enabled"`
+	SysfsRoot string      `yaml:"sysfs_root"`
+	Sensors   []IIOSensor `yaml:"sensors"`
+}
+
+// IIOSensor names one channel. Device is the device name, such as bme280,
+// or its directory, such as iio:device0; Channel is the attribute name
+// between in_ and _raw or _input, such as temp or humidityrelative.
+type IIOSensor struct {
+	Name    string `yaml:"name"`
+	Device  string `yaml:"device"`
+	Channel string `yaml:"channel"`
+}
+
+// OPCUANode names one node, such as ns=2;s=Line1.Speed, in the snapshot.
+type OPCUANode struct {
+	Name   string `yaml:"name"`
+	NodeID string `yaml:"node_id"`
 }
 
 func Default() Config {
@@ -76,22 +495,65 @@ func Default() Config {
 			Path:    DefaultRestPath,
 		},
 		MQTT: MQTTConfig{
-			Enabled: false,
-			QoS:     DefaultMQTTQoS,
+			Enabled:         false,
+			QoS:             DefaultMQTTQoS,
+			BrokerMode:      DefaultMQTTBrokerMode,
+			ProtocolVersion: DefaultMQTTProtocol,
+			ContentType:     DefaultMQTTContentType,
+			PayloadFormat:   DefaultMQTTPayload,
+			Sparkplug: SparkplugConfig{
+				GroupID: DefaultSparkplugGroupID,
+			},
+			HomeAssistant: HomeAssistantConfig{
+				DiscoveryPrefix: DefaultHADiscoveryPrefix,
+			},
+		},
+		ReportByException: ReportByExceptionConfig{
+			HeartbeatMinutes: DefaultHeartbeatMinutes,
 		},
 		Integrations: IntegrationConfig{
 			Modbus: ModbusConfig{
-				Enabled: false,
-				Mode:    DefaultModbusMode,
-				Host:    "localhost",
-				Port:    DefaultModbusPort,
-				UnitID:  DefaultModbusUnitID,
+				Enabled:   false,
+				Mode:      DefaultModbusMode,
+				Host:      "localhost",
+				Port:      DefaultModbusPort,
+				BaudRate:  DefaultModbusBaudRate,
+				DataBits:  DefaultModbusDataBits,
+				Parity:    DefaultModbusParity,
+				StopBits:  DefaultModbusStopBits,
+				UnitID:    DefaultModbusUnitID,
+				TimeoutMS: DefaultModbusTimeoutMS,
+			},
+			ModbusServer: ModbusServerConfig{
+				Address: DefaultModbusServerAddr,
 			},
 			OPCUA: OPCUAConfig{
 				Enabled:        false,
 				Endpoint:       DefaultOpcuaEndpoint,
 				SecurityPolicy: DefaultOpcuaPolicy,
 				SecurityMode:   DefaultOpcuaMode,
+
+				PublishingIntervalMS: DefaultOpcuaPublishingMS,
+				TimeoutMS:            DefaultOpcuaTimeoutMS,
+				Server:               OPCUAServerConfig{Address: DefaultOpcuaServerAddr},
+			},
+			SNMP: SNMPConfig{
+				TimeoutMS: DefaultSNMPTimeoutMS,
+				Retries:   DefaultSNMPRetries,
+			},
+			SNMPAgent: SNMPAgentConfig{
+				Address:   DefaultSNMPAgentAddr,
+				BootsFile: DefaultSNMPBootsFile,
+			},
+			GPS: GPSConfig{
+				BaudRate:      DefaultGPSBaudRate,
+				MaxAgeSeconds: DefaultGPSMaxAgeSeconds,
+			},
+			OneWire: OneWireConfig{
+				SysfsRoot: DefaultSysfsRoot,
+			},
+			IIO: IIOConfig{
+				SysfsRoot: DefaultSysfsRoot,
 			},
 		},
 	}
@@ -120,6 +582,127 @@ func Load(path string) (Config, error) {
 		cfg.Rest.Path = DefaultRestPath
 	}
 
+	if cfg.MQTT.Broker != "" && len(cfg.MQTT.Brokers) > 0 {
+		return Config{}, fmt.Errorf("set either mqtt.broker or mqtt.brokers, not both")
+	}
+	seen := make(map[string]bool, len(cfg.MQTT.Brokers))
+	for _, broker := range cfg.MQTT.Brokers {
+		if broker == "" {
+			return Config{}, fmt.Errorf("mqtt.brokers must not contain empty entries")
+		}
+		if seen[broker] {
+			return Config{}, fmt.Errorf("mqtt.brokers contains %q twice", broker)
+		}
+		seen[broker] = true
+	}
+	if cfg.MQTT.BrokerMode == "" {
+		cfg.MQTT.BrokerMode = DefaultMQTTBrokerMode
+	}
+	if cfg.MQTT.BrokerMode != "failover" && cfg.MQTT.BrokerMode != "fanout" {
+		return Config{}, fmt.Errorf("mqtt.broker_mode must be failover or fanout: %q", cfg.MQTT.BrokerMode)
+	}
+
+	if cfg.MQTT.ProtocolVersion == "" {
+		cfg.MQTT.ProtocolVersion = DefaultMQTTProtocol
+	}
+	if cfg.MQTT.ProtocolVersion != "3.1.1" && cfg.MQTT.ProtocolVersion != "5" {
+		return Config{}, fmt.Errorf("mqtt.protocol_version must be 3.1.1 or 5: %q", cfg.MQTT.ProtocolVersion)
+	}
+	if cfg.MQTT.ContentType == "" {
+		cfg.MQTT.ContentType = DefaultMQTTContentType
+	}
+	if cfg.MQTT.PayloadFormat == "" {
+		cfg.MQTT.PayloadFormat = DefaultMQTTPayload
+	}
+	switch cfg.MQTT.PayloadFormat {
+	case "json":
+	case "sparkplug_b":
+		if cfg.MQTT.ProtocolVersion != "3.1.1" {
+			return Config{}, fmt.Errorf("mqtt.payload_format sparkplug_b requires protocol_version 3.1.1")
+		}
+		// A standby broker would see the node born but never receive data.
+		if len(cfg.MQTT.Brokers) > 1 && cfg.MQTT.BrokerMode == "failover" {
+			return Config{}, fmt.Errorf("mqtt.payload_format sparkplug_b requires broker_mode fanout with several brokers")
+		}
+		if cfg.MQTT.Sparkplug.GroupID == "" {
+			cfg.MQTT.Sparkplug.GroupID = DefaultSparkplugGroupID
+		}
+		if strings.ContainsAny(cfg.MQTT.Sparkplug.GroupID+cfg.MQTT.Sparkplug.EdgeNodeID, "/+#") {
+			return Config{}, fmt.Errorf("mqtt.sparkplug ids must not contain '/', '+' or '#'")
+		}
+	default:
+		enc, err := encoding.Lookup(cfg.MQTT.PayloadFormat)
+		if err != nil {
+			return Config{}, fmt.Errorf("mqtt.payload_format must be sparkplug_b or one of %v: %q", encoding.Names(), cfg.MQTT.PayloadFormat)
+		}
+		// The default content type describes JSON.
+		if cfg.MQTT.ContentType == DefaultMQTTContentType {
+			cfg.MQTT.ContentType = enc.ContentType()
+		}
+	}
+	if cfg.MQTT.HomeAssistant.Enabled && cfg.MQTT.PayloadFormat != "json" {
+		return Config{}, fmt.Errorf("mqtt.home_assistant requires payload_format json")
+	}
+	if cfg.MQTT.HomeAssistant.DiscoveryPrefix == "" {
+		cfg.MQTT.HomeAssistant.DiscoveryPrefix = DefaultHADiscoveryPrefix
+	}
+
+	names := make(map[string]bool, len(cfg.Sinks))
+	for i := range cfg.Sinks {
+		sink := &cfg.Sinks[i]
+		if sink.Name == "" {
+			return Config{}, fmt.Errorf("sinks[%d].name is required", i)
+		}
+		if sink.Name == "mqtt" || names[sink.Name] {
+			return Config{}, fmt.Errorf("sinks[%d].name %q is already in use", i, sink.Name)
+		}
+		names[sink.Name] = true
+		if sink.Type == "" {
+			return Config{}, fmt.Errorf("sinks[%d].type is required", i)
+		}
+		if sink.Encoder != "" && slices.Contains(protocolSinks, sink.Type) {
+			return Config{}, fmt.Errorf("sinks[%d].encoder is not used by %s sinks", i, sink.Type)
+		}
+		if sink.Encoder == "" {
+			sink.Encoder = DefaultSinkEncoder
+		}
+		if _, err := encoding.Lookup(sink.Encoder); err != nil {
+			return Config{}, fmt.Errorf("sinks[%d].encoder: %w", i, err)
+		}
+		if sink.TimeoutSeconds == 0 {
+			sink.TimeoutSeconds = DefaultSinkTimeout
+		}
+		if sink.Retry.MaxAttempts == 0 {
+			sink.Retry.MaxAttempts = DefaultSinkAttempts
+		}
+		if sink.Retry.InitialBackoffMS == 0 {
+			sink.Retry.InitialBackoffMS = DefaultSinkBackoffMS
+		}
+		if sink.Retry.MaxBackoffMS == 0 {
+			sink.Retry.MaxBackoffMS = DefaultSinkMaxBackoffMS
+		}
+		if sink.QueueSize == 0 {
+			sink.QueueSize = DefaultSinkQueueSize
+		}
+		if sink.TimeoutSeconds < 0 || sink.Retry.MaxAttempts < 0 || sink.Retry.InitialBackoffMS < 0 || sink.Retry.MaxBackoffMS < 0 || sink.QueueSize < 0 {
+			return Config{}, fmt.Errorf("sinks[%d] timeout, retry and queue settings must not be negative", i)
+		}
+	}
+
+	if rbe := cfg.ReportByException; rbe.Enabled {
+		if rbe.AbsoluteDeadband < 0 || rbe.PercentDeadband < 0 {
+			return Config{}, fmt.Errorf("report_by_exception deadbands must not be negative")
+		}
+		if rbe.HeartbeatMinutes < 1 {
+			return Config{}, fmt.Errorf("report_by_exception.heartbeat_minutes must be at least 1: %d", rbe.HeartbeatMinutes)
+		}
+		// Sparkplug already reports by exception and Home Assistant needs full
+		// snapshots to derive entity states.
+		if cfg.MQTT.PayloadFormat != "json" || cfg.MQTT.HomeAssistant.Enabled {
+			return Config{}, fmt.Errorf("report_by_exception requires mqtt.payload_format json without home_assistant")
+		}
+	}
+
 	if cfg.Integrations.Modbus.Mode == "" {
 		cfg.Integrations.Modbus.Mode = DefaultModbusMode
 	}
@@ -132,6 +715,30 @@ func Load(path string) (Config, error) {
 	if cfg.Integrations.Modbus.UnitID == 0 {
 		cfg.Integrations.Modbus.UnitID = DefaultModbusUnitID
 	}
+	if cfg.Integrations.Modbus.TimeoutMS <= 0 {
+		cfg.Integrations.Modbus.TimeoutMS = DefaultModbusTimeoutMS
+	}
+	if cfg.Integrations.Modbus.BaudRate == 0 {
+		cfg.Integrations.Modbus.BaudRate = DefaultModbusBaudRate
+	}
+	if cfg.Integrations.Modbus.DataBits == 0 {
+		cfg.Integrations.Modbus.DataBits = DefaultModbusDataBits
+	}
+	if cfg.Integrations.Modbus.Parity == "" {
+		cfg.Integrations.Modbus.Parity = DefaultModbusParity
+	}
+	if cfg.Integrations.Modbus.StopBits == 0 {
+		cfg.Integrations.Modbus.StopBits = DefaultModbusStopBits
+	}
+	if err := validateModbus(&cfg.Integrations.Modbus); err != nil {
+		return Config{}, err
+	}
+	if cfg.Integrations.ModbusServer.Address == "" {
+		cfg.Integrations.ModbusServer.Address = DefaultModbusServerAddr
+	}
+	if id := cfg.Integrations.ModbusServer.UnitID; id < 0 || id > 255 {
+		return Config{}, fmt.Errorf("integrations.modbus_server.unit_id out of range: %d", id)
+	}
 	if cfg.Integrations.OPCUA.Endpoint == "" {
 		cfg.Integrations.OPCUA.Endpoint = DefaultOpcuaEndpoint
 	}
@@ -141,6 +748,193 @@ func Load(path string) (Config, error) {
 	if cfg.Integrations.OPCUA.SecurityMode == "" {
 		cfg.Integrations.OPCUA.SecurityMode = DefaultOpcuaMode
 	}
+	if cfg.Integrations.OPCUA.PublishingIntervalMS <= 0 {
+		cfg.Integrations.OPCUA.PublishingIntervalMS = DefaultOpcuaPublishingMS
+	}
+	if cfg.Integrations.OPCUA.TimeoutMS <= 0 {
+		cfg.Integrations.OPCUA.TimeoutMS = DefaultOpcuaTimeoutMS
+	}
+	if cfg.Integrations.OPCUA.Server.Address == "" {
+		cfg.Integrations.OPCUA.Server.Address = DefaultOpcuaServerAddr
+	}
+	if err := validateOPCUA(&cfg.Integrations.OPCUA); err != nil {
+		return Config{}, err
+	}
+	if cfg.Integrations.SNMP.TimeoutMS <= 0 {
+		cfg.Integrations.SNMP.TimeoutMS = DefaultSNMPTimeoutMS
+	}
+	if err := validateSNMP(&cfg.Integrations.SNMP); err != nil {
+		return Config{}, err
+	}
+	if cfg.Integrations.SNMPAgent.Address == "" {
+		cfg.Integrations.SNMPAgent.Address = DefaultSNMPAgentAddr
+	}
+	if cfg.Integrations.SNMPAgent.BootsFile == "" {
+		cfg.Integrations.SNMPAgent.BootsFile = DefaultSNMPBootsFile
+	}
+	if a := cfg.Integrations.SNMPAgent; a.Enabled && a.Community == "" && len(a.Users) == 0 {
+		return Config{}, fmt.Errorf("integrations.snmp_agent needs a community or at least one user")
+	}
+	if cfg.Integrations.GPS.BaudRate <= 0 {
+		cfg.Integrations.GPS.BaudRate = DefaultGPSBaudRate
+	}
+	if cfg.Integrations.GPS.MaxAgeSeconds <= 0 {
+		cfg.Integrations.GPS.MaxAgeSeconds = DefaultGPSMaxAgeSeconds
+	}
+	if g := cfg.Integrations.GPS; g.Enabled && (g.SerialPort == "") == (g.File == "") {
+		return Config{}, fmt.Errorf("integrations.gps needs either serial_port or file")
+	}
+	if cfg.Integrations.OneWire.SysfsRoot == "" {
+		cfg.Integrations.OneWire.SysfsRoot = DefaultSysfsRoot
+	}
+	for i, s := range cfg.Integrations.OneWire.Sensors {
+		if s.Name == "" || s.ID == "" {
+			return Config{}, fmt.Errorf("integrations.onewire.sensors[%d] needs a name and an id", i)
+		}
+	}
+	if cfg.Integrations.IIO.SysfsRoot == "" {
+		cfg.Integrations.IIO.SysfsRoot = DefaultSysfsRoot
+	}
+	for i, s := range cfg.Integrations.IIO.Sensors {
+		if s.Name == "" || s.Device == "" || s.Channel == "" {
+			return Config{}, fmt.Errorf("integrations.iio.sensors[%d] needs a name, a device and a channel", i)
+		}
+	}
 
 	return cfg, nil
 }
+
+// validateModbus normalizes the mode and parity and, when the poller is
+// enabled, checks the settings of the selected mode.
+func validateModbus(m *ModbusConfig) error {
+	m.Mode = strings.ToLower(m.Mode)
+	m.Parity = strings.ToLower(m.Parity)
+	if !m.Enabled {
+		return nil
+	}
+	switch m.Mode {
+	case "tcp":
+		if m.Port < 1 || m.Port > 65535 {
+			return fmt.Errorf("integrations.modbus.port out of range: %d", m.Port)
+		}
+	case "rtu":
+		if m.SerialPort == "" {
+			return fmt.Errorf("integrations.modbus.serial_port is required in rtu mode")
+		}
+		if m.BaudRate < 0 {
+			return fmt.Errorf("integrations.modbus.baud_rate must be positive: %d", m.BaudRate)
+		}
+		if m.DataBits != 8 {
+			return fmt.Errorf("integrations.modbus.data_bits must be 8 in rtu mode: %d", m.DataBits)
+		}
+		if m.Parity != "none" && m.Parity != "even" && m.Parity != "odd" {
+			return fmt.Errorf("integrations.modbus.parity must be none, even or odd: %q", m.Parity)
+		}
+		if m.StopBits != 1 && m.StopBits != 2 {
+			return fmt.Errorf("integrations.modbus.stop_bits must be 1 or 2: %d", m.StopBits)
+		}
+		// Unit 0 is the broadcast address, which devices never answer.
+		if m.UnitID < 1 || m.UnitID > 247 {
+			return fmt.Errorf("integrations.modbus.unit_id must be 1 to 247 in rtu mode: %d", m.UnitID)
+		}
+	default:
+		return fmt.Errorf("integrations.modbus.mode must be tcp or rtu: %q", m.Mode)
+	}
+	return nil
+}
+
+// validateSNMP normalizes the versions and ports of the targets and checks
+// that each one can be addressed; credentials and OIDs are checked by the
+// poller.
+func validateSNMP(s *SNMPConfig) error {
+	if s.Retries < 0 {
+		return fmt.Errorf("integrations.snmp.retries must not be negative: %d", s.Retries)
+	}
+	if s.Enabled && len(s.Targets) == 0 {
+		return fmt.Errorf("integrations.snmp needs at least one target")
+	}
+	names := make(map[string]bool, len(s.Targets))
+	for i := range s.Targets {
+		t := &s.Targets[i]
+		t.Version = strings.TrimPrefix(strings.ToLower(t.Version), "v")
+		if t.Version == "" {
+			t.Version = "2c"
+		}
+		if t.Port == 0 {
+			t.Port = DefaultSNMPPort
+		}
+		if t.Name == "" || t.Host == "" {
+			return fmt.Errorf("integrations.snmp.targets[%d] needs a name and a host", i)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("integrations.snmp.targets: %s is defined twice", t.Name)
+		}
+		names[t.Name] = true
+		if t.Port < 1 || t.Port > 65535 {
+			return fmt.Errorf("integrations.snmp.targets: %s port out of range: %d", t.Name, t.Port)
+		}
+		if t.Version != "2c" && t.Version != "3" {
+			return fmt.Errorf("integrations.snmp.targets: %s version must be 2c or 3: %q", t.Name, t.Version)
+		}
+		if len(t.Objects) == 0 {
+			return fmt.Errorf("integrations.snmp.targets: %s has no objects", t.Name)
+		}
+	}
+	return nil
+}
+
+// protocolSinks send the snapshot in a wire format of their own, such as
+// line protocol, and have no use for an encoder.
+var protocolSinks = []string{"influxdb", "graphite", "statsd", "remote_write", "otlp", "syslog"}
+
+var (
+	opcuaPolicies = []string{"None", "Basic128Rsa15", "Basic256", "Basic256Sha256", "Aes128_Sha256_RsaOaep", "Aes256_Sha256_RsaPss"}
+	opcuaModes    = []string{"None", "Sign", "SignAndEncrypt"}
+)
+
+// canonical returns the entry of names that equals s ignoring case, or s
+// when there is none.
+func canonical(names []string, s string) string {
+	i := slices.IndexFunc(names, func(name string) bool { return strings.EqualFold(name, s) })
+	if i < 0 {
+		return s
+	}
+	return names[i]
+}
+
+// validateOPCUA normalizes the spelling of the security settings and checks
+// them when the client or the server is enabled, and the node list when the
+// client is.
+func validateOPCUA(o *OPCUAConfig) error {
+	o.SecurityPolicy = canonical(opcuaPolicies, o.SecurityPolicy)
+	o.SecurityMode = canonical(opcuaModes, o.SecurityMode)
+	if !o.Enabled && !o.Server.Enabled {
+		return nil
+	}
+	if !slices.Contains(opcuaPolicies, o.SecurityPolicy) {
+		return fmt.Errorf("integrations.opcua.security_policy must be one of %s: %q", strings.Join(opcuaPolicies, ", "), o.SecurityPolicy)
+	}
+	if !slices.Contains(opcuaModes, o.SecurityMode) {
+		return fmt.Errorf("integrations.opcua.security_mode must be None, Sign or SignAndEncrypt: %q", o.SecurityMode)
+	}
+	if (o.SecurityPolicy == "None") != (o.SecurityMode == "None") {
+		return fmt.Errorf("integrations.opcua.security_policy %s does not match security_mode %s", o.SecurityPolicy, o.SecurityMode)
+	}
+	if (o.CertificateFile == "") != (o.PrivateKeyFile == "") {
+		return fmt.Errorf("integrations.opcua.certificate_file and private_key_file must be set together")
+	}
+	if !o.Enabled {
+		return nil
+	}
+	names := make(map[string]bool, len(o.Nodes))
+	for i, n := range o.Nodes {
+		if n.Name == "" || n.NodeID == "" {
+			return fmt.Errorf("integrations.opcua.nodes[%d] needs a name and a node_id", i)
+		}
+		if names[n.Name] {
+			return fmt.Errorf("integrations.opcua.nodes: %s is defined twice", n.Name)
+		}
+		names[n.Name] = true
+	}
+	return nil
+}
@@ -54,7 +54,7 @@ func TestLoadDefaults(t *testing.T) {
 }
 
 func TestLoadOverrides(t *testing.T) {
-	path := writeTempConfig(t, "frequency_seconds: 10\nrest:\n  address: ':9090'\n  path: '/metrics'\nmqtt:\n  enabled: true\n  broker: 'tcp://localhost:1883'\n  client_id: 'edgebeat-test'\n  topic: 'edgebeat/metrics'\n  qos: 2\nintegrations:\n  modbus:\n    enabled: true\n    mode: 'rtu'\n    host: '127.0.0.1'\n    port: 1502\n    unit_id: 2\n  opcua:\n    enabled: true\n    endpoint: 'opc.tcp://example:4840'\n    security_policy: 'Basic256'\n    security_mode: 'Sign'\n    username: 'user'\n    password: 'pass'\n")
+	path := writeTempConfig(t, "frequency_seconds: 10\nrest:\n  address: ':9090'\n  path: '/metrics'\nmqtt:\n  enabled: true\n  broker: 'tcp://localhost:1883'\n  client_id: 'edgebeat-test'\n  topic: 'edgebeat/metrics'\n  qos: 2\nintegrations:\n  modbus:\n    enabled: true\n    mode: 'rtu'\n    host: '127.0.0.1'\n    port: 1502\n    serial_port: '/dev/ttyUSB0'\n    baud_rate: 9600\n    parity: 'none'\n    unit_id: 2\n  opcua:\n    enabled: true\n    endpoint: 'opc.tcp://example:4840'\n    security_policy: 'Basic256'\n    security_mode: 'Sign'\n    username: 'user'\n    password: 'pass'\n")
 
 	cfg, err := Load(path)
 	if err != nil {
@@ -70,8 +70,8 @@ func TestLoadOverrides(t *testing.T) {
 	if !cfg.MQTT.Enabled || cfg.MQTT.QoS != 2 {
 		t.Fatalf("MQTT = %+v, want enabled and qos 2", cfg.MQTT)
 	}
-	if cfg.Integrations.Modbus.Mode != "rtu" || cfg.Integrations.Modbus.Port != 1502 {
-		t.Fatalf("Modbus = %+v", cfg.Integrations.Modbus)
+	if m := cfg.Integrations.Modbus; m.Mode != "rtu" || m.SerialPort != "/dev/ttyUSB0" || m.BaudRate != 9600 || m.Parity != "none" || m.DataBits != 8 || m.StopBits != 1 {
+		t.Fatalf("Modbus = %+v", m)
 	}
 	if cfg.Integrations.OPCUA.Endpoint != "opc.tcp://example:4840" {
 		t.Fatalf("OPCUA.Endpoint = %q", cfg.Integrations.OPCUA.Endpoint)
@@ -81,6 +81,183 @@ func TestLoadOverrides(t *testing.T) {
 	}
 }
 
+func TestLoadModbusRTU(t *testing.T) {
+	cases := map[string]string{
+		"missing serial port": "mode: rtu",
+		"unknown mode":        "mode: ascii\n    serial_port: /dev/ttyS0",
+		"seven data bits":     "mode: rtu\n    serial_port: /dev/ttyS0\n    data_bits: 7",
+		"unknown parity":      "mode: rtu\n    serial_port: /dev/ttyS0\n    parity: mark",
+		"stop bits":           "mode: rtu\n    serial_port: /dev/ttyS0\n    stop_bits: 3",
+		"broadcast unit":      "mode: rtu\n    serial_port: /dev/ttyS0\n    unit_id: 248",
+	}
+	for name, modbus := range cases {
+		path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  modbus:\n    enabled: true\n    "+modbus+"\n")
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  modbus:\n    enabled: true\n    mode: RTU\n    serial_port: /dev/ttyS0\n    parity: Odd\n    stop_bits: 2\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if m := cfg.Integrations.Modbus; m.Mode != "rtu" || m.Parity != "odd" || m.BaudRate != DefaultModbusBaudRate || m.StopBits != 2 {
+		t.Fatalf("Modbus = %+v", m)
+	}
+
+	// Settings of a disabled poller are not checked.
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  modbus:\n    mode: rtu\n    data_bits: 7\n")
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load disabled: %v", err)
+	}
+}
+
+func TestLoadOPCUANodes(t *testing.T) {
+	cases := map[string]string{
+		"unknown policy":      "security_policy: Basic512",
+		"unknown mode":        "security_policy: Basic256Sha256\n    security_mode: Encrypt",
+		"policy without mode": "security_policy: Basic256Sha256",
+		"key without cert":    "private_key_file: /etc/edgebeat/key.pem",
+		"node without id":     "nodes:\n      - name: speed",
+		"duplicate node":      "nodes:\n      - {name: speed, node_id: 'ns=2;i=1'}\n      - {name: speed, node_id: 'ns=2;i=2'}",
+	}
+	for name, opcua := range cases {
+		path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  opcua:\n    enabled: true\n    "+opcua+"\n")
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  opcua:\n    enabled: true\n    subscribe: true\n    nodes:\n      - name: line_speed\n        node_id: 'ns=2;s=Line1.Speed'\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	o := cfg.Integrations.OPCUA
+	if len(o.Nodes) != 1 || o.Nodes[0].NodeID != "ns=2;s=Line1.Speed" || !o.Subscribe {
+		t.Fatalf("OPCUA = %+v", o)
+	}
+	if o.PublishingIntervalMS != DefaultOpcuaPublishingMS || o.TimeoutMS != DefaultOpcuaTimeoutMS {
+		t.Fatalf("OPCUA intervals = %d, %d", o.PublishingIntervalMS, o.TimeoutMS)
+	}
+	if o.Server.Enabled || o.Server.Address != DefaultOpcuaServerAddr {
+		t.Fatalf("OPCUA.Server = %+v", o.Server)
+	}
+
+	// Security settings are matched ignoring case.
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  opcua:\n    enabled: true\n    security_policy: basic256sha256\n    security_mode: signandencrypt\n")
+	if cfg, err = Load(path); err != nil {
+		t.Fatalf("Load lower case: %v", err)
+	}
+	if o := cfg.Integrations.OPCUA; o.SecurityPolicy != "Basic256Sha256" || o.SecurityMode != "SignAndEncrypt" {
+		t.Fatalf("OPCUA security = %s, %s", o.SecurityPolicy, o.SecurityMode)
+	}
+
+	// Nothing is checked while neither the client nor the server is enabled.
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  opcua:\n    security_policy: Basic512\n    nodes:\n      - name: speed\n")
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load disabled: %v", err)
+	}
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  opcua:\n    security_policy: Basic512\n    server:\n      enabled: true\n")
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for an unknown policy with the server enabled")
+	}
+}
+
+func TestLoadSNMPAgent(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  snmp_agent:\n    enabled: true\n")
+	if _, err := Load(path); err == nil {
+		t.Error("agent without community or users: expected error")
+	}
+
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  snmp_agent:\n    enabled: true\n    users:\n      - {name: noc, auth_protocol: SHA256, auth_password: secret123}\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if a := cfg.Integrations.SNMPAgent; a.Address != DefaultSNMPAgentAddr || a.BootsFile != DefaultSNMPBootsFile || len(a.Users) != 1 || a.Users[0].AuthProtocol != "SHA256" {
+		t.Fatalf("SNMPAgent = %+v", a)
+	}
+}
+
+func TestLoadSNMP(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  snmp:\n    enabled: true\n")
+	if _, err := Load(path); err == nil {
+		t.Error("poller without targets: expected error")
+	}
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  snmp:\n    targets:\n      - {name: ups, host: 10.0.0.3, version: '1', objects: [{name: a, oid: 1.3.6.1.2.1.1.3.0}]}\n")
+	if _, err := Load(path); err == nil {
+		t.Error("version 1: expected error")
+	}
+
+	path = writeTempConfig(t, `frequency_seconds: 10
+integrations:
+  snmp:
+    enabled: true
+    targets:
+      - name: switch
+        host: 10.0.0.2
+        community: public
+        objects:
+          - {name: if_in_octets, oid: 1.3.6.1.2.1.2.2.1.10, walk: true}
+      - name: ups
+        host: 10.0.0.3
+        port: 1161
+        version: v3
+        user: {name: noc, auth_protocol: SHA, auth_password: secret123}
+        objects:
+          - {name: battery_charge, oid: 1.3.6.1.2.1.33.1.2.4.0, unit: "%"}
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	s := cfg.Integrations.SNMP
+	if s.TimeoutMS != DefaultSNMPTimeoutMS || s.Retries != DefaultSNMPRetries || len(s.Targets) != 2 {
+		t.Fatalf("SNMP = %+v", s)
+	}
+	if sw, ups := s.Targets[0], s.Targets[1]; sw.Version != "2c" || sw.Port != DefaultSNMPPort || !sw.Objects[0].Walk ||
+		ups.Version != "3" || ups.Port != 1161 || ups.User.Name != "noc" {
+		t.Fatalf("Targets = %+v", s.Targets)
+	}
+}
+
+func TestLoadGPS(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  gps:\n    enabled: true\n")
+	if _, err := Load(path); err == nil {
+		t.Error("gps without source: expected error")
+	}
+
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  gps:\n    enabled: true\n    serial_port: /dev/ttyACM0\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if g := cfg.Integrations.GPS; g.BaudRate != DefaultGPSBaudRate || g.MaxAgeSeconds != DefaultGPSMaxAgeSeconds || g.SerialPort != "/dev/ttyACM0" {
+		t.Fatalf("GPS = %+v", g)
+	}
+}
+
+func TestLoadSysfsSensors(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  iio:\n    enabled: true\n    sensors:\n      - name: enclosure\n        device: bme280\n")
+	if _, err := Load(path); err == nil {
+		t.Error("iio sensor without channel: expected error")
+	}
+
+	path = writeTempConfig(t, "frequency_seconds: 10\nintegrations:\n  onewire:\n    enabled: true\n    sensors:\n      - name: tank_inlet\n        id: 28-0316a2794aff\n  iio:\n    sysfs_root: /host/sys\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if w := cfg.Integrations.OneWire; w.SysfsRoot != DefaultSysfsRoot || len(w.Sensors) != 1 || w.Sensors[0].ID != "28-0316a2794aff" {
+		t.Fatalf("OneWire = %+v", w)
+	}
+	if cfg.Integrations.IIO.SysfsRoot != "/host/sys" {
+		t.Fatalf("IIO = %+v", cfg.Integrations.IIO)
+	}
+}
+
 func TestLoadInvalidFrequency(t *testing.T) {
 	path := writeTempConfig(t, "frequency_seconds: 500\n")
 	_, err := Load(path)
@@ -95,3 +272,166 @@ func TestLoadMissingFile(t *testing.T) {
 		t.Fatal("expected error for missing config file")
 	}
 }
+
+func TestLoadMQTTProtocolVersion(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  protocol_version: '5'\n  message_expiry_seconds: 300\n  topic_alias: true\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MQTT.ProtocolVersion != "5" || cfg.MQTT.MessageExpirySeconds != 300 || !cfg.MQTT.TopicAlias {
+		t.Fatalf("MQTT = %+v", cfg.MQTT)
+	}
+	if cfg.MQTT.ContentType != DefaultMQTTContentType {
+		t.Fatalf("MQTT.ContentType = %q, want %q", cfg.MQTT.ContentType, DefaultMQTTContentType)
+	}
+
+	path = writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  protocol_version: '4'\n")
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for unsupported protocol_version")
+	}
+}
+
+func TestLoadMQTTBrokers(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  brokers:\n    - 'tcp://cloud:1883'\n    - 'tcp://onprem:1883'\n  broker_mode: 'fanout'\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.MQTT.Brokers) != 2 || cfg.MQTT.Brokers[0] != "tcp://cloud:1883" || cfg.MQTT.BrokerMode != "fanout" {
+		t.Fatalf("MQTT = %+v", cfg.MQTT)
+	}
+
+	cfg, err = Load(writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  broker: 'tcp://localhost:1883'\n"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MQTT.BrokerMode != DefaultMQTTBrokerMode {
+		t.Fatalf("MQTT.BrokerMode = %q, want %q", cfg.MQTT.BrokerMode, DefaultMQTTBrokerMode)
+	}
+
+	invalid := []string{
+		"frequency_seconds: 10\nmqtt:\n  broker: 'tcp://a:1883'\n  brokers: ['tcp://b:1883']\n",
+		"frequency_seconds: 10\nmqtt:\n  brokers: ['tcp://a:1883', 'tcp://a:1883']\n",
+		"frequency_seconds: 10\nmqtt:\n  brokers: ['']\n",
+		"frequency_seconds: 10\nmqtt:\n  broker_mode: 'roundrobin'\n",
+	}
+	for _, content := range invalid {
+		if _, err := Load(writeTempConfig(t, content)); err == nil {
+			t.Fatalf("expected error for config %q", content)
+		}
+	}
+}
+
+func TestLoadMQTTPayloadFormat(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  payload_format: 'sparkplug_b'\n  sparkplug:\n    edge_node_id: 'edge-01'\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MQTT.Sparkplug.GroupID != DefaultSparkplugGroupID || cfg.MQTT.Sparkplug.EdgeNodeID != "edge-01" {
+		t.Fatalf("Sparkplug = %+v", cfg.MQTT.Sparkplug)
+	}
+
+	cfg, err = Load(writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  payload_format: 'cbor'\n"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MQTT.ContentType != "application/cbor" {
+		t.Fatalf("ContentType = %q", cfg.MQTT.ContentType)
+	}
+
+	invalid := []string{
+		"frequency_seconds: 10\nmqtt:\n  payload_format: 'xml'\n",
+		"frequency_seconds: 10\nmqtt:\n  payload_format: 'sparkplug_b'\n  protocol_version: '5'\n",
+		"frequency_seconds: 10\nmqtt:\n  payload_format: 'sparkplug_b'\n  sparkplug:\n    group_id: 'a/b'\n",
+		"frequency_seconds: 10\nmqtt:\n  payload_format: 'sparkplug_b'\n  brokers: ['tcp://a:1883', 'tcp://b:1883']\n",
+	}
+	for _, content := range invalid {
+		if _, err := Load(writeTempConfig(t, content)); err == nil {
+			t.Fatalf("expected error for config %q", content)
+		}
+	}
+}
+
+func TestLoadHomeAssistant(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  home_assistant:\n    enabled: true\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.MQTT.HomeAssistant.Enabled || cfg.MQTT.HomeAssistant.DiscoveryPrefix != DefaultHADiscoveryPrefix {
+		t.Fatalf("HomeAssistant = %+v", cfg.MQTT.HomeAssistant)
+	}
+
+	path = writeTempConfig(t, "frequency_seconds: 10\nmqtt:\n  payload_format: 'sparkplug_b'\n  home_assistant:\n    enabled: true\n")
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for home_assistant with sparkplug_b")
+	}
+}
+
+func TestLoadReportByException(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nreport_by_exception:\n  enabled: true\n  absolute_deadband: 0.5\n  percent_deadband: 2\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	rbe := cfg.ReportByException
+	if !rbe.Enabled || rbe.AbsoluteDeadband != 0.5 || rbe.PercentDeadband != 2 || rbe.HeartbeatMinutes != DefaultHeartbeatMinutes {
+		t.Fatalf("ReportByException = %+v", rbe)
+	}
+
+	invalid := []string{
+		"frequency_seconds: 10\nreport_by_exception:\n  enabled: true\n  absolute_deadband: -1\n",
+		"frequency_seconds: 10\nreport_by_exception:\n  enabled: true\n  heartbeat_minutes: 0\n",
+		"frequency_seconds: 10\nmqtt:\n  payload_format: 'sparkplug_b'\nreport_by_exception:\n  enabled: true\n",
+	}
+	for _, content := range invalid {
+		if _, err := Load(writeTempConfig(t, content)); err == nil {
+			t.Fatalf("expected error for config %q", content)
+		}
+	}
+
+	// Sinks keep receiving full snapshots next to report by exception.
+	path = writeTempConfig(t, "frequency_seconds: 10\nsinks:\n  - name: 'file'\n    type: 'file'\nreport_by_exception:\n  enabled: true\n")
+	if _, err := Load(path); err != nil {
+		t.Fatalf("Load with sinks: %v", err)
+	}
+}
+
+func TestLoadSinks(t *testing.T) {
+	path := writeTempConfig(t, "frequency_seconds: 10\nsinks:\n  - name: 'historian'\n    type: 'influxdb'\n  - name: 'archive'\n    type: 'file'\n    encoder: 'json'\n    timeout_seconds: 2\n    retry:\n      max_attempts: 1\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.Sinks) != 2 {
+		t.Fatalf("Sinks = %+v", cfg.Sinks)
+	}
+
+	historian := cfg.Sinks[0]
+	if historian.Encoder != DefaultSinkEncoder || historian.TimeoutSeconds != DefaultSinkTimeout {
+		t.Fatalf("historian = %+v", historian)
+	}
+	if historian.Retry.MaxAttempts != DefaultSinkAttempts || historian.Retry.InitialBackoffMS != DefaultSinkBackoffMS || historian.Retry.MaxBackoffMS != DefaultSinkMaxBackoffMS {
+		t.Fatalf("historian.Retry = %+v", historian.Retry)
+	}
+	if archive := cfg.Sinks[1]; archive.TimeoutSeconds != 2 || archive.Retry.MaxAttempts != 1 {
+		t.Fatalf("archive = %+v", archive)
+	}
+
+	invalid := []string{
+		"frequency_seconds: 10\nsinks:\n  - type: 'file'\n",
+		"frequency_seconds: 10\nsinks:\n  - name: 'a'\n",
+		"frequency_seconds: 10\nsinks:\n  - name: 'mqtt'\n    type: 'file'\n",
+		"frequency_seconds: 10\nsinks:\n  - name: 'a'\n    type: 'file'\n  - name: 'a'\n    type: 'file'\n",
+		"frequency_seconds: 10\nsinks:\n  - name: 'a'\n    type: 'file'\n    retry:\n      max_attempts: -1\n",
+		"frequency_seconds: 10\nsinks:\n  - name: 'a'\n    type: 'nats'\n    encoder: 'xml'\n",
+		"frequency_seconds: 10\nsinks:\n  - name: 'a'\n    type: 'influxdb'\n    encoder: 'cbor'\n",
+	}
+	for _, content := range invalid {
+		if _, err := Load(writeTempConfig(t, content)); err == nil {
+			t.Fatalf("expected error for config %q", content)
+		}
+	}
+}
@@ -103,7 +103,11 @@ func collectSystemInfo() utils.SystemInfo {
 	}
 
 	if ifaces, err := net.Interfaces(); err == nil {
-		info.Network.Interfaces = mapInterfaces(ifaces)
+		counters, err := net.IOCounters(true)
+		if err != nil {
+			errors = append(errors, "net.IOCounters: "+err.Error())
+		}
+		info.Network.Interfaces = mapInterfaces(ifaces, counters)
 	} else {
 		errors = append(errors, "net.Interfaces: "+err.Error())
 	}
@@ -246,19 +250,38 @@ func mapDiskIO(in map[string]disk.IOCountersStat) []utils.DiskIO {
 	return items
 }
 
-func mapInterfaces(in []net.InterfaceStat) []utils.NetInterface {
+// mapInterfaces merges the per-interface counters into the interfaces by
+// name. Interfaces without counters keep zero counters.
+func mapInterfaces(in []net.InterfaceStat, counters []net.IOCountersStat) []utils.NetInterface {
+	byName := make(map[string]net.IOCountersStat, len(counters))
+	for _, c := range counters {
+		byName[c.Name] = c
+	}
+
 	items := make([]utils.NetInterface, 0, len(in))
 	for _, v := range in {
 		addrs := make([]string, 0, len(v.Addrs))
 		for _, a := range v.Addrs {
 			addrs = append(addrs, a.Addr)
 		}
+		c := byName[v.Name]
 		items = append(items, utils.NetInterface{
+			Index:        v.Index,
 			Name:         v.Name,
 			MTU:          v.MTU,
 			HardwareAddr: v.HardwareAddr,
 			Flags:        v.Flags,
 			Addrs:        addrs,
+			IO: utils.NetIO{
+				BytesSent:   c.BytesSent,
+				BytesRecv:   c.BytesRecv,
+				PacketsSent: c.PacketsSent,
+				PacketsRecv: c.PacketsRecv,
+				Errin:       c.Errin,
+				Errout:      c.Errout,
+				Dropin:      c.Dropin,
+				Dropout:     c.Dropout,
+			},
 		})
 	}
 	return items
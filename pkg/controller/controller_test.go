@@ -1,13 +1,16 @@
 package controller
 
 import (
+	"context"
 	"testing"
 
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/disk"
 	"github.com/shirou/gopsutil/v4/host"
 	"github.com/shirou/gopsutil/v4/net"
 	"github.com/shirou/gopsutil/v4/sensors"
+	"go.uber.org/zap"
 )
 
 func TestAvgFloat64(t *testing.T) {
@@ -72,11 +75,18 @@ func TestMapDiskIO(t *testing.T) {
 }
 
 func TestMapInterfaces(t *testing.T) {
-	in := []net.InterfaceStat{{Name: "eth0", MTU: 1500, HardwareAddr: "00:11:22:33:44:55", Flags: []string{"up"}, Addrs: []net.InterfaceAddr{{Addr: "127.0.0.1"}}}}
-	out := mapInterfaces(in)
-	if len(out) != 1 || out[0].Name != "eth0" || len(out[0].Addrs) != 1 {
+	in := []net.InterfaceStat{
+		{Index: 1, Name: "lo", MTU: 65536},
+		{Index: 3, Name: "eth0", MTU: 1500, HardwareAddr: "00:11:22:33:44:55", Flags: []string{"up"}, Addrs: []net.InterfaceAddr{{Addr: "127.0.0.1"}}},
+	}
+	counters := []net.IOCountersStat{{Name: "eth0", BytesRecv: 2048, PacketsSent: 7, Errin: 1}}
+	out := mapInterfaces(in, counters)
+	if len(out) != 2 || out[1].Name != "eth0" || out[1].Index != 3 || len(out[1].Addrs) != 1 {
 		t.Fatalf("mapInterfaces = %+v", out)
 	}
+	if out[1].IO.BytesRecv != 2048 || out[1].IO.PacketsSent != 7 || out[1].IO.Errin != 1 || out[0].IO != (utils.NetIO{}) {
+		t.Fatalf("mapInterfaces counters = %+v, %+v", out[1].IO, out[0].IO)
+	}
 }
 
 func TestMapUsers(t *testing.T) {
@@ -110,3 +120,42 @@ func TestCollectSystemInfoNoPanic(t *testing.T) {
 		t.Logf("collectSystemInfo errors: %v", info.Errors)
 	}
 }
+
+// snapshotPublisher records what the collection loop publishes.
+type snapshotPublisher struct {
+	payloads [][]byte
+	infos    []*utils.SystemInfo
+}
+
+func (p *snapshotPublisher) Publish(ctx context.Context, payload []byte, info *utils.SystemInfo) error {
+	p.payloads = append(p.payloads, payload)
+	p.infos = append(p.infos, info)
+	return nil
+}
+
+type modbusCollector struct{}
+
+func (modbusCollector) Collect(ctx context.Context, info *utils.SystemInfo) {
+	info.Modbus = &utils.ModbusStats{Values: []utils.ModbusValue{{Name: "tank_level", Value: 42.5}}}
+	info.Errors = append(info.Errors, "modbus: register missing: illegal data address")
+}
+
+func TestCollectAndPublishRunsCollectors(t *testing.T) {
+	var o runOptions
+	WithCollectors(modbusCollector{})(&o)
+	store := NewStore()
+	pub := &snapshotPublisher{}
+
+	collectAndPublish(context.Background(), zap.NewNop(), store, pub, o)
+
+	if len(pub.payloads) != 1 || pub.infos[0].Modbus == nil {
+		t.Fatalf("published %d payloads", len(pub.payloads))
+	}
+	info, ok := store.GetInfo()
+	if !ok || info.Modbus == nil || info.Modbus.Values[0].Name != "tank_level" {
+		t.Fatalf("stored info = %+v", info)
+	}
+	if last := info.Errors[len(info.Errors)-1]; last != "modbus: register missing: illegal data address" {
+		t.Fatalf("Errors = %v", info.Errors)
+	}
+}
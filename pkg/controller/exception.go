@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// ExceptionConfig configures report-by-exception publishing. A numeric field
+// is reported once it moved further than every non-zero deadband from the last
+// value that was reported for it; any other change is always reported.
+type ExceptionConfig struct {
+	AbsoluteDeadband float64
+	PercentDeadband  float64
+	Heartbeat        time.Duration
+}
+
+// ExceptionReport is the payload published between heartbeats. Changes is
+// keyed by the dotted JSON path of each field, e.g. "disk.usage./.used_percent";
+// a null value means the field no longer exists.
+type ExceptionReport struct {
+	Timestamp string         `json:"timestamp"`
+	Changes   map[string]any `json:"changes"`
+}
+
+// PayloadPublisher sends JSON payloads, such as the MQTT brokers.
+type PayloadPublisher interface {
+	Publish(ctx context.Context, payload []byte) error
+	Close() error
+}
+
+// ExceptionPublisher reports by exception to one output: it forwards the
+// first snapshot and one every heartbeat, and in between only the fields
+// that moved beyond the deadbands. Other outputs keep receiving every full
+// snapshot.
+type ExceptionPublisher struct {
+	next   PayloadPublisher
+	filter *exceptionFilter
+	logger *zap.Logger
+}
+
+func NewExceptionPublisher(next PayloadPublisher, cfg ExceptionConfig, logger *zap.Logger) *ExceptionPublisher {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ExceptionPublisher{next: next, filter: newExceptionFilter(cfg), logger: logger}
+}
+
+// Publish sends the full snapshot or the changes in payload, or nothing when
+// no field moved beyond the deadbands. A failed publish is retried with the
+// next snapshot.
+func (p *ExceptionPublisher) Publish(ctx context.Context, payload []byte) error {
+	result, err := p.filter.prepare(payload, time.Now())
+	if err != nil {
+		return fmt.Errorf("report by exception: %w", err)
+	}
+	if result == nil {
+		p.logger.Debug("report by exception: no changes beyond deadband")
+		return nil
+	}
+
+	if err := p.next.Publish(ctx, result.payload); err != nil {
+		return err
+	}
+	p.filter.commit(result)
+
+	p.logger.Debug("report by exception published",
+		zap.Bool("heartbeat", result.full),
+		zap.Int("fields", len(result.fields)),
+	)
+	return nil
+}
+
+func (p *ExceptionPublisher) Close() error {
+	return p.next.Close()
+}
+
+// exceptionFilter remembers the last reported value of every field.
+type exceptionFilter struct {
+	cfg ExceptionConfig
+
+	mu       sync.Mutex
+	last     map[string]any
+	lastFull time.Time
+}
+
+// exceptionResult is a prepared publish that is committed once it was sent.
+type exceptionResult struct {
+	payload []byte
+	full    bool
+	fields  map[string]any
+	now     time.Time
+}
+
+func newExceptionFilter(cfg ExceptionConfig) *exceptionFilter {
+	return &exceptionFilter{cfg: cfg}
+}
+
+// prepare compares payload with the last reported state. It returns nil when
+// nothing moved beyond the deadbands and no heartbeat is due.
+func (f *exceptionFilter) prepare(payload []byte, now time.Time) (*exceptionResult, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+
+	timestamp, _ := doc["timestamp"].(string)
+	delete(doc, "timestamp")
+
+	current := make(map[string]any)
+	flatten("", doc, current)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.last == nil || (f.cfg.Heartbeat > 0 && now.Sub(f.lastFull) >= f.cfg.Heartbeat) {
+		return &exceptionResult{payload: payload, full: true, fields: current, now: now}, nil
+	}
+
+	changes := make(map[string]any)
+	for key, value := range current {
+		prev, ok := f.last[key]
+		if !ok || f.exceeds(prev, value) {
+			changes[key] = value
+		}
+	}
+	for key := range f.last {
+		if _, ok := current[key]; !ok {
+			changes[key] = nil
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	out, err := json.Marshal(ExceptionReport{Timestamp: timestamp, Changes: changes})
+	if err != nil {
+		return nil, fmt.Errorf("encode changes: %w", err)
+	}
+	return &exceptionResult{payload: out, fields: changes, now: now}, nil
+}
+
+// commit records a published result as the new reference values.
+func (f *exceptionFilter) commit(r *exceptionResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.full {
+		f.last = r.fields
+		f.lastFull = r.now
+		return
+	}
+
+	for key, value := range r.fields {
+		if value == nil {
+			delete(f.last, key)
+			continue
+		}
+		f.last[key] = value
+	}
+}
+
+func (f *exceptionFilter) exceeds(prev, value any) bool {
+	a, aok := prev.(float64)
+	b, bok := value.(float64)
+	if !aok || !bok {
+		return prev != value
+	}
+
+	delta := math.Abs(b - a)
+	if delta == 0 {
+		return false
+	}
+	if f.cfg.AbsoluteDeadband > 0 && delta <= f.cfg.AbsoluteDeadband {
+		return false
+	}
+	if f.cfg.PercentDeadband > 0 && a != 0 && delta/math.Abs(a)*100 <= f.cfg.PercentDeadband {
+		return false
+	}
+	return true
+}
+
+// jsonField returns the string field name of a list element decoded from
+// JSON, or "" when it has none.
+func jsonField(items []any, i int, name string) string {
+	m, _ := items[i].(map[string]any)
+	id, _ := m[name].(string)
+	return id
+}
+
+// flatten writes every leaf of v into out keyed by its dotted path. List
+// elements are keyed by their identity where they have one, so the order
+// of disks or interfaces, and elements added before them, do not show up as
+// changes. Nulls and empty containers have no leaves, so emptying a list
+// reports its former entries as removed.
+func flatten(prefix string, v any, out map[string]any) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch t := v.(type) {
+	case nil:
+	case map[string]any:
+		for k, item := range t {
+			flatten(join(k), item, out)
+		}
+	case []any:
+		keys := utils.ElementKeys(len(t), func(i int, name string) string { return jsonField(t, i, name) })
+		for i, item := range t {
+			key := strconv.Itoa(i)
+			if keys != nil {
+				key = keys[i]
+			}
+			flatten(join(key), item, out)
+		}
+	default:
+		out[prefix] = t
+	}
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+type recordingPublisher struct {
+	payloads [][]byte
+	err      error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, payload []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+func marshalInfo(t *testing.T, info utils.SystemInfo) []byte {
+	t.Helper()
+	payload, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return payload
+}
+
+func decodeReport(t *testing.T, payload []byte) ExceptionReport {
+	t.Helper()
+	var report ExceptionReport
+	if err := json.Unmarshal(payload, &report); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if report.Changes == nil {
+		t.Fatalf("payload is not an exception report: %s", payload)
+	}
+	return report
+}
+
+func TestExceptionFilterDeadbands(t *testing.T) {
+	pub := &recordingPublisher{}
+	p := NewExceptionPublisher(pub, ExceptionConfig{AbsoluteDeadband: 1, PercentDeadband: 5, Heartbeat: time.Hour}, nil)
+	ctx := context.Background()
+
+	info := utils.SystemInfo{
+		Timestamp: "t0",
+		CPU:       utils.CPUStats{TotalPercent: 50},
+		Memory:    utils.MemoryStats{Virtual: utils.VirtualMemory{Total: 1000}},
+		Host:      utils.HostStats{Hostname: "edge-01"},
+	}
+	p.Publish(ctx, marshalInfo(t, info))
+	if len(pub.payloads) != 1 {
+		t.Fatalf("payloads = %d, want initial full publish", len(pub.payloads))
+	}
+	var full utils.SystemInfo
+	if err := json.Unmarshal(pub.payloads[0], &full); err != nil || full.Host.Hostname != "edge-01" {
+		t.Fatalf("first publish is not a full snapshot: %s", pub.payloads[0])
+	}
+
+	// Within the absolute deadband: suppressed.
+	info.Timestamp = "t1"
+	info.CPU.TotalPercent = 50.9
+	p.Publish(ctx, marshalInfo(t, info))
+	if len(pub.payloads) != 1 {
+		t.Fatalf("payloads = %d, want change within deadband suppressed", len(pub.payloads))
+	}
+
+	// Beyond absolute but within percent (2/50 = 4%): suppressed.
+	info.CPU.TotalPercent = 52
+	p.Publish(ctx, marshalInfo(t, info))
+	if len(pub.payloads) != 1 {
+		t.Fatalf("payloads = %d, want change within percent deadband suppressed", len(pub.payloads))
+	}
+
+	// Beyond both deadbands, plus a string change.
+	info.Timestamp = "t3"
+	info.CPU.TotalPercent = 60
+	info.Host.Hostname = "edge-02"
+	p.Publish(ctx, marshalInfo(t, info))
+	if len(pub.payloads) != 2 {
+		t.Fatalf("payloads = %d, want delta publish", len(pub.payloads))
+	}
+	report := decodeReport(t, pub.payloads[1])
+	if report.Timestamp != "t3" || len(report.Changes) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Changes["cpu.total_percent"] != 60.0 || report.Changes["host.hostname"] != "edge-02" {
+		t.Fatalf("changes = %+v", report.Changes)
+	}
+}
+
+func TestExceptionFilterDriftIsMeasuredFromLastReport(t *testing.T) {
+	f := newExceptionFilter(ExceptionConfig{AbsoluteDeadband: 1, Heartbeat: time.Hour})
+	now := time.Now()
+
+	for i, v := range []float64{10, 10.6, 11.2} {
+		info := utils.SystemInfo{CPU: utils.CPUStats{TotalPercent: v}}
+		result, err := f.prepare(marshalInfo(t, info), now)
+		if err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		if i == 1 && result != nil {
+			t.Fatal("expected 0.6 change to be suppressed")
+		}
+		if i == 2 && result == nil {
+			t.Fatal("expected accumulated 1.2 change to be reported")
+		}
+		if result != nil {
+			f.commit(result)
+		}
+	}
+}
+
+func TestExceptionFilterHeartbeatAndRemoval(t *testing.T) {
+	f := newExceptionFilter(ExceptionConfig{Heartbeat: time.Minute})
+	now := time.Now()
+
+	info := utils.SystemInfo{Disk: utils.DiskStats{Usage: []utils.DiskUsage{{Mountpoint: "/"}, {Mountpoint: "/mnt/usb"}}}}
+	result, _ := f.prepare(marshalInfo(t, info), now)
+	f.commit(result)
+
+	info.Disk.Usage = info.Disk.Usage[:1]
+	result, err := f.prepare(marshalInfo(t, info), now.Add(time.Second))
+	if err != nil || result == nil || result.full {
+		t.Fatalf("prepare = %+v, %v", result, err)
+	}
+	report := decodeReport(t, result.payload)
+	if v, ok := report.Changes["disk.usage./mnt/usb.mountpoint"]; !ok || v != nil {
+		t.Fatalf("changes = %+v, want removed mount reported as null", report.Changes)
+	}
+	f.commit(result)
+
+	if result, _ := f.prepare(marshalInfo(t, info), now.Add(2*time.Second)); result != nil {
+		t.Fatalf("prepare = %s, want no changes", result.payload)
+	}
+
+	result, _ = f.prepare(marshalInfo(t, info), now.Add(time.Minute))
+	if result == nil || !result.full {
+		t.Fatal("expected heartbeat to publish a full snapshot")
+	}
+}
+
+func TestExceptionFilterRetriesAfterPublishFailure(t *testing.T) {
+	pub := &recordingPublisher{}
+	p := NewExceptionPublisher(pub, ExceptionConfig{Heartbeat: time.Hour}, nil)
+	ctx := context.Background()
+
+	info := utils.SystemInfo{CPU: utils.CPUStats{TotalPercent: 1}}
+	p.Publish(ctx, marshalInfo(t, info))
+
+	pub.err = errors.New("offline")
+	info.CPU.TotalPercent = 2
+	p.Publish(ctx, marshalInfo(t, info))
+
+	pub.err = nil
+	p.Publish(ctx, marshalInfo(t, info))
+	if len(pub.payloads) != 2 {
+		t.Fatalf("payloads = %d, want change re-sent after failure", len(pub.payloads))
+	}
+	if report := decodeReport(t, pub.payloads[1]); report.Changes["cpu.total_percent"] != 2.0 {
+		t.Fatalf("changes = %+v", report.Changes)
+	}
+}
+
+func TestExceptionFilterKeysListsByIdentity(t *testing.T) {
+	f := newExceptionFilter(ExceptionConfig{Heartbeat: time.Hour})
+	now := time.Now()
+
+	info := utils.SystemInfo{
+		CPU: utils.CPUStats{PerCPUPercent: []float64{10, 20}},
+		Disk: utils.DiskStats{IO: []utils.DiskIO{
+			{Device: "sda", ReadBytes: 100},
+			{Device: "mmcblk0", ReadBytes: 200},
+		}},
+	}
+	result, _ := f.prepare(marshalInfo(t, info), now)
+	f.commit(result)
+
+	// The same disks in another order are no change.
+	info.Disk.IO[0], info.Disk.IO[1] = info.Disk.IO[1], info.Disk.IO[0]
+	if result, _ := f.prepare(marshalInfo(t, info), now.Add(time.Second)); result != nil {
+		t.Fatalf("prepare = %s, want no changes", result.payload)
+	}
+
+	// A disk added in front only reports its own fields.
+	info.Disk.IO = append([]utils.DiskIO{{Device: "sdb", ReadBytes: 5}}, info.Disk.IO...)
+	info.Disk.IO[2].ReadBytes = 150
+	result, err := f.prepare(marshalInfo(t, info), now.Add(2*time.Second))
+	if err != nil || result == nil {
+		t.Fatalf("prepare = %+v, %v", result, err)
+	}
+	report := decodeReport(t, result.payload)
+	if report.Changes["disk.io.sdb.read_bytes"] != 5.0 || report.Changes["disk.io.sda.read_bytes"] != 150.0 ||
+		report.Changes["disk.io.sdb.device"] != "sdb" || len(report.Changes) != 8 {
+		t.Fatalf("changes = %+v", report.Changes)
+	}
+	for key := range report.Changes {
+		if strings.HasPrefix(key, "disk.io.mmcblk0.") || strings.HasPrefix(key, "cpu.") {
+			t.Errorf("unexpected change %s", key)
+		}
+	}
+}
@@ -2,22 +2,61 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
 	"go.uber.org/zap"
 )
 
+// snapshotEncoder encodes every payload. JSON is always registered, so a
+// failed lookup is a programming error.
+var snapshotEncoder = func() encoding.Encoder {
+	enc, err := encoding.Lookup(encoding.JSON)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}()
+
+// Publisher sends every snapshot. Payload is the JSON encoding of info, so
+// outputs neither decode it nor encode it again for JSON.
 type Publisher interface {
-	Publish(ctx context.Context, payload []byte) error
+	Publish(ctx context.Context, payload []byte, info *utils.SystemInfo) error
+}
+
+// Option customises the collection loop started by Run.
+type Option func(*runOptions)
+
+type runOptions struct {
+	collectors []Collector
+}
+
+// Collector adds data from an integration, such as values polled from a field
+// device, to every snapshot. Failures are reported in info.Errors.
+type Collector interface {
+	Collect(ctx context.Context, info *utils.SystemInfo)
+}
+
+// WithCollectors runs the collectors in order after the host metrics of each
+// snapshot were gathered.
+func WithCollectors(collectors ...Collector) Option {
+	return func(o *runOptions) {
+		o.collectors = append(o.collectors, collectors...)
+	}
 }
 
-func Run(ctx context.Context, logger *zap.Logger, frequency time.Duration, store *Store, publisher Publisher) {
+func Run(ctx context.Context, logger *zap.Logger, frequency time.Duration, store *Store, publisher Publisher, opts ...Option) {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
-	collectAndPublish(ctx, logger, store, publisher)
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	collectAndPublish(ctx, logger, store, publisher, o)
 
 	ticker := time.NewTicker(frequency)
 	defer ticker.Stop()
@@ -28,14 +67,19 @@ func Run(ctx context.Context, logger *zap.Logger, frequency time.Duration, store
 			logger.Info("shutting down", zap.String("reason", ctx.Err().Error()))
 			return
 		case <-ticker.C:
-			collectAndPublish(ctx, logger, store, publisher)
+			collectAndPublish(ctx, logger, store, publisher, o)
 		}
 	}
 }
 
-func collectAndPublish(ctx context.Context, logger *zap.Logger, store *Store, publisher Publisher) {
+func collectAndPublish(ctx context.Context, logger *zap.Logger, store *Store, publisher Publisher, o runOptions) {
 	info := collectSystemInfo()
-	payload, err := json.Marshal(info)
+	for _, c := range o.collectors {
+		c.Collect(ctx, &info)
+	}
+	// Payloads are always JSON; sinks and the REST API re-encode the
+	// snapshot when another encoding is asked for.
+	payload, err := snapshotEncoder.Encode(info)
 	if err != nil {
 		logger.Error("marshal system info", zap.Error(err))
 		return
@@ -46,8 +90,8 @@ func collectAndPublish(ctx context.Context, logger *zap.Logger, store *Store, pu
 	}
 
 	if publisher != nil {
-		if err := publisher.Publish(ctx, payload); err != nil {
-			logger.Error("mqtt publish failed", zap.Error(err))
+		if err := publisher.Publish(ctx, payload, &info); err != nil {
+			logger.Error("publish failed", zap.Error(err))
 		}
 	}
 
@@ -8,10 +8,11 @@ import (
 )
 
 type Store struct {
-	mu      sync.RWMutex
-	payload []byte
-	info    *utils.SystemInfo
-	hasData bool
+	mu        sync.RWMutex
+	payload   []byte
+	info      *utils.SystemInfo
+	hasData   bool
+	listeners []func(*utils.SystemInfo)
 }
 
 func NewStore() *Store {
@@ -35,7 +36,20 @@ func (s *Store) Set(payload []byte) {
 	s.payload = copyPayload
 	s.info = &info
 	s.hasData = true
+	listeners := s.listeners
 	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(&info)
+	}
+}
+
+// OnUpdate registers fn to be called with every snapshot after it was stored.
+// fn runs on the collection loop and must not modify the snapshot.
+func (s *Store) OnUpdate(fn func(info *utils.SystemInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
 }
 
 func (s *Store) Get() ([]byte, bool) {
@@ -56,6 +70,18 @@ func (s *Store) Get() ([]byte, bool) {
 	return copyPayload, true
 }
 
+// GetInfo returns the decoded snapshot
+func (s *Store) GetInfo() (*utils.SystemInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.hasData || s.info == nil {
+		return nil, false
+	}
+
+	return s.info, true
+}
+
 // GetCPU returns full system info for CPU metrics access
 func (s *Store) GetCPU() (*utils.SystemInfo, bool) {
 	s.mu.RLock()
@@ -72,3 +72,19 @@ func TestStoreAccessors(t *testing.T) {
 		t.Fatalf("GetSensors = %+v, ok=%v", data, ok)
 	}
 }
+
+func TestStoreOnUpdate(t *testing.T) {
+	store := NewStore()
+	var got []float64
+	store.OnUpdate(func(info *utils.SystemInfo) {
+		got = append(got, info.CPU.TotalPercent)
+	})
+
+	store.Set([]byte(`{"cpu":{"total_percent":12.5}}`))
+	store.Set([]byte("not-json"))
+	store.Set([]byte(`{"cpu":{"total_percent":20}}`))
+
+	if len(got) != 2 || got[0] != 12.5 || got[1] != 20 {
+		t.Fatalf("listener saw %v", got)
+	}
+}
@@ -0,0 +1,32 @@
+package encoding
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// cborEncoder writes the JSON document structure as CBOR (RFC 8949), using
+// the json field names as map keys. Floats take the shortest of the half,
+// single and double precision forms that holds their value exactly.
+type cborEncoder struct {
+	mode cbor.EncMode
+}
+
+func newCBOREncoder() cborEncoder {
+	mode, err := cbor.EncOptions{
+		ShortestFloat: cbor.ShortestFloat16,
+		NaNConvert:    cbor.NaNConvert7e00,
+		InfConvert:    cbor.InfConvertFloat16,
+	}.EncMode()
+	if err != nil {
+		panic("encoding: invalid cbor options: " + err.Error())
+	}
+	return cborEncoder{mode: mode}
+}
+
+func (cborEncoder) Name() string        { return CBOR }
+func (cborEncoder) ContentType() string { return "application/cbor" }
+
+func (e cborEncoder) Encode(info utils.SystemInfo) ([]byte, error) {
+	return e.mode.Marshal(info)
+}
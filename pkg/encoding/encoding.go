@@ -0,0 +1,130 @@
+// Package encoding serialises snapshots for sinks, MQTT and the REST API.
+package encoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+const (
+	JSON     = "json"
+	CBOR     = "cbor"
+	MsgPack  = "msgpack"
+	Protobuf = "protobuf"
+)
+
+// Encoder serialises a snapshot into a wire format.
+type Encoder interface {
+	Name() string
+	ContentType() string
+	Encode(info utils.SystemInfo) ([]byte, error)
+}
+
+var encoders = map[string]Encoder{
+	JSON:     jsonEncoder{},
+	CBOR:     newCBOREncoder(),
+	MsgPack:  msgpackEncoder{},
+	Protobuf: protobufEncoder{},
+}
+
+// aliases are further media types accepted for an encoder in Accept headers.
+var aliases = map[string]string{
+	"application/msgpack":   MsgPack,
+	"application/x-msgpack": MsgPack,
+	"application/protobuf":  Protobuf,
+}
+
+// Lookup returns the encoder registered under name; an empty name selects JSON.
+func Lookup(name string) (Encoder, error) {
+	if name == "" {
+		name = JSON
+	}
+	enc, ok := encoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoder %q, supported: %v", name, Names())
+	}
+	return enc, nil
+}
+
+// Names lists the supported encoder names in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ContentTypes lists the media types of the supported encoders in the order
+// of Names.
+func ContentTypes() []string {
+	names := Names()
+	types := make([]string, len(names))
+	for i, name := range names {
+		types[i] = encoders[name].ContentType()
+	}
+	return types
+}
+
+// Negotiate picks the encoder for an HTTP Accept header. An empty header and
+// wildcards select JSON; among the supported types the one with the highest
+// quality wins, ties go to the type listed first. It returns false when the
+// header only lists unsupported types.
+func Negotiate(accept string) (Encoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return encoders[JSON], true
+	}
+
+	var best Encoder
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		enc := forMediaType(mediaType)
+		if enc == nil || q <= bestQ {
+			continue
+		}
+		best, bestQ = enc, q
+	}
+	return best, best != nil
+}
+
+func forMediaType(mediaType string) Encoder {
+	switch mediaType {
+	case "*/*", "application/*":
+		return encoders[JSON]
+	}
+	if name, ok := aliases[mediaType]; ok {
+		return encoders[name]
+	}
+	for _, enc := range encoders {
+		if enc.ContentType() == mediaType {
+			return enc
+		}
+	}
+	return nil
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Name() string        { return JSON }
+func (jsonEncoder) ContentType() string { return "application/json" }
+
+func (jsonEncoder) Encode(info utils.SystemInfo) ([]byte, error) {
+	return json.Marshal(info)
+}
@@ -0,0 +1,314 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func sampleInfo() utils.SystemInfo {
+	return utils.SystemInfo{
+		Timestamp: "2024-02-15T10:31:45Z",
+		CPU: utils.CPUStats{
+			Info:          []utils.CPUInfo{{ModelName: "Cortex-A72", Cores: 4, Mhz: 1500, CacheSize: 1024}},
+			TotalTimes:    utils.CPUTimes{User: 120.5, System: 30.25, Idle: 9000},
+			PerCPUTimes:   []utils.CPUTimes{{User: 60}, {User: 60.5}},
+			TotalPercent:  12.5,
+			PerCPUPercent: []float64{10, 15},
+		},
+		Load:   utils.LoadStats{Load1: 0.52, Load5: 0.4, Load15: 0.3},
+		Memory: utils.MemoryStats{Virtual: utils.VirtualMemory{Total: 4 << 30, Used: 1 << 30, UsedPercent: 25}, Swap: utils.SwapMemory{Total: 1 << 20}},
+		Disk: utils.DiskStats{
+			Partitions: []utils.DiskPartition{{Device: "/dev/mmcblk0p2", Mountpoint: "/", FSType: "ext4"}},
+			Usage:      []utils.DiskUsage{{Device: "/dev/mmcblk0p2", Mountpoint: "/", FSType: "ext4", Total: 32 << 30, Used: 8 << 30, UsedPercent: 25}},
+			IO:         []utils.DiskIO{{Device: "mmcblk0", ReadBytes: 1234, WriteCount: 7}},
+		},
+		Network: utils.NetworkStats{
+			Interfaces: []utils.NetInterface{{Index: 2, Name: "eth0", MTU: 1500, HardwareAddr: "dc:a6:32:00:00:01", Flags: []string{"up", "broadcast"}, Addrs: []string{"192.168.1.10/24"}, IO: utils.NetIO{BytesSent: 600, BytesRecv: 1500, Errin: 1}}},
+			Totals:     utils.NetIO{BytesSent: 1000, BytesRecv: 2000, Dropin: 3},
+		},
+		Host: utils.HostStats{
+			Hostname: "edge-01", OS: "linux", KernelArch: "aarch64", UptimeSeconds: 3600, Procs: 120,
+			Users: []utils.HostUser{{User: "pi", Terminal: "pts/0", StartedUnix: 1707990000}},
+		},
+		Sensors: utils.SensorsStats{
+			Temperatures: []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48.2, Critical: 90}},
+			Fans:         []utils.Fan{{SensorKey: "fan1", Value: 3000}},
+			Readings:     []utils.SensorReading{{SensorKey: "enclosure_humidity", Type: "humidityrelative", Value: 41.5, Unit: "%"}},
+		},
+		Modbus: &utils.ModbusStats{Values: []utils.ModbusValue{{Name: "tank_level", Value: 42.5, Unit: "%"}}},
+		OPCUA: &utils.OPCUAStats{Values: []utils.OPCUAValue{
+			{Name: "line_speed", NodeID: "ns=2;s=Line1.Speed", Value: 1.25, Status: "good", SourceTimestamp: "2024-02-15T10:00:00Z"},
+			{Name: "batch", NodeID: "ns=2;i=1001", Text: "B-0042", Status: "bad", StatusCode: 0x80340000},
+		}},
+		SNMP: &utils.SNMPStats{Values: []utils.SNMPValue{
+			{Target: "ups", Name: "battery_charge", OID: "1.3.6.1.2.1.33.1.2.4.0", Value: 97, Type: "Integer", Unit: "%"},
+			{Target: "switch", Name: "if_descr.2", OID: "1.3.6.1.2.1.2.2.1.2.2", Text: "ge-0/0/1", Type: "OctetString"},
+		}},
+		Location: &utils.LocationStats{
+			Fix: true, FixQuality: 1, FixMode: "3d", Latitude: 48.1173, Longitude: -11.516667, AltitudeM: 545.4,
+			SpeedKmh: 41.48, CourseDeg: 84.4, Satellites: 8, HDOP: 0.9, PDOP: 1.8, VDOP: 1.5, Time: "2026-03-18T10:15:01Z",
+		},
+		Errors: []string{"host.Users: not supported"},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	info := sampleInfo()
+
+	b, err := encoders[CBOR].Encode(info)
+	if err != nil {
+		t.Fatalf("cbor Encode: %v", err)
+	}
+	var fromCBOR utils.SystemInfo
+	if err := cbor.Unmarshal(b, &fromCBOR); err != nil {
+		t.Fatalf("cbor Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(fromCBOR, info) {
+		t.Fatalf("cbor round trip = %+v", fromCBOR)
+	}
+
+	b, err = encoders[MsgPack].Encode(info)
+	if err != nil {
+		t.Fatalf("msgpack Encode: %v", err)
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	var fromMsgPack utils.SystemInfo
+	if err := dec.Decode(&fromMsgPack); err != nil {
+		t.Fatalf("msgpack Decode: %v", err)
+	}
+	if !reflect.DeepEqual(fromMsgPack, info) {
+		t.Fatalf("msgpack round trip = %+v", fromMsgPack)
+	}
+
+	// Both use the JSON keys, so generic decoders see the JSON document.
+	var generic map[string]any
+	if err := msgpack.Unmarshal(b, &generic); err != nil {
+		t.Fatalf("msgpack Unmarshal: %v", err)
+	}
+	if _, ok := generic["cpu"].(map[string]any)["per_cpu_percent"]; !ok || generic["timestamp"] != info.Timestamp {
+		t.Fatalf("msgpack keys = %v", generic)
+	}
+}
+
+func TestCompactEncodings(t *testing.T) {
+	info := sampleInfo()
+	js, _ := encoders[JSON].Encode(info)
+	for _, name := range []string{CBOR, MsgPack, Protobuf} {
+		b, err := encoders[name].Encode(info)
+		if err != nil {
+			t.Fatalf("%s Encode: %v", name, err)
+		}
+		if len(b) >= len(js) {
+			t.Errorf("%s is %d bytes, json %d", name, len(b), len(js))
+		}
+	}
+}
+
+// TestProtobufMatchesSchema decodes the protobuf encoding with a descriptor
+// built from systeminfo.proto and compares it with the JSON encoding.
+func TestProtobufMatchesSchema(t *testing.T) {
+	desc := loadSchema(t)
+
+	info := sampleInfo()
+	b, err := encoders[Protobuf].Encode(info)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(b, msg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	js, _ := encoders[JSON].Encode(info)
+	var want any
+	if err := json.Unmarshal(js, &want); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	got := fromProto(msg)
+	if !reflect.DeepEqual(prune(got), prune(want)) {
+		t.Fatalf("protobuf decodes as\n%v\nwant\n%v", prune(got), prune(want))
+	}
+}
+
+var (
+	protoMessage = regexp.MustCompile(`(?m)^message (\w+) \{$`)
+	protoField   = regexp.MustCompile(`^\s+(repeated )?(\w+) (\w+) = (\d+);`)
+)
+
+// loadSchema builds the SystemInfo descriptor from systeminfo.proto, which
+// only uses scalar fields and messages of the same file.
+func loadSchema(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	src, err := os.ReadFile("systeminfo.proto")
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	scalars := map[string]descriptorpb.FieldDescriptorProto_Type{
+		"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+		"double": descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+		"uint64": descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		"uint32": descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("systeminfo.proto"),
+		Package: proto.String("edgebeat.v1"),
+		Syntax:  proto.String("proto3"),
+	}
+	var current *descriptorpb.DescriptorProto
+	for _, line := range strings.Split(string(src), "\n") {
+		if m := protoMessage.FindStringSubmatch(line); m != nil {
+			current = &descriptorpb.DescriptorProto{Name: proto.String(m[1])}
+			file.MessageType = append(file.MessageType, current)
+			continue
+		}
+		m := protoField.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		num, _ := strconv.Atoi(m[4])
+		field := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(m[3]),
+			JsonName: proto.String(m[3]),
+			Number:   proto.Int32(int32(num)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if m[1] != "" {
+			field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}
+		if typ, ok := scalars[m[2]]; ok {
+			field.Type = typ.Enum()
+		} else {
+			field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			field.TypeName = proto.String(".edgebeat.v1." + m[2])
+		}
+		current.Field = append(current.Field, field)
+	}
+
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	return fd.Messages().ByName("SystemInfo")
+}
+
+// fromProto converts msg into the shape encoding/json produces.
+func fromProto(msg protoreflect.Message) map[string]any {
+	out := map[string]any{}
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsList() {
+			list := v.List()
+			items := make([]any, list.Len())
+			for i := range items {
+				items[i] = protoValue(fd, list.Get(i))
+			}
+			out[string(fd.Name())] = items
+			return true
+		}
+		out[string(fd.Name())] = protoValue(fd, v)
+		return true
+	})
+	return out
+}
+
+func protoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		return fromProto(v.Message())
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.DoubleKind:
+		return v.Float()
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.Uint64Kind, protoreflect.Uint32Kind:
+		return float64(v.Uint())
+	default:
+		return float64(v.Int())
+	}
+}
+
+// prune drops zero values, empty lists and empty objects, which proto3 does
+// not transmit.
+func prune(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for k, item := range v {
+			if p := prune(item); p != nil {
+				out[k] = p
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case []any:
+		if len(v) == 0 {
+			return nil
+		}
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = prune(item)
+			if out[i] == nil {
+				out[i] = map[string]any{}
+			}
+		}
+		return out
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	case nil:
+		return nil
+	}
+	return v
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                               JSON,
+		"*/*":                            JSON,
+		"text/html, application/*;q=0.5": JSON,
+		"application/cbor":               CBOR,
+		"application/x-msgpack":          MsgPack,
+		"application/json;q=0.5, application/x-protobuf":        Protobuf,
+		"application/cbor;q=0.2, application/vnd.msgpack;q=0.9": MsgPack,
+	}
+	for accept, want := range cases {
+		enc, ok := Negotiate(accept)
+		if !ok || enc.Name() != want {
+			t.Errorf("Negotiate(%q) = %v, %v, want %s", accept, enc, ok, want)
+		}
+	}
+	if _, ok := Negotiate("text/html, application/xml;q=0.9"); ok {
+		t.Error("expected no encoder for html and xml")
+	}
+}
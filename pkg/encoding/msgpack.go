@@ -0,0 +1,28 @@
+package encoding
+
+import (
+	"bytes"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackEncoder writes the JSON document structure as MessagePack, using the
+// json field names as map keys. Integers and floats take the smallest form
+// that holds their value exactly.
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Name() string        { return MsgPack }
+func (msgpackEncoder) ContentType() string { return "application/vnd.msgpack" }
+
+func (msgpackEncoder) Encode(info utils.SystemInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(info); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,339 @@
+package encoding
+
+import (
+	"math"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufEncoder writes snapshots as edgebeat.v1.SystemInfo messages, see
+// systeminfo.proto, whose field numbers the marshal functions use. Zero values
+// are left out as in proto3.
+type protobufEncoder struct{}
+
+func (protobufEncoder) Name() string        { return Protobuf }
+func (protobufEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (protobufEncoder) Encode(info utils.SystemInfo) ([]byte, error) {
+	return marshalSystemInfo(info), nil
+}
+
+// message builds one protobuf message; every method appends a field.
+type message []byte
+
+func (m message) str(num protowire.Number, v string) message {
+	if v == "" {
+		return m
+	}
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendString(m, v)
+}
+
+func (m message) strs(num protowire.Number, vs []string) message {
+	for _, v := range vs {
+		m = protowire.AppendTag(m, num, protowire.BytesType)
+		m = protowire.AppendString(m, v)
+	}
+	return m
+}
+
+func (m message) double(num protowire.Number, v float64) message {
+	if v == 0 && !math.Signbit(v) {
+		return m
+	}
+	m = protowire.AppendTag(m, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(m, math.Float64bits(v))
+}
+
+// doubles writes a packed repeated double field.
+func (m message) doubles(num protowire.Number, vs []float64) message {
+	if len(vs) == 0 {
+		return m
+	}
+	packed := make([]byte, 0, 8*len(vs))
+	for _, v := range vs {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(v))
+	}
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendBytes(m, packed)
+}
+
+func (m message) uint(num protowire.Number, v uint64) message {
+	if v == 0 {
+		return m
+	}
+	m = protowire.AppendTag(m, num, protowire.VarintType)
+	return protowire.AppendVarint(m, v)
+}
+
+func (m message) bool(num protowire.Number, v bool) message {
+	if !v {
+		return m
+	}
+	return m.uint(num, 1)
+}
+
+// int writes int32 and int64 fields; negative values take ten bytes.
+func (m message) int(num protowire.Number, v int64) message {
+	return m.uint(num, uint64(v))
+}
+
+// sub writes a singular message field, left out when it is empty.
+func (m message) sub(num protowire.Number, v message) message {
+	if len(v) == 0 {
+		return m
+	}
+	return m.elem(num, v)
+}
+
+// elem writes one element of a repeated message field.
+func (m message) elem(num protowire.Number, v message) message {
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendBytes(m, v)
+}
+
+func marshalSystemInfo(info utils.SystemInfo) []byte {
+	var m message
+	m = m.str(1, info.Timestamp)
+	m = m.sub(2, marshalCPU(info.CPU))
+	m = m.sub(3, message(nil).
+		double(1, info.Load.Load1).
+		double(2, info.Load.Load5).
+		double(3, info.Load.Load15))
+	m = m.sub(4, marshalMemory(info.Memory))
+	m = m.sub(5, marshalDisk(info.Disk))
+	m = m.sub(6, marshalNetwork(info.Network))
+	m = m.sub(7, marshalHost(info.Host))
+	m = m.sub(8, marshalSensors(info.Sensors))
+	m = m.strs(9, info.Errors)
+	if info.Modbus != nil {
+		// Sent even when empty, as the section shows that polling is enabled.
+		m = m.elem(10, marshalModbus(*info.Modbus))
+	}
+	if info.OPCUA != nil {
+		m = m.elem(11, marshalOPCUA(*info.OPCUA))
+	}
+	if info.SNMP != nil {
+		m = m.elem(12, marshalSNMP(*info.SNMP))
+	}
+	if info.Location != nil {
+		m = m.elem(13, marshalLocation(*info.Location))
+	}
+	return m
+}
+
+func marshalCPU(cpu utils.CPUStats) message {
+	var m message
+	for _, c := range cpu.Info {
+		m = m.elem(1, message(nil).
+			str(1, c.ModelName).
+			int(2, int64(c.Cores)).
+			double(3, c.Mhz).
+			int(4, int64(c.CacheSize)))
+	}
+	m = m.sub(2, marshalCPUTimes(cpu.TotalTimes))
+	for _, t := range cpu.PerCPUTimes {
+		m = m.elem(3, marshalCPUTimes(t))
+	}
+	m = m.double(4, cpu.TotalPercent)
+	return m.doubles(5, cpu.PerCPUPercent)
+}
+
+func marshalCPUTimes(t utils.CPUTimes) message {
+	return message(nil).
+		double(1, t.User).
+		double(2, t.System).
+		double(3, t.Idle).
+		double(4, t.Nice).
+		double(5, t.Iowait).
+		double(6, t.Irq).
+		double(7, t.SoftIrq).
+		double(8, t.Steal).
+		double(9, t.Guest).
+		double(10, t.GuestNice)
+}
+
+func marshalMemory(mem utils.MemoryStats) message {
+	vm, swap := mem.Virtual, mem.Swap
+	return message(nil).
+		sub(1, message(nil).
+			uint(1, vm.Total).
+			uint(2, vm.Available).
+			uint(3, vm.Used).
+			uint(4, vm.Free).
+			uint(5, vm.Buffers).
+			uint(6, vm.Cached).
+			uint(7, vm.Active).
+			uint(8, vm.Inactive).
+			double(9, vm.UsedPercent)).
+		sub(2, message(nil).
+			uint(1, swap.Total).
+			uint(2, swap.Used).
+			uint(3, swap.Free).
+			double(4, swap.UsedPercent))
+}
+
+func marshalDisk(disk utils.DiskStats) message {
+	var m message
+	for _, p := range disk.Partitions {
+		m = m.elem(1, message(nil).
+			str(1, p.Device).
+			str(2, p.Mountpoint).
+			str(3, p.FSType))
+	}
+	for _, u := range disk.Usage {
+		m = m.elem(2, message(nil).
+			str(1, u.Device).
+			str(2, u.Mountpoint).
+			str(3, u.FSType).
+			uint(4, u.Total).
+			uint(5, u.Used).
+			uint(6, u.Free).
+			double(7, u.UsedPercent))
+	}
+	for _, io := range disk.IO {
+		m = m.elem(3, message(nil).
+			str(1, io.Device).
+			uint(2, io.ReadBytes).
+			uint(3, io.WriteBytes).
+			uint(4, io.ReadCount).
+			uint(5, io.WriteCount).
+			uint(6, io.ReadTimeMS).
+			uint(7, io.WriteTimeMS))
+	}
+	return m
+}
+
+func marshalNetwork(network utils.NetworkStats) message {
+	var m message
+	for _, i := range network.Interfaces {
+		m = m.elem(1, message(nil).
+			str(1, i.Name).
+			int(2, int64(i.MTU)).
+			str(3, i.HardwareAddr).
+			strs(4, i.Flags).
+			strs(5, i.Addrs).
+			int(6, int64(i.Index)).
+			sub(7, marshalNetIO(i.IO)))
+	}
+	return m.sub(2, marshalNetIO(network.Totals))
+}
+
+func marshalNetIO(io utils.NetIO) message {
+	return message(nil).
+		uint(1, io.BytesSent).
+		uint(2, io.BytesRecv).
+		uint(3, io.PacketsSent).
+		uint(4, io.PacketsRecv).
+		uint(5, io.Errin).
+		uint(6, io.Errout).
+		uint(7, io.Dropin).
+		uint(8, io.Dropout)
+}
+
+func marshalHost(host utils.HostStats) message {
+	m := message(nil).
+		str(1, host.Hostname).
+		str(2, host.OS).
+		str(3, host.Platform).
+		str(4, host.PlatformFamily).
+		str(5, host.PlatformVersion).
+		str(6, host.KernelVersion).
+		str(7, host.KernelArch).
+		uint(8, host.UptimeSeconds).
+		uint(9, host.BootTime).
+		uint(10, host.Procs).
+		str(11, host.VirtualizationSystem).
+		str(12, host.VirtualizationRole)
+	for _, u := range host.Users {
+		m = m.elem(13, message(nil).
+			str(1, u.User).
+			str(2, u.Terminal).
+			str(3, u.Host).
+			int(4, u.StartedUnix))
+	}
+	return m
+}
+
+func marshalSensors(sensors utils.SensorsStats) message {
+	var m message
+	for _, t := range sensors.Temperatures {
+		m = m.elem(1, message(nil).
+			str(1, t.SensorKey).
+			double(2, t.Value).
+			double(3, t.High).
+			double(4, t.Critical))
+	}
+	for _, f := range sensors.Fans {
+		m = m.elem(2, message(nil).
+			str(1, f.SensorKey).
+			double(2, f.Value))
+	}
+	for _, r := range sensors.Readings {
+		m = m.elem(3, message(nil).
+			str(1, r.SensorKey).
+			str(2, r.Type).
+			double(3, r.Value).
+			str(4, r.Unit))
+	}
+	return m
+}
+
+func marshalModbus(modbus utils.ModbusStats) message {
+	var m message
+	for _, v := range modbus.Values {
+		m = m.elem(1, message(nil).
+			str(1, v.Name).
+			double(2, v.Value).
+			str(3, v.Unit))
+	}
+	return m
+}
+
+func marshalOPCUA(opcua utils.OPCUAStats) message {
+	var m message
+	for _, v := range opcua.Values {
+		m = m.elem(1, message(nil).
+			str(1, v.Name).
+			str(2, v.NodeID).
+			double(3, v.Value).
+			str(4, v.Text).
+			str(5, v.Status).
+			uint(6, uint64(v.StatusCode)).
+			str(7, v.SourceTimestamp))
+	}
+	return m
+}
+
+func marshalSNMP(snmp utils.SNMPStats) message {
+	var m message
+	for _, v := range snmp.Values {
+		m = m.elem(1, message(nil).
+			str(1, v.Target).
+			str(2, v.Name).
+			str(3, v.OID).
+			double(4, v.Value).
+			str(5, v.Text).
+			str(6, v.Type).
+			str(7, v.Unit))
+	}
+	return m
+}
+
+func marshalLocation(loc utils.LocationStats) message {
+	return message(nil).
+		bool(1, loc.Fix).
+		int(2, int64(loc.FixQuality)).
+		str(3, loc.FixMode).
+		double(4, loc.Latitude).
+		double(5, loc.Longitude).
+		double(6, loc.AltitudeM).
+		double(7, loc.SpeedKmh).
+		double(8, loc.CourseDeg).
+		int(9, int64(loc.Satellites)).
+		double(10, loc.HDOP).
+		double(11, loc.PDOP).
+		double(12, loc.VDOP).
+		str(13, loc.Time)
+}
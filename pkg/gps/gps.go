@@ -0,0 +1,267 @@
+// Package gps reads the position of an NMEA 0183 GPS receiver.
+package gps
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.bug.st/serial"
+	"go.uber.org/zap"
+)
+
+// Defaults for settings left zero in Config.
+const (
+	DefaultBaudRate = 9600
+	DefaultMaxAge   = 10 * time.Second
+)
+
+const (
+	// reopenDelay is the wait before the source is opened again after an
+	// error, such as a receiver that was unplugged.
+	reopenDelay = time.Second
+	// followInterval is how often the end of a file is checked for new
+	// sentences.
+	followInterval = 200 * time.Millisecond
+	// maxLineLen bounds a line; NMEA sentences have at most 82 characters,
+	// so longer lines are noise and dropped.
+	maxLineLen = 256
+)
+
+type Config struct {
+	// SerialPort is the device of the receiver, read at BaudRate with 8N1.
+	SerialPort string
+	BaudRate   int
+	// File is read instead of a serial port, such as a recorded log, a pipe
+	// or a device set up elsewhere. At its end it is followed like tail -f.
+	File string
+	// MaxAge is how long the last position counts as a fix when no new GGA
+	// or RMC sentence arrives.
+	MaxAge time.Duration
+}
+
+// Collector reads sentences in the background and adds the latest fix to
+// every snapshot. The source is opened when the collector is created and
+// re-opened after errors.
+type Collector struct {
+	cfg    Config
+	mode   *serial.Mode
+	start  time.Time
+	logger *zap.Logger
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu     sync.Mutex
+	fix    fix
+	last   time.Time
+	err    error
+	source io.Closer
+}
+
+// NewCollector validates cfg and starts reading from the serial port or
+// file.
+func NewCollector(cfg Config, logger *zap.Logger) (*Collector, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if (cfg.SerialPort == "") == (cfg.File == "") {
+		return nil, fmt.Errorf("gps needs either a serial port or a file")
+	}
+	if cfg.BaudRate == 0 {
+		cfg.BaudRate = DefaultBaudRate
+	}
+	if cfg.BaudRate < 0 {
+		return nil, fmt.Errorf("gps baud rate must be positive: %d", cfg.BaudRate)
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = DefaultMaxAge
+	}
+
+	c := &Collector{
+		cfg:    cfg,
+		mode:   &serial.Mode{BaudRate: cfg.BaudRate, DataBits: 8, Parity: serial.NoParity, StopBits: serial.OneStopBit},
+		start:  time.Now(),
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+func (c *Collector) name() string {
+	if c.cfg.File != "" {
+		return c.cfg.File
+	}
+	return c.cfg.SerialPort
+}
+
+func (c *Collector) run() {
+	defer close(c.done)
+	for {
+		err := c.read()
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		c.logger.Warn("gps read failed", zap.String("source", c.name()), zap.Error(err))
+
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(reopenDelay):
+		}
+	}
+}
+
+func (c *Collector) open() (io.ReadCloser, error) {
+	if c.cfg.File != "" {
+		return os.Open(c.cfg.File)
+	}
+	return serial.Open(c.cfg.SerialPort, c.mode)
+}
+
+// read opens the source and handles its lines until an error or Close.
+func (c *Collector) read() error {
+	src, err := c.open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", c.name(), err)
+	}
+	c.mu.Lock()
+	select {
+	case <-c.stop:
+		c.mu.Unlock()
+		return src.Close()
+	default:
+	}
+	c.source = src
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.source = nil
+		c.mu.Unlock()
+		_ = src.Close()
+	}()
+
+	r := bufio.NewReaderSize(src, maxLineLen)
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		switch {
+		case err == nil:
+			c.handle(string(line))
+			line = line[:0]
+		case errors.Is(err, bufio.ErrBufferFull):
+		case errors.Is(err, io.EOF) && c.cfg.File != "":
+			select {
+			case <-c.stop:
+				return nil
+			case <-time.After(followInterval):
+			}
+		default:
+			return fmt.Errorf("read %s: %w", c.name(), err)
+		}
+		if len(line) > maxLineLen {
+			line = line[:0]
+		}
+	}
+}
+
+// handle applies one line. Lines that fail their checksum or cannot be
+// parsed are dropped, as are sentences other than GGA, RMC and GSA.
+func (c *Collector) handle(line string) {
+	s, err := parseSentence(line)
+	if err != nil {
+		c.logger.Debug("gps sentence dropped", zap.Error(err))
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.fix.apply(s); err != nil {
+		if !errors.Is(err, errUnsupported) {
+			c.logger.Debug("gps sentence dropped", zap.Error(err))
+		}
+		return
+	}
+	if s.typ != "GSA" {
+		c.last = time.Now()
+	}
+	c.err = nil
+}
+
+// Collect stores the latest fix in info.Location. A receiver that has not
+// sent a position for longer than MaxAge is reported in info.Errors and has
+// no fix.
+func (c *Collector) Collect(ctx context.Context, info *utils.SystemInfo) {
+	c.mu.Lock()
+	f, last, err := c.fix, c.last, c.err
+	c.mu.Unlock()
+
+	loc := f.stats()
+	since := last
+	if since.IsZero() {
+		since = c.start
+	}
+	if time.Since(since) > c.cfg.MaxAge {
+		loc.Fix = false
+		msg := "no position from " + c.name()
+		if !last.IsZero() {
+			msg += " since " + last.UTC().Format(time.RFC3339)
+		}
+		if err != nil {
+			msg += ": " + err.Error()
+		}
+		info.Errors = append(info.Errors, "gps: "+msg)
+	}
+	info.Location = &loc
+}
+
+func (f fix) stats() utils.LocationStats {
+	loc := utils.LocationStats{
+		Fix:        f.valid,
+		FixQuality: f.quality,
+		FixMode:    f.mode,
+		Latitude:   f.latitude,
+		Longitude:  f.longitude,
+		AltitudeM:  f.altitude,
+		SpeedKmh:   f.speed,
+		CourseDeg:  f.course,
+		Satellites: f.satellites,
+		HDOP:       f.hdop,
+		PDOP:       f.pdop,
+		VDOP:       f.vdop,
+	}
+	if !f.time.IsZero() {
+		loc.Time = f.time.Format(time.RFC3339)
+	}
+	return loc
+}
+
+// Close stops reading and closes the source.
+func (c *Collector) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.stop:
+		c.mu.Unlock()
+		return nil
+	default:
+	}
+	close(c.stop)
+	if c.source != nil {
+		_ = c.source.Close()
+	}
+	c.mu.Unlock()
+	<-c.done
+	return nil
+}
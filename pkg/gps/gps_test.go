@@ -0,0 +1,146 @@
+package gps
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// feed writes the recording to the controlling side of a pseudo-terminal
+// every interval, as a receiver repeats its sentences, until the test ends.
+// The collector under test opens the terminal side as its serial port.
+func feed(t *testing.T, nmea string, interval time.Duration) string {
+	t.Helper()
+	ptm, pts, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	// Echoed input is read and discarded until the collector switches the
+	// terminal to raw mode.
+	go io.Copy(io.Discard, ptm)
+	go func() {
+		defer close(done)
+		for {
+			if _, err := io.WriteString(ptm, strings.ReplaceAll(nmea, "\n", "\r\n")); err != nil {
+				return
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+		ptm.Close()
+		pts.Close()
+	})
+	return pts.Name()
+}
+
+// collect returns the first snapshot for which ok is true.
+func collect(t *testing.T, c *Collector, ok func(*utils.SystemInfo) bool) *utils.SystemInfo {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info := &utils.SystemInfo{}
+		c.Collect(context.Background(), info)
+		if ok(info) {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("location = %+v, errors = %v", info.Location, info.Errors)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCollectorSerial(t *testing.T) {
+	tty := feed(t, recording, 50*time.Millisecond)
+	c, err := NewCollector(Config{SerialPort: tty, BaudRate: 4800}, nil)
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	defer c.Close()
+
+	// The recording repeats, so the fix is checked once its GSA arrived.
+	info := collect(t, c, func(info *utils.SystemInfo) bool { return info.Location.Fix && info.Location.FixMode == "3d" })
+	loc := info.Location
+	if loc.FixQuality != 1 || loc.Satellites != 8 || loc.HDOP != 0.9 ||
+		loc.AltitudeM != 545.4 || loc.Time != "2026-03-18T10:15:01Z" || len(info.Errors) != 0 {
+		t.Fatalf("location = %+v, errors = %v", loc, info.Errors)
+	}
+
+	start := time.Now()
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %v", d)
+	}
+}
+
+func TestCollectorFileAndMaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gps.nmea")
+	if err := os.WriteFile(path, []byte("$GNGGA,101501.00,4807.0380,N,01131.0000,E,1,08,0.9,545.4,M,46.9,M,,*7E\n$GNRMC,1015"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	c, err := NewCollector(Config{File: path, MaxAge: 300 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	defer c.Close()
+
+	collect(t, c, func(info *utils.SystemInfo) bool { return info.Location.Fix && info.Location.SpeedKmh == 0 })
+
+	// The file is followed, and the partial line at its end completed.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	f.WriteString("01.00,A,4807.0380,N,01131.0000,E,22.4,84.4,180326,003.1,W,A*3F\n")
+	f.Close()
+	collect(t, c, func(info *utils.SystemInfo) bool { return info.Location.SpeedKmh > 41 })
+
+	// Without new sentences the fix expires but the position is kept.
+	info := collect(t, c, func(info *utils.SystemInfo) bool { return !info.Location.Fix })
+	if info.Location.Latitude == 0 || len(info.Errors) != 1 || !strings.HasPrefix(info.Errors[0], "gps: no position from "+path+" since ") {
+		t.Fatalf("location = %+v, errors = %v", info.Location, info.Errors)
+	}
+}
+
+func TestCollectorMissingSource(t *testing.T) {
+	c, err := NewCollector(Config{SerialPort: "/dev/does-not-exist", MaxAge: 50 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatalf("NewCollector: %v", err)
+	}
+	defer c.Close()
+
+	info := collect(t, c, func(info *utils.SystemInfo) bool { return len(info.Errors) > 0 })
+	if info.Location == nil || info.Location.Fix || !strings.Contains(info.Errors[0], "open /dev/does-not-exist") {
+		t.Fatalf("location = %+v, errors = %v", info.Location, info.Errors)
+	}
+}
+
+func TestNewCollectorValidates(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"no source": {},
+		"two":       {SerialPort: "/dev/ttyUSB0", File: "/tmp/gps.nmea"},
+		"baud rate": {SerialPort: "/dev/ttyUSB0", BaudRate: -1},
+	} {
+		if _, err := NewCollector(cfg, nil); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
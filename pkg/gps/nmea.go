@@ -0,0 +1,239 @@
+package gps
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knotsToKmh converts the speed over ground of RMC sentences.
+const knotsToKmh = 1.852
+
+var errUnsupported = errors.New("unsupported sentence")
+
+// sentence is a checked NMEA sentence split into its fields. typ is the
+// sentence formatter without the talker id, such as GGA for $GNGGA.
+type sentence struct {
+	typ    string
+	fields []string
+}
+
+// parseSentence checks the framing and, when present, the checksum of one
+// line. Talker ids are ignored, so GPS, GLONASS and multi-constellation
+// receivers ($GP, $GL, $GN, ...) are read alike.
+func parseSentence(line string) (sentence, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) < 7 || line[0] != '$' {
+		return sentence{}, fmt.Errorf("not an nmea sentence: %q", line)
+	}
+	body := line[1:]
+	if i := strings.LastIndexByte(body, '*'); i >= 0 {
+		want, err := strconv.ParseUint(body[i+1:], 16, 8)
+		if err != nil || len(body)-i-1 != 2 {
+			return sentence{}, fmt.Errorf("bad checksum field: %q", line)
+		}
+		body = body[:i]
+		var sum byte
+		for j := 0; j < len(body); j++ {
+			sum ^= body[j]
+		}
+		if sum != byte(want) {
+			return sentence{}, fmt.Errorf("checksum mismatch: %q", line)
+		}
+	}
+	fields := strings.Split(body, ",")
+	if len(fields[0]) != 5 {
+		return sentence{}, fmt.Errorf("bad address field: %q", line)
+	}
+	return sentence{typ: fields[0][2:], fields: fields[1:]}, nil
+}
+
+// field returns field i, or "" when the sentence is shorter.
+func (s sentence) field(i int) string {
+	if i < len(s.fields) {
+		return s.fields[i]
+	}
+	return ""
+}
+
+// fix is the state a stream of sentences builds up. Fields keep their last
+// known value while the receiver has no fix.
+type fix struct {
+	valid      bool
+	quality    int
+	mode       string
+	latitude   float64
+	longitude  float64
+	altitude   float64
+	speed      float64
+	course     float64
+	satellites int
+	hdop       float64
+	pdop       float64
+	vdop       float64
+	time       time.Time
+}
+
+// apply updates f with a GGA, RMC or GSA sentence.
+func (f *fix) apply(s sentence) error {
+	switch s.typ {
+	case "GGA":
+		return f.applyGGA(s)
+	case "RMC":
+		return f.applyRMC(s)
+	case "GSA":
+		return f.applyGSA(s)
+	}
+	return errUnsupported
+}
+
+// applyGGA reads the fix quality, satellites in use, position, HDOP and
+// altitude above mean sea level.
+func (f *fix) applyGGA(s sentence) error {
+	quality, err := optInt(s.field(5))
+	if err != nil {
+		return fmt.Errorf("gga quality: %w", err)
+	}
+	f.quality = quality
+	f.valid = quality > 0
+	// Receivers report the satellites they track while searching for a fix.
+	if f.satellites, err = optInt(s.field(6)); err != nil {
+		return fmt.Errorf("gga satellites: %w", err)
+	}
+	if !f.valid {
+		return nil
+	}
+	if err := f.position(s.field(1), s.field(2), s.field(3), s.field(4)); err != nil {
+		return fmt.Errorf("gga: %w", err)
+	}
+	if f.hdop, err = optFloat(s.field(7)); err != nil {
+		return fmt.Errorf("gga hdop: %w", err)
+	}
+	if f.altitude, err = optFloat(s.field(8)); err != nil {
+		return fmt.Errorf("gga altitude: %w", err)
+	}
+	return nil
+}
+
+// applyRMC reads the status, position, speed, course and UTC date and time.
+func (f *fix) applyRMC(s sentence) error {
+	f.valid = s.field(1) == "A"
+	if !f.valid {
+		return nil
+	}
+	if err := f.position(s.field(2), s.field(3), s.field(4), s.field(5)); err != nil {
+		return fmt.Errorf("rmc: %w", err)
+	}
+	knots, err := optFloat(s.field(6))
+	if err != nil {
+		return fmt.Errorf("rmc speed: %w", err)
+	}
+	f.speed = knots * knotsToKmh
+	if f.course, err = optFloat(s.field(7)); err != nil {
+		return fmt.Errorf("rmc course: %w", err)
+	}
+	if t, err := parseTime(s.field(8), s.field(0)); err == nil {
+		f.time = t
+	}
+	return nil
+}
+
+// applyGSA reads the fix mode and the dilutions of precision.
+func (f *fix) applyGSA(s sentence) error {
+	switch s.field(1) {
+	case "2":
+		f.mode = "2d"
+	case "3":
+		f.mode = "3d"
+	default:
+		f.mode = "none"
+	}
+	var err error
+	if f.pdop, err = optFloat(s.field(14)); err != nil {
+		return fmt.Errorf("gsa pdop: %w", err)
+	}
+	if f.hdop, err = optFloat(s.field(15)); err != nil {
+		return fmt.Errorf("gsa hdop: %w", err)
+	}
+	if f.vdop, err = optFloat(s.field(16)); err != nil {
+		return fmt.Errorf("gsa vdop: %w", err)
+	}
+	return nil
+}
+
+func (f *fix) position(lat, ns, lon, ew string) error {
+	if lat == "" || lon == "" {
+		return nil
+	}
+	latitude, err := degrees(lat, 2)
+	if err != nil {
+		return fmt.Errorf("latitude: %w", err)
+	}
+	longitude, err := degrees(lon, 3)
+	if err != nil {
+		return fmt.Errorf("longitude: %w", err)
+	}
+	if ns == "S" {
+		latitude = -latitude
+	}
+	if ew == "W" {
+		longitude = -longitude
+	}
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return fmt.Errorf("position out of range: %s,%s", lat, lon)
+	}
+	f.latitude, f.longitude = latitude, longitude
+	return nil
+}
+
+// degrees converts ddmm.mmmm, or dddmm.mmmm with three degree digits, to
+// decimal degrees.
+func degrees(s string, digits int) (float64, error) {
+	if len(s) < digits+2 {
+		return 0, fmt.Errorf("too short: %q", s)
+	}
+	d, err := strconv.Atoi(s[:digits])
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.ParseFloat(s[digits:], 64)
+	if err != nil || m >= 60 {
+		return 0, fmt.Errorf("bad minutes: %q", s)
+	}
+	return float64(d) + m/60, nil
+}
+
+// parseTime combines an RMC date (ddmmyy) and time (hhmmss.ss) in UTC.
+func parseTime(date, clock string) (time.Time, error) {
+	if len(date) != 6 || len(clock) < 6 {
+		return time.Time{}, fmt.Errorf("bad date or time: %q %q", date, clock)
+	}
+	t, err := time.Parse("020106150405", date+clock[:6])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(clock) > 7 && clock[6] == '.' {
+		frac, err := strconv.ParseFloat("0"+clock[6:], 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		t = t.Add(time.Duration(frac * float64(time.Second)))
+	}
+	return t, nil
+}
+
+func optInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func optFloat(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,93 @@
+package gps
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recording is a receiver acquiring a fix: a search without position, then
+// a 3D fix and a DGPS fix on the other side of the globe, with a GSV
+// sentence in between that is skipped.
+const recording = `$GPGGA,101500.00,,,,,0,03,,,,,,,*4E
+$GPRMC,101500.00,V,,,,,,,180326,,,N*76
+$GPGSA,A,1,,,,,,,,,,,,,99.99,99.99,99.99*30
+$GNGGA,101501.00,4807.0380,N,01131.0000,E,1,08,0.9,545.4,M,46.9,M,,*7E
+$GNRMC,101501.00,A,4807.0380,N,01131.0000,E,22.4,84.4,180326,003.1,W,A*3F
+$GNGSA,A,3,04,05,09,12,24,25,29,31,,,,,1.8,0.9,1.5*2B
+$GPGSV,3,1,11,03,03,111,00,04,15,270,00,06,01,010,00,13,06,292,00*74
+`
+
+func TestParseSentence(t *testing.T) {
+	s, err := parseSentence("$GNGSA,A,3,04,05,09,12,24,25,29,31,,,,,1.8,0.9,1.5*2B\r\n")
+	if err != nil || s.typ != "GSA" || len(s.fields) != 17 || s.field(1) != "3" || s.field(40) != "" {
+		t.Fatalf("parseSentence = %+v, %v", s, err)
+	}
+	if s, err := parseSentence("$GPRMC,101500.00,V,,,,,,,180326,,,N"); err != nil || s.typ != "RMC" {
+		t.Errorf("without checksum = %+v, %v", s, err)
+	}
+	for _, line := range []string{
+		"$GNGSA,A,3,04,05,09,12,24,25,29,31,,,,,1.8,0.9,1.5*2C",
+		"$GNGSA,A,3,04,05,09,12,24,25,29,31,,,,,1.8,0.9,1.5*2",
+		"GNGSA,A,3*2B",
+		"$GNGS,A,3,04,05,09,12,24,25,29,31",
+		"",
+	} {
+		if _, err := parseSentence(line); err == nil {
+			t.Errorf("parseSentence(%q): no error", line)
+		}
+	}
+}
+
+func TestFixApply(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(recording), "\n")
+	var f fix
+	for _, line := range lines[:3] {
+		s, err := parseSentence(line)
+		if err != nil {
+			t.Fatalf("parseSentence(%q): %v", line, err)
+		}
+		if err := f.apply(s); err != nil {
+			t.Fatalf("apply(%q): %v", line, err)
+		}
+	}
+	if f.valid || f.quality != 0 || f.mode != "none" || f.satellites != 3 || f.latitude != 0 {
+		t.Fatalf("searching = %+v", f)
+	}
+
+	for _, line := range lines[3:] {
+		s, _ := parseSentence(line)
+		if err := f.apply(s); err != nil && !(s.typ == "GSV" && err == errUnsupported) {
+			t.Fatalf("apply(%q): %v", line, err)
+		}
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+	if !f.valid || f.quality != 1 || f.mode != "3d" || f.satellites != 8 ||
+		!near(f.latitude, 48.1173) || !near(f.longitude, 11.516666666) || f.altitude != 545.4 ||
+		!near(f.speed, 41.4848) || f.course != 84.4 || f.hdop != 0.9 || f.pdop != 1.8 || f.vdop != 1.5 {
+		t.Fatalf("fix = %+v", f)
+	}
+	if want := time.Date(2026, 3, 18, 10, 15, 1, 0, time.UTC); !f.time.Equal(want) {
+		t.Errorf("time = %v", f.time)
+	}
+
+	s, _ := parseSentence("$GNGGA,101502.00,3351.8512,S,15112.5104,W,2,11,0.7,12.0,M,20.1,M,1.2,0101*6F")
+	if err := f.apply(s); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if f.quality != 2 || !near(f.latitude, -33.86418666) || !near(f.longitude, -151.20850666) || f.satellites != 11 {
+		t.Fatalf("southern fix = %+v", f)
+	}
+
+	for _, line := range []string{
+		"$GPGGA,101503.00,9107.0380,N,01131.0000,E,1,08,0.9,545.4,M,46.9,M,,",
+		"$GPGGA,101503.00,4867.0380,N,01131.0000,E,1,08,0.9,545.4,M,46.9,M,,",
+		"$GPRMC,101503.00,A,4807.0380,N,01131.0000,E,fast,84.4,180326,,,A",
+	} {
+		s, _ := parseSentence(line)
+		if err := f.apply(s); err == nil {
+			t.Errorf("apply(%q): no error", line)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package graphite flattens snapshots into dotted metric paths as used by
+// Graphite and StatsD, and encodes them in the Graphite plaintext protocol.
+package graphite
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// DefaultPrefix puts every metric below the agent and the host name.
+const DefaultPrefix = "edgebeat.{hostname}"
+
+// Metric is one value below a dotted path.
+type Metric struct {
+	Path  string
+	Value float64
+}
+
+// Flatten converts a snapshot into metrics. Entity names such as devices,
+// mountpoints and sensors become single path nodes, see Sanitize. Metrics with
+// a NaN or infinite value are left out.
+func Flatten(info utils.SystemInfo) []Metric {
+	var metrics []Metric
+	add := func(value float64, nodes ...string) {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+		metrics = append(metrics, Metric{Path: strings.Join(nodes, "."), Value: value})
+	}
+
+	add(info.CPU.TotalPercent, "cpu", "total", "percent")
+	for i, percent := range info.CPU.PerCPUPercent {
+		add(percent, "cpu", "cpu"+strconv.Itoa(i), "percent")
+	}
+	times := info.CPU.TotalTimes
+	add(times.User, "cpu", "total", "time", "user")
+	add(times.System, "cpu", "total", "time", "system")
+	add(times.Idle, "cpu", "total", "time", "idle")
+	add(times.Nice, "cpu", "total", "time", "nice")
+	add(times.Iowait, "cpu", "total", "time", "iowait")
+	add(times.Irq, "cpu", "total", "time", "irq")
+	add(times.SoftIrq, "cpu", "total", "time", "softirq")
+	add(times.Steal, "cpu", "total", "time", "steal")
+
+	add(info.Load.Load1, "load", "load1")
+	add(info.Load.Load5, "load", "load5")
+	add(info.Load.Load15, "load", "load15")
+
+	vm := info.Memory.Virtual
+	add(float64(vm.Total), "memory", "total")
+	add(float64(vm.Available), "memory", "available")
+	add(float64(vm.Used), "memory", "used")
+	add(float64(vm.Free), "memory", "free")
+	add(float64(vm.Buffers), "memory", "buffers")
+	add(float64(vm.Cached), "memory", "cached")
+	add(vm.UsedPercent, "memory", "used_percent")
+	swap := info.Memory.Swap
+	add(float64(swap.Total), "swap", "total")
+	add(float64(swap.Used), "swap", "used")
+	add(float64(swap.Free), "swap", "free")
+	add(swap.UsedPercent, "swap", "used_percent")
+
+	for _, u := range info.Disk.Usage {
+		node := Sanitize(u.Mountpoint)
+		add(float64(u.Total), "disk", node, "total")
+		add(float64(u.Used), "disk", node, "used")
+		add(float64(u.Free), "disk", node, "free")
+		add(u.UsedPercent, "disk", node, "used_percent")
+	}
+	for _, io := range info.Disk.IO {
+		node := Sanitize(io.Device)
+		add(float64(io.ReadBytes), "diskio", node, "read_bytes")
+		add(float64(io.WriteBytes), "diskio", node, "write_bytes")
+		add(float64(io.ReadCount), "diskio", node, "reads")
+		add(float64(io.WriteCount), "diskio", node, "writes")
+	}
+
+	net := info.Network.Totals
+	add(float64(net.BytesSent), "net", "bytes_sent")
+	add(float64(net.BytesRecv), "net", "bytes_recv")
+	add(float64(net.PacketsSent), "net", "packets_sent")
+	add(float64(net.PacketsRecv), "net", "packets_recv")
+	add(float64(net.Errin), "net", "err_in")
+	add(float64(net.Errout), "net", "err_out")
+	add(float64(net.Dropin), "net", "drop_in")
+	add(float64(net.Dropout), "net", "drop_out")
+
+	add(float64(info.Host.UptimeSeconds), "host", "uptime_seconds")
+	add(float64(info.Host.Procs), "host", "procs")
+	add(float64(len(info.Errors)), "host", "collect_errors")
+
+	for _, t := range info.Sensors.Temperatures {
+		add(t.Value, "sensors", "temperature", Sanitize(t.SensorKey))
+	}
+	for _, f := range info.Sensors.Fans {
+		add(f.Value, "sensors", "fan", Sanitize(f.SensorKey))
+	}
+	for _, r := range info.Sensors.Readings {
+		add(r.Value, "sensors", Sanitize(r.Type), Sanitize(r.SensorKey))
+	}
+	return metrics
+}
+
+// Sanitize turns s into a single path node: letters, digits, '-' and '_' are
+// kept, everything else becomes '_', and leading or trailing '_' are trimmed.
+// The root mountpoint "/" becomes "root".
+func Sanitize(s string) string {
+	if s == "/" {
+		return "root"
+	}
+	out := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+	out = strings.Trim(out, "_")
+	if out == "" {
+		return "unknown"
+	}
+	return out
+}
+
+// Prefix expands {hostname} in template with the sanitized host name, so the
+// dots of a fully qualified name do not create extra levels. Empty nodes are
+// dropped.
+func Prefix(template, hostname string) string {
+	expanded := strings.ReplaceAll(template, "{hostname}", Sanitize(hostname))
+	var nodes []string
+	for _, node := range strings.Split(expanded, ".") {
+		if node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+	return strings.Join(nodes, ".")
+}
+
+// Join returns path below prefix.
+func Join(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+	return prefix + "." + path
+}
+
+// Encode renders metrics as plaintext protocol lines below prefix.
+func Encode(metrics []Metric, prefix string, ts time.Time) []byte {
+	var b strings.Builder
+	stamp := strconv.FormatInt(ts.Unix(), 10)
+	for _, m := range metrics {
+		b.WriteString(Join(prefix, m.Path))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(m.Value, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(stamp)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
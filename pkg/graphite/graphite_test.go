@@ -0,0 +1,56 @@
+package graphite
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func TestFlattenAndEncode(t *testing.T) {
+	info := utils.SystemInfo{
+		CPU:  utils.CPUStats{TotalPercent: 12.5, PerCPUPercent: []float64{10}},
+		Disk: utils.DiskStats{Usage: []utils.DiskUsage{{Mountpoint: "/", Used: 10}, {Mountpoint: "/var/log", UsedPercent: math.NaN()}}},
+		Sensors: utils.SensorsStats{
+			Temperatures: []utils.Temperature{{SensorKey: "coretemp Package id 0", Value: 48.2}},
+			Readings:     []utils.SensorReading{{SensorKey: "bme280_humidity", Type: "humidityrelative", Value: 41.5, Unit: "%"}},
+		},
+	}
+
+	out := string(Encode(Flatten(info), Prefix(DefaultPrefix, "edge-01.plant.local"), time.Unix(1707993105, 0)))
+	want := []string{
+		"edgebeat.edge-01_plant_local.cpu.total.percent 12.5 1707993105\n",
+		"edgebeat.edge-01_plant_local.cpu.cpu0.percent 10 1707993105\n",
+		"edgebeat.edge-01_plant_local.disk.root.used 10 1707993105\n",
+		"edgebeat.edge-01_plant_local.disk.var_log.total 0 1707993105\n",
+		"edgebeat.edge-01_plant_local.sensors.temperature.coretemp_Package_id_0 48.2 1707993105\n",
+		"edgebeat.edge-01_plant_local.sensors.humidityrelative.bme280_humidity 41.5 1707993105\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("missing %q in\n%s", w, out)
+		}
+	}
+	if strings.Contains(out, "var_log.used_percent") {
+		t.Error("NaN value was not dropped")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	cases := map[string]string{
+		"edgebeat.{hostname}":         "edgebeat.edge-01",
+		"plant.a..{hostname}.system.": "plant.a.edge-01.system",
+		"":                            "",
+		"{hostname}":                  "edge-01",
+	}
+	for template, want := range cases {
+		if got := Prefix(template, "edge-01"); got != want {
+			t.Errorf("Prefix(%q) = %q, want %q", template, got, want)
+		}
+	}
+	if got := Join("", "cpu.total"); got != "cpu.total" {
+		t.Errorf("Join = %q", got)
+	}
+}
@@ -1,32 +1,78 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jilanisayyad/edgebeat/pkg/config"
 	"github.com/jilanisayyad/edgebeat/pkg/controller"
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
+	"github.com/jilanisayyad/edgebeat/pkg/mqtt"
+	"github.com/jilanisayyad/edgebeat/pkg/sink"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
 )
 
+// integrationTestTimeout bounds a connection test below the write timeout of
+// the REST server.
+const integrationTestTimeout = 4 * time.Second
+
 // ResponseWithMetadata wraps the metric with timestamp
 type ResponseWithMetadata struct {
 	Timestamp string      `json:"timestamp"`
 	Data      interface{} `json:"data"`
 }
 
+// BrokerStatusSource reports the state of the MQTT broker connections
+type BrokerStatusSource interface {
+	Status() mqtt.GroupStatus
+}
+
+// SinkStatusSource reports the publish counters of every output sink
+type SinkStatusSource interface {
+	Status() []sink.Status
+}
+
+// IntegrationStatusSource reports the live state of a polled integration and
+// tests its connection on demand
+type IntegrationStatusSource interface {
+	Status() utils.IntegrationStatus
+	Test(ctx context.Context) error
+}
+
 // Handler wraps the store and provides metric-specific endpoints
 type Handler struct {
 	store        *controller.Store
 	integrations config.IntegrationConfig
+	brokers      BrokerStatusSource
+	sinks        SinkStatusSource
+	live         map[string]IntegrationStatusSource
 }
 
 // New creates a new handler with the given store
 func New(store *controller.Store, integrations config.IntegrationConfig) *Handler {
-	return &Handler{store: store, integrations: integrations}
+	return &Handler{store: store, integrations: integrations, live: make(map[string]IntegrationStatusSource)}
+}
+
+// SetBrokerStatusSource enables the /mqtt/brokers endpoint
+func (h *Handler) SetBrokerStatusSource(src BrokerStatusSource) {
+	h.brokers = src
+}
+
+// SetSinkStatusSource enables the /sinks endpoint
+func (h *Handler) SetSinkStatusSource(src SinkStatusSource) {
+	h.sinks = src
+}
+
+// SetIntegrationStatusSource adds the live state of the modbus or opcua
+// integration to /integrations and enables its connection test
+func (h *Handler) SetIntegrationStatusSource(name string, src IntegrationStatusSource) {
+	h.live[name] = src
 }
 
 // writeJSON handles common JSON response logic
@@ -46,128 +92,140 @@ func (h *Handler) checkMethod(w http.ResponseWriter, r *http.Request, allowed st
 	return true
 }
 
-// getFullMetrics returns full system metrics
+// negotiate picks the encoder for the Accept header of r. It answers 406
+// with the supported types and returns false when none is acceptable.
+func (h *Handler) negotiate(w http.ResponseWriter, r *http.Request) (encoding.Encoder, bool) {
+	w.Header().Set("Vary", "Accept")
+	enc, ok := encoding.Negotiate(r.Header.Get("Accept"))
+	if !ok {
+		h.writeJSON(w, map[string]interface{}{
+			"error":     "not acceptable",
+			"supported": encoding.ContentTypes(),
+		}, http.StatusNotAcceptable)
+	}
+	return enc, ok
+}
+
+// getFullMetrics returns full system metrics in the encoding negotiated
+// through the Accept header
 func (h *Handler) getFullMetrics(w http.ResponseWriter, r *http.Request) {
 	if !h.checkMethod(w, r, http.MethodGet) {
 		return
 	}
 
-	payload, ok := h.store.Get()
+	enc, ok := h.negotiate(w, r)
 	if !ok {
-		h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_, _ = w.Write(payload)
-}
-
-// getCPUMetrics returns only CPU metrics
-func (h *Handler) getCPUMetrics(w http.ResponseWriter, r *http.Request) {
-	if !h.checkMethod(w, r, http.MethodGet) {
+	if enc.Name() == encoding.JSON {
+		payload, ok := h.store.Get()
+		if !ok {
+			h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", enc.ContentType())
+		_, _ = w.Write(payload)
 		return
 	}
 
-	data, ok := h.store.GetCPU()
+	info, ok := h.store.GetInfo()
 	if !ok {
 		h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
 		return
 	}
-
-	h.writeJSON(w, ResponseWithMetadata{
-		Timestamp: data.Timestamp,
-		Data:      data.CPU,
-	}, http.StatusOK)
+	h.writeEncoded(w, enc, *info)
 }
 
-// getMemoryMetrics returns only memory metrics
-func (h *Handler) getMemoryMetrics(w http.ResponseWriter, r *http.Request) {
-	if !h.checkMethod(w, r, http.MethodGet) {
+// writeEncoded writes info in a non-JSON encoding.
+func (h *Handler) writeEncoded(w http.ResponseWriter, enc encoding.Encoder, info utils.SystemInfo) {
+	payload, err := enc.Encode(info)
+	if err != nil {
+		h.writeJSON(w, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", enc.ContentType())
+	_, _ = w.Write(payload)
+}
 
-	data, ok := h.store.GetMemory()
-	if !ok {
-		h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
+// writeSection answers a per-section endpoint in the negotiated encoding.
+// JSON wraps the section in ResponseWithMetadata; other encodings carry a
+// snapshot with only the timestamp and the section, so clients decode it
+// with the same schema as the full snapshot.
+func (h *Handler) writeSection(w http.ResponseWriter, r *http.Request, get func() (*utils.SystemInfo, bool), section func(info *utils.SystemInfo, out *utils.SystemInfo) any) {
+	if !h.checkMethod(w, r, http.MethodGet) {
 		return
 	}
 
-	h.writeJSON(w, ResponseWithMetadata{
-		Timestamp: data.Timestamp,
-		Data:      data.Memory,
-	}, http.StatusOK)
-}
-
-// getDiskMetrics returns only disk metrics
-func (h *Handler) getDiskMetrics(w http.ResponseWriter, r *http.Request) {
-	if !h.checkMethod(w, r, http.MethodGet) {
+	enc, ok := h.negotiate(w, r)
+	if !ok {
 		return
 	}
 
-	data, ok := h.store.GetDisk()
+	data, ok := get()
 	if !ok {
 		h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
 		return
 	}
 
+	out := utils.SystemInfo{Timestamp: data.Timestamp}
+	value := section(data, &out)
+	if enc.Name() != encoding.JSON {
+		h.writeEncoded(w, enc, out)
+		return
+	}
 	h.writeJSON(w, ResponseWithMetadata{
 		Timestamp: data.Timestamp,
-		Data:      data.Disk,
+		Data:      value,
 	}, http.StatusOK)
 }
 
-// getNetworkMetrics returns only network metrics
-func (h *Handler) getNetworkMetrics(w http.ResponseWriter, r *http.Request) {
-	if !h.checkMethod(w, r, http.MethodGet) {
-		return
-	}
+// getCPUMetrics returns only CPU metrics
+func (h *Handler) getCPUMetrics(w http.ResponseWriter, r *http.Request) {
+	h.writeSection(w, r, h.store.GetCPU, func(info, out *utils.SystemInfo) any {
+		out.CPU = info.CPU
+		return info.CPU
+	})
+}
 
-	data, ok := h.store.GetNetwork()
-	if !ok {
-		h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
-		return
-	}
+// getMemoryMetrics returns only memory metrics
+func (h *Handler) getMemoryMetrics(w http.ResponseWriter, r *http.Request) {
+	h.writeSection(w, r, h.store.GetMemory, func(info, out *utils.SystemInfo) any {
+		out.Memory = info.Memory
+		return info.Memory
+	})
+}
 
-	h.writeJSON(w, ResponseWithMetadata{
-		Timestamp: data.Timestamp,
-		Data:      data.Network,
-	}, http.StatusOK)
+// getDiskMetrics returns only disk metrics
+func (h *Handler) getDiskMetrics(w http.ResponseWriter, r *http.Request) {
+	h.writeSection(w, r, h.store.GetDisk, func(info, out *utils.SystemInfo) any {
+		out.Disk = info.Disk
+		return info.Disk
+	})
+}
+
+// getNetworkMetrics returns only network metrics
+func (h *Handler) getNetworkMetrics(w http.ResponseWriter, r *http.Request) {
+	h.writeSection(w, r, h.store.GetNetwork, func(info, out *utils.SystemInfo) any {
+		out.Network = info.Network
+		return info.Network
+	})
 }
 
 // getSystemMetrics returns only system metrics
 func (h *Handler) getSystemMetrics(w http.ResponseWriter, r *http.Request) {
-	if !h.checkMethod(w, r, http.MethodGet) {
-		return
-	}
-
-	data, ok := h.store.GetSystem()
-	if !ok {
-		h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
-		return
-	}
-
-	h.writeJSON(w, ResponseWithMetadata{
-		Timestamp: data.Timestamp,
-		Data:      data.Host,
-	}, http.StatusOK)
+	h.writeSection(w, r, h.store.GetSystem, func(info, out *utils.SystemInfo) any {
+		out.Host = info.Host
+		return info.Host
+	})
 }
 
 // getSensorMetrics returns only sensor metrics
 func (h *Handler) getSensorMetrics(w http.ResponseWriter, r *http.Request) {
-	if !h.checkMethod(w, r, http.MethodGet) {
-		return
-	}
-
-	data, ok := h.store.GetSensors()
-	if !ok {
-		h.writeJSON(w, map[string]string{"error": "no data available"}, http.StatusServiceUnavailable)
-		return
-	}
-
-	h.writeJSON(w, ResponseWithMetadata{
-		Timestamp: data.Timestamp,
-		Data:      data.Sensors,
-	}, http.StatusOK)
+	h.writeSection(w, r, h.store.GetSensors, func(info, out *utils.SystemInfo) any {
+		out.Sensors = info.Sensors
+		return info.Sensors
+	})
 }
 
 type ModbusCapability struct {
@@ -175,9 +233,16 @@ type ModbusCapability struct {
 	Mode           string   `json:"mode"`
 	Host           string   `json:"host"`
 	Port           int      `json:"port"`
+	SerialPort     string   `json:"serial_port,omitempty"`
+	BaudRate       int      `json:"baud_rate,omitempty"`
+	DataBits       int      `json:"data_bits,omitempty"`
+	Parity         string   `json:"parity,omitempty"`
+	StopBits       int      `json:"stop_bits,omitempty"`
 	UnitID         int      `json:"unit_id"`
 	RequiredFields []string `json:"required_fields"`
 	Notes          string   `json:"notes,omitempty"`
+
+	Status *utils.IntegrationStatus `json:"status,omitempty"`
 }
 
 type OPCUACapability struct {
@@ -187,13 +252,30 @@ type OPCUACapability struct {
 	SecurityMode       string   `json:"security_mode"`
 	UsernameConfigured bool     `json:"username_configured"`
 	PasswordConfigured bool     `json:"password_configured"`
+	Nodes              int      `json:"nodes"`
+	Subscribe          bool     `json:"subscribe"`
 	RequiredFields     []string `json:"required_fields"`
 	Notes              string   `json:"notes,omitempty"`
+
+	Status *utils.IntegrationStatus `json:"status,omitempty"`
+}
+
+type SNMPCapability struct {
+	Enabled        bool     `json:"enabled"`
+	Targets        int      `json:"targets"`
+	Objects        int      `json:"objects"`
+	TimeoutMS      int      `json:"timeout_ms"`
+	Retries        int      `json:"retries"`
+	RequiredFields []string `json:"required_fields"`
+	Notes          string   `json:"notes,omitempty"`
+
+	Status *utils.IntegrationStatus `json:"status,omitempty"`
 }
 
 type IntegrationCapabilities struct {
 	Modbus ModbusCapability `json:"modbus"`
 	OPCUA  OPCUACapability  `json:"opcua"`
+	SNMP   SNMPCapability   `json:"snmp"`
 }
 
 func (h *Handler) getIntegrations(w http.ResponseWriter, r *http.Request) {
@@ -225,14 +307,121 @@ func (h *Handler) getIntegrations(w http.ResponseWriter, r *http.Request) {
 			SecurityMode:       h.integrations.OPCUA.SecurityMode,
 			UsernameConfigured: h.integrations.OPCUA.Username != "",
 			PasswordConfigured: h.integrations.OPCUA.Password != "",
+			Nodes:              len(h.integrations.OPCUA.Nodes),
+			Subscribe:          h.integrations.OPCUA.Subscribe,
 			RequiredFields:     opcuaRequired,
 			Notes:              h.integrations.OPCUA.Notes,
 		},
+		SNMP: SNMPCapability{
+			Enabled:        h.integrations.SNMP.Enabled,
+			Targets:        len(h.integrations.SNMP.Targets),
+			TimeoutMS:      h.integrations.SNMP.TimeoutMS,
+			Retries:        h.integrations.SNMP.Retries,
+			RequiredFields: snmpRequiredFields(h.integrations.SNMP.Targets),
+			Notes:          h.integrations.SNMP.Notes,
+		},
 	}
+	for _, t := range h.integrations.SNMP.Targets {
+		resp.SNMP.Objects += len(t.Objects)
+	}
+
+	if m := h.integrations.Modbus; strings.EqualFold(m.Mode, "rtu") {
+		resp.Modbus.SerialPort = m.SerialPort
+		resp.Modbus.BaudRate = m.BaudRate
+		resp.Modbus.DataBits = m.DataBits
+		resp.Modbus.Parity = m.Parity
+		resp.Modbus.StopBits = m.StopBits
+	}
+	resp.Modbus.Status = h.liveStatus("modbus")
+	resp.OPCUA.Status = h.liveStatus("opcua")
+	resp.SNMP.Status = h.liveStatus("snmp")
 
 	h.writeJSON(w, resp, http.StatusOK)
 }
 
+func (h *Handler) liveStatus(name string) *utils.IntegrationStatus {
+	src, ok := h.live[name]
+	if !ok {
+		return nil
+	}
+	status := src.Status()
+	return &status
+}
+
+// IntegrationTestResult is the outcome of an on-demand connection test
+type IntegrationTestResult struct {
+	Name      string  `json:"name"`
+	OK        bool    `json:"ok"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	TestedAt  string  `json:"tested_at"`
+}
+
+// testIntegration connects to the device of an enabled integration and
+// reports whether it answered
+func (h *Handler) testIntegration(w http.ResponseWriter, r *http.Request) {
+	if !h.checkMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	name := r.PathValue("name")
+	if name != "modbus" && name != "opcua" && name != "snmp" {
+		h.writeJSON(w, map[string]string{"error": "unknown integration"}, http.StatusNotFound)
+		return
+	}
+	src, ok := h.live[name]
+	if !ok {
+		h.writeJSON(w, map[string]string{"error": name + " is not enabled"}, http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), integrationTestTimeout)
+	defer cancel()
+	start := time.Now()
+	err := src.Test(ctx)
+	result := IntegrationTestResult{
+		Name:      name,
+		OK:        err == nil,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		TestedAt:  start.UTC().Format(time.RFC3339),
+	}
+	statusCode := http.StatusOK
+	if err != nil {
+		result.Error = err.Error()
+		statusCode = http.StatusBadGateway
+	}
+
+	h.writeJSON(w, result, statusCode)
+}
+
+// getBrokers returns the connection state of every configured MQTT broker
+func (h *Handler) getBrokers(w http.ResponseWriter, r *http.Request) {
+	if !h.checkMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	if h.brokers == nil {
+		h.writeJSON(w, map[string]string{"error": "mqtt is not enabled"}, http.StatusNotFound)
+		return
+	}
+
+	h.writeJSON(w, h.brokers.Status(), http.StatusOK)
+}
+
+// getSinks returns the publish counters of every configured output
+func (h *Handler) getSinks(w http.ResponseWriter, r *http.Request) {
+	if !h.checkMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	statuses := []sink.Status{}
+	if h.sinks != nil {
+		statuses = h.sinks.Status()
+	}
+
+	h.writeJSON(w, map[string][]sink.Status{"sinks": statuses}, http.StatusOK)
+}
+
 const (
 	defaultFabricateBytes uint64 = 1024
 	maxFabricateBytes     uint64 = 1 << 30
@@ -376,6 +565,29 @@ func opcuaRequiredFields(securityMode string, usernameSet bool, passwordSet bool
 	return required
 }
 
+func snmpRequiredFields(targets []config.SNMPTarget) []string {
+	required := []string{
+		"targets.name",
+		"targets.host",
+		"targets.version",
+		"targets.objects",
+	}
+
+	var v2c, v3 bool
+	for _, t := range targets {
+		v2c = v2c || t.Version != "3"
+		v3 = v3 || t.Version == "3"
+	}
+	if v2c {
+		required = append(required, "targets.community")
+	}
+	if v3 {
+		required = append(required, "targets.user")
+	}
+
+	return required
+}
+
 // RegisterRoutes registers all metric endpoints to the mux
 func (h *Handler) RegisterRoutes(mux *http.ServeMux, basePrefix string) {
 	if mux == nil {
@@ -396,6 +608,9 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux, basePrefix string) {
 	mux.HandleFunc(prefix+"/metrics/system", h.getSystemMetrics)
 	mux.HandleFunc(prefix+"/metrics/sensors", h.getSensorMetrics)
 	mux.HandleFunc(prefix+"/integrations", h.getIntegrations)
+	mux.HandleFunc(prefix+"/integrations/{name}/test", h.testIntegration)
+	mux.HandleFunc(prefix+"/mqtt/brokers", h.getBrokers)
+	mux.HandleFunc(prefix+"/sinks", h.getSinks)
 	mux.HandleFunc(prefix+"/data/fabricate", h.getFabricatedPayload)
 
 	// Health check endpoint (minimal)
@@ -1,15 +1,21 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/jilanisayyad/edgebeat/pkg/config"
 	"github.com/jilanisayyad/edgebeat/pkg/controller"
+	"github.com/jilanisayyad/edgebeat/pkg/mqtt"
+	"github.com/jilanisayyad/edgebeat/pkg/sink"
 	"github.com/jilanisayyad/edgebeat/pkg/utils"
 )
 
@@ -124,6 +130,35 @@ func TestGetFullMetrics(t *testing.T) {
 	}
 }
 
+func TestGetFullMetricsAccept(t *testing.T) {
+	store, info, _ := seedStore(t)
+	h := New(store, config.IntegrationConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Accept", "application/json;q=0.5, application/cbor")
+	rec := httptest.NewRecorder()
+	h.getFullMetrics(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/cbor" {
+		t.Fatalf("status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got utils.SystemInfo
+	if err := cbor.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("cbor: %v", err)
+	}
+	if got.Host.Hostname != info.Host.Hostname || got.CPU.TotalPercent != info.CPU.TotalPercent {
+		t.Fatalf("decoded = %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Accept", "text/html")
+	rec = httptest.NewRecorder()
+	h.getFullMetrics(rec, req)
+	if rec.Code != http.StatusNotAcceptable || !strings.Contains(rec.Body.String(), "application/x-protobuf") {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestGetFullMetricsNoData(t *testing.T) {
 	h := New(controller.NewStore(), config.IntegrationConfig{})
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
@@ -155,10 +190,64 @@ func TestGetCPUMetrics(t *testing.T) {
 	}
 }
 
+func TestSectionEndpointsAccept(t *testing.T) {
+	store, info, _ := seedStore(t)
+	h := New(store, config.IntegrationConfig{})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, "")
+
+	for path, check := range map[string]func(got utils.SystemInfo) bool{
+		"/metrics/cpu": func(got utils.SystemInfo) bool {
+			return got.CPU.TotalPercent == info.CPU.TotalPercent && got.Host.Hostname == ""
+		},
+		"/metrics/memory":  func(got utils.SystemInfo) bool { return got.Memory.Virtual.Total == 1 && got.CPU.TotalPercent == 0 },
+		"/metrics/disk":    func(got utils.SystemInfo) bool { return len(got.Disk.Partitions) == 1 },
+		"/metrics/network": func(got utils.SystemInfo) bool { return got.Network.Totals.BytesSent == 1 },
+		"/metrics/system":  func(got utils.SystemInfo) bool { return got.Host.Hostname == "test-host" },
+		"/metrics/sensors": func(got utils.SystemInfo) bool { return len(got.Sensors.Temperatures) == 1 },
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/cbor")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/cbor" {
+			t.Fatalf("%s: status = %d, content type %q", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		var got utils.SystemInfo
+		if err := cbor.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: cbor: %v", path, err)
+		}
+		if got.Timestamp != info.Timestamp || !check(got) {
+			t.Errorf("%s: decoded = %+v", path, got)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/json")
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var resp metaResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Timestamp != info.Timestamp || len(resp.Data) == 0 {
+			t.Errorf("%s: json = %s", path, rec.Body.String())
+		}
+
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "text/html")
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotAcceptable || rec.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s: status = %d", path, rec.Code)
+		}
+	}
+}
+
 func TestGetIntegrations(t *testing.T) {
 	integrations := config.IntegrationConfig{
 		Modbus: config.ModbusConfig{Enabled: true, Mode: "tcp", Host: "localhost", Port: 502, UnitID: 1, Notes: "note"},
 		OPCUA:  config.OPCUAConfig{Enabled: true, Endpoint: "opc.tcp://localhost:4840", SecurityPolicy: "None", SecurityMode: "None"},
+		SNMP: config.SNMPConfig{Enabled: true, TimeoutMS: 2000, Retries: 1, Targets: []config.SNMPTarget{
+			{Name: "switch", Host: "10.0.0.2", Version: "2c", Objects: make([]config.SNMPObject, 2)},
+			{Name: "ups", Host: "10.0.0.3", Version: "3", Objects: make([]config.SNMPObject, 1)},
+		}},
 	}
 	h := New(controller.NewStore(), integrations)
 	req := httptest.NewRequest(http.MethodGet, "/integrations", nil)
@@ -168,6 +257,147 @@ func TestGetIntegrations(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("status = %d", rec.Code)
 	}
+	var caps IntegrationCapabilities
+	if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if s := caps.SNMP; !s.Enabled || s.Targets != 2 || s.Objects != 3 ||
+		!slices.Contains(s.RequiredFields, "targets.community") || !slices.Contains(s.RequiredFields, "targets.user") {
+		t.Fatalf("SNMP = %+v", s)
+	}
+}
+
+type staticIntegration struct {
+	status utils.IntegrationStatus
+	err    error
+}
+
+func (s staticIntegration) Status() utils.IntegrationStatus { return s.status }
+
+func (s staticIntegration) Test(context.Context) error { return s.err }
+
+func TestIntegrationStatus(t *testing.T) {
+	h := New(controller.NewStore(), config.IntegrationConfig{
+		Modbus: config.ModbusConfig{Enabled: true, Mode: "tcp", Host: "plc", Port: 502, UnitID: 1},
+	})
+	h.SetIntegrationStatusSource("modbus", staticIntegration{
+		status: utils.IntegrationStatus{Connected: false, Polls: 4, FailedPolls: 1, LastError: "register a: i/o timeout"},
+		err:    errors.New("register a: i/o timeout"),
+	})
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux, "")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/integrations", nil))
+	var caps IntegrationCapabilities
+	if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if caps.Modbus.Status == nil || caps.Modbus.Status.Polls != 4 || caps.Modbus.Status.LastError == "" || caps.OPCUA.Status != nil {
+		t.Fatalf("caps = %+v", caps)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/integrations/modbus/test", nil))
+	var result IntegrationTestResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if rec.Code != http.StatusBadGateway || result.Name != "modbus" || result.OK || result.Error != "register a: i/o timeout" || result.TestedAt == "" {
+		t.Fatalf("status = %d, result = %+v", rec.Code, result)
+	}
+
+	h.SetIntegrationStatusSource("modbus", staticIntegration{})
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/integrations/modbus/test", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok":true`) {
+		t.Fatalf("status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+
+	for path, code := range map[string]int{
+		"/integrations/opcua/test":  http.StatusNotFound,
+		"/integrations/bacnet/test": http.StatusNotFound,
+	} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != code {
+			t.Errorf("%s: status = %d", path, rec.Code)
+		}
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/integrations/modbus/test", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status = %d", rec.Code)
+	}
+}
+
+type staticBrokerStatus mqtt.GroupStatus
+
+func (s staticBrokerStatus) Status() mqtt.GroupStatus {
+	return mqtt.GroupStatus(s)
+}
+
+func TestGetBrokers(t *testing.T) {
+	h := New(controller.NewStore(), config.IntegrationConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/mqtt/brokers", nil)
+	rec := httptest.NewRecorder()
+	h.getBrokers(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status without mqtt = %d", rec.Code)
+	}
+
+	h.SetBrokerStatusSource(staticBrokerStatus{
+		Mode: mqtt.BrokerModeFailover,
+		Brokers: []mqtt.BrokerStatus{
+			{Broker: "tcp://cloud:1883", Connected: false},
+			{Broker: "tcp://onprem:1883", Connected: true, Active: true, Published: 3},
+		},
+	})
+	rec = httptest.NewRecorder()
+	h.getBrokers(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	var resp mqtt.GroupStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if resp.Mode != mqtt.BrokerModeFailover || len(resp.Brokers) != 2 || !resp.Brokers[1].Active {
+		t.Fatalf("resp = %+v", resp)
+	}
+}
+
+type staticSinkStatus []sink.Status
+
+func (s staticSinkStatus) Status() []sink.Status {
+	return s
+}
+
+func TestGetSinks(t *testing.T) {
+	h := New(controller.NewStore(), config.IntegrationConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/sinks", nil)
+	rec := httptest.NewRecorder()
+	h.getSinks(rec, req)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"sinks":[]}` {
+		t.Fatalf("status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+
+	h.SetSinkStatusSource(staticSinkStatus{{Name: "mqtt", Type: "mqtt", Published: 2}, {Name: "archive", Type: "file", Failed: 1}})
+	rec = httptest.NewRecorder()
+	h.getSinks(rec, req)
+
+	var resp struct {
+		Sinks []sink.Status `json:"sinks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(resp.Sinks) != 2 || resp.Sinks[0].Published != 2 || resp.Sinks[1].Failed != 1 {
+		t.Fatalf("resp = %+v", resp)
+	}
 }
 
 func TestGetFabricatedPayload(t *testing.T) {
@@ -0,0 +1,280 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+const (
+	PrecisionNanoseconds  = "ns"
+	PrecisionMicroseconds = "us"
+	PrecisionMilliseconds = "ms"
+	PrecisionSeconds      = "s"
+)
+
+// Point is one line protocol entry. Field values are float64, int64, uint64,
+// bool or string.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any
+	Time        time.Time
+}
+
+// Points converts a snapshot into one point per measurement and entity. Every
+// point is tagged with the hostname; per entity points add device, mountpoint,
+// interface, cpu or sensor tags, and sensor values their type and unit.
+func Points(info utils.SystemInfo) []Point {
+	ts, err := time.Parse(time.RFC3339Nano, info.Timestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+
+	host := info.Host.Hostname
+	tags := func(kv ...string) map[string]string {
+		t := make(map[string]string, len(kv)/2+1)
+		if host != "" {
+			t["host"] = host
+		}
+		for i := 0; i+1 < len(kv); i += 2 {
+			if kv[i+1] != "" {
+				t[kv[i]] = kv[i+1]
+			}
+		}
+		return t
+	}
+
+	cpuTimes := info.CPU.TotalTimes
+	points := []Point{
+		{Measurement: "cpu", Tags: tags("cpu", "cpu-total"), Fields: map[string]any{
+			"usage_percent": info.CPU.TotalPercent,
+			"time_user":     cpuTimes.User,
+			"time_system":   cpuTimes.System,
+			"time_idle":     cpuTimes.Idle,
+			"time_iowait":   cpuTimes.Iowait,
+			"time_steal":    cpuTimes.Steal,
+		}},
+	}
+	for i, percent := range info.CPU.PerCPUPercent {
+		points = append(points, Point{Measurement: "cpu", Tags: tags("cpu", "cpu"+strconv.Itoa(i)), Fields: map[string]any{
+			"usage_percent": percent,
+		}})
+	}
+
+	points = append(points,
+		Point{Measurement: "system", Tags: tags(), Fields: map[string]any{
+			"load1":          info.Load.Load1,
+			"load5":          info.Load.Load5,
+			"load15":         info.Load.Load15,
+			"uptime_seconds": info.Host.UptimeSeconds,
+			"boot_time":      info.Host.BootTime,
+			"procs":          info.Host.Procs,
+			"collect_errors": int64(len(info.Errors)),
+		}},
+		Point{Measurement: "mem", Tags: tags(), Fields: map[string]any{
+			"total":        info.Memory.Virtual.Total,
+			"available":    info.Memory.Virtual.Available,
+			"used":         info.Memory.Virtual.Used,
+			"free":         info.Memory.Virtual.Free,
+			"buffers":      info.Memory.Virtual.Buffers,
+			"cached":       info.Memory.Virtual.Cached,
+			"used_percent": info.Memory.Virtual.UsedPercent,
+		}},
+		Point{Measurement: "swap", Tags: tags(), Fields: map[string]any{
+			"total":        info.Memory.Swap.Total,
+			"used":         info.Memory.Swap.Used,
+			"free":         info.Memory.Swap.Free,
+			"used_percent": info.Memory.Swap.UsedPercent,
+		}},
+	)
+
+	for _, u := range info.Disk.Usage {
+		points = append(points, Point{Measurement: "disk", Tags: tags("device", u.Device, "mountpoint", u.Mountpoint, "fstype", u.FSType), Fields: map[string]any{
+			"total":        u.Total,
+			"used":         u.Used,
+			"free":         u.Free,
+			"used_percent": u.UsedPercent,
+		}})
+	}
+	for _, io := range info.Disk.IO {
+		points = append(points, Point{Measurement: "diskio", Tags: tags("device", io.Device), Fields: map[string]any{
+			"read_bytes":    io.ReadBytes,
+			"write_bytes":   io.WriteBytes,
+			"reads":         io.ReadCount,
+			"writes":        io.WriteCount,
+			"read_time_ms":  io.ReadTimeMS,
+			"write_time_ms": io.WriteTimeMS,
+		}})
+	}
+
+	totals := info.Network.Totals
+	points = append(points, Point{Measurement: "net", Tags: tags("interface", "all"), Fields: map[string]any{
+		"bytes_sent":   totals.BytesSent,
+		"bytes_recv":   totals.BytesRecv,
+		"packets_sent": totals.PacketsSent,
+		"packets_recv": totals.PacketsRecv,
+		"err_in":       totals.Errin,
+		"err_out":      totals.Errout,
+		"drop_in":      totals.Dropin,
+		"drop_out":     totals.Dropout,
+	}})
+	for _, iface := range info.Network.Interfaces {
+		up := false
+		for _, flag := range iface.Flags {
+			if flag == "up" {
+				up = true
+			}
+		}
+		points = append(points, Point{Measurement: "net_interface", Tags: tags("interface", iface.Name), Fields: map[string]any{
+			"mtu":   int64(iface.MTU),
+			"up":    up,
+			"addrs": int64(len(iface.Addrs)),
+		}})
+	}
+
+	for _, t := range info.Sensors.Temperatures {
+		points = append(points, Point{Measurement: "temperature", Tags: tags("sensor", t.SensorKey), Fields: map[string]any{
+			"value":    t.Value,
+			"high":     t.High,
+			"critical": t.Critical,
+		}})
+	}
+	for _, f := range info.Sensors.Fans {
+		points = append(points, Point{Measurement: "fan", Tags: tags("sensor", f.SensorKey), Fields: map[string]any{
+			"rpm": f.Value,
+		}})
+	}
+	for _, r := range info.Sensors.Readings {
+		points = append(points, Point{Measurement: "sensor", Tags: tags("sensor", r.SensorKey, "type", r.Type, "unit", r.Unit), Fields: map[string]any{
+			"value": r.Value,
+		}})
+	}
+
+	for i := range points {
+		points[i].Time = ts
+	}
+	return points
+}
+
+// Encode renders points as line protocol with timestamps in precision. Points
+// without any representable field are skipped.
+func Encode(points []Point, precision string) ([]byte, error) {
+	var b strings.Builder
+	for _, p := range points {
+		if err := appendPoint(&b, p, precision); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+func appendPoint(b *strings.Builder, p Point, precision string) error {
+	fieldKeys := make([]string, 0, len(p.Fields))
+	for k, v := range p.Fields {
+		if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			continue
+		}
+		fieldKeys = append(fieldKeys, k)
+	}
+	if len(fieldKeys) == 0 {
+		return nil
+	}
+	sort.Strings(fieldKeys)
+
+	ts, err := timestamp(p.Time, precision)
+	if err != nil {
+		return err
+	}
+
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+
+	// Sorted tags are what InfluxDB stores anyway and keep the output stable.
+	tagKeys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(p.Tags[k]))
+	}
+
+	for i, k := range fieldKeys {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		if err := appendFieldValue(b, p.Fields[k]); err != nil {
+			return fmt.Errorf("%s field %s: %w", p.Measurement, k, err)
+		}
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(ts, 10))
+	b.WriteByte('\n')
+	return nil
+}
+
+func appendFieldValue(b *strings.Builder, v any) error {
+	switch t := v.(type) {
+	case float64:
+		b.WriteString(strconv.FormatFloat(t, 'f', -1, 64))
+	case int64:
+		b.WriteString(strconv.FormatInt(t, 10))
+		b.WriteByte('i')
+	case uint64:
+		// Counters are written as signed integers, which every InfluxDB
+		// version accepts; real values never reach the int64 limit.
+		if t > math.MaxInt64 {
+			t = math.MaxInt64
+		}
+		b.WriteString(strconv.FormatUint(t, 10))
+		b.WriteByte('i')
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case string:
+		b.WriteByte('"')
+		b.WriteString(stringEscaper.Replace(t))
+		b.WriteByte('"')
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
+
+// CheckPrecision reports an error for precisions InfluxDB does not accept.
+func CheckPrecision(precision string) error {
+	_, err := timestamp(time.Time{}, precision)
+	return err
+}
+
+func timestamp(t time.Time, precision string) (int64, error) {
+	switch precision {
+	case PrecisionNanoseconds, "":
+		return t.UnixNano(), nil
+	case PrecisionMicroseconds:
+		return t.UnixMicro(), nil
+	case PrecisionMilliseconds:
+		return t.UnixMilli(), nil
+	case PrecisionSeconds:
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("unknown precision %q", precision)
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
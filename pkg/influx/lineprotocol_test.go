@@ -0,0 +1,96 @@
+package influx
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func TestPointsTagsEntities(t *testing.T) {
+	info := utils.SystemInfo{
+		Timestamp: "2024-02-15T10:31:45Z",
+		CPU:       utils.CPUStats{TotalPercent: 12.5, PerCPUPercent: []float64{10, 15}},
+		Host:      utils.HostStats{Hostname: "edge-01", UptimeSeconds: 3600},
+		Disk:      utils.DiskStats{Usage: []utils.DiskUsage{{Device: "/dev/sda1", Mountpoint: "/", FSType: "ext4", Used: 10, UsedPercent: 50}}},
+		Network:   utils.NetworkStats{Interfaces: []utils.NetInterface{{Name: "eth0", MTU: 1500, Flags: []string{"up", "broadcast"}}}},
+		Sensors: utils.SensorsStats{
+			Temperatures: []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48.2}},
+			Readings:     []utils.SensorReading{{SensorKey: "bme280_pressure", Type: "pressure", Value: 101.3, Unit: "kPa"}},
+		},
+	}
+
+	out, err := Encode(Points(info), PrecisionSeconds)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	lines := string(out)
+
+	want := []string{
+		"cpu,cpu=cpu-total,host=edge-01 time_idle=0,time_iowait=0,time_steal=0,time_system=0,time_user=0,usage_percent=12.5 1707993105\n",
+		"cpu,cpu=cpu1,host=edge-01 usage_percent=15 1707993105\n",
+		"disk,device=/dev/sda1,fstype=ext4,host=edge-01,mountpoint=/ free=0i,total=0i,used=10i,used_percent=50 1707993105\n",
+		"net_interface,host=edge-01,interface=eth0 addrs=0i,mtu=1500i,up=true 1707993105\n",
+		"temperature,host=edge-01,sensor=cpu_thermal critical=0,high=0,value=48.2 1707993105\n",
+		"sensor,host=edge-01,sensor=bme280_pressure,type=pressure,unit=kPa value=101.3 1707993105\n",
+		"uptime_seconds=3600i",
+	}
+	for _, w := range want {
+		if !strings.Contains(lines, w) {
+			t.Errorf("missing %q in\n%s", w, lines)
+		}
+	}
+}
+
+func TestEncodeEscapingAndTypes(t *testing.T) {
+	ts := time.Unix(1, 500)
+	points := []Point{
+		{
+			Measurement: "my measurement,x",
+			Tags:        map[string]string{"tag key": "a=b,c"},
+			Fields: map[string]any{
+				"s":   `say "hi" \ bye`,
+				"b":   false,
+				"i":   int64(-3),
+				"u":   uint64(math.MaxUint64),
+				"nan": math.NaN(),
+			},
+			Time: ts,
+		},
+		{Measurement: "empty", Fields: map[string]any{"inf": math.Inf(1)}, Time: ts},
+	}
+
+	out, err := Encode(points, PrecisionNanoseconds)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	want := `my\ measurement\,x,tag\ key=a\=b\,c b=false,i=-3i,s="say \"hi\" \\ bye",u=9223372036854775807i 1000000500` + "\n"
+	if string(out) != want {
+		t.Fatalf("Encode =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	ts := time.Unix(2, 3_004_005)
+	cases := map[string]string{
+		PrecisionNanoseconds:  "2003004005",
+		PrecisionMicroseconds: "2003004",
+		PrecisionMilliseconds: "2003",
+		PrecisionSeconds:      "2",
+	}
+	for precision, want := range cases {
+		out, err := Encode([]Point{{Measurement: "m", Fields: map[string]any{"v": 1.0}, Time: ts}}, precision)
+		if err != nil {
+			t.Fatalf("Encode(%s): %v", precision, err)
+		}
+		if got := strings.Fields(string(out))[2]; got != want {
+			t.Fatalf("precision %s timestamp = %s, want %s", precision, got, want)
+		}
+	}
+
+	if err := CheckPrecision("h"); err == nil {
+		t.Fatal("expected error for unknown precision")
+	}
+}
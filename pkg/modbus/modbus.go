@@ -0,0 +1,158 @@
+// Package modbus implements the Modbus application protocol for polling
+// devices: a client on top of TCP and RTU transports and the decoding of
+// register values into numbers.
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// Function codes of the read functions.
+const (
+	FuncReadCoils            byte = 0x01
+	FuncReadDiscreteInputs   byte = 0x02
+	FuncReadHoldingRegisters byte = 0x03
+	FuncReadInputRegisters   byte = 0x04
+)
+
+// Limits of a single read request from the Modbus application protocol
+// specification.
+const (
+	MaxReadBits      = 2000
+	MaxReadRegisters = 125
+)
+
+// Exception codes returned by a device that rejects a request.
+const (
+	ExceptionIllegalFunction    byte = 0x01
+	ExceptionIllegalDataAddress byte = 0x02
+	ExceptionIllegalDataValue   byte = 0x03
+	ExceptionServerDeviceFailed byte = 0x04
+	ExceptionServerDeviceBusy   byte = 0x06
+	ExceptionGatewayPath        byte = 0x0A
+	ExceptionGatewayTarget      byte = 0x0B
+)
+
+var exceptionNames = map[byte]string{
+	ExceptionIllegalFunction:    "illegal function",
+	ExceptionIllegalDataAddress: "illegal data address",
+	ExceptionIllegalDataValue:   "illegal data value",
+	ExceptionServerDeviceFailed: "server device failure",
+	0x05:                        "acknowledge",
+	ExceptionServerDeviceBusy:   "server device busy",
+	0x08:                        "memory parity error",
+	ExceptionGatewayPath:        "gateway path unavailable",
+	ExceptionGatewayTarget:      "gateway target device failed to respond",
+}
+
+// ExceptionError is a Modbus exception response.
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+func (e *ExceptionError) Error() string {
+	name, ok := exceptionNames[e.Code]
+	if !ok {
+		name = fmt.Sprintf("exception 0x%02x", e.Code)
+	}
+	return fmt.Sprintf("modbus function 0x%02x: %s", e.Function, name)
+}
+
+// Transport sends a request PDU to a unit and returns the response PDU,
+// which may be an exception response.
+type Transport interface {
+	Send(ctx context.Context, unitID byte, pdu []byte) ([]byte, error)
+	Close() error
+}
+
+// Client issues read requests to one unit through a transport.
+type Client struct {
+	transport Transport
+	unitID    byte
+}
+
+func NewClient(transport Transport, unitID byte) *Client {
+	return &Client{transport: transport, unitID: unitID}
+}
+
+// ReadBits reads quantity coils or discrete inputs starting at address,
+// depending on function.
+func (c *Client) ReadBits(ctx context.Context, function byte, address, quantity uint16) ([]bool, error) {
+	if function != FuncReadCoils && function != FuncReadDiscreteInputs {
+		return nil, fmt.Errorf("modbus function 0x%02x does not read bits", function)
+	}
+	if quantity == 0 || quantity > MaxReadBits {
+		return nil, fmt.Errorf("modbus read of %d bits out of range 1-%d", quantity, MaxReadBits)
+	}
+	data, err := c.read(ctx, function, address, quantity, (int(quantity)+7)/8)
+	if err != nil {
+		return nil, err
+	}
+	bits := make([]bool, quantity)
+	for i := range bits {
+		bits[i] = data[i/8]&(1<<(i%8)) != 0
+	}
+	return bits, nil
+}
+
+// ReadRegisters reads quantity holding or input registers starting at
+// address, depending on function.
+func (c *Client) ReadRegisters(ctx context.Context, function byte, address, quantity uint16) ([]uint16, error) {
+	if function != FuncReadHoldingRegisters && function != FuncReadInputRegisters {
+		return nil, fmt.Errorf("modbus function 0x%02x does not read registers", function)
+	}
+	if quantity == 0 || quantity > MaxReadRegisters {
+		return nil, fmt.Errorf("modbus read of %d registers out of range 1-%d", quantity, MaxReadRegisters)
+	}
+	data, err := c.read(ctx, function, address, quantity, 2*int(quantity))
+	if err != nil {
+		return nil, err
+	}
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return regs, nil
+}
+
+// read sends a read request and returns the data bytes of the response,
+// checking that there are exactly size of them.
+func (c *Client) read(ctx context.Context, function byte, address, quantity uint16, size int) ([]byte, error) {
+	req := make([]byte, 5)
+	req[0] = function
+	binary.BigEndian.PutUint16(req[1:], address)
+	binary.BigEndian.PutUint16(req[3:], quantity)
+
+	resp, err := c.transport.Send(ctx, c.unitID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(function, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || int(resp[1]) != size || len(resp) != 2+size {
+		return nil, fmt.Errorf("modbus function 0x%02x: malformed response of %d bytes", function, len(resp))
+	}
+	return resp[2:], nil
+}
+
+// checkResponse turns an exception response into an ExceptionError and
+// rejects responses to another function.
+func checkResponse(function byte, resp []byte) error {
+	if len(resp) == 0 {
+		return fmt.Errorf("modbus function 0x%02x: empty response", function)
+	}
+	if resp[0] == function|0x80 {
+		if len(resp) < 2 {
+			return fmt.Errorf("modbus function 0x%02x: malformed exception response", function)
+		}
+		return &ExceptionError{Function: function, Code: resp[1]}
+	}
+	if resp[0] != function {
+		return fmt.Errorf("modbus function 0x%02x: response for function 0x%02x", function, resp[0])
+	}
+	return nil
+}
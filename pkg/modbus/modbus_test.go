@@ -0,0 +1,284 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// standIn is a Modbus TCP server holding a sparse data model. Reads touching
+// an address without a value are answered with an illegal data address
+// exception.
+type standIn struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	bits      map[byte]map[uint16]bool
+	registers map[byte]map[uint16]uint16
+	requests  int
+}
+
+func newStandIn(t *testing.T) *standIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	s := newDataModel()
+	s.ln = ln
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// newDataModel returns a stand-in without a listener, for other transports.
+func newDataModel() *standIn {
+	return &standIn{
+		bits:      map[byte]map[uint16]bool{FuncReadCoils: {}, FuncReadDiscreteInputs: {}},
+		registers: map[byte]map[uint16]uint16{FuncReadHoldingRegisters: {}, FuncReadInputRegisters: {}},
+	}
+}
+
+func (s *standIn) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		txID, unit, pdu, err := readMBAP(conn)
+		if err != nil {
+			return
+		}
+		resp := s.handle(pdu)
+		frame := make([]byte, mbapHeaderLen, mbapHeaderLen+len(resp))
+		binary.BigEndian.PutUint16(frame[0:], txID)
+		binary.BigEndian.PutUint16(frame[4:], uint16(1+len(resp)))
+		frame[6] = unit
+		if _, err := conn.Write(append(frame, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *standIn) handle(pdu []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	function := pdu[0]
+	address := binary.BigEndian.Uint16(pdu[1:])
+	quantity := binary.BigEndian.Uint16(pdu[3:])
+	exception := []byte{function | 0x80, ExceptionIllegalDataAddress}
+
+	if bits, ok := s.bits[function]; ok {
+		data := make([]byte, (quantity+7)/8)
+		for i := uint16(0); i < quantity; i++ {
+			v, ok := bits[address+i]
+			if !ok {
+				return exception
+			}
+			if v {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append([]byte{function, byte(len(data))}, data...)
+	}
+	if regs, ok := s.registers[function]; ok {
+		data := make([]byte, 2*quantity)
+		for i := uint16(0); i < quantity; i++ {
+			v, ok := regs[address+i]
+			if !ok {
+				return exception
+			}
+			binary.BigEndian.PutUint16(data[2*i:], v)
+		}
+		return append([]byte{function, byte(len(data))}, data...)
+	}
+	return []byte{function | 0x80, ExceptionIllegalFunction}
+}
+
+func (s *standIn) set(function byte, address uint16, values ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range values {
+		s.registers[function][address+uint16(i)] = v
+	}
+}
+
+func (s *standIn) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestDecode(t *testing.T) {
+	f32 := math.Float32bits(-12.5)
+	f64 := math.Float64bits(1234.5678)
+	cases := []struct {
+		reg  Register
+		regs []uint16
+		want float64
+	}{
+		{Register{DataType: TypeInt16}, []uint16{0xFFFE}, -2},
+		{Register{DataType: TypeUint16, Scale: 0.1}, []uint16{1234}, 123.4},
+		{Register{DataType: TypeUint16, ByteOrder: OrderLittle}, []uint16{0x3412}, 0x1234},
+		{Register{DataType: TypeInt32}, []uint16{0xFFFF, 0xFFF6}, -10},
+		{Register{DataType: TypeUint32, WordOrder: OrderLittle}, []uint16{0x5678, 0x1234}, 0x12345678},
+		{Register{DataType: TypeFloat32}, []uint16{uint16(f32 >> 16), uint16(f32)}, -12.5},
+		// CDAB and BADC layouts of the same float.
+		{Register{DataType: TypeFloat32, WordOrder: OrderLittle}, []uint16{uint16(f32), uint16(f32 >> 16)}, -12.5},
+		{Register{DataType: TypeFloat32, ByteOrder: OrderLittle}, []uint16{swap(uint16(f32 >> 16)), swap(uint16(f32))}, -12.5},
+		{Register{DataType: TypeUint64}, []uint16{0, 0, 1, 0}, 65536},
+		{Register{DataType: TypeInt64, WordOrder: OrderLittle}, []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF}, -1},
+		{Register{DataType: TypeFloat64}, []uint16{uint16(f64 >> 48), uint16(f64 >> 32), uint16(f64 >> 16), uint16(f64)}, 1234.5678},
+	}
+	for _, c := range cases {
+		c.reg.Name = "v"
+		c.reg.Normalize()
+		got, err := c.reg.Decode(c.regs)
+		if err != nil || math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%+v Decode(%x) = %v, %v, want %v", c.reg, c.regs, got, err, c.want)
+		}
+	}
+}
+
+func swap(v uint16) uint16 { return v<<8 | v>>8 }
+
+func TestPollerCollect(t *testing.T) {
+	srv := newStandIn(t)
+	srv.set(FuncReadHoldingRegisters, 0, 425)
+	f := math.Float32bits(21.75)
+	srv.set(FuncReadInputRegisters, 100, uint16(f>>16), uint16(f))
+	srv.mu.Lock()
+	srv.bits[FuncReadCoils][7] = true
+	srv.mu.Unlock()
+
+	p, err := NewPoller(Config{Host: "127.0.0.1", Port: srv.port(), UnitID: 1, Registers: []Register{
+		{Name: "tank_level", Address: 0, Scale: 0.1, Unit: "%"},
+		{Name: "missing", Address: 50},
+		{Name: "water_temp", Function: FuncReadInputRegisters, Address: 100, DataType: TypeFloat32, Unit: "Cel"},
+		{Name: "pump_on", Function: FuncReadCoils, Address: 7},
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	defer p.Close()
+
+	var info utils.SystemInfo
+	p.Collect(context.Background(), &info)
+
+	want := []utils.ModbusValue{
+		{Name: "tank_level", Value: 42.5, Unit: "%"},
+		{Name: "water_temp", Value: 21.75, Unit: "Cel"},
+		{Name: "pump_on", Value: 1},
+	}
+	if info.Modbus == nil || len(info.Modbus.Values) != len(want) {
+		t.Fatalf("Modbus = %+v", info.Modbus)
+	}
+	for i, v := range want {
+		if got := info.Modbus.Values[i]; got.Name != v.Name || math.Abs(got.Value-v.Value) > 1e-9 || got.Unit != v.Unit {
+			t.Errorf("value %d = %+v, want %+v", i, got, v)
+		}
+	}
+	if len(info.Errors) != 1 || !strings.Contains(info.Errors[0], "register missing: modbus function 0x03: illegal data address") {
+		t.Fatalf("Errors = %v", info.Errors)
+	}
+
+	// An exception fails the poll, but the device is still connected.
+	status := p.Status()
+	if !status.Connected || status.Polls != 1 || status.FailedPolls != 1 || !strings.HasPrefix(status.LastError, "register missing") || status.LastSuccess != "" {
+		t.Fatalf("Status = %+v", status)
+	}
+	if err := p.Test(context.Background()); err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+}
+
+func TestPollerStopsOnConnectionError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	p, err := NewPoller(Config{Host: "127.0.0.1", Port: port, Timeout: time.Second, Registers: []Register{
+		{Name: "a", Address: 0},
+		{Name: "b", Address: 1},
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	defer p.Close()
+
+	values, errs := p.Poll(context.Background())
+	if len(values) != 0 || len(errs) != 1 {
+		t.Fatalf("values = %v, errs = %v", values, errs)
+	}
+	var exc *ExceptionError
+	if errors.As(errs[0], &exc) {
+		t.Fatalf("unexpected exception %v", exc)
+	}
+
+	p.Collect(context.Background(), &utils.SystemInfo{})
+	if status := p.Status(); status.Connected || status.Polls != 1 || status.FailedPolls != 1 || status.LastErrorAt == "" {
+		t.Fatalf("Status = %+v", status)
+	}
+	if err := p.Test(context.Background()); err == nil || !strings.HasPrefix(err.Error(), "register a: ") {
+		t.Fatalf("Test = %v", err)
+	}
+}
+
+func TestTCPTransportReconnects(t *testing.T) {
+	srv := newStandIn(t)
+	srv.set(FuncReadHoldingRegisters, 0, 1, 2)
+
+	tr := NewTCPTransport(srv.ln.Addr().String(), time.Second)
+	defer tr.Close()
+	c := NewClient(tr, 1)
+
+	regs, err := c.ReadRegisters(context.Background(), FuncReadHoldingRegisters, 0, 2)
+	if err != nil || regs[0] != 1 || regs[1] != 2 {
+		t.Fatalf("ReadRegisters = %v, %v", regs, err)
+	}
+
+	// The device drops the connection; the next request dials again.
+	tr.mu.Lock()
+	tr.conn.Close()
+	tr.mu.Unlock()
+	_, _ = c.ReadRegisters(context.Background(), FuncReadHoldingRegisters, 0, 1)
+	if regs, err = c.ReadRegisters(context.Background(), FuncReadHoldingRegisters, 1, 1); err != nil || regs[0] != 2 {
+		t.Fatalf("ReadRegisters after reconnect = %v, %v", regs, err)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	invalid := [][]Register{
+		{{Address: 1}},
+		{{Name: "a", Function: 5}},
+		{{Name: "a", Function: FuncReadCoils, DataType: TypeInt16}},
+		{{Name: "a", DataType: TypeBool}},
+		{{Name: "a", DataType: "string"}},
+		{{Name: "a", ByteOrder: "middle"}},
+		{{Name: "a", Address: 65535, DataType: TypeUint32}},
+		{{Name: "a"}, {Name: "a", Address: 1}},
+		{},
+	}
+	for _, regs := range invalid {
+		if _, err := NewPoller(Config{Host: "plc", Port: 502, Registers: regs}, nil); err == nil {
+			t.Errorf("expected error for %+v", regs)
+		}
+	}
+}
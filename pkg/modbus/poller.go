@@ -0,0 +1,194 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout bounds each request when no timeout is configured.
+const DefaultTimeout = 2 * time.Second
+
+type Config struct {
+	// Mode is tcp (the default) or rtu. Host and Port address a TCP device,
+	// Serial an RTU device.
+	Mode    string
+	Host    string
+	Port    int
+	Serial  SerialConfig
+	UnitID  int
+	Timeout time.Duration
+	// Registers is the register map polled on every collection.
+	Registers []Register
+}
+
+// Poller reads the register map of one device on every collection and adds
+// the decoded values to the snapshot.
+type Poller struct {
+	client    *Client
+	transport Transport
+	registers []Register
+	logger    *zap.Logger
+
+	mu     sync.Mutex
+	status utils.IntegrationStatus
+}
+
+// NewPoller validates the register map and returns a poller for a Modbus TCP
+// or RTU device. The connection or serial port is opened on the first poll.
+func NewPoller(cfg Config, logger *zap.Logger) (*Poller, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	switch cfg.Mode {
+	case "", "tcp":
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("modbus host is required")
+		}
+		if cfg.Port <= 0 || cfg.Port > 65535 {
+			return nil, fmt.Errorf("modbus port out of range: %d", cfg.Port)
+		}
+		address := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+		return newPoller(NewTCPTransport(address, cfg.Timeout), cfg.UnitID, cfg.Registers, logger)
+	case "rtu":
+		// Serial devices do not answer the broadcast address 0.
+		if cfg.UnitID < 1 || cfg.UnitID > 247 {
+			return nil, fmt.Errorf("modbus rtu unit_id out of range: %d", cfg.UnitID)
+		}
+		transport, err := NewRTUTransport(cfg.Serial, cfg.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return newPoller(transport, cfg.UnitID, cfg.Registers, logger)
+	}
+	return nil, fmt.Errorf("unknown modbus mode %q", cfg.Mode)
+}
+
+func newPoller(transport Transport, unitID int, registers []Register, logger *zap.Logger) (*Poller, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if unitID < 0 || unitID > 255 {
+		return nil, fmt.Errorf("modbus unit_id out of range: %d", unitID)
+	}
+	if len(registers) == 0 {
+		return nil, fmt.Errorf("modbus register map is empty")
+	}
+
+	names := make(map[string]bool, len(registers))
+	regs := make([]Register, len(registers))
+	for i, r := range registers {
+		r.Normalize()
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("register %s is defined twice", r.Name)
+		}
+		names[r.Name] = true
+		regs[i] = r
+	}
+
+	return &Poller{
+		client:    NewClient(transport, byte(unitID)),
+		transport: transport,
+		registers: regs,
+		logger:    logger,
+	}, nil
+}
+
+// Poll reads every register in map order. A register the device rejects is
+// skipped; any other error, such as a lost connection, ends the poll.
+func (p *Poller) Poll(ctx context.Context) ([]utils.ModbusValue, []error) {
+	values := make([]utils.ModbusValue, 0, len(p.registers))
+	var errs []error
+	for _, r := range p.registers {
+		v, err := p.read(ctx, r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("register %s: %w", r.Name, err))
+			var exc *ExceptionError
+			if errors.As(err, &exc) {
+				continue
+			}
+			break
+		}
+		values = append(values, utils.ModbusValue{Name: r.Name, Value: v, Unit: r.Unit})
+	}
+	return values, errs
+}
+
+func (p *Poller) read(ctx context.Context, r Register) (float64, error) {
+	if r.DataType == TypeBool {
+		bits, err := p.client.ReadBits(ctx, r.Function, r.Address, 1)
+		if err != nil {
+			return 0, err
+		}
+		if bits[0] {
+			return r.Scale, nil
+		}
+		return 0, nil
+	}
+
+	regs, err := p.client.ReadRegisters(ctx, r.Function, r.Address, r.Count())
+	if err != nil {
+		return 0, err
+	}
+	return r.Decode(regs)
+}
+
+// Collect polls the device and stores the values in info.Modbus. Errors are
+// added to info.Errors.
+func (p *Poller) Collect(ctx context.Context, info *utils.SystemInfo) {
+	start := time.Now()
+	values, errs := p.Poll(ctx)
+	p.record(start, errs)
+	info.Modbus = &utils.ModbusStats{Values: values}
+	for _, err := range errs {
+		info.Errors = append(info.Errors, "modbus: "+err.Error())
+	}
+	if len(errs) > 0 {
+		p.logger.Warn("modbus poll incomplete", zap.Int("values", len(values)), zap.Error(errs[0]))
+	}
+}
+
+// record updates the status with a poll. The device is connected as long as
+// it answers, even if only with exceptions.
+func (p *Poller) record(start time.Time, errs []error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	if len(errs) > 0 {
+		err = errs[0]
+	}
+	p.status.Record(start, err)
+	var exc *ExceptionError
+	p.status.Connected = len(errs) == 0 || errors.As(errs[len(errs)-1], &exc)
+}
+
+// Status returns the state of the device as seen by the last collections.
+func (p *Poller) Status() utils.IntegrationStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// Test reads the first register of the map, independent of collections. An
+// exception response fails the test as well.
+func (p *Poller) Test(ctx context.Context) error {
+	r := p.registers[0]
+	if _, err := p.read(ctx, r); err != nil {
+		return fmt.Errorf("register %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+func (p *Poller) Close() error {
+	return p.transport.Close()
+}
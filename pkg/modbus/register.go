@@ -0,0 +1,211 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Data types a register map entry can decode.
+const (
+	TypeBool    = "bool"
+	TypeInt16   = "int16"
+	TypeUint16  = "uint16"
+	TypeInt32   = "int32"
+	TypeUint32  = "uint32"
+	TypeInt64   = "int64"
+	TypeUint64  = "uint64"
+	TypeFloat32 = "float32"
+	TypeFloat64 = "float64"
+)
+
+// Byte and word orders. Modbus transmits each register big endian; devices
+// differ in how they spread wider values across registers.
+const (
+	OrderBig    = "big"
+	OrderLittle = "little"
+)
+
+var registerCounts = map[string]uint16{
+	TypeInt16: 1, TypeUint16: 1,
+	TypeInt32: 2, TypeUint32: 2, TypeFloat32: 2,
+	TypeInt64: 4, TypeUint64: 4, TypeFloat64: 4,
+}
+
+// Register is one entry of a register map: a value read with Function from
+// Address and decoded as DataType. The decoded number is multiplied by Scale.
+type Register struct {
+	Name     string
+	Function byte
+	Address  uint16
+	DataType string
+	Scale    float64
+	// ByteOrder little swaps the two bytes of every register. WordOrder
+	// little puts the least significant register first.
+	ByteOrder string
+	WordOrder string
+	Unit      string
+}
+
+// Normalize fills in the defaults: holding registers, uint16 for registers
+// and bool for coils and discrete inputs, a scale of 1 and big endian byte
+// and word order.
+func (r *Register) Normalize() {
+	if r.Function == 0 {
+		r.Function = FuncReadHoldingRegisters
+	}
+	if r.DataType == "" {
+		r.DataType = TypeUint16
+		if r.Function == FuncReadCoils || r.Function == FuncReadDiscreteInputs {
+			r.DataType = TypeBool
+		}
+	}
+	if r.Scale == 0 {
+		r.Scale = 1
+	}
+	if r.ByteOrder == "" {
+		r.ByteOrder = OrderBig
+	}
+	if r.WordOrder == "" {
+		r.WordOrder = OrderBig
+	}
+}
+
+// Validate checks a normalized register.
+func (r Register) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("register at address %d has no name", r.Address)
+	}
+	switch r.Function {
+	case FuncReadCoils, FuncReadDiscreteInputs:
+		if r.DataType != TypeBool {
+			return fmt.Errorf("register %s: function %d reads bits, data_type must be bool", r.Name, r.Function)
+		}
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+		if _, ok := registerCounts[r.DataType]; !ok {
+			return fmt.Errorf("register %s: unsupported data_type %q for function %d", r.Name, r.DataType, r.Function)
+		}
+	default:
+		return fmt.Errorf("register %s: function_code must be 1, 2, 3 or 4, got %d", r.Name, r.Function)
+	}
+	for _, order := range []string{r.ByteOrder, r.WordOrder} {
+		if order != OrderBig && order != OrderLittle {
+			return fmt.Errorf("register %s: byte and word order must be big or little, got %q", r.Name, order)
+		}
+	}
+	if math.IsNaN(r.Scale) || math.IsInf(r.Scale, 0) {
+		return fmt.Errorf("register %s: invalid scale", r.Name)
+	}
+	if int(r.Address)+int(r.Count()) > 0x10000 {
+		return fmt.Errorf("register %s: ends beyond address 65535", r.Name)
+	}
+	return nil
+}
+
+// Count returns the number of registers, or bits for bool, that hold the
+// value.
+func (r Register) Count() uint16 {
+	if r.DataType == TypeBool {
+		return 1
+	}
+	return registerCounts[r.DataType]
+}
+
+// Decode converts the registers read for r into its scaled value.
+func (r Register) Decode(regs []uint16) (float64, error) {
+	if len(regs) != int(r.Count()) {
+		return 0, fmt.Errorf("register %s: got %d registers, want %d", r.Name, len(regs), r.Count())
+	}
+
+	// Arrange the bytes most significant first.
+	b := make([]byte, 2*len(regs))
+	for i, reg := range regs {
+		if r.WordOrder == OrderLittle {
+			i = len(regs) - 1 - i
+		}
+		if r.ByteOrder == OrderLittle {
+			reg = reg<<8 | reg>>8
+		}
+		binary.BigEndian.PutUint16(b[2*i:], reg)
+	}
+
+	var v float64
+	switch r.DataType {
+	case TypeInt16:
+		v = float64(int16(binary.BigEndian.Uint16(b)))
+	case TypeUint16:
+		v = float64(binary.BigEndian.Uint16(b))
+	case TypeInt32:
+		v = float64(int32(binary.BigEndian.Uint32(b)))
+	case TypeUint32:
+		v = float64(binary.BigEndian.Uint32(b))
+	case TypeFloat32:
+		v = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case TypeInt64:
+		v = float64(int64(binary.BigEndian.Uint64(b)))
+	case TypeUint64:
+		v = float64(binary.BigEndian.Uint64(b))
+	case TypeFloat64:
+		v = math.Float64frombits(binary.BigEndian.Uint64(b))
+	default:
+		return 0, fmt.Errorf("register %s: unsupported data_type %q", r.Name, r.DataType)
+	}
+	return v * r.Scale, nil
+}
+
+// Encode converts value into the registers for r, the inverse of Decode:
+// the value is divided by Scale and stored as DataType. Integer types round
+// and clamp to their range; NaN is stored as 0.
+func (r Register) Encode(value float64) ([]uint16, error) {
+	raw := value / r.Scale
+	b := make([]byte, 2*r.Count())
+	switch r.DataType {
+	case TypeInt16:
+		binary.BigEndian.PutUint16(b, uint16(int16(clamp(raw, math.MinInt16, math.MaxInt16))))
+	case TypeUint16:
+		binary.BigEndian.PutUint16(b, uint16(clamp(raw, 0, math.MaxUint16)))
+	case TypeInt32:
+		binary.BigEndian.PutUint32(b, uint32(int32(clamp(raw, math.MinInt32, math.MaxInt32))))
+	case TypeUint32:
+		binary.BigEndian.PutUint32(b, uint32(clamp(raw, 0, math.MaxUint32)))
+	case TypeFloat32:
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(raw)))
+	// The largest 64 bit integers are not exact floats; clamp to the
+	// largest float below them.
+	case TypeInt64:
+		binary.BigEndian.PutUint64(b, uint64(int64(clamp(raw, math.MinInt64, math.Nextafter(math.MaxInt64, 0)))))
+	case TypeUint64:
+		binary.BigEndian.PutUint64(b, uint64(clamp(raw, 0, math.Nextafter(math.MaxUint64, 0))))
+	case TypeFloat64:
+		binary.BigEndian.PutUint64(b, math.Float64bits(raw))
+	default:
+		return nil, fmt.Errorf("register %s: unsupported data_type %q", r.Name, r.DataType)
+	}
+
+	regs := make([]uint16, len(b)/2)
+	for i := range regs {
+		reg := binary.BigEndian.Uint16(b[2*i:])
+		if r.ByteOrder == OrderLittle {
+			reg = reg<<8 | reg>>8
+		}
+		if r.WordOrder == OrderLittle {
+			regs[len(regs)-1-i] = reg
+		} else {
+			regs[i] = reg
+		}
+	}
+	return regs, nil
+}
+
+// clamp rounds v and limits it to [lo, hi]. NaN becomes 0.
+func clamp(v, lo, hi float64) float64 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v <= lo:
+		return lo
+	case v >= hi:
+		return hi
+	}
+	return math.Round(v)
+}
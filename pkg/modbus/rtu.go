@@ -0,0 +1,246 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// rtuMaxADULen is the largest RTU frame: address, PDU and CRC.
+const rtuMaxADULen = 1 + maxPDULen + 2
+
+// SerialConfig describes the serial line of an RTU device.
+type SerialConfig struct {
+	Port     string
+	BaudRate int
+	DataBits int
+	// Parity is none, even or odd.
+	Parity   string
+	StopBits int
+}
+
+func (c SerialConfig) mode() (*serial.Mode, error) {
+	mode := &serial.Mode{BaudRate: c.BaudRate, DataBits: c.DataBits}
+	if mode.BaudRate <= 0 {
+		return nil, fmt.Errorf("modbus baud rate must be positive: %d", c.BaudRate)
+	}
+	if mode.DataBits != 8 {
+		return nil, fmt.Errorf("modbus rtu requires 8 data bits: %d", c.DataBits)
+	}
+	switch c.Parity {
+	case "none":
+		mode.Parity = serial.NoParity
+	case "even":
+		mode.Parity = serial.EvenParity
+	case "odd":
+		mode.Parity = serial.OddParity
+	default:
+		return nil, fmt.Errorf("unknown modbus parity %q", c.Parity)
+	}
+	switch c.StopBits {
+	case 1:
+		mode.StopBits = serial.OneStopBit
+	case 2:
+		mode.StopBits = serial.TwoStopBits
+	default:
+		return nil, fmt.Errorf("modbus stop bits must be 1 or 2: %d", c.StopBits)
+	}
+	return mode, nil
+}
+
+// frameDelay returns the silent interval of 3.5 character times that
+// separates frames on the line. Above 19200 baud the specification fixes it
+// at 1.75 ms.
+func (c SerialConfig) frameDelay() time.Duration {
+	if c.BaudRate > 19200 {
+		return 1750 * time.Microsecond
+	}
+	bits := 1 + c.DataBits + c.StopBits
+	if c.Parity != "none" {
+		bits++
+	}
+	return time.Duration(float64(bits) * 3.5 * float64(time.Second) / float64(c.BaudRate))
+}
+
+// RTUTransport sends requests as RTU frames over a serial line. The port is
+// opened on the first request and re-opened after any error.
+type RTUTransport struct {
+	cfg     SerialConfig
+	mode    *serial.Mode
+	timeout time.Duration
+	delay   time.Duration
+
+	mu        sync.Mutex
+	port      serial.Port
+	lastFrame time.Time
+}
+
+// NewRTUTransport checks the serial settings and returns a transport for the
+// device on cfg.Port. Each request is bounded by timeout.
+func NewRTUTransport(cfg SerialConfig, timeout time.Duration) (*RTUTransport, error) {
+	if cfg.Port == "" {
+		return nil, fmt.Errorf("modbus serial port is required")
+	}
+	mode, err := cfg.mode()
+	if err != nil {
+		return nil, err
+	}
+	return &RTUTransport{cfg: cfg, mode: mode, timeout: timeout, delay: cfg.frameDelay()}, nil
+}
+
+func (t *RTUTransport) Send(ctx context.Context, unitID byte, pdu []byte) ([]byte, error) {
+	if len(pdu) > maxPDULen {
+		return nil, fmt.Errorf("modbus request of %d bytes exceeds %d", len(pdu), maxPDULen)
+	}
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if t.port == nil {
+		port, err := serial.Open(t.cfg.Port, t.mode)
+		if err != nil {
+			return nil, fmt.Errorf("modbus open %s: %w", t.cfg.Port, err)
+		}
+		t.port = port
+	}
+
+	resp, err := t.roundTrip(ctx, unitID, pdu)
+	t.lastFrame = time.Now()
+	if err != nil {
+		// Bytes of a late response would be taken for the next response.
+		_ = t.port.Close()
+		t.port = nil
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *RTUTransport) roundTrip(ctx context.Context, unitID byte, pdu []byte) ([]byte, error) {
+	if wait := t.delay - time.Since(t.lastFrame); wait > 0 {
+		time.Sleep(wait)
+	}
+	if err := t.port.ResetInputBuffer(); err != nil {
+		return nil, fmt.Errorf("modbus reset input: %w", err)
+	}
+
+	frame := make([]byte, 0, 1+len(pdu)+2)
+	frame = append(frame, unitID)
+	frame = append(frame, pdu...)
+	frame = binary.LittleEndian.AppendUint16(frame, crc16(frame))
+	if _, err := t.port.Write(frame); err != nil {
+		return nil, fmt.Errorf("modbus write: %w", err)
+	}
+
+	adu, err := t.readFrame(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("modbus read: %w", err)
+	}
+	if adu[0] != unitID {
+		return nil, fmt.Errorf("modbus response from unit %d, want unit %d", adu[0], unitID)
+	}
+	return adu[1 : len(adu)-2], nil
+}
+
+// readFrame reads one response frame. Its length follows from the function
+// code and, for reads, the byte count, so the frame ends without waiting for
+// the line to become silent.
+func (t *RTUTransport) readFrame(ctx context.Context) ([]byte, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+
+	buf := make([]byte, rtuMaxADULen)
+	n, want := 0, 0
+	for want == 0 || n < want {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("timeout after %d bytes", n)
+		}
+		if err := t.port.SetReadTimeout(remaining); err != nil {
+			return nil, err
+		}
+		read, err := t.port.Read(buf[n:])
+		if err != nil {
+			return nil, err
+		}
+		if read == 0 {
+			return nil, fmt.Errorf("timeout after %d bytes", n)
+		}
+		n += read
+		if want, err = rtuFrameLen(buf[:n]); err != nil {
+			return nil, err
+		}
+	}
+
+	adu := buf[:want]
+	if got := binary.LittleEndian.Uint16(adu[len(adu)-2:]); got != crc16(adu[:len(adu)-2]) {
+		return nil, errors.New("crc mismatch")
+	}
+	return adu, nil
+}
+
+// rtuFrameLen returns the length of the response frame that starts with adu,
+// or 0 while too few bytes are known to tell.
+func rtuFrameLen(adu []byte) (int, error) {
+	if len(adu) < 2 {
+		return 0, nil
+	}
+	function := adu[1]
+	switch {
+	case function&0x80 != 0:
+		return 5, nil
+	case function >= FuncReadCoils && function <= FuncReadInputRegisters:
+		if len(adu) < 3 {
+			return 0, nil
+		}
+		if 3+int(adu[2])+2 > rtuMaxADULen {
+			return 0, fmt.Errorf("invalid byte count %d", adu[2])
+		}
+		return 3 + int(adu[2]) + 2, nil
+	case function == 0x05, function == 0x06, function == 0x0F, function == 0x10:
+		return 8, nil
+	}
+	return 0, fmt.Errorf("unexpected function 0x%02x in response", function)
+}
+
+// crc16 returns the Modbus CRC of data, which is sent low byte first.
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+func (t *RTUTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.port == nil {
+		return nil
+	}
+	err := t.port.Close()
+	t.port = nil
+	return err
+}
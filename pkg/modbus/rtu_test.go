@@ -0,0 +1,207 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// rtuSlave answers RTU read requests for one unit on the controlling side of
+// a pseudo-terminal pair. The transport under test opens the other side.
+type rtuSlave struct {
+	*standIn
+	unitID byte
+	tty    string
+
+	mu        sync.Mutex
+	corrupt   bool
+	lastReply time.Time
+	gaps      []time.Duration
+}
+
+func newRTUSlave(t *testing.T, unitID byte) *rtuSlave {
+	t.Helper()
+	ptm, pts, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	s := &rtuSlave{standIn: newDataModel(), unitID: unitID, tty: pts.Name()}
+	go s.serve(ptm)
+	// The terminal side stays open so the controlling side keeps working
+	// while the transport re-opens the port.
+	t.Cleanup(func() {
+		ptm.Close()
+		pts.Close()
+	})
+	return s
+}
+
+func (s *rtuSlave) serve(ptm *os.File) {
+	for {
+		req := make([]byte, 8)
+		if _, err := io.ReadFull(ptm, req); err != nil {
+			return
+		}
+		s.mu.Lock()
+		if !s.lastReply.IsZero() {
+			s.gaps = append(s.gaps, time.Since(s.lastReply))
+		}
+		s.mu.Unlock()
+
+		if binary.LittleEndian.Uint16(req[6:]) != crc16(req[:6]) || req[0] != s.unitID {
+			continue
+		}
+		adu := append([]byte{s.unitID}, s.handle(req[1:6])...)
+		adu = binary.LittleEndian.AppendUint16(adu, crc16(adu))
+
+		s.mu.Lock()
+		if s.corrupt {
+			adu[len(adu)-1] ^= 0xFF
+			s.corrupt = false
+		}
+		// The master cannot see the response before the write starts.
+		s.lastReply = time.Now()
+		s.mu.Unlock()
+		if _, err := ptm.Write(adu); err != nil {
+			return
+		}
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	// Read 10 holding registers from unit 1, as sent on the line:
+	// 01 03 00 00 00 0A C5 CD.
+	if got := crc16([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}); got != 0xCDC5 {
+		t.Fatalf("crc16 = %04x, want cdc5", got)
+	}
+	if got := crc16([]byte{0x11, 0x03, 0x00, 0x6B, 0x00, 0x03}); got != 0x8776 {
+		t.Fatalf("crc16 = %04x, want 8776", got)
+	}
+}
+
+func TestRTUPollerCollect(t *testing.T) {
+	slave := newRTUSlave(t, 7)
+	slave.set(FuncReadHoldingRegisters, 0, 425)
+	f := math.Float32bits(21.75)
+	slave.set(FuncReadInputRegisters, 100, uint16(f), uint16(f>>16))
+	slave.standIn.mu.Lock()
+	slave.bits[FuncReadCoils][7] = true
+	slave.standIn.mu.Unlock()
+
+	serial := SerialConfig{Port: slave.tty, BaudRate: 9600, DataBits: 8, Parity: "even", StopBits: 1}
+	p, err := NewPoller(Config{Mode: "rtu", Serial: serial, UnitID: 7, Timeout: time.Second, Registers: []Register{
+		{Name: "tank_level", Address: 0, Scale: 0.1, Unit: "%"},
+		{Name: "missing", Address: 50},
+		{Name: "water_temp", Function: FuncReadInputRegisters, Address: 100, DataType: TypeFloat32, WordOrder: OrderLittle},
+		{Name: "pump_on", Function: FuncReadCoils, Address: 7},
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	defer p.Close()
+
+	var info utils.SystemInfo
+	p.Collect(context.Background(), &info)
+
+	want := []utils.ModbusValue{
+		{Name: "tank_level", Value: 42.5, Unit: "%"},
+		{Name: "water_temp", Value: 21.75},
+		{Name: "pump_on", Value: 1},
+	}
+	if info.Modbus == nil || len(info.Modbus.Values) != len(want) {
+		t.Fatalf("Modbus = %+v, errors = %v", info.Modbus, info.Errors)
+	}
+	for i, v := range want {
+		if got := info.Modbus.Values[i]; got.Name != v.Name || math.Abs(got.Value-v.Value) > 1e-9 || got.Unit != v.Unit {
+			t.Errorf("value %d = %+v, want %+v", i, got, v)
+		}
+	}
+	if len(info.Errors) != 1 || !strings.Contains(info.Errors[0], "register missing: modbus function 0x03: illegal data address") {
+		t.Fatalf("Errors = %v", info.Errors)
+	}
+
+	// Every request waited at least 3.5 character times after the previous
+	// response: 11 bits per character at 9600 baud.
+	minGap := 11 * 35 * time.Second / 10 / 9600
+	slave.mu.Lock()
+	defer slave.mu.Unlock()
+	if len(slave.gaps) != 3 {
+		t.Fatalf("gaps = %v", slave.gaps)
+	}
+	for _, gap := range slave.gaps {
+		if gap < minGap {
+			t.Errorf("request sent %v after the previous response, want at least %v", gap, minGap)
+		}
+	}
+}
+
+func TestRTUTransportErrors(t *testing.T) {
+	slave := newRTUSlave(t, 1)
+	slave.set(FuncReadHoldingRegisters, 0, 1, 2)
+
+	tr, err := NewRTUTransport(SerialConfig{Port: slave.tty, BaudRate: 38400, DataBits: 8, Parity: "none", StopBits: 2}, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewRTUTransport: %v", err)
+	}
+	defer tr.Close()
+	c := NewClient(tr, 1)
+
+	slave.mu.Lock()
+	slave.corrupt = true
+	slave.mu.Unlock()
+	if _, err := c.ReadRegisters(context.Background(), FuncReadHoldingRegisters, 0, 2); err == nil || !strings.Contains(err.Error(), "crc mismatch") {
+		t.Fatalf("expected crc error, got %v", err)
+	}
+
+	// The port is re-opened for the next request.
+	regs, err := c.ReadRegisters(context.Background(), FuncReadHoldingRegisters, 0, 2)
+	if err != nil || regs[0] != 1 || regs[1] != 2 {
+		t.Fatalf("ReadRegisters = %v, %v", regs, err)
+	}
+
+	// A unit that is not on the line never answers.
+	_, err = NewClient(tr, 2).ReadRegisters(context.Background(), FuncReadHoldingRegisters, 0, 1)
+	var exc *ExceptionError
+	if err == nil || errors.As(err, &exc) || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestRTUConfigValidation(t *testing.T) {
+	valid := SerialConfig{Port: "/dev/ttyUSB0", BaudRate: 19200, DataBits: 8, Parity: "even", StopBits: 1}
+	if d := valid.frameDelay(); d < 2*time.Millisecond || d > 2100*time.Microsecond {
+		t.Errorf("frameDelay at 19200 baud = %v", d)
+	}
+	fast := valid
+	fast.BaudRate = 115200
+	if d := fast.frameDelay(); d != 1750*time.Microsecond {
+		t.Errorf("frameDelay at 115200 baud = %v", d)
+	}
+
+	invalid := []SerialConfig{
+		{BaudRate: 19200, DataBits: 8, Parity: "even", StopBits: 1},
+		{Port: "/dev/ttyUSB0", DataBits: 8, Parity: "even", StopBits: 1},
+		{Port: "/dev/ttyUSB0", BaudRate: 19200, DataBits: 7, Parity: "even", StopBits: 1},
+		{Port: "/dev/ttyUSB0", BaudRate: 19200, DataBits: 8, Parity: "mark", StopBits: 1},
+		{Port: "/dev/ttyUSB0", BaudRate: 19200, DataBits: 8, Parity: "even", StopBits: 0},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewRTUTransport(cfg, time.Second); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+	if _, err := NewPoller(Config{Mode: "rtu", Serial: valid, UnitID: 0, Registers: []Register{{Name: "a"}}}, nil); err == nil {
+		t.Error("expected error for broadcast unit id")
+	}
+}
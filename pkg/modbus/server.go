@@ -0,0 +1,293 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Snapshot metrics a server can map to registers.
+const (
+	MetricCPUPercent    = "cpu_percent"
+	MetricMemoryPercent = "memory_percent"
+	MetricDiskPercent   = "disk_percent"
+	MetricTemperature   = "temperature"
+	MetricUptime        = "uptime_seconds"
+)
+
+// MetricRegister serves one snapshot metric from holding or input registers.
+// Key selects the mountpoint of disk_percent (default "/") and the sensor key
+// of temperature. The value is divided by Scale, so the same Register
+// settings decode it again on the client.
+type MetricRegister struct {
+	Metric string
+	Key    string
+	Register
+}
+
+type ServerConfig struct {
+	Address string
+	// UnitID restricts the server to one unit id; 0 answers every unit.
+	UnitID    int
+	Registers []MetricRegister
+}
+
+// Server is a Modbus TCP server that lets PLCs read snapshot metrics. The
+// register values are replaced on every Update.
+type Server struct {
+	ln        net.Listener
+	unitID    byte
+	registers []MetricRegister
+	mapped    map[byte]map[uint16]bool
+	logger    *zap.Logger
+
+	mu      sync.RWMutex
+	values  map[byte]map[uint16]uint16
+	updated bool
+	conns   map[net.Conn]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewServer validates the register map, listens on cfg.Address and serves
+// requests until Close. Registers are unavailable until the first Update.
+func NewServer(cfg ServerConfig, logger *zap.Logger) (*Server, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.UnitID < 0 || cfg.UnitID > 255 {
+		return nil, fmt.Errorf("modbus server unit_id out of range: %d", cfg.UnitID)
+	}
+	if len(cfg.Registers) == 0 {
+		return nil, fmt.Errorf("modbus server register map is empty")
+	}
+
+	s := &Server{
+		unitID: byte(cfg.UnitID),
+		mapped: map[byte]map[uint16]bool{FuncReadHoldingRegisters: {}, FuncReadInputRegisters: {}},
+		logger: logger,
+		conns:  make(map[net.Conn]struct{}),
+	}
+	for _, m := range cfg.Registers {
+		if err := m.normalize(); err != nil {
+			return nil, err
+		}
+		mapped, ok := s.mapped[m.Function]
+		if !ok {
+			return nil, fmt.Errorf("register %s: function_code must be 3 or 4, got %d", m.Name, m.Function)
+		}
+		for i := uint16(0); i < m.Count(); i++ {
+			a := m.Address + i
+			if mapped[a] {
+				return nil, fmt.Errorf("register %s: address %d is already mapped", m.Name, a)
+			}
+			mapped[a] = true
+		}
+		s.registers = append(s.registers, m)
+	}
+
+	ln, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("modbus server listen: %w", err)
+	}
+	s.ln = ln
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+func (m *MetricRegister) normalize() error {
+	switch m.Metric {
+	case MetricCPUPercent, MetricMemoryPercent, MetricUptime:
+	case MetricDiskPercent:
+		if m.Key == "" {
+			m.Key = "/"
+		}
+	case MetricTemperature:
+		if m.Key == "" {
+			return fmt.Errorf("metric temperature at address %d needs the sensor key", m.Address)
+		}
+	default:
+		return fmt.Errorf("unknown metric %q at address %d", m.Metric, m.Address)
+	}
+	m.Name = m.Metric
+	if m.Key != "" {
+		m.Name += "[" + m.Key + "]"
+	}
+	m.Normalize()
+	return m.Validate()
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Update encodes the metrics of info into the registers. A register whose
+// metric is missing from info, such as an unplugged sensor, is answered with
+// a server device failure until the metric comes back.
+func (s *Server) Update(info *utils.SystemInfo) {
+	values := map[byte]map[uint16]uint16{FuncReadHoldingRegisters: {}, FuncReadInputRegisters: {}}
+	for _, m := range s.registers {
+		v, ok := metricValue(info, m.Metric, m.Key)
+		if !ok {
+			continue
+		}
+		regs, err := m.Encode(v)
+		if err != nil {
+			s.logger.Warn("modbus server encode", zap.Error(err))
+			continue
+		}
+		for i, reg := range regs {
+			values[m.Function][m.Address+uint16(i)] = reg
+		}
+	}
+
+	s.mu.Lock()
+	s.values = values
+	s.updated = true
+	s.mu.Unlock()
+}
+
+func metricValue(info *utils.SystemInfo, metric, key string) (float64, bool) {
+	switch metric {
+	case MetricCPUPercent:
+		return info.CPU.TotalPercent, true
+	case MetricMemoryPercent:
+		return info.Memory.Virtual.UsedPercent, true
+	case MetricUptime:
+		return float64(info.Host.UptimeSeconds), true
+	case MetricDiskPercent:
+		for _, u := range info.Disk.Usage {
+			if u.Mountpoint == key {
+				return u.UsedPercent, true
+			}
+		}
+	case MetricTemperature:
+		for _, t := range info.Sensors.Temperatures {
+			if t.SensorKey == key {
+				return t.Value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Error("modbus server accept", zap.Error(err))
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		txID, unit, pdu, err := readMBAP(conn)
+		if err != nil {
+			return
+		}
+		resp := s.handle(unit, pdu)
+		frame := make([]byte, mbapHeaderLen, mbapHeaderLen+len(resp))
+		binary.BigEndian.PutUint16(frame[0:], txID)
+		binary.BigEndian.PutUint16(frame[4:], uint16(1+len(resp)))
+		frame[6] = unit
+		if _, err := conn.Write(append(frame, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers one request PDU.
+func (s *Server) handle(unit byte, pdu []byte) []byte {
+	function := pdu[0]
+	exception := func(code byte) []byte {
+		return []byte{function | 0x80, code}
+	}
+
+	if s.unitID != 0 && unit != s.unitID {
+		return exception(ExceptionGatewayTarget)
+	}
+	if function != FuncReadHoldingRegisters && function != FuncReadInputRegisters {
+		return exception(ExceptionIllegalFunction)
+	}
+	if len(pdu) != 5 {
+		return exception(ExceptionIllegalDataValue)
+	}
+	address := binary.BigEndian.Uint16(pdu[1:])
+	quantity := binary.BigEndian.Uint16(pdu[3:])
+	if quantity == 0 || quantity > MaxReadRegisters {
+		return exception(ExceptionIllegalDataValue)
+	}
+	if int(address)+int(quantity) > 0x10000 {
+		return exception(ExceptionIllegalDataAddress)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data := make([]byte, 2*quantity)
+	for i := uint16(0); i < quantity; i++ {
+		if !s.mapped[function][address+i] {
+			return exception(ExceptionIllegalDataAddress)
+		}
+		if !s.updated {
+			return exception(ExceptionServerDeviceBusy)
+		}
+		v, ok := s.values[function][address+i]
+		if !ok {
+			return exception(ExceptionServerDeviceFailed)
+		}
+		binary.BigEndian.PutUint16(data[2*i:], v)
+	}
+	return append([]byte{function, byte(len(data))}, data...)
+}
+
+// Close stops listening, drops the client connections and waits for them to
+// finish.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.ln.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
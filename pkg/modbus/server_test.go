@@ -0,0 +1,183 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	cases := []struct {
+		reg   Register
+		value float64
+		want  float64
+	}{
+		{Register{DataType: TypeUint16, Scale: 0.1}, 42.54, 42.5},
+		{Register{DataType: TypeInt16, Scale: 0.1}, -4.5, -4.5},
+		{Register{DataType: TypeUint16}, -3, 0},
+		{Register{DataType: TypeUint16}, 70000, 65535},
+		{Register{DataType: TypeInt16}, math.NaN(), 0},
+		{Register{DataType: TypeUint32, WordOrder: OrderLittle}, 0x12345678, 0x12345678},
+		{Register{DataType: TypeFloat32, ByteOrder: OrderLittle}, -12.5, -12.5},
+		{Register{DataType: TypeInt64, WordOrder: OrderLittle}, -1, -1},
+		{Register{DataType: TypeUint64}, 1e30, math.Nextafter(math.MaxUint64, 0)},
+		{Register{DataType: TypeFloat64, Scale: 2}, 1234.5678, 1234.5678},
+	}
+	for _, c := range cases {
+		c.reg.Name = "v"
+		c.reg.Normalize()
+		regs, err := c.reg.Encode(c.value)
+		if err != nil {
+			t.Fatalf("%+v Encode(%v): %v", c.reg, c.value, err)
+		}
+		got, err := c.reg.Decode(regs)
+		if err != nil || math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%+v Encode(%v) decodes to %v, %v, want %v", c.reg, c.value, got, err, c.want)
+		}
+	}
+}
+
+func TestServerServesMetrics(t *testing.T) {
+	srv, err := NewServer(ServerConfig{Address: "127.0.0.1:0", Registers: []MetricRegister{
+		{Metric: MetricCPUPercent, Register: Register{Address: 0, Scale: 0.1}},
+		{Metric: MetricMemoryPercent, Register: Register{Address: 1, DataType: TypeFloat32, WordOrder: OrderLittle}},
+		{Metric: MetricDiskPercent, Register: Register{Address: 3, Scale: 0.01}},
+		{Metric: MetricTemperature, Key: "outdoor", Register: Register{Function: FuncReadInputRegisters, Address: 10, DataType: TypeInt16, Scale: 0.1}},
+		{Metric: MetricTemperature, Key: "unplugged", Register: Register{Function: FuncReadInputRegisters, Address: 11, DataType: TypeInt16}},
+		{Metric: MetricUptime, Register: Register{Function: FuncReadInputRegisters, Address: 20, DataType: TypeUint32}},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	tr := NewTCPTransport(srv.Addr().String(), time.Second)
+	defer tr.Close()
+	c := NewClient(tr, 1)
+	ctx := context.Background()
+
+	var exc *ExceptionError
+	if _, err := c.ReadRegisters(ctx, FuncReadHoldingRegisters, 0, 1); !errors.As(err, &exc) || exc.Code != ExceptionServerDeviceBusy {
+		t.Fatalf("read before first update: %v", err)
+	}
+
+	info := &utils.SystemInfo{}
+	info.CPU.TotalPercent = 42.54
+	info.Memory.Virtual.UsedPercent = 61.25
+	info.Disk.Usage = []utils.DiskUsage{{Mountpoint: "/data", UsedPercent: 10}, {Mountpoint: "/", UsedPercent: 87.65}}
+	info.Sensors.Temperatures = []utils.Temperature{{SensorKey: "outdoor", Value: -4.5}}
+	info.Host.UptimeSeconds = 90061
+	srv.Update(info)
+
+	regs, err := c.ReadRegisters(ctx, FuncReadHoldingRegisters, 0, 4)
+	if err != nil {
+		t.Fatalf("ReadRegisters: %v", err)
+	}
+	mem := math.Float32bits(61.25)
+	if want := []uint16{425, uint16(mem), uint16(mem >> 16), 8765}; !slices.Equal(regs, want) {
+		t.Fatalf("holding registers = %v, want %v", regs, want)
+	}
+	if regs, err := c.ReadRegisters(ctx, FuncReadInputRegisters, 20, 2); err != nil || !slices.Equal(regs, []uint16{1, 90061 - 65536}) {
+		t.Fatalf("uptime = %v, %v", regs, err)
+	}
+	if regs, err := c.ReadRegisters(ctx, FuncReadInputRegisters, 10, 1); err != nil || int16(regs[0]) != -45 {
+		t.Fatalf("temperature = %v, %v", regs, err)
+	}
+
+	failures := []struct {
+		function byte
+		address  uint16
+		quantity uint16
+		code     byte
+	}{
+		{FuncReadInputRegisters, 10, 2, ExceptionServerDeviceFailed},
+		{FuncReadHoldingRegisters, 3, 2, ExceptionIllegalDataAddress},
+		{FuncReadInputRegisters, 0, 1, ExceptionIllegalDataAddress},
+	}
+	for _, f := range failures {
+		_, err := c.ReadRegisters(ctx, f.function, f.address, f.quantity)
+		if !errors.As(err, &exc) || exc.Code != f.code {
+			t.Errorf("read %d registers at %d with function %d: %v, want exception %d", f.quantity, f.address, f.function, err, f.code)
+		}
+	}
+	if _, err := c.ReadBits(ctx, FuncReadCoils, 0, 1); !errors.As(err, &exc) || exc.Code != ExceptionIllegalFunction {
+		t.Errorf("read coils: %v", err)
+	}
+
+	// The registers follow the snapshot.
+	info.CPU.TotalPercent = 3
+	srv.Update(info)
+	if regs, err := c.ReadRegisters(ctx, FuncReadHoldingRegisters, 0, 1); err != nil || regs[0] != 30 {
+		t.Fatalf("cpu after update = %v, %v", regs, err)
+	}
+}
+
+func TestServerPollerRoundTrip(t *testing.T) {
+	reg := Register{Address: 100, DataType: TypeInt32, Scale: 0.01, WordOrder: OrderLittle}
+	srv, err := NewServer(ServerConfig{Address: "127.0.0.1:0", UnitID: 5, Registers: []MetricRegister{
+		{Metric: MetricTemperature, Key: "coretemp Package id 0", Register: reg},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+	info := &utils.SystemInfo{}
+	info.Sensors.Temperatures = []utils.Temperature{{SensorKey: "coretemp Package id 0", Value: 48.25}}
+	srv.Update(info)
+
+	addr := srv.Addr().(*net.TCPAddr)
+	reg.Name = "cpu_temp"
+	for unit, want := range map[int]int{5: 1, 6: 0} {
+		p, err := NewPoller(Config{Host: "127.0.0.1", Port: addr.Port, UnitID: unit, Registers: []Register{reg}}, nil)
+		if err != nil {
+			t.Fatalf("NewPoller: %v", err)
+		}
+		values, errs := p.Poll(context.Background())
+		p.Close()
+		if len(values) != want {
+			t.Fatalf("unit %d: values = %v, errs = %v", unit, values, errs)
+		}
+		if want == 1 && values[0].Value != 48.25 {
+			t.Fatalf("unit %d: value = %v", unit, values[0].Value)
+		}
+	}
+}
+
+func TestServerConfigValidation(t *testing.T) {
+	invalid := [][]MetricRegister{
+		{},
+		{{Metric: "swap_percent"}},
+		{{Metric: MetricTemperature}},
+		{{Metric: MetricCPUPercent, Register: Register{Function: FuncReadCoils}}},
+		{{Metric: MetricCPUPercent, Register: Register{DataType: TypeBool}}},
+		{{Metric: MetricCPUPercent, Register: Register{Address: 65535, DataType: TypeFloat32}}},
+		{
+			{Metric: MetricCPUPercent, Register: Register{Address: 0, DataType: TypeUint32}},
+			{Metric: MetricMemoryPercent, Register: Register{Address: 1}},
+		},
+	}
+	for _, regs := range invalid {
+		if srv, err := NewServer(ServerConfig{Address: "127.0.0.1:0", Registers: regs}, nil); err == nil {
+			srv.Close()
+			t.Errorf("expected error for %+v", regs)
+		}
+	}
+
+	// The same address may hold a holding and an input register.
+	srv, err := NewServer(ServerConfig{Address: "127.0.0.1:0", Registers: []MetricRegister{
+		{Metric: MetricCPUPercent, Register: Register{Address: 65535}},
+		{Metric: MetricMemoryPercent, Register: Register{Function: FuncReadInputRegisters, Address: 65535}},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
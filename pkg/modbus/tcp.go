@@ -0,0 +1,123 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// mbapHeaderLen is the size of the Modbus application protocol header that
+// precedes every PDU on TCP.
+const mbapHeaderLen = 7
+
+// maxPDULen is the largest PDU allowed by the specification.
+const maxPDULen = 253
+
+// TCPTransport sends requests over one TCP connection, which is opened on
+// the first request and re-opened after any error.
+type TCPTransport struct {
+	address string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	txID uint16
+}
+
+// NewTCPTransport returns a transport for the device at address (host:port).
+// Each request including connecting is bounded by timeout.
+func NewTCPTransport(address string, timeout time.Duration) *TCPTransport {
+	return &TCPTransport{address: address, timeout: timeout}
+}
+
+func (t *TCPTransport) Send(ctx context.Context, unitID byte, pdu []byte) ([]byte, error) {
+	if len(pdu) > maxPDULen {
+		return nil, fmt.Errorf("modbus request of %d bytes exceeds %d", len(pdu), maxPDULen)
+	}
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", t.address)
+		if err != nil {
+			return nil, fmt.Errorf("modbus connect: %w", err)
+		}
+		t.conn = conn
+	}
+
+	resp, err := t.roundTrip(ctx, unitID, pdu)
+	if err != nil {
+		// A late response would be read as the answer to the next request.
+		_ = t.conn.Close()
+		t.conn = nil
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *TCPTransport) roundTrip(ctx context.Context, unitID byte, pdu []byte) ([]byte, error) {
+	deadline, _ := ctx.Deadline()
+	_ = t.conn.SetDeadline(deadline)
+
+	t.txID++
+	frame := make([]byte, mbapHeaderLen+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:], t.txID)
+	binary.BigEndian.PutUint16(frame[4:], uint16(1+len(pdu)))
+	frame[6] = unitID
+	copy(frame[mbapHeaderLen:], pdu)
+	if _, err := t.conn.Write(frame); err != nil {
+		return nil, fmt.Errorf("modbus write: %w", err)
+	}
+
+	txID, gotUnit, resp, err := readMBAP(t.conn)
+	if err != nil {
+		return nil, fmt.Errorf("modbus read: %w", err)
+	}
+	if txID != t.txID || gotUnit != unitID {
+		return nil, fmt.Errorf("modbus response for transaction %d unit %d, want %d unit %d", txID, gotUnit, t.txID, unitID)
+	}
+	return resp, nil
+}
+
+// readMBAP reads one frame and returns its transaction id, unit id and PDU.
+func readMBAP(r io.Reader) (uint16, byte, []byte, error) {
+	header := make([]byte, mbapHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	if protocol := binary.BigEndian.Uint16(header[2:]); protocol != 0 {
+		return 0, 0, nil, fmt.Errorf("unknown protocol id %d", protocol)
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 2 || length > 1+maxPDULen {
+		return 0, 0, nil, fmt.Errorf("invalid frame length %d", length)
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(r, pdu); err != nil {
+		return 0, 0, nil, err
+	}
+	return binary.BigEndian.Uint16(header[0:]), header[6], pdu, nil
+}
+
+func (t *TCPTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
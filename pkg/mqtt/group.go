@@ -0,0 +1,249 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	BrokerModeFailover = "failover"
+	BrokerModeFanout   = "fanout"
+)
+
+// BrokerStatus reports the connection state of one broker. Active is set on
+// the brokers that accepted the most recent snapshot.
+type BrokerStatus struct {
+	Broker      string `json:"broker"`
+	Connected   bool   `json:"connected"`
+	Active      bool   `json:"active"`
+	Published   uint64 `json:"published"`
+	Failed      uint64 `json:"failed"`
+	LastPublish string `json:"last_publish,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+type GroupStatus struct {
+	Mode    string         `json:"mode"`
+	Brokers []BrokerStatus `json:"brokers"`
+}
+
+// Group publishes to several brokers. In failover mode each snapshot goes to
+// the first connected broker in configured order, so traffic returns to the
+// primary as soon as it reconnects. In fanout mode every connected broker
+// receives every snapshot.
+type Group struct {
+	mode    string
+	members []*groupMember
+	logger  *zap.Logger
+}
+
+type groupMember struct {
+	broker    string
+	publisher *Publisher
+
+	mu          sync.Mutex
+	active      bool
+	published   uint64
+	failed      uint64
+	lastPublish time.Time
+	lastError   string
+}
+
+// NewGroup connects to every broker in cfg.Brokers, falling back to
+// cfg.Broker, and returns once the first of them is connected. The others
+// keep connecting in the background.
+func NewGroup(ctx context.Context, cfg Config, logger *zap.Logger) (*Group, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	brokers := cfg.Brokers
+	if len(brokers) == 0 {
+		brokers = []string{cfg.Broker}
+	}
+
+	mode := cfg.BrokerMode
+	if mode == "" {
+		mode = BrokerModeFailover
+	}
+	if mode != BrokerModeFailover && mode != BrokerModeFanout {
+		return nil, fmt.Errorf("unknown broker mode %q", mode)
+	}
+	if cfg.PayloadFormat == PayloadSparkplugB && mode == BrokerModeFailover && len(brokers) > 1 {
+		return nil, fmt.Errorf("sparkplug_b payload format requires fanout broker mode with several brokers")
+	}
+
+	g := &Group{mode: mode, logger: logger}
+	waits := make([]func(context.Context) error, 0, len(brokers))
+	for _, broker := range brokers {
+		memberCfg := cfg
+		memberCfg.Broker = broker
+		p, awaitConnection, err := dial(ctx, memberCfg, logger)
+		if err != nil {
+			_ = g.Close()
+			return nil, fmt.Errorf("broker %s: %w", broker, err)
+		}
+		g.members = append(g.members, &groupMember{broker: broker, publisher: p})
+		waits = append(waits, awaitConnection)
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan error, len(waits))
+	for _, wait := range waits {
+		go func(wait func(context.Context) error) {
+			results <- wait(waitCtx)
+		}(wait)
+	}
+
+	var errs []error
+	for range waits {
+		err := <-results
+		if err == nil {
+			return g, nil
+		}
+		errs = append(errs, err)
+	}
+
+	_ = g.Close()
+	return nil, errors.Join(errs...)
+}
+
+func (g *Group) Publish(ctx context.Context, payload []byte) error {
+	if g == nil || len(g.members) == 0 {
+		return fmt.Errorf("publisher not initialized")
+	}
+
+	if g.mode == BrokerModeFanout {
+		return g.publishFanout(ctx, payload)
+	}
+	return g.publishFailover(ctx, payload)
+}
+
+func (g *Group) publishFailover(ctx context.Context, payload []byte) error {
+	var errs []error
+	for i, m := range g.members {
+		if !m.publisher.isConnected() {
+			continue
+		}
+
+		err := m.publish(ctx, payload)
+		if err == nil {
+			for j, other := range g.members {
+				if j != i {
+					other.setActive(false)
+				}
+			}
+			return nil
+		}
+
+		g.logger.Warn("mqtt broker publish failed, trying next broker", zap.String("broker", m.broker), zap.Error(err))
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("no mqtt broker connected")
+	}
+	return errors.Join(errs...)
+}
+
+// publishFanout sends to all connected brokers concurrently so a slow broker
+// does not delay the others. It only fails when no broker accepted the
+// snapshot; individual failures are logged and visible in Status.
+func (g *Group) publishFanout(ctx context.Context, payload []byte) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(g.members))
+	for i, m := range g.members {
+		if !m.publisher.isConnected() {
+			m.setActive(false)
+			errs[i] = fmt.Errorf("broker %s: mqtt client not connected", m.broker)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, m *groupMember) {
+			defer wg.Done()
+			if err := m.publish(ctx, payload); err != nil {
+				g.logger.Warn("mqtt broker publish failed", zap.String("broker", m.broker), zap.Error(err))
+				errs[i] = fmt.Errorf("broker %s: %w", m.broker, err)
+			}
+		}(i, m)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *groupMember) publish(ctx context.Context, payload []byte) error {
+	err := m.publisher.Publish(ctx, payload)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.active = err == nil
+	if err != nil {
+		m.failed++
+		m.lastError = err.Error()
+		return err
+	}
+	m.published++
+	m.lastPublish = time.Now()
+	m.lastError = ""
+	return nil
+}
+
+func (m *groupMember) setActive(active bool) {
+	m.mu.Lock()
+	m.active = active
+	m.mu.Unlock()
+}
+
+// Status returns the state of every broker in configured order.
+func (g *Group) Status() GroupStatus {
+	status := GroupStatus{Mode: g.mode, Brokers: make([]BrokerStatus, 0, len(g.members))}
+	for _, m := range g.members {
+		connected := m.publisher.isConnected()
+
+		m.mu.Lock()
+		s := BrokerStatus{
+			Broker:    m.broker,
+			Connected: connected,
+			Active:    m.active && connected,
+			Published: m.published,
+			Failed:    m.failed,
+			LastError: m.lastError,
+		}
+		if !m.lastPublish.IsZero() {
+			s.LastPublish = m.lastPublish.UTC().Format(time.RFC3339)
+		}
+		m.mu.Unlock()
+
+		status.Brokers = append(status.Brokers, s)
+	}
+	return status
+}
+
+func (g *Group) Close() error {
+	if g == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, m := range g.members {
+		if err := m.publisher.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("broker %s: %w", m.broker, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newTestGroup(mode string, clients ...*fakeClient) *Group {
+	g := &Group{mode: mode, logger: zap.NewNop()}
+	for i, c := range clients {
+		p := &Publisher{client: c, topic: "test", qos: 1, logger: zap.NewNop()}
+		g.members = append(g.members, &groupMember{broker: fmt.Sprintf("tcp://broker-%d:1883", i), publisher: p})
+	}
+	return g
+}
+
+func TestGroupFailover(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeClient{connected: true, publishToken: newFakeToken(nil, true)}
+	secondary := &fakeClient{connected: true, publishToken: newFakeToken(nil, true)}
+	g := newTestGroup(BrokerModeFailover, primary, secondary)
+
+	if err := g.Publish(ctx, []byte("one")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(primary.published) != 1 || len(secondary.published) != 0 {
+		t.Fatalf("published = %d/%d, want primary only", len(primary.published), len(secondary.published))
+	}
+
+	primary.connected = false
+	if err := g.Publish(ctx, []byte("two")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(secondary.published) != 1 {
+		t.Fatal("expected failover to secondary")
+	}
+	status := g.Status()
+	if status.Brokers[0].Active || !status.Brokers[1].Active {
+		t.Fatalf("status = %+v", status)
+	}
+
+	primary.connected = true
+	if err := g.Publish(ctx, []byte("three")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(primary.published) != 2 || len(secondary.published) != 1 {
+		t.Fatal("expected traffic to return to primary")
+	}
+	status = g.Status()
+	if !status.Brokers[0].Active || status.Brokers[1].Active {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.Brokers[0].Published != 2 || status.Brokers[0].LastPublish == "" {
+		t.Fatalf("primary status = %+v", status.Brokers[0])
+	}
+}
+
+func TestGroupFailoverOnPublishError(t *testing.T) {
+	primary := &fakeClient{connected: true, publishToken: newFakeToken(errors.New("quota exceeded"), true)}
+	secondary := &fakeClient{connected: true, publishToken: newFakeToken(nil, true)}
+	g := newTestGroup(BrokerModeFailover, primary, secondary)
+
+	if err := g.Publish(context.Background(), []byte("data")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(secondary.published) != 1 {
+		t.Fatal("expected publish error to fail over")
+	}
+	if s := g.Status().Brokers[0]; s.Failed != 1 || s.LastError == "" {
+		t.Fatalf("primary status = %+v", s)
+	}
+
+	primary.connected, secondary.connected = false, false
+	if err := g.Publish(context.Background(), []byte("data")); err == nil {
+		t.Fatal("expected error with no broker connected")
+	}
+}
+
+func TestGroupFanout(t *testing.T) {
+	ctx := context.Background()
+	a := &fakeClient{connected: true, publishToken: newFakeToken(nil, true)}
+	b := &fakeClient{connected: true, publishToken: newFakeToken(errors.New("refused"), true)}
+	c := &fakeClient{connected: false}
+	g := newTestGroup(BrokerModeFanout, a, b, c)
+
+	if err := g.Publish(ctx, []byte("data")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(a.published) != 1 || len(b.published) != 1 || len(c.published) != 0 {
+		t.Fatalf("published = %d/%d/%d", len(a.published), len(b.published), len(c.published))
+	}
+
+	status := g.Status()
+	if status.Mode != BrokerModeFanout {
+		t.Fatalf("mode = %q", status.Mode)
+	}
+	if !status.Brokers[0].Active || status.Brokers[1].Active || status.Brokers[2].Active {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.Brokers[1].Failed != 1 || status.Brokers[2].Connected {
+		t.Fatalf("status = %+v", status)
+	}
+
+	a.publishToken = newFakeToken(errors.New("refused"), true)
+	if err := g.Publish(ctx, []byte("data")); err == nil {
+		t.Fatal("expected error when no broker accepted the publish")
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	a := &fakeClient{connected: true}
+	b := &fakeClient{connected: false}
+	g := newTestGroup(BrokerModeFanout, a, b)
+
+	if err := g.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !a.disconnectCalled || !b.disconnectCalled {
+		t.Fatal("expected every broker to be disconnected")
+	}
+}
+
+func TestNewGroupRejectsUnknownMode(t *testing.T) {
+	if _, err := NewGroup(context.Background(), Config{Broker: "tcp://localhost:1883", BrokerMode: "roundrobin"}, nil); err == nil {
+		t.Fatal("expected error for unknown broker mode")
+	}
+}
+
+func TestNewGroupRejectsSparkplugFailover(t *testing.T) {
+	cfg := Config{Brokers: []string{"tcp://a:1883", "tcp://b:1883"}, BrokerMode: BrokerModeFailover, PayloadFormat: PayloadSparkplugB}
+	if _, err := NewGroup(context.Background(), cfg, nil); err == nil {
+		t.Fatal("expected error for sparkplug_b with failover brokers")
+	}
+}
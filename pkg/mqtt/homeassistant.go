@@ -0,0 +1,297 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	haOnline  = "online"
+	haOffline = "offline"
+)
+
+type HomeAssistantConfig struct {
+	Enabled         bool
+	DiscoveryPrefix string
+	NodeID          string
+	StatePrefix     string
+	SoftwareVersion string
+}
+
+// haSensor is one Home Assistant entity derived from a snapshot.
+type haSensor struct {
+	objectID    string
+	name        string
+	unit        string
+	deviceClass string
+	stateClass  string
+	icon        string
+	state       string
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+	HWVersion    string   `json:"hw_version,omitempty"`
+}
+
+type haDiscovery struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	ObjectID          string   `json:"object_id"`
+	StateTopic        string   `json:"state_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Icon              string   `json:"icon,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// homeAssistant tracks which discovery configs have been announced so they
+// are only re-sent when the entity set changes or after a reconnect. The
+// announced set outlives reconnects, so entities that disappeared meanwhile
+// are still removed.
+type homeAssistant struct {
+	cfg HomeAssistantConfig
+
+	mu        sync.Mutex
+	online    bool
+	resend    bool
+	announced map[string]string
+}
+
+func newHomeAssistant(cfg HomeAssistantConfig) *homeAssistant {
+	cfg.NodeID = objectID(cfg.NodeID)
+	return &homeAssistant{cfg: cfg, announced: make(map[string]string)}
+}
+
+func (h *homeAssistant) availabilityTopic() string {
+	return h.cfg.StatePrefix + "/availability"
+}
+
+func (h *homeAssistant) stateTopic(objectID string) string {
+	return h.cfg.StatePrefix + "/" + objectID + "/state"
+}
+
+func (h *homeAssistant) discoveryTopic(objectID string) string {
+	return h.cfg.DiscoveryPrefix + "/sensor/" + h.cfg.NodeID + "/" + objectID + "/config"
+}
+
+// reset forces availability and discovery to be re-announced, e.g. after a
+// reconnect where the broker may have lost retained messages.
+func (h *homeAssistant) reset() {
+	h.mu.Lock()
+	h.online = false
+	h.resend = true
+	h.mu.Unlock()
+}
+
+func haSensors(info utils.SystemInfo) []haSensor {
+	sensors := []haSensor{
+		{objectID: "cpu_percent", name: "CPU usage", unit: "%", stateClass: "measurement", icon: "mdi:cpu-64-bit", state: formatFloat(info.CPU.TotalPercent)},
+		{objectID: "memory_percent", name: "Memory usage", unit: "%", stateClass: "measurement", icon: "mdi:memory", state: formatFloat(info.Memory.Virtual.UsedPercent)},
+		{objectID: "uptime", name: "Uptime", unit: "s", deviceClass: "duration", stateClass: "total_increasing", state: strconv.FormatUint(info.Host.UptimeSeconds, 10)},
+	}
+
+	for _, u := range info.Disk.Usage {
+		sensors = append(sensors, haSensor{
+			objectID:   "disk_" + objectID(u.Mountpoint) + "_percent",
+			name:       "Disk " + u.Mountpoint + " usage",
+			unit:       "%",
+			stateClass: "measurement",
+			icon:       "mdi:harddisk",
+			state:      formatFloat(u.UsedPercent),
+		})
+	}
+
+	for _, t := range info.Sensors.Temperatures {
+		sensors = append(sensors, haSensor{
+			objectID:    "temperature_" + objectID(t.SensorKey),
+			name:        "Temperature " + t.SensorKey,
+			unit:        "°C",
+			deviceClass: "temperature",
+			stateClass:  "measurement",
+			state:       formatFloat(t.Value),
+		})
+	}
+	for _, r := range info.Sensors.Readings {
+		sensors = append(sensors, haSensor{
+			objectID:    "sensor_" + objectID(r.SensorKey),
+			name:        "Sensor " + r.SensorKey,
+			unit:        r.Unit,
+			deviceClass: haDeviceClasses[r.Type],
+			stateClass:  "measurement",
+			state:       formatFloat(r.Value),
+		})
+	}
+
+	return sensors
+}
+
+// haDeviceClasses are the Home Assistant device classes of IIO channel types
+// whose unit Home Assistant accepts.
+var haDeviceClasses = map[string]string{
+	"humidityrelative": "humidity",
+	"pressure":         "pressure",
+	"voltage":          "voltage",
+	"current":          "current",
+	"illuminance":      "illuminance",
+}
+
+func (h *homeAssistant) discovery(s haSensor, info utils.SystemInfo) ([]byte, error) {
+	model := strings.TrimSpace(info.Host.Platform + " " + info.Host.PlatformVersion)
+	name := info.Host.Hostname
+	if name == "" {
+		name = h.cfg.NodeID
+	}
+
+	return json.Marshal(haDiscovery{
+		Name:              s.name,
+		UniqueID:          h.cfg.NodeID + "_" + s.objectID,
+		ObjectID:          h.cfg.NodeID + "_" + s.objectID,
+		StateTopic:        h.stateTopic(s.objectID),
+		AvailabilityTopic: h.availabilityTopic(),
+		UnitOfMeasurement: s.unit,
+		DeviceClass:       s.deviceClass,
+		StateClass:        s.stateClass,
+		Icon:              s.icon,
+		Device: haDevice{
+			Identifiers:  []string{"edgebeat_" + h.cfg.NodeID},
+			Name:         name,
+			Manufacturer: "edgebeat",
+			Model:        model,
+			SWVersion:    h.cfg.SoftwareVersion,
+			HWVersion:    info.Host.KernelArch,
+		},
+	})
+}
+
+// publishHomeAssistant announces availability and discovery when needed and
+// then publishes the current state of every entity.
+func (p *Publisher) publishHomeAssistant(ctx context.Context, payload []byte) error {
+	var info utils.SystemInfo
+	if err := json.Unmarshal(payload, &info); err != nil {
+		return fmt.Errorf("home assistant decode: %w", err)
+	}
+
+	h := p.homeAssistant
+	sensors := haSensors(info)
+
+	h.mu.Lock()
+	online := h.online
+	resend := h.resend
+	announced := make(map[string]string, len(h.announced))
+	for k, v := range h.announced {
+		announced[k] = v
+	}
+	h.mu.Unlock()
+
+	if !online {
+		if err := p.publish(ctx, h.availabilityTopic(), 1, true, []byte(haOnline)); err != nil {
+			return err
+		}
+		h.mu.Lock()
+		h.online = true
+		h.mu.Unlock()
+	}
+
+	current := make(map[string]bool, len(sensors))
+	for _, s := range sensors {
+		current[s.objectID] = true
+
+		config, err := h.discovery(s, info)
+		if err != nil {
+			return fmt.Errorf("home assistant discovery: %w", err)
+		}
+		if !resend && announced[s.objectID] == string(config) {
+			continue
+		}
+		if err := p.publish(ctx, h.discoveryTopic(s.objectID), 1, true, config); err != nil {
+			return err
+		}
+		h.mu.Lock()
+		h.announced[s.objectID] = string(config)
+		h.mu.Unlock()
+	}
+	if resend {
+		h.mu.Lock()
+		h.resend = false
+		h.mu.Unlock()
+	}
+
+	// An empty retained config removes entities that disappeared, such as an
+	// unmounted disk.
+	stale := make([]string, 0)
+	for id := range announced {
+		if !current[id] {
+			stale = append(stale, id)
+		}
+	}
+	sort.Strings(stale)
+	for _, id := range stale {
+		if err := p.publish(ctx, h.discoveryTopic(id), 1, true, []byte{}); err != nil {
+			return err
+		}
+		h.mu.Lock()
+		delete(h.announced, id)
+		h.mu.Unlock()
+	}
+
+	for _, s := range sensors {
+		if err := p.publish(ctx, h.stateTopic(s.objectID), p.qos, true, []byte(s.state)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishOffline marks the device unavailable on clean shutdown; the will only
+// covers unexpected disconnects.
+func (p *Publisher) publishOffline() {
+	if !p.isConnected() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.publish(ctx, p.homeAssistant.availabilityTopic(), 1, true, []byte(haOffline)); err != nil {
+		p.logger.Warn("home assistant offline publish failed", zap.Error(err))
+	}
+}
+
+// objectID reduces s to the characters Home Assistant accepts in object ids.
+func objectID(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	id := strings.Trim(b.String(), "_")
+	if id == "" {
+		return "root"
+	}
+	return id
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
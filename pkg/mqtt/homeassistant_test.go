@@ -0,0 +1,168 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+func newTestHAPublisher() (*Publisher, *fakeClient) {
+	fake := &fakeClient{connected: true, publishToken: newFakeToken(nil, true)}
+	ha := newHomeAssistant(HomeAssistantConfig{
+		Enabled:         true,
+		DiscoveryPrefix: "homeassistant",
+		NodeID:          "edge.01",
+		StatePrefix:     "edgebeat/edge-01",
+		SoftwareVersion: "1.2.3",
+	})
+	return &Publisher{client: fake, homeAssistant: ha, topic: "edgebeat/health", qos: 1, logger: zap.NewNop()}, fake
+}
+
+func topicsWithPrefix(msgs []fakeMessage, prefix string) []fakeMessage {
+	out := make([]fakeMessage, 0)
+	for _, m := range msgs {
+		if strings.HasPrefix(m.topic, prefix) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func TestHomeAssistantDiscoveryAndState(t *testing.T) {
+	publisher, fake := newTestHAPublisher()
+	info := utils.SystemInfo{
+		CPU:    utils.CPUStats{TotalPercent: 12.34},
+		Memory: utils.MemoryStats{Virtual: utils.VirtualMemory{UsedPercent: 50}},
+		Disk:   utils.DiskStats{Usage: []utils.DiskUsage{{Mountpoint: "/", UsedPercent: 70}}},
+		Host:   utils.HostStats{Hostname: "edge-01", Platform: "raspbian", PlatformVersion: "12", UptimeSeconds: 3600},
+		Sensors: utils.SensorsStats{
+			Temperatures: []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48}},
+			Readings:     []utils.SensorReading{{SensorKey: "bme280_humidity", Type: "humidityrelative", Value: 41.5, Unit: "%"}},
+		},
+	}
+	publishInfo(t, publisher, info)
+
+	if fake.published[0].topic != "edgebeat/health" {
+		t.Fatalf("first topic = %q, want raw payload first", fake.published[0].topic)
+	}
+
+	avail := topicsWithPrefix(fake.published, "edgebeat/edge-01/availability")
+	if len(avail) != 1 || string(avail[0].payload) != "online" || !avail[0].retained {
+		t.Fatalf("availability = %+v", avail)
+	}
+
+	configs := topicsWithPrefix(fake.published, "homeassistant/sensor/edge_01/")
+	if len(configs) != 6 {
+		t.Fatalf("discovery configs = %d, want 6", len(configs))
+	}
+	for _, c := range configs {
+		if !c.retained {
+			t.Fatalf("discovery %q not retained", c.topic)
+		}
+	}
+
+	var disk, humidity haDiscovery
+	for _, c := range configs {
+		switch c.topic {
+		case "homeassistant/sensor/edge_01/disk_root_percent/config":
+			if err := json.Unmarshal(c.payload, &disk); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+		case "homeassistant/sensor/edge_01/sensor_bme280_humidity/config":
+			if err := json.Unmarshal(c.payload, &humidity); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+		}
+	}
+	if humidity.DeviceClass != "humidity" || humidity.UnitOfMeasurement != "%" || humidity.StateTopic != "edgebeat/edge-01/sensor_bme280_humidity/state" {
+		t.Fatalf("humidity discovery = %+v", humidity)
+	}
+	if disk.StateTopic != "edgebeat/edge-01/disk_root_percent/state" || disk.UnitOfMeasurement != "%" {
+		t.Fatalf("disk discovery = %+v", disk)
+	}
+	if disk.Device.Name != "edge-01" || disk.Device.Model != "raspbian 12" || disk.Device.SWVersion != "1.2.3" {
+		t.Fatalf("device = %+v", disk.Device)
+	}
+
+	states := topicsWithPrefix(fake.published, "edgebeat/edge-01/cpu_percent/state")
+	if len(states) != 1 || string(states[0].payload) != "12.3" {
+		t.Fatalf("cpu state = %+v", states)
+	}
+
+	// Second publish only sends the raw payload and states.
+	fake.published = nil
+	publishInfo(t, publisher, info)
+	if n := len(topicsWithPrefix(fake.published, "homeassistant/")); n != 0 {
+		t.Fatalf("re-announced %d discovery configs", n)
+	}
+	if n := len(topicsWithPrefix(fake.published, "edgebeat/edge-01/")); n != 6 {
+		t.Fatalf("state updates = %d, want 6", n)
+	}
+}
+
+func TestHomeAssistantRemovesStaleEntities(t *testing.T) {
+	publisher, fake := newTestHAPublisher()
+	info := utils.SystemInfo{Disk: utils.DiskStats{Usage: []utils.DiskUsage{{Mountpoint: "/mnt/usb"}}}}
+	publishInfo(t, publisher, info)
+
+	fake.published = nil
+	info.Disk.Usage = nil
+	publishInfo(t, publisher, info)
+
+	removed := topicsWithPrefix(fake.published, "homeassistant/sensor/edge_01/disk_mnt_usb_percent/config")
+	if len(removed) != 1 || len(removed[0].payload) != 0 || !removed[0].retained {
+		t.Fatalf("removal = %+v", removed)
+	}
+}
+
+func TestHomeAssistantReannounceAfterReset(t *testing.T) {
+	publisher, fake := newTestHAPublisher()
+	info := utils.SystemInfo{Disk: utils.DiskStats{Usage: []utils.DiskUsage{{Mountpoint: "/mnt/usb"}}}}
+	publishInfo(t, publisher, info)
+
+	// The disk is unmounted while the connection is down.
+	publisher.homeAssistant.reset()
+	fake.published = nil
+	info.Disk.Usage = nil
+	publishInfo(t, publisher, info)
+
+	if len(topicsWithPrefix(fake.published, "edgebeat/edge-01/availability")) != 1 {
+		t.Fatal("expected availability after reset")
+	}
+	if n := len(topicsWithPrefix(fake.published, "homeassistant/sensor/edge_01/cpu_percent/config")); n != 1 {
+		t.Fatalf("cpu discovery sent %d times after reset", n)
+	}
+	removed := topicsWithPrefix(fake.published, "homeassistant/sensor/edge_01/disk_mnt_usb_percent/config")
+	if len(removed) != 1 || len(removed[0].payload) != 0 {
+		t.Fatalf("removal after reset = %+v", removed)
+	}
+
+	// Only the reconnect forces a re-send.
+	fake.published = nil
+	publishInfo(t, publisher, info)
+	if n := len(topicsWithPrefix(fake.published, "homeassistant/")); n != 0 {
+		t.Fatalf("re-announced %d discovery configs", n)
+	}
+}
+
+func TestHomeAssistantCloseOffline(t *testing.T) {
+	publisher, fake := newTestHAPublisher()
+	if err := publisher.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(fake.published) != 1 || string(fake.published[0].payload) != "offline" {
+		t.Fatalf("published = %+v", fake.published)
+	}
+}
+
+func TestObjectID(t *testing.T) {
+	cases := map[string]string{"/": "root", "/var/log": "var_log", "Core 0": "core_0", "C:\\": "c"}
+	for in, want := range cases {
+		if got := objectID(in); got != want {
+			t.Fatalf("objectID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -9,11 +9,24 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	ProtocolV311 = "3.1.1"
+	ProtocolV5   = "5"
+)
+
+const (
+	PayloadJSON       = "json"
+	PayloadSparkplugB = "sparkplug_b"
+)
+
 type Publisher struct {
-	client pahomqtt.Client
-	topic  string
-	qos    byte
-	logger *zap.Logger
+	client        pahomqtt.Client
+	v5            *v5Session
+	sparkplug     *sparkplugNode
+	homeAssistant *homeAssistant
+	topic         string
+	qos           byte
+	logger        *zap.Logger
 }
 
 type Config struct {
@@ -23,13 +36,74 @@ type Config struct {
 	Username string
 	Password string
 	QoS      byte
+
+	// Brokers and BrokerMode are only used by NewGroup.
+	Brokers    []string
+	BrokerMode string
+
+	// ProtocolVersion selects the client implementation; empty means 3.1.1.
+	ProtocolVersion string
+
+	// The remaining fields are only sent when ProtocolVersion is ProtocolV5.
+	ContentType          string
+	MessageExpirySeconds uint32
+	TopicAlias           bool
+	UserProperties       map[string]string
+
+	// PayloadFormat PayloadSparkplugB publishes a Sparkplug B edge node
+	// session; any other format publishes payloads as given.
+	PayloadFormat string
+	Sparkplug     SparkplugConfig
+
+	HomeAssistant HomeAssistantConfig
 }
 
 func NewPublisher(ctx context.Context, cfg Config, logger *zap.Logger) (*Publisher, error) {
+	p, awaitConnection, err := dial(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := awaitConnection(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// dial creates a publisher whose client keeps connecting in the background.
+// The returned function blocks until the first connection is established.
+func dial(ctx context.Context, cfg Config, logger *zap.Logger) (*Publisher, func(context.Context) error, error) {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
+	var node *sparkplugNode
+	if cfg.PayloadFormat == PayloadSparkplugB {
+		if cfg.ProtocolVersion == ProtocolV5 {
+			return nil, nil, fmt.Errorf("sparkplug_b payload format requires mqtt protocol 3.1.1")
+		}
+		node = newSparkplugNode(cfg.Sparkplug)
+	}
+
+	var ha *homeAssistant
+	if cfg.HomeAssistant.Enabled {
+		if node != nil {
+			return nil, nil, fmt.Errorf("home assistant discovery cannot be combined with sparkplug_b")
+		}
+		ha = newHomeAssistant(cfg.HomeAssistant)
+	}
+
+	if cfg.ProtocolVersion == ProtocolV5 {
+		return newV5Publisher(ctx, cfg, ha, logger)
+	}
+
+	p := &Publisher{
+		sparkplug:     node,
+		homeAssistant: ha,
+		topic:         cfg.Topic,
+		qos:           cfg.QoS,
+		logger:        logger,
+	}
+
 	opts := pahomqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
 	opts.SetClientID(cfg.ClientID)
@@ -48,42 +122,81 @@ func NewPublisher(ctx context.Context, cfg Config, logger *zap.Logger) (*Publish
 
 	opts.SetOnConnectHandler(func(client pahomqtt.Client) {
 		logger.Info("mqtt connected", zap.String("broker", cfg.Broker))
+		if node != nil {
+			p.sparkplugConnected(client)
+		}
+		if ha != nil {
+			ha.reset()
+		}
 	})
 
+	if node != nil {
+		node.configure(opts)
+	}
+	if ha != nil {
+		opts.SetWill(ha.availabilityTopic(), haOffline, 1, true)
+	}
+
 	opts.SetConnectionLostHandler(func(client pahomqtt.Client, err error) {
 		logger.Warn("mqtt connection lost", zap.Error(err))
 	})
 
-	client := pahomqtt.NewClient(opts)
-	token := client.Connect()
-
-	select {
-	case <-ctx.Done():
-		return nil, fmt.Errorf("context cancelled during mqtt connection")
-	case <-token.Done():
-		if token.Error() != nil {
-			return nil, fmt.Errorf("mqtt connect: %w", token.Error())
+	// The client is set before connecting, as the connect handler uses it.
+	p.client = pahomqtt.NewClient(opts)
+	token := p.client.Connect()
+
+	awaitConnection := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("mqtt connect: %w", ctx.Err())
+		case <-token.Done():
+			if token.Error() != nil {
+				return fmt.Errorf("mqtt connect: %w", token.Error())
+			}
 		}
+		return nil
 	}
 
-	return &Publisher{
-		client: client,
-		topic:  cfg.Topic,
-		qos:    cfg.QoS,
-		logger: logger,
-	}, nil
+	return p, awaitConnection, nil
 }
 
 func (p *Publisher) Publish(ctx context.Context, payload []byte) error {
-	if p == nil || p.client == nil {
+	if p == nil || (p.client == nil && p.v5 == nil) {
 		return fmt.Errorf("publisher not initialized")
 	}
 
+	if p.sparkplug != nil {
+		return p.publishSparkplug(ctx, payload)
+	}
+
+	if err := p.publish(ctx, p.topic, p.qos, false, payload); err != nil {
+		return err
+	}
+
+	if p.homeAssistant != nil {
+		return p.publishHomeAssistant(ctx, payload)
+	}
+	return nil
+}
+
+func (p *Publisher) isConnected() bool {
+	if p.v5 != nil {
+		return p.v5.isConnected()
+	}
+	return p.client.IsConnected()
+}
+
+// publish sends a single message using whichever protocol client is configured.
+func (p *Publisher) publish(ctx context.Context, topic string, qos byte, retained bool, payload []byte) error {
+	if p.v5 != nil {
+		return p.publishV5(ctx, topic, qos, retained, payload)
+	}
+
 	if !p.client.IsConnected() {
 		return fmt.Errorf("mqtt client not connected")
 	}
 
-	token := p.client.Publish(p.topic, p.qos, false, payload)
+	token := p.client.Publish(topic, qos, retained, payload)
 
 	select {
 	case <-ctx.Done():
@@ -94,15 +207,27 @@ func (p *Publisher) Publish(ctx context.Context, payload []byte) error {
 		}
 	}
 
-	p.logger.Debug("mqtt published", zap.String("topic", p.topic), zap.Int("bytes", len(payload)))
+	p.logger.Debug("mqtt published", zap.String("topic", topic), zap.Int("bytes", len(payload)))
 	return nil
 }
 
 func (p *Publisher) Close() error {
+	if p != nil && p.homeAssistant != nil && (p.v5 != nil || p.client != nil) {
+		p.publishOffline()
+	}
+
+	if p != nil && p.v5 != nil {
+		return p.closeV5()
+	}
+
 	if p == nil || p.client == nil {
 		return nil
 	}
 
+	if p.sparkplug != nil {
+		p.publishDeath()
+	}
+
 	p.client.Disconnect(1000)
 	p.logger.Info("mqtt disconnected")
 	return nil
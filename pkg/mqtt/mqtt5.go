@@ -0,0 +1,285 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+)
+
+// v5Client is the subset of autopaho.ConnectionManager used by the publisher.
+type v5Client interface {
+	Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error)
+	Disconnect(ctx context.Context) error
+}
+
+// v5Session tracks per-connection MQTT 5 state. Topic aliases only live as
+// long as the network connection, so they are reset on every reconnect.
+type v5Session struct {
+	client v5Client
+
+	contentType   string
+	messageExpiry uint32
+	topicAlias    bool
+	userProps     paho.UserProperties
+
+	// onUp runs after connection state has been reset on every connect.
+	onUp func()
+
+	mu         sync.Mutex
+	connected  bool
+	connectErr error
+	aliasMax   uint16
+	aliases    map[string]uint16
+	confirmed  map[string]bool
+}
+
+func newV5Session(cfg Config) *v5Session {
+	keys := make([]string, 0, len(cfg.UserProperties))
+	for k := range cfg.UserProperties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	props := make(paho.UserProperties, 0, len(keys))
+	for _, k := range keys {
+		props.Add(k, cfg.UserProperties[k])
+	}
+
+	return &v5Session{
+		contentType:   cfg.ContentType,
+		messageExpiry: cfg.MessageExpirySeconds,
+		topicAlias:    cfg.TopicAlias,
+		userProps:     props,
+		aliases:       make(map[string]uint16),
+		confirmed:     make(map[string]bool),
+	}
+}
+
+func (s *v5Session) connectionUp(connack *paho.Connack) {
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		if s.onUp != nil {
+			s.onUp()
+		}
+	}()
+
+	s.connected = true
+	s.aliasMax = 0
+	if connack != nil && connack.Properties != nil && connack.Properties.TopicAliasMaximum != nil {
+		s.aliasMax = *connack.Properties.TopicAliasMaximum
+	}
+	s.aliases = make(map[string]uint16)
+	s.confirmed = make(map[string]bool)
+}
+
+// connectFailed records the error of a failed connect attempt, which is
+// reported when the first connection does not come up in time.
+func (s *v5Session) connectFailed(err error) {
+	s.mu.Lock()
+	s.connectErr = err
+	s.mu.Unlock()
+}
+
+func (s *v5Session) connectionDown() {
+	s.mu.Lock()
+	s.connected = false
+	s.mu.Unlock()
+}
+
+func (s *v5Session) isConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected
+}
+
+// alias returns the topic alias to use for topic and whether the full topic
+// name still has to be sent to establish it. An alias of 0 means none.
+func (s *v5Session) alias(topic string) (uint16, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.topicAlias || s.aliasMax == 0 {
+		return 0, true
+	}
+
+	if a, ok := s.aliases[topic]; ok {
+		return a, !s.confirmed[topic]
+	}
+
+	if len(s.aliases) >= int(s.aliasMax) {
+		return 0, true
+	}
+
+	a := uint16(len(s.aliases) + 1)
+	s.aliases[topic] = a
+	return a, true
+}
+
+func (s *v5Session) confirmAlias(topic string, alias uint16) {
+	s.mu.Lock()
+	if s.aliases[topic] == alias {
+		s.confirmed[topic] = true
+	}
+	s.mu.Unlock()
+}
+
+func newV5Publisher(ctx context.Context, cfg Config, ha *homeAssistant, logger *zap.Logger) (*Publisher, func(context.Context) error, error) {
+	brokerURL, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mqtt broker url: %w", err)
+	}
+
+	session := newV5Session(cfg)
+	if ha != nil {
+		session.onUp = ha.reset
+	}
+
+	clientCfg := autopaho.ClientConfig{
+		ServerUrls:       []*url.URL{brokerURL},
+		KeepAlive:        30,
+		ReconnectBackoff: reconnectBackoff,
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+			session.connectionUp(connack)
+			logger.Info("mqtt connected", zap.String("broker", cfg.Broker), zap.String("protocol", ProtocolV5))
+		},
+		OnConnectionDown: func() bool {
+			session.connectionDown()
+			logger.Warn("mqtt connection lost", zap.String("broker", cfg.Broker))
+			return true
+		},
+		OnConnectError: func(err error) {
+			session.connectFailed(err)
+			logger.Warn("mqtt connect attempt failed", zap.String("broker", cfg.Broker), zap.Error(err))
+		},
+		ConnectUsername: cfg.Username,
+		ConnectPassword: []byte(cfg.Password),
+		ClientConfig: paho.ClientConfig{
+			ClientID: cfg.ClientID,
+		},
+	}
+	if ha != nil {
+		clientCfg.WillMessage = &paho.WillMessage{Topic: ha.availabilityTopic(), Payload: []byte(haOffline), QoS: 1, Retain: true}
+	}
+
+	cm, err := autopaho.NewConnection(ctx, clientCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mqtt connect: %w", err)
+	}
+
+	session.client = cm
+
+	awaitConnection := func(ctx context.Context) error {
+		if err := cm.AwaitConnection(ctx); err != nil {
+			session.mu.Lock()
+			if session.connectErr != nil {
+				err = session.connectErr
+			}
+			session.mu.Unlock()
+			return fmt.Errorf("mqtt connect: %w", err)
+		}
+		return nil
+	}
+
+	return &Publisher{
+		v5:            session,
+		homeAssistant: ha,
+		topic:         cfg.Topic,
+		qos:           cfg.QoS,
+		logger:        logger,
+	}, awaitConnection, nil
+}
+
+// reconnectBackoff mirrors the 3.1.1 client settings: retry after 5s and
+// double the wait up to a 60s ceiling.
+func reconnectBackoff(attempt int) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+	delay := 5 * time.Second
+	for i := 1; i < attempt && delay < 60*time.Second; i++ {
+		delay *= 2
+	}
+	if delay > 60*time.Second {
+		delay = 60 * time.Second
+	}
+	return delay
+}
+
+func (p *Publisher) publishV5(ctx context.Context, topic string, qos byte, retained bool, payload []byte) error {
+	s := p.v5
+	if s.client == nil {
+		return fmt.Errorf("publisher not initialized")
+	}
+
+	if !s.isConnected() {
+		return fmt.Errorf("mqtt client not connected")
+	}
+
+	props := &paho.PublishProperties{User: s.userProps}
+	// The content type describes the snapshot encoding. Home Assistant
+	// discovery, availability and state messages go to other topics.
+	if topic == p.topic {
+		props.ContentType = s.contentType
+	}
+	if s.messageExpiry > 0 {
+		expiry := s.messageExpiry
+		props.MessageExpiry = &expiry
+	}
+
+	pubTopic := topic
+	alias, sendTopic := s.alias(topic)
+	if alias != 0 {
+		props.TopicAlias = &alias
+		if !sendTopic {
+			pubTopic = ""
+		}
+	}
+
+	_, err := s.client.Publish(ctx, &paho.Publish{
+		Topic:      pubTopic,
+		QoS:        qos,
+		Retain:     retained,
+		Payload:    payload,
+		Properties: props,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("context cancelled during publish")
+		}
+		return fmt.Errorf("mqtt publish: %w", err)
+	}
+
+	if alias != 0 && sendTopic {
+		s.confirmAlias(topic, alias)
+	}
+
+	p.logger.Debug("mqtt published",
+		zap.String("topic", topic),
+		zap.Uint16("topic_alias", alias),
+		zap.Int("bytes", len(payload)),
+	)
+	return nil
+}
+
+func (p *Publisher) closeV5() error {
+	if p.v5.client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.v5.client.Disconnect(ctx); err != nil {
+		return fmt.Errorf("mqtt disconnect: %w", err)
+	}
+	p.logger.Info("mqtt disconnected")
+	return nil
+}
@@ -0,0 +1,186 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+)
+
+type fakeV5Client struct {
+	published        []*paho.Publish
+	err              error
+	disconnectCalled bool
+}
+
+func (c *fakeV5Client) Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.published = append(c.published, p)
+	return &paho.PublishResponse{}, nil
+}
+
+func (c *fakeV5Client) Disconnect(ctx context.Context) error {
+	c.disconnectCalled = true
+	return nil
+}
+
+func newTestV5Publisher(cfg Config, aliasMax uint16) (*Publisher, *fakeV5Client) {
+	fake := &fakeV5Client{}
+	session := newV5Session(cfg)
+	session.client = fake
+	session.connectionUp(&paho.Connack{Properties: &paho.ConnackProperties{TopicAliasMaximum: &aliasMax}})
+	return &Publisher{v5: session, topic: cfg.Topic, qos: cfg.QoS, logger: zap.NewNop()}, fake
+}
+
+func TestV5PublishProperties(t *testing.T) {
+	publisher, fake := newTestV5Publisher(Config{
+		Topic:                "edgebeat/health",
+		QoS:                  1,
+		ContentType:          "application/json",
+		MessageExpirySeconds: 120,
+		UserProperties:       map[string]string{"schema_version": "1", "hostname": "edge-01"},
+	}, 0)
+
+	if err := publisher.Publish(context.Background(), []byte("{}")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(fake.published) != 1 {
+		t.Fatalf("published = %d, want 1", len(fake.published))
+	}
+
+	msg := fake.published[0]
+	if msg.Topic != "edgebeat/health" || msg.QoS != 1 {
+		t.Fatalf("publish = %+v", msg)
+	}
+	if msg.Properties.ContentType != "application/json" {
+		t.Fatalf("ContentType = %q", msg.Properties.ContentType)
+	}
+	if msg.Properties.MessageExpiry == nil || *msg.Properties.MessageExpiry != 120 {
+		t.Fatalf("MessageExpiry = %v", msg.Properties.MessageExpiry)
+	}
+	if msg.Properties.TopicAlias != nil {
+		t.Fatalf("TopicAlias = %d, want none when broker disallows aliases", *msg.Properties.TopicAlias)
+	}
+	if got := msg.Properties.User.Get("hostname"); got != "edge-01" {
+		t.Fatalf("user property hostname = %q", got)
+	}
+	if msg.Properties.User[0].Key != "hostname" {
+		t.Fatalf("user properties not sorted: %+v", msg.Properties.User)
+	}
+}
+
+func TestV5ContentTypeOnlyOnSnapshots(t *testing.T) {
+	publisher, fake := newTestV5Publisher(Config{Topic: "edgebeat/health", ContentType: "application/cbor"}, 0)
+	publisher.homeAssistant = newHomeAssistant(HomeAssistantConfig{Enabled: true, DiscoveryPrefix: "homeassistant", NodeID: "edge-01", StatePrefix: "edgebeat/edge-01"})
+
+	if err := publisher.Publish(context.Background(), []byte("{}")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(fake.published) < 2 {
+		t.Fatalf("published = %d messages", len(fake.published))
+	}
+	for _, msg := range fake.published {
+		want := ""
+		if msg.Topic == "edgebeat/health" {
+			want = "application/cbor"
+		}
+		if msg.Properties.ContentType != want {
+			t.Fatalf("%s: ContentType = %q, want %q", msg.Topic, msg.Properties.ContentType, want)
+		}
+	}
+}
+
+func TestV5AwaitConnectionError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, awaitConnection, err := newV5Publisher(ctx, Config{Broker: "mqtt://127.0.0.1:1", ClientID: "test"}, nil, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newV5Publisher: %v", err)
+	}
+	// The refused connect attempt is reported rather than the deadline.
+	err = awaitConnection(ctx)
+	if err == nil || !strings.HasPrefix(err.Error(), "mqtt connect: ") || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("awaitConnection = %v", err)
+	}
+}
+
+func TestV5PublishTopicAlias(t *testing.T) {
+	publisher, fake := newTestV5Publisher(Config{Topic: "edgebeat/health", TopicAlias: true}, 10)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := publisher.Publish(ctx, []byte("{}")); err != nil {
+			t.Fatalf("Publish %d: %v", i, err)
+		}
+	}
+
+	first, second := fake.published[0], fake.published[1]
+	if first.Topic != "edgebeat/health" || first.Properties.TopicAlias == nil || *first.Properties.TopicAlias != 1 {
+		t.Fatalf("first publish = topic %q alias %v", first.Topic, first.Properties.TopicAlias)
+	}
+	if second.Topic != "" || second.Properties.TopicAlias == nil || *second.Properties.TopicAlias != 1 {
+		t.Fatalf("second publish = topic %q alias %v", second.Topic, second.Properties.TopicAlias)
+	}
+
+	// Aliases must be re-established after a reconnect.
+	aliasMax := uint16(10)
+	publisher.v5.connectionUp(&paho.Connack{Properties: &paho.ConnackProperties{TopicAliasMaximum: &aliasMax}})
+	if err := publisher.Publish(ctx, []byte("{}")); err != nil {
+		t.Fatalf("Publish after reconnect: %v", err)
+	}
+	if third := fake.published[2]; third.Topic != "edgebeat/health" {
+		t.Fatalf("publish after reconnect topic = %q", third.Topic)
+	}
+}
+
+func TestV5PublishErrors(t *testing.T) {
+	publisher, fake := newTestV5Publisher(Config{Topic: "test", TopicAlias: true}, 10)
+
+	fake.err = errors.New("boom")
+	err := publisher.Publish(context.Background(), []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "mqtt publish") {
+		t.Fatalf("expected publish error, got %v", err)
+	}
+
+	// A failed publish must not leave the alias marked as established.
+	fake.err = nil
+	if err := publisher.Publish(context.Background(), []byte("{}")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if fake.published[0].Topic != "test" {
+		t.Fatalf("topic = %q, want full topic after failed alias publish", fake.published[0].Topic)
+	}
+
+	publisher.v5.connectionDown()
+	if err := publisher.Publish(context.Background(), []byte("{}")); err == nil {
+		t.Fatal("expected error for disconnected client")
+	}
+}
+
+func TestV5Close(t *testing.T) {
+	publisher, fake := newTestV5Publisher(Config{Topic: "test"}, 0)
+	if err := publisher.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !fake.disconnectCalled {
+		t.Fatal("expected Disconnect to be called")
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	if got := reconnectBackoff(0); got != 0 {
+		t.Fatalf("reconnectBackoff(0) = %v", got)
+	}
+	if got := reconnectBackoff(1); got.Seconds() != 5 {
+		t.Fatalf("reconnectBackoff(1) = %v", got)
+	}
+	if got := reconnectBackoff(10); got.Seconds() != 60 {
+		t.Fatalf("reconnectBackoff(10) = %v", got)
+	}
+}
@@ -46,10 +46,21 @@ func (t *fakeToken) Error() error {
 	return t.err
 }
 
+type fakeMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
 type fakeClient struct {
 	connected        bool
 	publishToken     pahomqtt.Token
 	disconnectCalled bool
+	published        []fakeMessage
+	// subscribeTokens answer the next subscribes; later ones succeed.
+	subscribeTokens []pahomqtt.Token
+	subscribed      []string
 }
 
 func (c *fakeClient) IsConnected() bool       { return c.connected }
@@ -57,9 +68,17 @@ func (c *fakeClient) IsConnectionOpen() bool  { return c.connected }
 func (c *fakeClient) Connect() pahomqtt.Token { return newFakeToken(nil, true) }
 func (c *fakeClient) Disconnect(quiesce uint) { c.disconnectCalled = true }
 func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) pahomqtt.Token {
+	data, _ := payload.([]byte)
+	c.published = append(c.published, fakeMessage{topic: topic, qos: qos, retained: retained, payload: data})
 	return c.publishToken
 }
 func (c *fakeClient) Subscribe(topic string, qos byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	c.subscribed = append(c.subscribed, topic)
+	if len(c.subscribeTokens) > 0 {
+		token := c.subscribeTokens[0]
+		c.subscribeTokens = c.subscribeTokens[1:]
+		return token
+	}
 	return newFakeToken(nil, true)
 }
 func (c *fakeClient) SubscribeMultiple(filters map[string]byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
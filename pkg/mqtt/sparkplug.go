@@ -0,0 +1,298 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jilanisayyad/edgebeat/pkg/sparkplug"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Bounds of the session setup on every connect: the NCMD subscription is
+// tried sparkplugSubscribeAttempts times, and each step waits at most
+// sparkplugConnectTimeout.
+const (
+	sparkplugSubscribeAttempts = 3
+	sparkplugConnectTimeout    = 10 * time.Second
+)
+
+type SparkplugConfig struct {
+	GroupID    string
+	EdgeNodeID string
+}
+
+// sparkplugNode holds the edge node session state. The NBIRTH/NDEATH pair is
+// tied together by bdSeq, which advances on every CONNECT so that a host can
+// discard a stale NDEATH delivered after the node has already reconnected.
+type sparkplugNode struct {
+	groupID    string
+	edgeNodeID string
+
+	// send serialises prepare, publish and commit, as an NBIRTH is sent
+	// both on connect and with collections.
+	send sync.Mutex
+
+	mu       sync.Mutex
+	bdSeq    uint64
+	seq      uint64
+	born     bool
+	last     map[string]any
+	snapshot *utils.SystemInfo
+}
+
+// sparkplugMessage is a prepared message that has not been published yet.
+type sparkplugMessage struct {
+	messageType string
+	seq         uint64
+	metrics     []sparkplug.Metric
+	payload     []byte
+}
+
+func newSparkplugNode(cfg SparkplugConfig) *sparkplugNode {
+	return &sparkplugNode{
+		groupID:    cfg.GroupID,
+		edgeNodeID: cfg.EdgeNodeID,
+		last:       make(map[string]any),
+	}
+}
+
+func (n *sparkplugNode) topic(messageType string) string {
+	return sparkplug.Topic(n.groupID, messageType, n.edgeNodeID)
+}
+
+func (n *sparkplugNode) deathPayload() []byte {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return sparkplug.Payload{
+		Timestamp: uint64(time.Now().UnixMilli()),
+		Metrics:   []sparkplug.Metric{sparkplug.Int64(sparkplug.MetricBdSeq, int64(n.bdSeq))},
+	}.Marshal()
+}
+
+// configure registers the NDEATH will and refreshes it before each reconnect.
+func (n *sparkplugNode) configure(opts *pahomqtt.ClientOptions) {
+	opts.SetBinaryWill(n.topic(sparkplug.NDEATH), n.deathPayload(), 1, false)
+	opts.SetReconnectingHandler(func(_ pahomqtt.Client, o *pahomqtt.ClientOptions) {
+		n.mu.Lock()
+		n.bdSeq = (n.bdSeq + 1) % 256
+		n.mu.Unlock()
+		o.SetBinaryWill(n.topic(sparkplug.NDEATH), n.deathPayload(), 1, false)
+	})
+}
+
+// subscribeCommands listens for rebirth requests. Without the subscription
+// hosts cannot ask for a rebirth, so a failed subscribe is retried.
+func (p *Publisher) subscribeCommands(client pahomqtt.Client) {
+	topic := p.sparkplug.topic(sparkplug.NCMD)
+	// The NBIRTH is published outside the handler, which must not wait for
+	// a publish.
+	handler := func(_ pahomqtt.Client, msg pahomqtt.Message) {
+		go p.sparkplugCommand(msg.Payload())
+	}
+	for attempt := 1; attempt <= sparkplugSubscribeAttempts; attempt++ {
+		err := waitSubscribe(client.Subscribe(topic, 1, handler), topic)
+		if err == nil {
+			return
+		}
+		p.logger.Warn("sparkplug ncmd subscribe failed", zap.String("topic", topic), zap.Int("attempt", attempt), zap.Error(err))
+		if !client.IsConnected() {
+			return
+		}
+	}
+}
+
+// waitSubscribe waits for the SUBACK of topic.
+func waitSubscribe(token pahomqtt.Token, topic string) error {
+	if !token.WaitTimeout(sparkplugConnectTimeout) {
+		return fmt.Errorf("no suback within %s", sparkplugConnectTimeout)
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+	// Brokers refuse a subscription, e.g. by ACL, with return code 0x80.
+	if st, ok := token.(*pahomqtt.SubscribeToken); ok && st.Result()[topic] == 0x80 {
+		return fmt.Errorf("subscription refused by broker")
+	}
+	return nil
+}
+
+func (n *sparkplugNode) requestRebirth() {
+	n.mu.Lock()
+	n.born = false
+	n.mu.Unlock()
+}
+
+// handleCommand processes an NCMD payload and reports whether it asked for a
+// rebirth, in which case the next message is an NBIRTH.
+func (n *sparkplugNode) handleCommand(payload []byte) bool {
+	cmd, err := sparkplug.Unmarshal(payload)
+	if err != nil {
+		return false
+	}
+	for _, m := range cmd.Metrics {
+		if m.Name == sparkplug.MetricRebirth && m.Value == true {
+			n.requestRebirth()
+			return true
+		}
+	}
+	return false
+}
+
+// prepare builds the next message for info and keeps info for the NBIRTH of
+// the next connection. It returns an NBIRTH when the node has not been born
+// on this connection or a metric appeared that the host has not seen,
+// otherwise an NDATA carrying only changed metrics. A nil message means
+// nothing changed.
+func (n *sparkplugNode) prepare(info utils.SystemInfo, now time.Time) *sparkplugMessage {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.snapshot = &info
+	// Metrics carry the time of the snapshot, which is older than now when
+	// an NBIRTH is built from a kept snapshot.
+	ts := uint64(now.UnixMilli())
+	sampled := ts
+	if t, err := time.Parse(time.RFC3339Nano, info.Timestamp); err == nil {
+		sampled = uint64(t.UnixMilli())
+	}
+	metrics := sparkplug.FromSystemInfo(info)
+	for i := range metrics {
+		metrics[i].Timestamp = sampled
+	}
+
+	rebirth := !n.born
+	if !rebirth {
+		for _, m := range metrics {
+			if _, ok := n.last[m.Name]; !ok {
+				rebirth = true
+				break
+			}
+		}
+	}
+
+	if rebirth {
+		metrics = append(metrics,
+			sparkplug.Metric{Name: sparkplug.MetricBdSeq, Timestamp: ts, DataType: sparkplug.TypeInt64, Value: int64(n.bdSeq)},
+			sparkplug.Metric{Name: sparkplug.MetricRebirth, Timestamp: ts, DataType: sparkplug.TypeBoolean, Value: false},
+		)
+		msg := &sparkplugMessage{messageType: sparkplug.NBIRTH, seq: 0, metrics: metrics}
+		msg.payload = sparkplug.Payload{Timestamp: ts, Seq: msg.seq, Metrics: metrics}.Marshal()
+		return msg
+	}
+
+	changed := make([]sparkplug.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if n.last[m.Name] != m.Value {
+			changed = append(changed, m)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	msg := &sparkplugMessage{messageType: sparkplug.NDATA, seq: (n.seq + 1) % 256, metrics: changed}
+	msg.payload = sparkplug.Payload{Timestamp: ts, Seq: msg.seq, Metrics: changed}.Marshal()
+	return msg
+}
+
+// commit records a successfully published message.
+func (n *sparkplugNode) commit(msg *sparkplugMessage) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if msg.messageType == sparkplug.NBIRTH {
+		n.born = true
+		n.last = make(map[string]any, len(msg.metrics))
+	}
+	for _, m := range msg.metrics {
+		n.last[m.Name] = m.Value
+	}
+	n.seq = msg.seq
+}
+
+// sparkplugConnected starts the session of a new connection: it subscribes
+// to NCMD and sends the NBIRTH from the last snapshot, so hosts do not wait
+// for the next collection.
+func (p *Publisher) sparkplugConnected(client pahomqtt.Client) {
+	p.sparkplug.requestRebirth()
+	p.subscribeCommands(client)
+	p.publishBirth()
+}
+
+// sparkplugCommand handles an NCMD. A Rebirth request is answered at once
+// with an NBIRTH from the last snapshot.
+func (p *Publisher) sparkplugCommand(payload []byte) {
+	if !p.sparkplug.handleCommand(payload) {
+		return
+	}
+	p.logger.Info("sparkplug rebirth requested", zap.String("topic", p.sparkplug.topic(sparkplug.NCMD)))
+	p.publishBirth()
+}
+
+// publishBirth sends the NBIRTH requested by requestRebirth from the last
+// snapshot. Before the first collection there is no snapshot and the NBIRTH
+// is sent with it.
+func (p *Publisher) publishBirth() {
+	n := p.sparkplug
+	n.mu.Lock()
+	info := n.snapshot
+	n.mu.Unlock()
+	if info == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sparkplugConnectTimeout)
+	defer cancel()
+	if err := p.sendSparkplug(ctx, *info); err != nil {
+		p.logger.Warn("sparkplug nbirth publish failed", zap.Error(err))
+	}
+}
+
+func (p *Publisher) publishSparkplug(ctx context.Context, payload []byte) error {
+	var info utils.SystemInfo
+	if err := json.Unmarshal(payload, &info); err != nil {
+		return fmt.Errorf("sparkplug decode: %w", err)
+	}
+	return p.sendSparkplug(ctx, info)
+}
+
+func (p *Publisher) sendSparkplug(ctx context.Context, info utils.SystemInfo) error {
+	p.sparkplug.send.Lock()
+	defer p.sparkplug.send.Unlock()
+
+	msg := p.sparkplug.prepare(info, time.Now())
+	if msg == nil {
+		p.logger.Debug("sparkplug no metrics changed")
+		return nil
+	}
+
+	// Sparkplug requires NBIRTH and NDATA to be sent with QoS 0, not retained.
+	if err := p.publish(ctx, p.sparkplug.topic(msg.messageType), 0, false, msg.payload); err != nil {
+		return err
+	}
+
+	p.sparkplug.commit(msg)
+	return nil
+}
+
+// publishDeath announces a clean shutdown; the broker only delivers the will
+// when the connection drops unexpectedly.
+func (p *Publisher) publishDeath() {
+	if !p.isConnected() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	topic := p.sparkplug.topic(sparkplug.NDEATH)
+	if err := p.publish(ctx, topic, 1, false, p.sparkplug.deathPayload()); err != nil {
+		p.logger.Warn("sparkplug ndeath publish failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,237 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jilanisayyad/edgebeat/pkg/sparkplug"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+func newTestSparkplugPublisher() (*Publisher, *fakeClient) {
+	fake := &fakeClient{connected: true, publishToken: newFakeToken(nil, true)}
+	node := newSparkplugNode(SparkplugConfig{GroupID: "plant", EdgeNodeID: "edge-01"})
+	return &Publisher{client: fake, sparkplug: node, topic: "unused", qos: 1, logger: zap.NewNop()}, fake
+}
+
+func publishInfo(t *testing.T, p *Publisher, info utils.SystemInfo) {
+	t.Helper()
+	payload, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := p.Publish(context.Background(), payload); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func decodeSparkplug(t *testing.T, msg fakeMessage) sparkplug.Payload {
+	t.Helper()
+	payload, err := sparkplug.Unmarshal(msg.payload)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return payload
+}
+
+func metricValue(p sparkplug.Payload, name string) (any, bool) {
+	for _, m := range p.Metrics {
+		if m.Name == name {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+func TestSparkplugBirthThenData(t *testing.T) {
+	publisher, fake := newTestSparkplugPublisher()
+	info := utils.SystemInfo{CPU: utils.CPUStats{TotalPercent: 10}, Host: utils.HostStats{Hostname: "edge-01"}}
+
+	publishInfo(t, publisher, info)
+	if len(fake.published) != 1 || fake.published[0].topic != "spBv1.0/plant/NBIRTH/edge-01" {
+		t.Fatalf("published = %+v", fake.published)
+	}
+	if fake.published[0].qos != 0 || fake.published[0].retained {
+		t.Fatalf("NBIRTH qos/retain = %d/%v", fake.published[0].qos, fake.published[0].retained)
+	}
+	birth := decodeSparkplug(t, fake.published[0])
+	if birth.Seq != 0 {
+		t.Fatalf("NBIRTH seq = %d", birth.Seq)
+	}
+	if v, ok := metricValue(birth, sparkplug.MetricBdSeq); !ok || v != int64(0) {
+		t.Fatalf("NBIRTH bdSeq = %v", v)
+	}
+	if _, ok := metricValue(birth, sparkplug.MetricRebirth); !ok {
+		t.Fatal("NBIRTH missing rebirth metric")
+	}
+
+	// Unchanged snapshot publishes nothing.
+	publishInfo(t, publisher, info)
+	if len(fake.published) != 1 {
+		t.Fatalf("published %d messages for unchanged snapshot", len(fake.published))
+	}
+
+	info.CPU.TotalPercent = 20
+	publishInfo(t, publisher, info)
+	if len(fake.published) != 2 || fake.published[1].topic != "spBv1.0/plant/NDATA/edge-01" {
+		t.Fatalf("published = %+v", fake.published)
+	}
+	data := decodeSparkplug(t, fake.published[1])
+	if data.Seq != 1 || len(data.Metrics) != 1 {
+		t.Fatalf("NDATA = %+v", data)
+	}
+	if v, _ := metricValue(data, "CPU/TotalPercent"); v != 20.0 {
+		t.Fatalf("CPU/TotalPercent = %v", v)
+	}
+}
+
+func TestSparkplugRebirthOnNewMetric(t *testing.T) {
+	publisher, fake := newTestSparkplugPublisher()
+	info := utils.SystemInfo{}
+	publishInfo(t, publisher, info)
+
+	info.Disk.Usage = []utils.DiskUsage{{Mountpoint: "/data", UsedPercent: 5}}
+	publishInfo(t, publisher, info)
+	if got := fake.published[1].topic; got != "spBv1.0/plant/NBIRTH/edge-01" {
+		t.Fatalf("topic = %q, want NBIRTH after new metric", got)
+	}
+}
+
+func TestSparkplugSeqWraps(t *testing.T) {
+	node := newSparkplugNode(SparkplugConfig{GroupID: "g", EdgeNodeID: "n"})
+	now := time.Now()
+	info := utils.SystemInfo{}
+
+	node.commit(node.prepare(info, now))
+	for i := 1; i <= 256; i++ {
+		info.Host.Procs = uint64(i)
+		msg := node.prepare(info, now)
+		if msg.seq != uint64(i%256) {
+			t.Fatalf("message %d seq = %d", i, msg.seq)
+		}
+		node.commit(msg)
+	}
+}
+
+func TestSparkplugConnected(t *testing.T) {
+	publisher, fake := newTestSparkplugPublisher()
+	fake.subscribeTokens = []pahomqtt.Token{newFakeToken(errors.New("not authorized"), true)}
+
+	// The failed NCMD subscribe is retried. Without a snapshot the NBIRTH
+	// waits for the first collection.
+	publisher.sparkplugConnected(fake)
+	if len(fake.subscribed) != 2 || fake.subscribed[1] != "spBv1.0/plant/NCMD/edge-01" {
+		t.Fatalf("subscribed = %v", fake.subscribed)
+	}
+	if len(fake.published) != 0 {
+		t.Fatalf("published = %+v", fake.published)
+	}
+
+	info := utils.SystemInfo{Timestamp: "2024-02-15T10:31:45Z", CPU: utils.CPUStats{TotalPercent: 10}}
+	publishInfo(t, publisher, info)
+	publishInfo(t, publisher, info)
+	if len(fake.published) != 1 {
+		t.Fatalf("published %d messages", len(fake.published))
+	}
+
+	// A reconnect sends the NBIRTH of the new session at once. Its values
+	// keep the time of the snapshot they were taken from.
+	publisher.sparkplugConnected(fake)
+	if len(fake.published) != 2 || fake.published[1].topic != "spBv1.0/plant/NBIRTH/edge-01" {
+		t.Fatalf("published = %+v", fake.published)
+	}
+	birth := decodeSparkplug(t, fake.published[1])
+	sampled := uint64(time.Date(2024, 2, 15, 10, 31, 45, 0, time.UTC).UnixMilli())
+	for _, m := range birth.Metrics {
+		if m.Name == "CPU/TotalPercent" && (m.Value != 10.0 || m.Timestamp != sampled) {
+			t.Fatalf("CPU/TotalPercent = %v at %d, want 10 at %d", m.Value, m.Timestamp, sampled)
+		}
+	}
+	if birth.Timestamp <= sampled {
+		t.Fatalf("NBIRTH timestamp = %d, want the send time", birth.Timestamp)
+	}
+	publishInfo(t, publisher, info)
+	if len(fake.published) != 2 {
+		t.Fatalf("published %d messages after the NBIRTH", len(fake.published))
+	}
+}
+
+func TestSparkplugRebirthCommandPublishesBirth(t *testing.T) {
+	publisher, fake := newTestSparkplugPublisher()
+	publishInfo(t, publisher, utils.SystemInfo{CPU: utils.CPUStats{TotalPercent: 10}})
+
+	other := sparkplug.Payload{Metrics: []sparkplug.Metric{sparkplug.Boolean("Other", true)}}.Marshal()
+	publisher.sparkplugCommand(other)
+	if len(fake.published) != 1 {
+		t.Fatalf("published = %+v", fake.published)
+	}
+
+	cmd := sparkplug.Payload{Metrics: []sparkplug.Metric{sparkplug.Boolean(sparkplug.MetricRebirth, true)}}.Marshal()
+	publisher.sparkplugCommand(cmd)
+	if len(fake.published) != 2 || fake.published[1].topic != "spBv1.0/plant/NBIRTH/edge-01" {
+		t.Fatalf("published = %+v", fake.published)
+	}
+	if v, _ := metricValue(decodeSparkplug(t, fake.published[1]), "CPU/TotalPercent"); v != 10.0 {
+		t.Fatalf("CPU/TotalPercent = %v", v)
+	}
+}
+
+func TestSparkplugRebirthCommand(t *testing.T) {
+	node := newSparkplugNode(SparkplugConfig{GroupID: "g", EdgeNodeID: "n"})
+	node.commit(node.prepare(utils.SystemInfo{}, time.Now()))
+
+	other := sparkplug.Payload{Metrics: []sparkplug.Metric{sparkplug.Boolean("Other", true)}}.Marshal()
+	if node.handleCommand(other) {
+		t.Fatal("unexpected rebirth for unrelated command")
+	}
+
+	cmd := sparkplug.Payload{Metrics: []sparkplug.Metric{sparkplug.Boolean(sparkplug.MetricRebirth, true)}}.Marshal()
+	if !node.handleCommand(cmd) {
+		t.Fatal("expected rebirth command to be recognised")
+	}
+	if msg := node.prepare(utils.SystemInfo{}, time.Now()); msg == nil || msg.messageType != sparkplug.NBIRTH {
+		t.Fatalf("prepare after rebirth = %+v", msg)
+	}
+}
+
+func TestSparkplugBdSeqAdvancesOnReconnect(t *testing.T) {
+	node := newSparkplugNode(SparkplugConfig{GroupID: "g", EdgeNodeID: "n"})
+	opts := pahomqtt.NewClientOptions()
+	node.configure(opts)
+
+	if opts.WillTopic != "spBv1.0/g/NDEATH/n" || opts.WillQos != 1 || opts.WillRetained {
+		t.Fatalf("will = %q qos %d retained %v", opts.WillTopic, opts.WillQos, opts.WillRetained)
+	}
+
+	opts.OnReconnecting(nil, opts)
+	death, err := sparkplug.Unmarshal(opts.WillPayload)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v, _ := metricValue(death, sparkplug.MetricBdSeq); v != int64(1) {
+		t.Fatalf("NDEATH bdSeq after reconnect = %v, want 1", v)
+	}
+
+	birth, err := sparkplug.Unmarshal(node.prepare(utils.SystemInfo{}, time.Now()).payload)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v, _ := metricValue(birth, sparkplug.MetricBdSeq); v != int64(1) {
+		t.Fatalf("NBIRTH bdSeq = %v, want to match NDEATH", v)
+	}
+}
+
+func TestSparkplugCloseSendsDeath(t *testing.T) {
+	publisher, fake := newTestSparkplugPublisher()
+	if err := publisher.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(fake.published) != 1 || fake.published[0].topic != "spBv1.0/plant/NDEATH/edge-01" {
+		t.Fatalf("published = %+v", fake.published)
+	}
+}
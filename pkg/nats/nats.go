@@ -0,0 +1,193 @@
+// Package nats publishes snapshots to NATS subjects, optionally through
+// JetStream with publish acknowledgements.
+package nats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// DefaultSubject is used when no subject template is configured.
+const DefaultSubject = "edgebeat.{hostname}.metrics"
+
+type Config struct {
+	// URL is one server URL or a comma separated list.
+	URL string
+	// Subject may contain {hostname}, which is replaced by the host name
+	// with characters NATS treats specially turned into '_'.
+	Subject string
+	// Name identifies the connection on the server.
+	Name string
+
+	Username        string
+	Password        string
+	Token           string
+	CredentialsFile string
+
+	// JetStream publishes through JetStream and waits for the stream's
+	// acknowledgement. Stream optionally names the stream that must store
+	// the messages.
+	JetStream bool
+	Stream    string
+
+	// ReconnectWait is the pause between reconnect attempts.
+	ReconnectWait time.Duration
+}
+
+// Publisher implements controller.Publisher. The connection is retried in
+// the background like the MQTT client's auto reconnect: core NATS publishes
+// are buffered while disconnected, JetStream publishes fail until the
+// connection is back.
+type Publisher struct {
+	conn    *natsgo.Conn
+	js      jetstream.JetStream
+	subject string
+	stream  string
+	logger  *zap.Logger
+}
+
+func NewPublisher(ctx context.Context, cfg Config, logger *zap.Logger) (*Publisher, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("nats url is required")
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = DefaultSubject
+	}
+	hostname, _ := os.Hostname()
+	subject, err := ExpandSubject(cfg.Subject, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReconnectWait <= 0 {
+		cfg.ReconnectWait = 2 * time.Second
+	}
+
+	opts := []natsgo.Option{
+		natsgo.Name(cfg.Name),
+		natsgo.RetryOnFailedConnect(true),
+		natsgo.MaxReconnects(-1),
+		natsgo.ReconnectWait(cfg.ReconnectWait),
+		natsgo.ConnectHandler(func(c *natsgo.Conn) {
+			logger.Info("nats connected", zap.String("server", c.ConnectedUrlRedacted()))
+		}),
+		natsgo.ReconnectHandler(func(c *natsgo.Conn) {
+			logger.Info("nats reconnected", zap.String("server", c.ConnectedUrlRedacted()))
+		}),
+		natsgo.DisconnectErrHandler(func(c *natsgo.Conn, err error) {
+			if err != nil {
+				logger.Warn("nats connection lost", zap.Error(err))
+			}
+		}),
+	}
+	switch {
+	case cfg.CredentialsFile != "":
+		opts = append(opts, natsgo.UserCredentials(cfg.CredentialsFile))
+	case cfg.Token != "":
+		opts = append(opts, natsgo.Token(cfg.Token))
+	case cfg.Username != "":
+		opts = append(opts, natsgo.UserInfo(cfg.Username, cfg.Password))
+	}
+
+	conn, err := natsgo.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+
+	p := &Publisher{conn: conn, subject: subject, stream: cfg.Stream, logger: logger}
+	if cfg.JetStream {
+		if p.js, err = jetstream.New(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("nats jetstream: %w", err)
+		}
+	}
+	return p, nil
+}
+
+func (p *Publisher) Publish(ctx context.Context, payload []byte) error {
+	if p == nil || p.conn == nil {
+		return fmt.Errorf("publisher not initialized")
+	}
+	if p.conn.IsClosed() {
+		return fmt.Errorf("nats connection closed")
+	}
+
+	if p.js == nil {
+		if err := p.conn.Publish(p.subject, payload); err != nil {
+			return fmt.Errorf("nats publish: %w", err)
+		}
+		p.logger.Debug("nats published", zap.String("subject", p.subject), zap.Int("bytes", len(payload)))
+		return nil
+	}
+
+	// The message id lets the stream drop the duplicate when a retry
+	// follows a publish whose acknowledgement got lost.
+	sum := sha256.Sum256(payload)
+	opts := []jetstream.PublishOpt{jetstream.WithMsgID(hex.EncodeToString(sum[:16]))}
+	if p.stream != "" {
+		opts = append(opts, jetstream.WithExpectStream(p.stream))
+	}
+	ack, err := p.js.Publish(ctx, p.subject, payload, opts...)
+	if err != nil {
+		return fmt.Errorf("nats jetstream publish: %w", err)
+	}
+	p.logger.Debug("nats jetstream published",
+		zap.String("subject", p.subject),
+		zap.String("stream", ack.Stream),
+		zap.Uint64("seq", ack.Sequence),
+		zap.Bool("duplicate", ack.Duplicate))
+	return nil
+}
+
+// Connected reports whether the connection to a server is currently up.
+func (p *Publisher) Connected() bool {
+	return p != nil && p.conn != nil && p.conn.IsConnected()
+}
+
+func (p *Publisher) Close() error {
+	if p == nil || p.conn == nil || p.conn.IsClosed() {
+		return nil
+	}
+	if p.conn.IsConnected() {
+		if err := p.conn.FlushTimeout(2 * time.Second); err != nil {
+			p.logger.Warn("nats flush failed", zap.Error(err))
+		}
+	}
+	p.conn.Close()
+	p.logger.Info("nats disconnected")
+	return nil
+}
+
+// ExpandSubject replaces {hostname} in template and checks that the result is
+// a valid subject to publish to.
+func ExpandSubject(template, hostname string) (string, error) {
+	token := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, hostname)
+	if token == "" {
+		token = "unknown"
+	}
+
+	subject := strings.ReplaceAll(template, "{hostname}", token)
+	for _, t := range strings.Split(subject, ".") {
+		if t == "" || t == "*" || t == ">" || strings.ContainsAny(t, " \t\r\n") {
+			return "", fmt.Errorf("invalid nats subject %q", subject)
+		}
+	}
+	return subject, nil
+}
@@ -0,0 +1,161 @@
+package nats
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+func runServer(t *testing.T, port int, storeDir string) *server.Server {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: port, JetStream: true, StoreDir: storeDir, NoSigs: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	return s
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublishCore(t *testing.T) {
+	srv := runServer(t, -1, t.TempDir())
+	defer srv.Shutdown()
+
+	sub, err := natsgo.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer sub.Close()
+	msgs := make(chan *natsgo.Msg, 1)
+	if _, err := sub.ChanSubscribe("plant.>", msgs); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	_ = sub.Flush()
+
+	p, err := NewPublisher(context.Background(), Config{URL: srv.ClientURL(), Subject: "plant.metrics"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+	defer p.Close()
+	waitFor(t, p.Connected)
+
+	if err := p.Publish(context.Background(), []byte(`{"cpu":1}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case msg := <-msgs:
+		if msg.Subject != "plant.metrics" || string(msg.Data) != `{"cpu":1}` {
+			t.Fatalf("msg = %s %s", msg.Subject, msg.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestPublishJetStream(t *testing.T) {
+	srv := runServer(t, -1, t.TempDir())
+	defer srv.Shutdown()
+
+	nc, err := natsgo.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer nc.Close()
+	js, _ := jetstream.New(nc)
+	stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EDGE", Subjects: []string{"edge.>"}})
+	if err != nil {
+		t.Fatalf("CreateStream: %v", err)
+	}
+
+	p, err := NewPublisher(context.Background(), Config{URL: srv.ClientURL(), Subject: "edge.metrics", JetStream: true, Stream: "EDGE"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+	defer p.Close()
+	waitFor(t, p.Connected)
+
+	// A retried publish of the same payload is stored once.
+	for i := 0; i < 2; i++ {
+		if err := p.Publish(context.Background(), []byte(`{"timestamp":"t0"}`)); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	if err := p.Publish(context.Background(), []byte(`{"timestamp":"t1"}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	info, err := stream.Info(context.Background())
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.State.Msgs != 2 {
+		t.Fatalf("stream holds %d messages, want 2", info.State.Msgs)
+	}
+
+	// Without a stream for the subject the publish is not acknowledged.
+	other, err := NewPublisher(context.Background(), Config{URL: srv.ClientURL(), Subject: "other.metrics", JetStream: true}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+	defer other.Close()
+	waitFor(t, other.Connected)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := other.Publish(ctx, []byte("x")); err == nil {
+		t.Fatal("expected error without a stream")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	storeDir := t.TempDir()
+	srv := runServer(t, -1, storeDir)
+	port := srv.Addr().(*net.TCPAddr).Port
+
+	p, err := NewPublisher(context.Background(), Config{URL: srv.ClientURL(), Subject: "edge.metrics", ReconnectWait: 20 * time.Millisecond}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+	defer p.Close()
+	waitFor(t, p.Connected)
+
+	srv.Shutdown()
+	waitFor(t, func() bool { return !p.Connected() })
+
+	restarted := runServer(t, port, storeDir)
+	defer restarted.Shutdown()
+	waitFor(t, p.Connected)
+
+	if err := p.Publish(context.Background(), []byte("after reconnect")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func TestExpandSubject(t *testing.T) {
+	got, err := ExpandSubject(DefaultSubject, "edge-01.plant.local")
+	if err != nil || got != "edgebeat.edge-01_plant_local.metrics" {
+		t.Fatalf("ExpandSubject = %q, %v", got, err)
+	}
+	for _, invalid := range []string{"edge..metrics", "edge.*", "edge.>", "edge metrics", ".edge"} {
+		if _, err := ExpandSubject(invalid, "h"); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package opcua
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"time"
+)
+
+// applicationURI identifies edgebeat on this host. OPC UA peers compare it
+// with the URI in the application certificate.
+func applicationURI() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return "urn:edgebeat:" + host
+}
+
+// selfSigned creates an application instance certificate for appURI, for
+// security modes other than None when no certificate is configured. Peers
+// that check trust must be told to accept it.
+func selfSigned(appURI string, hosts ...string) ([]byte, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	uri, err := url.Parse(appURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("application uri: %w", err)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "edgebeat", Organization: []string{"edgebeat"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{uri},
+		DNSNames:              hosts,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create certificate: %w", err)
+	}
+	return der, key, nil
+}
+
+// loadKeyPair reads a certificate and an RSA private key, PEM or DER
+// encoded, and returns the DER certificate.
+func loadKeyPair(certFile, keyFile string) ([]byte, *rsa.PrivateKey, error) {
+	der, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", certFile, err)
+	}
+
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS1PrivateKey(b); err == nil {
+		key = k
+	} else if k, err := x509.ParsePKCS8PrivateKey(b); err == nil {
+		key, _ = k.(*rsa.PrivateKey)
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("%s: not an RSA private key", keyFile)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, nil, fmt.Errorf("%s does not match the key in %s", certFile, keyFile)
+	}
+	return der, key, nil
+}
@@ -0,0 +1,450 @@
+package opcua
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Defaults for settings left zero in Config.
+const (
+	DefaultTimeout            = 5 * time.Second
+	DefaultPublishingInterval = time.Second
+)
+
+// maxPublishErrors is the number of consecutive publish errors after which
+// the subscription is considered lost.
+const maxPublishErrors = 3
+
+// Node names one node, such as ns=2;s=Line1.Speed, in the snapshot.
+type Node struct {
+	Name   string
+	NodeID string
+}
+
+type Config struct {
+	Endpoint string
+	// SecurityPolicy is a policy name such as Basic256Sha256 and
+	// SecurityMode one of None, Sign and SignAndEncrypt.
+	SecurityPolicy string
+	SecurityMode   string
+	// CertificateFile and PrivateKeyFile are the client certificate; a
+	// self-signed one is generated when the security mode needs one and
+	// they are empty.
+	CertificateFile string
+	PrivateKeyFile  string
+	// Username and Password authenticate the session; without them it is
+	// anonymous.
+	Username string
+	Password string
+	Nodes    []Node
+	// Subscribe monitors the nodes instead of reading them on every
+	// collection. The server publishes changes every PublishingInterval.
+	Subscribe          bool
+	PublishingInterval time.Duration
+	// Timeout bounds connecting and every read.
+	Timeout time.Duration
+}
+
+type node struct {
+	name   string
+	nodeID string
+	id     *ua.NodeID
+}
+
+// Client adds the values of the configured nodes to every snapshot. It
+// connects on the first collection and reconnects on the next collection
+// after the connection is lost.
+type Client struct {
+	cfg    Config
+	nodes  []node
+	opts   []opcua.Option
+	logger *zap.Logger
+
+	statusMu sync.Mutex
+	status   utils.IntegrationStatus
+
+	mu     sync.Mutex
+	conn   *opcua.Client
+	sub    *opcua.Subscription
+	stop   chan struct{}
+	done   chan struct{}
+	latest []utils.OPCUAValue
+	// subErr is why the subscription stopped delivering values; the next
+	// poll connects again.
+	subErr error
+}
+
+// NewClient validates the node list and security settings and returns a
+// client for cfg.Endpoint.
+func NewClient(cfg Config, logger *zap.Logger) (*Client, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("opcua endpoint is required")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.PublishingInterval <= 0 {
+		cfg.PublishingInterval = DefaultPublishingInterval
+	}
+	if cfg.SecurityPolicy == "" {
+		cfg.SecurityPolicy = "None"
+	}
+	if cfg.SecurityMode == "" {
+		cfg.SecurityMode = "None"
+	}
+	if ua.MessageSecurityModeFromString(cfg.SecurityMode) == ua.MessageSecurityModeInvalid {
+		return nil, fmt.Errorf("unknown opcua security mode %q", cfg.SecurityMode)
+	}
+	if len(cfg.Nodes) == 0 {
+		return nil, fmt.Errorf("opcua node list is empty")
+	}
+
+	c := &Client{cfg: cfg, logger: logger}
+	names := make(map[string]bool, len(cfg.Nodes))
+	for _, n := range cfg.Nodes {
+		if n.Name == "" || n.NodeID == "" {
+			return nil, fmt.Errorf("opcua node %q needs a name and a node id", n.Name+n.NodeID)
+		}
+		if names[n.Name] {
+			return nil, fmt.Errorf("opcua node %s is defined twice", n.Name)
+		}
+		names[n.Name] = true
+		id, err := ua.ParseNodeID(n.NodeID)
+		if err != nil {
+			return nil, fmt.Errorf("opcua node %s: %w", n.Name, err)
+		}
+		c.nodes = append(c.nodes, node{name: n.Name, nodeID: n.NodeID, id: id})
+	}
+
+	c.opts = []opcua.Option{
+		opcua.ApplicationName("edgebeat"),
+		opcua.SecurityPolicy(cfg.SecurityPolicy),
+		opcua.SecurityModeString(cfg.SecurityMode),
+		opcua.AutoReconnect(false),
+		opcua.DialTimeout(cfg.Timeout),
+		opcua.RequestTimeout(cfg.Timeout),
+	}
+	switch {
+	case cfg.CertificateFile != "" || cfg.PrivateKeyFile != "":
+		if cfg.CertificateFile == "" || cfg.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("opcua certificate and private key must be set together")
+		}
+		for _, f := range []string{cfg.CertificateFile, cfg.PrivateKeyFile} {
+			if _, err := os.Stat(f); err != nil {
+				return nil, fmt.Errorf("opcua certificate: %w", err)
+			}
+		}
+		c.opts = append(c.opts, opcua.CertificateFile(cfg.CertificateFile), opcua.PrivateKeyFile(cfg.PrivateKeyFile))
+	case cfg.SecurityMode != "None":
+		cert, key, err := selfSigned(applicationURI())
+		if err != nil {
+			return nil, fmt.Errorf("opcua certificate: %w", err)
+		}
+		c.opts = append(c.opts, opcua.Certificate(cert), opcua.PrivateKey(key))
+		logger.Warn("opcua uses a generated self-signed certificate; configure certificate_file to use a trusted one")
+	default:
+		c.opts = append(c.opts, opcua.ApplicationURI(applicationURI()))
+	}
+	if cfg.Username != "" {
+		c.opts = append(c.opts, opcua.AuthUsername(cfg.Username, cfg.Password))
+	} else {
+		c.opts = append(c.opts, opcua.AuthAnonymous())
+	}
+	return c, nil
+}
+
+// Poll returns the value of every node in configuration order. In subscribe
+// mode these are the last values the server published; a node without one
+// yet has the status BadWaitingForInitialData. A lost subscription is
+// replaced by a new session. An error means no values are known because the
+// server cannot be reached.
+func (c *Client) Poll(ctx context.Context) ([]utils.OPCUAValue, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.conn != nil && c.conn.State() != opcua.Connected:
+		c.logger.Warn("opcua connection lost", zap.String("endpoint", c.cfg.Endpoint))
+		c.disconnect(ctx)
+	case c.subErr != nil:
+		c.logger.Warn("opcua subscription lost", zap.String("endpoint", c.cfg.Endpoint), zap.Error(c.subErr))
+		c.disconnect(ctx)
+	}
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.sub != nil {
+		return append([]utils.OPCUAValue(nil), c.latest...), nil
+	}
+	values, err := c.read(ctx)
+	if err != nil {
+		c.disconnect(ctx)
+		return nil, err
+	}
+	return values, nil
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+
+	if c.cfg.Subscribe {
+		if err := c.subscribe(ctx); err != nil {
+			c.disconnect(ctx)
+			return err
+		}
+	}
+	c.logger.Info("opcua connected", zap.String("endpoint", c.cfg.Endpoint), zap.String("security_policy", c.cfg.SecurityPolicy), zap.String("security_mode", c.cfg.SecurityMode))
+	return nil
+}
+
+// dial opens a session with the endpoint that matches the configured
+// security policy and mode.
+func (c *Client) dial(ctx context.Context) (*opcua.Client, error) {
+	endpoints, err := opcua.GetEndpoints(ctx, c.cfg.Endpoint, opcua.DialTimeout(c.cfg.Timeout))
+	if err != nil {
+		return nil, fmt.Errorf("get endpoints of %s: %w", c.cfg.Endpoint, err)
+	}
+	ep, err := opcua.SelectEndpoint(endpoints, c.cfg.SecurityPolicy, ua.MessageSecurityModeFromString(c.cfg.SecurityMode))
+	if err != nil {
+		return nil, err
+	}
+	auth := ua.UserTokenTypeAnonymous
+	if c.cfg.Username != "" {
+		auth = ua.UserTokenTypeUserName
+	}
+	// The endpoint is dialled as configured, whatever host name the server
+	// advertises. Tests dial concurrently with collections, so c.opts is
+	// never appended to in place.
+	opts := append(c.opts[:len(c.opts):len(c.opts)], opcua.SecurityFromEndpoint(ep, auth))
+	conn, err := opcua.NewClient(c.cfg.Endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", c.cfg.Endpoint, err)
+	}
+	return conn, nil
+}
+
+func (c *Client) read(ctx context.Context) ([]utils.OPCUAValue, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	req := &ua.ReadRequest{TimestampsToReturn: ua.TimestampsToReturnSource}
+	for _, n := range c.nodes {
+		req.NodesToRead = append(req.NodesToRead, &ua.ReadValueID{NodeID: n.id, AttributeID: ua.AttributeIDValue})
+	}
+	resp, err := c.conn.Read(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	if len(resp.Results) != len(c.nodes) {
+		return nil, fmt.Errorf("read returned %d results for %d nodes", len(resp.Results), len(c.nodes))
+	}
+	values := make([]utils.OPCUAValue, len(c.nodes))
+	for i, n := range c.nodes {
+		values[i] = newValue(n, resp.Results[i])
+	}
+	return values, nil
+}
+
+// subscribe monitors every node; the client handle of a monitored item is
+// the index of its node.
+func (c *Client) subscribe(ctx context.Context) error {
+	notify := make(chan *opcua.PublishNotificationData, 16)
+	sub, err := c.conn.Subscribe(ctx, &opcua.SubscriptionParameters{Interval: c.cfg.PublishingInterval}, notify)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+
+	c.latest = make([]utils.OPCUAValue, len(c.nodes))
+	items := make([]*ua.MonitoredItemCreateRequest, len(c.nodes))
+	for i, n := range c.nodes {
+		c.latest[i] = withStatus(utils.OPCUAValue{Name: n.name, NodeID: n.nodeID}, ua.StatusBadWaitingForInitialData)
+		items[i] = opcua.NewMonitoredItemCreateRequestWithDefaults(n.id, ua.AttributeIDValue, uint32(i))
+	}
+	resp, err := sub.Monitor(ctx, ua.TimestampsToReturnSource, items...)
+	if err != nil {
+		return fmt.Errorf("monitor: %w", err)
+	}
+	for i, r := range resp.Results {
+		if i < len(c.latest) && r.StatusCode != ua.StatusOK {
+			c.latest[i] = withStatus(c.latest[i], r.StatusCode)
+		}
+	}
+
+	c.sub = sub
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.receive(notify, c.stop, c.done)
+	return nil
+}
+
+// receive stores the published values until stop is closed. After
+// maxPublishErrors consecutive errors, or when the server closes the
+// subscription, the values are marked BadNoCommunication and receive
+// returns.
+func (c *Client) receive(notify <-chan *opcua.PublishNotificationData, stop, done chan struct{}) {
+	defer close(done)
+	errs := 0
+	for {
+		var data *opcua.PublishNotificationData
+		select {
+		case <-stop:
+			return
+		case d, ok := <-notify:
+			if !ok {
+				c.fail(stop, fmt.Errorf("subscription closed"))
+				return
+			}
+			data = d
+		}
+
+		if data.Error != nil {
+			errs++
+			c.logger.Warn("opcua publish", zap.Error(data.Error), zap.Int("consecutive_errors", errs))
+			if errs >= maxPublishErrors {
+				c.fail(stop, fmt.Errorf("publish: %w", data.Error))
+				return
+			}
+			continue
+		}
+		errs = 0
+
+		switch v := data.Value.(type) {
+		case *ua.StatusChangeNotification:
+			// The server closed the subscription, e.g. when its lifetime
+			// expired.
+			if v.Status != ua.StatusOK {
+				c.fail(stop, fmt.Errorf("subscription closed by server: %w", v.Status))
+				return
+			}
+		case *ua.DataChangeNotification:
+			c.mu.Lock()
+			if stopped(stop) {
+				// The subscription was closed while waiting for the lock.
+				c.mu.Unlock()
+				return
+			}
+			for _, item := range v.MonitoredItems {
+				if i := int(item.ClientHandle); i < len(c.nodes) {
+					c.latest[i] = newValue(c.nodes[i], item.Value)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// fail marks the values of the subscription as lost until the next poll
+// connects again, unless the subscription was closed meanwhile.
+func (c *Client) fail(stop chan struct{}, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stopped(stop) {
+		return
+	}
+	c.logger.Warn("opcua subscription failed", zap.Error(err))
+	c.subErr = err
+	for i := range c.latest {
+		c.latest[i] = withStatus(c.latest[i], ua.StatusBadNoCommunication)
+	}
+}
+
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// disconnect closes the session; the next poll connects again.
+func (c *Client) disconnect(ctx context.Context) {
+	if c.stop != nil {
+		close(c.stop)
+		// receive may be waiting for the lock held by the caller, so it is
+		// not waited for here.
+		c.stop, c.done = nil, nil
+	}
+	c.sub = nil
+	c.latest = nil
+	c.subErr = nil
+	if c.conn != nil {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.Timeout)
+		defer cancel()
+		_ = c.conn.Close(ctx)
+		c.conn = nil
+	}
+}
+
+// Collect stores the node values in info.OPCUA. A connection error is added
+// to info.Errors.
+func (c *Client) Collect(ctx context.Context, info *utils.SystemInfo) {
+	start := time.Now()
+	values, err := c.Poll(ctx)
+	c.statusMu.Lock()
+	c.status.Record(start, err)
+	c.status.Connected = err == nil
+	c.statusMu.Unlock()
+	info.OPCUA = &utils.OPCUAStats{Values: values}
+	if err != nil {
+		info.Errors = append(info.Errors, "opcua: "+err.Error())
+		c.logger.Warn("opcua poll failed", zap.Error(err))
+	}
+}
+
+// Status returns the state of the server as seen by the last collections.
+// It does not wait for a collection in progress.
+func (c *Client) Status() utils.IntegrationStatus {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.status
+}
+
+// Test opens and closes a separate session with the configured endpoint,
+// security and credentials, leaving the session of the collections alone.
+func (c *Client) Test(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close(ctx)
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	done := c.done
+	c.disconnect(context.Background())
+	c.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package opcua
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/ua"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// standIn is a local OPC UA server whose variables in namespace 1 have
+// string node ids, such as ns=1;s=Line1.Speed.
+type standIn struct {
+	srv      *server.Server
+	ns       *server.NodeNameSpace
+	port     int
+	endpoint string
+
+	mu      sync.Mutex
+	values  map[string]*ua.DataValue
+	stopped bool
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newStandIn(t *testing.T, port int, opts ...server.Option) *standIn {
+	t.Helper()
+	opts = append([]server.Option{
+		server.EndPoint("127.0.0.1", port),
+		server.EnableSecurity("None", ua.MessageSecurityModeNone),
+		server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+		server.EnableAuthMode(ua.UserTokenTypeUserName),
+	}, opts...)
+	s := &standIn{
+		srv:      server.New(opts...),
+		port:     port,
+		endpoint: fmt.Sprintf("opc.tcp://127.0.0.1:%d", port),
+		values:   make(map[string]*ua.DataValue),
+	}
+	s.ns = server.NewNodeNameSpace(s.srv, "edgebeat-test")
+	if err := s.srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.stopped {
+			s.srv.Close()
+		}
+	})
+	return s
+}
+
+// stop closes the server without waiting for its channels to finish, which
+// the server library gives up on only after ten seconds.
+func (s *standIn) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	go s.srv.Close()
+}
+
+// variable adds a node whose value follows set.
+func (s *standIn) variable(name string, v any) {
+	s.set(name, v, ua.StatusOK)
+	s.ns.AddNewVariableStringNode(name, func() *ua.DataValue {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.values[name]
+	})
+}
+
+func (s *standIn) set(name string, v any, status ua.StatusCode) {
+	s.mu.Lock()
+	s.values[name] = &ua.DataValue{
+		EncodingMask:    ua.DataValueValue | ua.DataValueStatusCode | ua.DataValueSourceTimestamp,
+		Value:           ua.MustVariant(v),
+		Status:          status,
+		SourceTimestamp: time.Date(2024, 2, 15, 10, 0, 0, 0, time.UTC),
+	}
+	s.mu.Unlock()
+	s.srv.ChangeNotification(ua.NewStringNodeID(s.ns.ID(), name))
+}
+
+func (s *standIn) nodeID(name string) string {
+	return fmt.Sprintf("ns=%d;s=%s", s.ns.ID(), name)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestClientRead(t *testing.T) {
+	s := newStandIn(t, freePort(t))
+	s.variable("Line1.Speed", 1.25)
+	s.variable("Line1.Count", uint32(42))
+	s.variable("Line1.Running", true)
+	s.variable("Line1.Batch", "B-0042")
+
+	c, err := NewClient(Config{Endpoint: s.endpoint, Username: "operator", Password: "secret", Nodes: []Node{
+		{Name: "speed", NodeID: s.nodeID("Line1.Speed")},
+		{Name: "count", NodeID: s.nodeID("Line1.Count")},
+		{Name: "running", NodeID: s.nodeID("Line1.Running")},
+		{Name: "batch", NodeID: s.nodeID("Line1.Batch")},
+		{Name: "missing", NodeID: s.nodeID("Line1.Missing")},
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	var info utils.SystemInfo
+	c.Collect(context.Background(), &info)
+	if info.OPCUA == nil || len(info.OPCUA.Values) != 5 || len(info.Errors) != 0 {
+		t.Fatalf("OPCUA = %+v, errors = %v", info.OPCUA, info.Errors)
+	}
+	want := []utils.OPCUAValue{
+		{Name: "speed", NodeID: s.nodeID("Line1.Speed"), Value: 1.25, Status: StatusGood, SourceTimestamp: "2024-02-15T10:00:00Z"},
+		{Name: "count", NodeID: s.nodeID("Line1.Count"), Value: 42, Status: StatusGood, SourceTimestamp: "2024-02-15T10:00:00Z"},
+		{Name: "running", NodeID: s.nodeID("Line1.Running"), Value: 1, Status: StatusGood, SourceTimestamp: "2024-02-15T10:00:00Z"},
+		{Name: "batch", NodeID: s.nodeID("Line1.Batch"), Text: "B-0042", Status: StatusGood, SourceTimestamp: "2024-02-15T10:00:00Z"},
+		{Name: "missing", NodeID: s.nodeID("Line1.Missing"), Status: StatusBad, StatusCode: uint32(ua.StatusBadNodeIDUnknown)},
+	}
+	for i, v := range want {
+		if got := info.OPCUA.Values[i]; got != v {
+			t.Errorf("value %d = %+v, want %+v", i, got, v)
+		}
+	}
+
+	if status := c.Status(); !status.Connected || status.Polls != 1 || status.FailedPolls != 0 || status.LastSuccess == "" {
+		t.Fatalf("Status = %+v", status)
+	}
+
+	// Status codes of the server are passed on.
+	s.set("Line1.Speed", 1.5, ua.StatusUncertain)
+	values, err := c.Poll(context.Background())
+	if err != nil || values[0].Value != 1.5 || values[0].Status != StatusUncertain || values[0].StatusCode != uint32(ua.StatusUncertain) {
+		t.Fatalf("Poll = %+v, %v", values, err)
+	}
+}
+
+func TestClientSubscribe(t *testing.T) {
+	s := newStandIn(t, freePort(t))
+	s.variable("Tank.Level", int16(70))
+
+	c, err := NewClient(Config{Endpoint: s.endpoint, Subscribe: true, PublishingInterval: 50 * time.Millisecond, Nodes: []Node{
+		{Name: "level", NodeID: s.nodeID("Tank.Level")},
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	level := func() utils.OPCUAValue {
+		values, err := c.Poll(context.Background())
+		if err != nil || len(values) != 1 {
+			t.Fatalf("Poll = %+v, %v", values, err)
+		}
+		return values[0]
+	}
+	if v := level(); v.Status != StatusGood && v.StatusCode != uint32(ua.StatusBadWaitingForInitialData) {
+		t.Fatalf("initial value = %+v", v)
+	}
+	waitFor(t, func() bool { return level().Value == 70 })
+
+	s.set("Tank.Level", int16(72), ua.StatusOK)
+	waitFor(t, func() bool { return level().Value == 72 })
+
+	// A lost subscription is replaced by a new session on the next poll.
+	c.mu.Lock()
+	stop, sub := c.stop, c.sub
+	c.mu.Unlock()
+	c.fail(stop, ua.StatusBadTimeout)
+	c.mu.Lock()
+	stale := c.latest[0]
+	c.mu.Unlock()
+	if stale.Value != 72 || stale.StatusCode != uint32(ua.StatusBadNoCommunication) {
+		t.Fatalf("value after failure = %+v", stale)
+	}
+	level()
+	c.mu.Lock()
+	replaced := c.sub != nil && c.sub != sub && c.subErr == nil
+	c.mu.Unlock()
+	if !replaced {
+		t.Fatal("subscription was not replaced")
+	}
+	waitFor(t, func() bool { return level().Value == 72 })
+}
+
+func TestClientReceive(t *testing.T) {
+	c, err := NewClient(Config{Endpoint: "opc.tcp://localhost:4840", Nodes: []Node{{Name: "level", NodeID: "ns=2;s=Tank.Level"}}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	c.latest = []utils.OPCUAValue{{Name: "level"}}
+	notify := make(chan *opcua.PublishNotificationData)
+	stop, done := make(chan struct{}), make(chan struct{})
+	go c.receive(notify, stop, done)
+
+	change := &ua.DataChangeNotification{MonitoredItems: []*ua.MonitoredItemNotification{
+		{ClientHandle: 0, Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(int16(70))}},
+	}}
+	publishErr := &opcua.PublishNotificationData{Error: ua.StatusBadTimeout}
+
+	// Errors are counted only while they follow each other.
+	for range maxPublishErrors - 1 {
+		notify <- publishErr
+	}
+	notify <- &opcua.PublishNotificationData{Value: change}
+	for range maxPublishErrors - 1 {
+		notify <- publishErr
+	}
+	c.mu.Lock()
+	failed := c.subErr
+	c.mu.Unlock()
+	if failed != nil {
+		t.Fatalf("subscription failed after interleaved errors: %v", failed)
+	}
+
+	notify <- publishErr
+	<-done
+	if !errors.Is(c.subErr, ua.StatusBadTimeout) || c.latest[0].Value != 70 || c.latest[0].Status != StatusBad {
+		t.Fatalf("after failure: err = %v, value = %+v", c.subErr, c.latest[0])
+	}
+
+	// The server closing the subscription ends it at once.
+	c.subErr = nil
+	notify = make(chan *opcua.PublishNotificationData, 1)
+	done = make(chan struct{})
+	go c.receive(notify, stop, done)
+	notify <- &opcua.PublishNotificationData{Value: &ua.StatusChangeNotification{Status: ua.StatusBadTimeout}}
+	<-done
+	if c.subErr == nil {
+		t.Fatal("status change did not fail the subscription")
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	port := freePort(t)
+	s := newStandIn(t, port)
+	s.variable("Counter", int32(1))
+	nodes := []Node{{Name: "counter", NodeID: s.nodeID("Counter")}}
+
+	c, err := NewClient(Config{Endpoint: s.endpoint, Timeout: time.Second, Nodes: nodes}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+	if values, err := c.Poll(context.Background()); err != nil || values[0].Value != 1 {
+		t.Fatalf("Poll = %+v, %v", values, err)
+	}
+
+	s.stop()
+	var info utils.SystemInfo
+	waitFor(t, func() bool {
+		info = utils.SystemInfo{}
+		c.Collect(context.Background(), &info)
+		return len(info.Errors) > 0
+	})
+	if len(info.OPCUA.Values) != 0 || !strings.HasPrefix(info.Errors[0], "opcua: ") {
+		t.Fatalf("OPCUA = %+v, errors = %v", info.OPCUA, info.Errors)
+	}
+	if status := c.Status(); status.Connected || status.FailedPolls == 0 || "opcua: "+status.LastError != info.Errors[0] {
+		t.Fatalf("Status = %+v", status)
+	}
+	if err := c.Test(context.Background()); err == nil {
+		t.Fatal("Test succeeded without a server")
+	}
+
+	restarted := newStandIn(t, port)
+	restarted.variable("Counter", int32(2))
+	if err := c.Test(context.Background()); err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+	waitFor(t, func() bool {
+		values, err := c.Poll(context.Background())
+		return err == nil && values[0].Value == 2
+	})
+}
+
+func TestClientSecurity(t *testing.T) {
+	s := newStandIn(t, freePort(t))
+	s.variable("Secret", 7.0)
+
+	// The client only uses an endpoint with the configured policy and mode.
+	c, err := NewClient(Config{Endpoint: s.endpoint, SecurityPolicy: "Basic256Sha256", SecurityMode: "SignAndEncrypt", Nodes: []Node{
+		{Name: "secret", NodeID: s.nodeID("Secret")},
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Poll(context.Background()); err == nil || !strings.Contains(err.Error(), "no matching endpoint") {
+		t.Fatalf("expected endpoint error, got %v", err)
+	}
+	if err := c.Test(context.Background()); err == nil || !strings.Contains(err.Error(), "no matching endpoint") {
+		t.Fatalf("expected endpoint error from Test, got %v", err)
+	}
+}
+
+func TestSelfSigned(t *testing.T) {
+	der, key, err := selfSigned("urn:edgebeat:edge-01", "edge-01")
+	if err != nil {
+		t.Fatalf("selfSigned: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "urn:edgebeat:edge-01" || cert.DNSNames[0] != "edge-01" {
+		t.Fatalf("certificate names = %v, %v", cert.URIs, cert.DNSNames)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		t.Fatal("certificate does not match the key")
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		t.Fatalf("CheckSignature: %v", err)
+	}
+}
+
+func TestClientConfigValidation(t *testing.T) {
+	valid := Config{Endpoint: "opc.tcp://localhost:4840", Nodes: []Node{{Name: "a", NodeID: "ns=2;i=1"}}}
+	invalid := []Config{
+		{Nodes: valid.Nodes},
+		{Endpoint: valid.Endpoint},
+		{Endpoint: valid.Endpoint, Nodes: []Node{{NodeID: "ns=2;i=1"}}},
+		{Endpoint: valid.Endpoint, Nodes: []Node{{Name: "a", NodeID: "ns=2;i=abc"}}},
+		{Endpoint: valid.Endpoint, Nodes: []Node{{Name: "a"}}},
+		{Endpoint: valid.Endpoint, Nodes: []Node{{Name: "a", NodeID: "i=1"}, {Name: "a", NodeID: "i=2"}}},
+		{Endpoint: valid.Endpoint, Nodes: valid.Nodes, SecurityMode: "Encrypt"},
+		{Endpoint: valid.Endpoint, Nodes: valid.Nodes, CertificateFile: "/does/not/exist.der", PrivateKeyFile: "/does/not/exist.pem"},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewClient(cfg, nil); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+	if _, err := NewClient(valid, nil); err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package opcua connects edgebeat to OPC UA: a client that reads or
+// subscribes to configured nodes and adds their values, with status codes, to
+// the snapshot, and a server that lets OPC UA clients browse the snapshot.
+package opcua
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// Status classes of an OPC UA status code, from its two most significant
+// bits.
+const (
+	StatusGood      = "good"
+	StatusUncertain = "uncertain"
+	StatusBad       = "bad"
+)
+
+func statusClass(code ua.StatusCode) string {
+	switch code >> 30 {
+	case 0:
+		return StatusGood
+	case 1:
+		return StatusUncertain
+	}
+	return StatusBad
+}
+
+// newValue converts the data value of a node. Numbers and booleans end up
+// in Value, anything else in Text.
+func newValue(n node, dv *ua.DataValue) utils.OPCUAValue {
+	v := utils.OPCUAValue{Name: n.name, NodeID: n.nodeID}
+	if dv == nil {
+		return withStatus(v, ua.StatusBadNoData)
+	}
+	v = withStatus(v, dv.Status)
+	if !dv.SourceTimestamp.IsZero() {
+		v.SourceTimestamp = dv.SourceTimestamp.UTC().Format(time.RFC3339Nano)
+	}
+	if dv.Value == nil {
+		return v
+	}
+
+	switch x := dv.Value.Value().(type) {
+	case nil:
+	case bool:
+		if x {
+			v.Value = 1
+		}
+	case int8:
+		v.Value = float64(x)
+	case uint8:
+		v.Value = float64(x)
+	case int16:
+		v.Value = float64(x)
+	case uint16:
+		v.Value = float64(x)
+	case int32:
+		v.Value = float64(x)
+	case uint32:
+		v.Value = float64(x)
+	case int64:
+		v.Value = float64(x)
+	case uint64:
+		v.Value = float64(x)
+	case float32:
+		v.Value = float64(x)
+	case float64:
+		v.Value = x
+	case string:
+		v.Text = x
+	case time.Time:
+		v.Text = x.UTC().Format(time.RFC3339Nano)
+	case *ua.LocalizedText:
+		v.Text = x.Text
+	default:
+		v.Text = fmt.Sprint(x)
+	}
+	return v
+}
+
+func withStatus(v utils.OPCUAValue, code ua.StatusCode) utils.OPCUAValue {
+	v.StatusCode = uint32(code)
+	v.Status = statusClass(code)
+	return v
+}
@@ -0,0 +1,471 @@
+package opcua
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/ua"
+	"github.com/gopcua/opcua/uapolicy"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// NamespaceURI names the namespace of the nodes the server exposes. Its
+// index, 1 on this server, is part of every node id.
+const NamespaceURI = "urn:edgebeat:snapshot"
+
+type ServerConfig struct {
+	// Address is host:port. Without a host the server listens on every IPv4
+	// interface and advertises the host name.
+	Address string
+	// SecurityPolicy and SecurityMode select the only endpoint the server
+	// offers, as in Config.
+	SecurityPolicy string
+	SecurityMode   string
+	// CertificateFile and PrivateKeyFile are the server certificate; a
+	// self-signed one is generated when the security mode needs one and
+	// they are empty.
+	CertificateFile string
+	PrivateKeyFile  string
+}
+
+// field is a variable of the node tree. value returns nil when the snapshot
+// has no such value, such as the usage of a disk that was unmounted.
+type field struct {
+	name     string
+	dataType uint32
+	value    func(info *utils.SystemInfo) any
+}
+
+// folders are the fixed folders below Device, parents first.
+var folders = []struct {
+	path   string
+	fields []field
+}{
+	{"CPU", []field{
+		{"TotalPercent", id.Double, func(i *utils.SystemInfo) any { return i.CPU.TotalPercent }},
+		{"ModelName", id.String, func(i *utils.SystemInfo) any {
+			if len(i.CPU.Info) == 0 {
+				return nil
+			}
+			return i.CPU.Info[0].ModelName
+		}},
+		{"Cores", id.Int32, func(i *utils.SystemInfo) any {
+			var cores int32
+			for _, c := range i.CPU.Info {
+				cores += c.Cores
+			}
+			return cores
+		}},
+	}},
+	{"Load", []field{
+		{"Load1", id.Double, func(i *utils.SystemInfo) any { return i.Load.Load1 }},
+		{"Load5", id.Double, func(i *utils.SystemInfo) any { return i.Load.Load5 }},
+		{"Load15", id.Double, func(i *utils.SystemInfo) any { return i.Load.Load15 }},
+	}},
+	{"Memory", []field{
+		{"Total", id.UInt64, func(i *utils.SystemInfo) any { return i.Memory.Virtual.Total }},
+		{"Available", id.UInt64, func(i *utils.SystemInfo) any { return i.Memory.Virtual.Available }},
+		{"Used", id.UInt64, func(i *utils.SystemInfo) any { return i.Memory.Virtual.Used }},
+		{"Free", id.UInt64, func(i *utils.SystemInfo) any { return i.Memory.Virtual.Free }},
+		{"UsedPercent", id.Double, func(i *utils.SystemInfo) any { return i.Memory.Virtual.UsedPercent }},
+	}},
+	{"Memory.Swap", []field{
+		{"Total", id.UInt64, func(i *utils.SystemInfo) any { return i.Memory.Swap.Total }},
+		{"Used", id.UInt64, func(i *utils.SystemInfo) any { return i.Memory.Swap.Used }},
+		{"Free", id.UInt64, func(i *utils.SystemInfo) any { return i.Memory.Swap.Free }},
+		{"UsedPercent", id.Double, func(i *utils.SystemInfo) any { return i.Memory.Swap.UsedPercent }},
+	}},
+	{"Disk", nil},
+	{"Network", []field{
+		{"BytesSent", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.BytesSent }},
+		{"BytesRecv", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.BytesRecv }},
+		{"PacketsSent", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.PacketsSent }},
+		{"PacketsRecv", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.PacketsRecv }},
+		{"ErrIn", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.Errin }},
+		{"ErrOut", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.Errout }},
+		{"DropIn", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.Dropin }},
+		{"DropOut", id.UInt64, func(i *utils.SystemInfo) any { return i.Network.Totals.Dropout }},
+	}},
+	{"Host", []field{
+		{"Hostname", id.String, func(i *utils.SystemInfo) any { return i.Host.Hostname }},
+		{"OS", id.String, func(i *utils.SystemInfo) any { return i.Host.OS }},
+		{"Platform", id.String, func(i *utils.SystemInfo) any { return i.Host.Platform }},
+		{"PlatformVersion", id.String, func(i *utils.SystemInfo) any { return i.Host.PlatformVersion }},
+		{"KernelVersion", id.String, func(i *utils.SystemInfo) any { return i.Host.KernelVersion }},
+		{"KernelArch", id.String, func(i *utils.SystemInfo) any { return i.Host.KernelArch }},
+		{"UptimeSeconds", id.UInt64, func(i *utils.SystemInfo) any { return i.Host.UptimeSeconds }},
+		{"BootTime", id.DateTime, func(i *utils.SystemInfo) any {
+			if i.Host.BootTime == 0 {
+				return nil
+			}
+			return time.Unix(int64(i.Host.BootTime), 0).UTC()
+		}},
+		{"Procs", id.UInt64, func(i *utils.SystemInfo) any { return i.Host.Procs }},
+	}},
+	{"Sensors", nil},
+	{"Sensors.Temperatures", nil},
+	{"Sensors.Fans", nil},
+}
+
+// keyedFolders get a subfolder per disk or sensor found in a snapshot, named
+// after its mountpoint or sensor key.
+var keyedFolders = []struct {
+	parent string
+	keys   func(info *utils.SystemInfo) []string
+	fields func(key string) []field
+}{
+	{
+		parent: "Disk",
+		keys: func(i *utils.SystemInfo) []string {
+			keys := make([]string, len(i.Disk.Usage))
+			for n, u := range i.Disk.Usage {
+				keys[n] = u.Mountpoint
+			}
+			return keys
+		},
+		fields: func(key string) []field {
+			usage := func(f func(u utils.DiskUsage) any) func(*utils.SystemInfo) any {
+				return func(i *utils.SystemInfo) any {
+					for _, u := range i.Disk.Usage {
+						if u.Mountpoint == key {
+							return f(u)
+						}
+					}
+					return nil
+				}
+			}
+			return []field{
+				{"Device", id.String, usage(func(u utils.DiskUsage) any { return u.Device })},
+				{"FSType", id.String, usage(func(u utils.DiskUsage) any { return u.FSType })},
+				{"Total", id.UInt64, usage(func(u utils.DiskUsage) any { return u.Total })},
+				{"Used", id.UInt64, usage(func(u utils.DiskUsage) any { return u.Used })},
+				{"Free", id.UInt64, usage(func(u utils.DiskUsage) any { return u.Free })},
+				{"UsedPercent", id.Double, usage(func(u utils.DiskUsage) any { return u.UsedPercent })},
+			}
+		},
+	},
+	{
+		parent: "Sensors.Temperatures",
+		keys: func(i *utils.SystemInfo) []string {
+			keys := make([]string, len(i.Sensors.Temperatures))
+			for n, t := range i.Sensors.Temperatures {
+				keys[n] = t.SensorKey
+			}
+			return keys
+		},
+		fields: func(key string) []field {
+			temperature := func(f func(t utils.Temperature) any) func(*utils.SystemInfo) any {
+				return func(i *utils.SystemInfo) any {
+					for _, t := range i.Sensors.Temperatures {
+						if t.SensorKey == key {
+							return f(t)
+						}
+					}
+					return nil
+				}
+			}
+			return []field{
+				{"Value", id.Double, temperature(func(t utils.Temperature) any { return t.Value })},
+				{"High", id.Double, temperature(func(t utils.Temperature) any { return t.High })},
+				{"Critical", id.Double, temperature(func(t utils.Temperature) any { return t.Critical })},
+			}
+		},
+	},
+	{
+		parent: "Sensors.Fans",
+		keys: func(i *utils.SystemInfo) []string {
+			keys := make([]string, len(i.Sensors.Fans))
+			for n, f := range i.Sensors.Fans {
+				keys[n] = f.SensorKey
+			}
+			return keys
+		},
+		fields: func(key string) []field {
+			return []field{
+				{"Value", id.Double, func(i *utils.SystemInfo) any {
+					for _, f := range i.Sensors.Fans {
+						if f.SensorKey == key {
+							return f.Value
+						}
+					}
+					return nil
+				}},
+			}
+		},
+	},
+}
+
+// Server is an OPC UA server that exposes the snapshot as a node tree below
+// Objects/Device, such as ns=1;s=Device.CPU.TotalPercent. The values are
+// replaced on every Update and published to subscribed clients. Disks and
+// sensors get their nodes when they first appear in a snapshot.
+type Server struct {
+	srv      *server.Server
+	space    *addressSpace
+	endpoint string
+	logger   *zap.Logger
+	cancel   context.CancelFunc
+	closed   *atomic.Bool
+	changed  chan struct{}
+
+	mu      sync.RWMutex
+	info    *utils.SystemInfo
+	at      time.Time
+	folders map[string]*server.Node
+	vars    []*ua.NodeID
+}
+
+// NewServer builds the node tree and serves it on cfg.Address until Close.
+// Values are BadWaitingForInitialData until the first Update.
+func NewServer(cfg ServerConfig, logger *zap.Logger) (*Server, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	host, portStr, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("opcua server address: %w", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("opcua server port out of range: %q", portStr)
+	}
+	if cfg.SecurityPolicy == "" {
+		cfg.SecurityPolicy = "None"
+	}
+	if cfg.SecurityMode == "" {
+		cfg.SecurityMode = "None"
+	}
+	mode := ua.MessageSecurityModeFromString(cfg.SecurityMode)
+	if mode == ua.MessageSecurityModeInvalid {
+		return nil, fmt.Errorf("unknown opcua security mode %q", cfg.SecurityMode)
+	}
+	if !slices.Contains(uapolicy.SupportedPolicies(), ua.FormatSecurityPolicyURI(cfg.SecurityPolicy)) {
+		return nil, fmt.Errorf("unknown opcua security policy %q", cfg.SecurityPolicy)
+	}
+	if (cfg.SecurityPolicy == "None") != (mode == ua.MessageSecurityModeNone) {
+		return nil, fmt.Errorf("opcua security policy %s does not match security mode %s", cfg.SecurityPolicy, cfg.SecurityMode)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	closed := new(atomic.Bool)
+	opts := []server.Option{
+		server.ServerName("edgebeat"),
+		server.ManufacturerName("edgebeat"),
+		server.ProductName("edgebeat"),
+		server.SetLogger(serverLogger{logger.Sugar(), closed}),
+		server.EnableSecurity(cfg.SecurityPolicy, mode),
+		// The server library does not check user credentials, so only
+		// anonymous sessions are offered.
+		server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+	}
+	// The first endpoint is the one the server listens on.
+	endpoint := fmt.Sprintf("opc.tcp://%s", net.JoinHostPort(host, portStr))
+	if host == "" {
+		opts = append(opts, server.EndPoint("0.0.0.0", port), server.EndPoint(hostname, port))
+		endpoint = fmt.Sprintf("opc.tcp://%s", net.JoinHostPort(hostname, portStr))
+	} else {
+		opts = append(opts, server.EndPoint(host, port))
+	}
+
+	switch {
+	case cfg.CertificateFile != "" || cfg.PrivateKeyFile != "":
+		if cfg.CertificateFile == "" || cfg.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("opcua certificate and private key must be set together")
+		}
+		cert, key, err := loadKeyPair(cfg.CertificateFile, cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("opcua certificate: %w", err)
+		}
+		opts = append(opts, server.Certificate(cert), server.PrivateKey(key))
+	case mode != ua.MessageSecurityModeNone:
+		hosts := []string{hostname, "localhost"}
+		if host != "" && !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+		cert, key, err := selfSigned(applicationURI(), hosts...)
+		if err != nil {
+			return nil, fmt.Errorf("opcua certificate: %w", err)
+		}
+		opts = append(opts, server.Certificate(cert), server.PrivateKey(key))
+		logger.Warn("opcua server uses a generated self-signed certificate; configure certificate_file to use a trusted one")
+	}
+
+	s := &Server{
+		srv:      server.New(opts...),
+		endpoint: endpoint,
+		logger:   logger,
+		closed:   closed,
+		changed:  make(chan struct{}, 1),
+		folders:  make(map[string]*server.Node),
+	}
+	s.space = newAddressSpace(s.srv, NamespaceURI)
+	root, err := s.srv.Namespace(0)
+	if err != nil {
+		return nil, err
+	}
+	objects := root.Objects()
+	device := s.space.addFolder(objects, "Device", "Device")
+	objects.AddRef(device, id.Organizes, true)
+	s.folders["Device"] = device
+	s.addField(device, "Device", field{"Timestamp", id.DateTime, func(i *utils.SystemInfo) any {
+		t, err := time.Parse(time.RFC3339Nano, i.Timestamp)
+		if err != nil {
+			return nil
+		}
+		return t.UTC()
+	}})
+	for _, f := range folders {
+		parent, name := "Device", f.path
+		if i := strings.LastIndex(f.path, "."); i >= 0 {
+			parent, name = "Device."+f.path[:i], f.path[i+1:]
+		}
+		path := "Device." + f.path
+		folder := s.space.addFolder(s.folders[parent], path, name)
+		s.folders[path] = folder
+		for _, v := range f.fields {
+			s.addField(folder, path, v)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.srv.Start(ctx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("opcua server: %w", err)
+	}
+	s.cancel = cancel
+	go s.notify(ctx)
+	return s, nil
+}
+
+// Endpoint is the URL clients connect to.
+func (s *Server) Endpoint() string {
+	return s.endpoint
+}
+
+// addField adds the variable f to folder; s.mu must be held or the server
+// not yet started.
+func (s *Server) addField(folder *server.Node, path string, f field) {
+	n := s.space.addVariable(folder, path+"."+f.name, f.name, f.dataType, func() *ua.DataValue {
+		return s.read(f.value)
+	})
+	s.vars = append(s.vars, n.ID())
+}
+
+func (s *Server) read(value func(*utils.SystemInfo) any) *ua.DataValue {
+	s.mu.RLock()
+	info, at := s.info, s.at
+	s.mu.RUnlock()
+
+	now := time.Now()
+	if info == nil {
+		return &ua.DataValue{
+			EncodingMask:    ua.DataValueStatusCode | ua.DataValueServerTimestamp,
+			Status:          ua.StatusBadWaitingForInitialData,
+			ServerTimestamp: now,
+		}
+	}
+	v := value(info)
+	if v == nil {
+		return &ua.DataValue{
+			EncodingMask:    ua.DataValueStatusCode | ua.DataValueSourceTimestamp | ua.DataValueServerTimestamp,
+			Status:          ua.StatusBadNoData,
+			SourceTimestamp: at,
+			ServerTimestamp: now,
+		}
+	}
+	return &ua.DataValue{
+		EncodingMask:    ua.DataValueValue | ua.DataValueSourceTimestamp | ua.DataValueServerTimestamp,
+		Value:           ua.MustVariant(v),
+		SourceTimestamp: at,
+		ServerTimestamp: now,
+	}
+}
+
+// Update replaces the values with those of info and adds the nodes of disks
+// and sensors seen for the first time.
+func (s *Server) Update(info *utils.SystemInfo) {
+	at, err := time.Parse(time.RFC3339Nano, info.Timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+
+	s.mu.Lock()
+	s.info, s.at = info, at.UTC()
+	for _, k := range keyedFolders {
+		parent := "Device." + k.parent
+		for _, key := range k.keys(info) {
+			path := parent + "." + key
+			if _, ok := s.folders[path]; ok || key == "" {
+				continue
+			}
+			folder := s.space.addFolder(s.folders[parent], path, key)
+			s.folders[path] = folder
+			for _, f := range k.fields(key) {
+				s.addField(folder, path, f)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// notify tells the subscriptions of clients about new values. It runs apart
+// from Update so that a stalled subscription cannot hold up collection.
+func (s *Server) notify(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed:
+		}
+		s.mu.RLock()
+		vars := s.vars[:len(s.vars):len(s.vars)]
+		s.mu.RUnlock()
+		for _, v := range vars {
+			s.srv.ChangeNotification(v)
+		}
+	}
+}
+
+func (s *Server) Close() error {
+	s.closed.Store(true)
+	s.cancel()
+	return s.srv.Close()
+}
+
+// serverLogger passes the messages of the server library to zap. They are
+// about single connections and requests, so they are logged one level lower,
+// and errors of the closing server are not logged above debug at all.
+type serverLogger struct {
+	s      *zap.SugaredLogger
+	closed *atomic.Bool
+}
+
+func (l serverLogger) Debug(msg string, args ...any) { l.s.Debugf(msg, args...) }
+func (l serverLogger) Info(msg string, args ...any)  { l.s.Debugf(msg, args...) }
+func (l serverLogger) Warn(msg string, args ...any)  { l.s.Debugf(msg, args...) }
+func (l serverLogger) Error(msg string, args ...any) {
+	if l.closed.Load() {
+		l.s.Debugf(msg, args...)
+		return
+	}
+	l.s.Warnf(msg, args...)
+}
@@ -0,0 +1,301 @@
+package opcua
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+func newServer(t *testing.T, cfg ServerConfig) *Server {
+	t.Helper()
+	if cfg.Address == "" {
+		cfg.Address = fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	}
+	srv, err := NewServer(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func sampleInfo() *utils.SystemInfo {
+	info := &utils.SystemInfo{Timestamp: "2024-02-15T10:00:00Z"}
+	info.CPU.TotalPercent = 42.5
+	info.CPU.Info = []utils.CPUInfo{{ModelName: "Cortex-A72", Cores: 4}}
+	info.Memory.Virtual.Total = 8 << 30
+	info.Memory.Virtual.UsedPercent = 61.25
+	info.Disk.Usage = []utils.DiskUsage{{Mountpoint: "/", Device: "/dev/mmcblk0p2", UsedPercent: 87.5}}
+	info.Host.Hostname = "edge-01"
+	info.Host.UptimeSeconds = 90061
+	info.Sensors.Temperatures = []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48.25, Critical: 85}}
+	return info
+}
+
+func snapshotNode(name string) Node {
+	return Node{Name: name, NodeID: "ns=1;s=Device." + name}
+}
+
+func TestServerRead(t *testing.T) {
+	srv := newServer(t, ServerConfig{})
+	c, err := NewClient(Config{Endpoint: srv.Endpoint(), Nodes: []Node{
+		snapshotNode("CPU.TotalPercent"),
+		snapshotNode("CPU.ModelName"),
+		snapshotNode("CPU.Cores"),
+		snapshotNode("Memory.Total"),
+		snapshotNode("Disk./.UsedPercent"),
+		snapshotNode("Sensors.Temperatures.cpu_thermal.Value"),
+		snapshotNode("Host.UptimeSeconds"),
+		snapshotNode("Timestamp"),
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	values, err := c.Poll(context.Background())
+	if err != nil || values[0].StatusCode != uint32(ua.StatusBadWaitingForInitialData) {
+		t.Fatalf("before first update: %+v, %v", values, err)
+	}
+	// Disks and sensors have no nodes before they are seen.
+	if values[4].StatusCode != uint32(ua.StatusBadNodeIDUnknown) {
+		t.Fatalf("disk before first update: %+v", values[4])
+	}
+
+	srv.Update(sampleInfo())
+	values, err = c.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	want := []utils.OPCUAValue{
+		{Value: 42.5}, {Text: "Cortex-A72"}, {Value: 4}, {Value: 8 << 30},
+		{Value: 87.5}, {Value: 48.25}, {Value: 90061}, {Text: "2024-02-15T10:00:00Z"},
+	}
+	for i, w := range want {
+		got := values[i]
+		if got.Status != StatusGood || got.Value != w.Value || got.Text != w.Text || got.SourceTimestamp != "2024-02-15T10:00:00Z" {
+			t.Errorf("%s = %+v, want %+v", got.Name, got, w)
+		}
+	}
+
+	// A disk that is gone keeps its node without data.
+	info := sampleInfo()
+	info.Disk.Usage = nil
+	srv.Update(info)
+	values, err = c.Poll(context.Background())
+	if err != nil || values[4].StatusCode != uint32(ua.StatusBadNoData) {
+		t.Fatalf("unmounted disk = %+v, %v", values[4], err)
+	}
+}
+
+func TestServerBrowse(t *testing.T) {
+	srv := newServer(t, ServerConfig{})
+	srv.Update(sampleInfo())
+
+	ctx := context.Background()
+	conn, err := opcua.NewClient(srv.Endpoint(), opcua.SecurityMode(ua.MessageSecurityModeNone))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := conn.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	browse := func(nodeID *ua.NodeID) []string {
+		t.Helper()
+		refs, err := conn.Node(nodeID).ReferencedNodes(ctx, id.HierarchicalReferences, ua.BrowseDirectionForward, ua.NodeClassAll, true)
+		if err != nil {
+			t.Fatalf("browse %s: %v", nodeID, err)
+		}
+		var names []string
+		for _, n := range refs {
+			name, err := n.BrowseName(ctx)
+			if err != nil {
+				t.Fatalf("browse name of %s: %v", n.ID, err)
+			}
+			names = append(names, name.Name)
+		}
+		return names
+	}
+	if names := browse(ua.NewNumericNodeID(0, id.ObjectsFolder)); !slices.Contains(names, "Device") {
+		t.Fatalf("Objects = %v", names)
+	}
+	want := []string{"Timestamp", "CPU", "Load", "Memory", "Disk", "Network", "Host", "Sensors"}
+	if names := browse(ua.NewStringNodeID(1, "Device")); !slices.Equal(names, want) {
+		t.Fatalf("Device = %v, want %v", names, want)
+	}
+	if names := browse(ua.NewStringNodeID(1, "Device.Disk")); !slices.Equal(names, []string{"/"}) {
+		t.Fatalf("Disk = %v", names)
+	}
+
+	types := map[string]uint32{
+		"Device.CPU.TotalPercent": id.Double,
+		"Device.CPU.Cores":        id.Int32,
+		"Device.Memory.Total":     id.UInt64,
+		"Device.Host.Hostname":    id.String,
+		"Device.Host.BootTime":    id.DateTime,
+	}
+	for name, want := range types {
+		dv, err := conn.Node(ua.NewStringNodeID(1, name)).Attribute(ctx, ua.AttributeIDDataType)
+		if err != nil {
+			t.Fatalf("data type of %s: %v", name, err)
+		}
+		if got, ok := dv.Value().(*ua.NodeID); !ok || got.IntID() != want {
+			t.Errorf("data type of %s = %v, want %d", name, dv.Value(), want)
+		}
+	}
+
+	// The snapshot is read-only.
+	resp, err := conn.Write(ctx, &ua.WriteRequest{NodesToWrite: []*ua.WriteValue{{
+		NodeID:      ua.NewStringNodeID(1, "Device.CPU.TotalPercent"),
+		AttributeID: ua.AttributeIDValue,
+		Value:       &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(1.0)},
+	}}})
+	if err != nil || resp.Results[0] != ua.StatusBadNotWritable {
+		t.Fatalf("Write = %+v, %v", resp, err)
+	}
+}
+
+func TestServerSubscribe(t *testing.T) {
+	srv := newServer(t, ServerConfig{})
+	srv.Update(sampleInfo())
+
+	c, err := NewClient(Config{Endpoint: srv.Endpoint(), Subscribe: true, PublishingInterval: 50 * time.Millisecond, Nodes: []Node{
+		snapshotNode("CPU.TotalPercent"),
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	cpu := func() float64 {
+		values, err := c.Poll(context.Background())
+		if err != nil {
+			t.Fatalf("Poll: %v", err)
+		}
+		return values[0].Value
+	}
+	waitFor(t, func() bool { return cpu() == 42.5 })
+	info := sampleInfo()
+	info.CPU.TotalPercent = 7
+	srv.Update(info)
+	waitFor(t, func() bool { return cpu() == 7 })
+}
+
+func TestServerSecurity(t *testing.T) {
+	for _, mode := range []string{"Sign", "SignAndEncrypt"} {
+		t.Run(mode, func(t *testing.T) {
+			srv := newServer(t, ServerConfig{SecurityPolicy: "Basic256Sha256", SecurityMode: mode})
+			srv.Update(sampleInfo())
+			nodes := []Node{snapshotNode("CPU.TotalPercent")}
+
+			c, err := NewClient(Config{Endpoint: srv.Endpoint(), SecurityPolicy: "Basic256Sha256", SecurityMode: mode, Nodes: nodes}, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			defer c.Close()
+			if values, err := c.Poll(context.Background()); err != nil || values[0].Value != 42.5 {
+				t.Fatalf("Poll = %+v, %v", values, err)
+			}
+
+			// Only the configured policy and mode are offered.
+			insecure, err := NewClient(Config{Endpoint: srv.Endpoint(), Nodes: nodes}, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			defer insecure.Close()
+			if _, err := insecure.Poll(context.Background()); err == nil || !strings.Contains(err.Error(), "no matching endpoint") {
+				t.Fatalf("expected endpoint error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServerConfigValidation(t *testing.T) {
+	port := freePort(t)
+	invalid := []ServerConfig{
+		{Address: "127.0.0.1"},
+		{Address: "127.0.0.1:0"},
+		{Address: "127.0.0.1:70000"},
+		{Address: fmt.Sprintf("127.0.0.1:%d", port), SecurityPolicy: "Basic256Sha256"},
+		{Address: fmt.Sprintf("127.0.0.1:%d", port), SecurityPolicy: "Basic512", SecurityMode: "Sign"},
+		{Address: fmt.Sprintf("127.0.0.1:%d", port), SecurityMode: "Encrypt"},
+		{Address: fmt.Sprintf("127.0.0.1:%d", port), CertificateFile: "/does/not/exist.pem"},
+		{Address: fmt.Sprintf("127.0.0.1:%d", port), CertificateFile: "/does/not/exist.pem", PrivateKeyFile: "/does/not/exist.key"},
+	}
+	for _, cfg := range invalid {
+		if srv, err := NewServer(cfg, nil); err == nil {
+			srv.Close()
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestLoadKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+	der, key, err := selfSigned("urn:edgebeat:edge-01", "edge-01")
+	if err != nil {
+		t.Fatalf("selfSigned: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	certPEM := write("cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := write("key.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	certDER := write("cert.der", der)
+	keyDER := write("key.der", x509.MarshalPKCS1PrivateKey(key))
+
+	for _, files := range [][2]string{{certPEM, keyPEM}, {certDER, keyDER}} {
+		got, _, err := loadKeyPair(files[0], files[1])
+		if err != nil || !slices.Equal(got, der) {
+			t.Fatalf("loadKeyPair(%s, %s) = %v", files[0], files[1], err)
+		}
+	}
+
+	_, other, err := selfSigned("urn:edgebeat:edge-02")
+	if err != nil {
+		t.Fatalf("selfSigned: %v", err)
+	}
+	otherKey := write("other.der", x509.MarshalPKCS1PrivateKey(other))
+	if _, _, err := loadKeyPair(certPEM, otherKey); err == nil {
+		t.Fatal("expected error for a key that does not match the certificate")
+	}
+	if _, _, err := loadKeyPair(keyPEM, keyPEM); err == nil {
+		t.Fatal("expected error for a key as certificate")
+	}
+
+	// A server with the certificate files accepts secure sessions.
+	srv := newServer(t, ServerConfig{SecurityPolicy: "Basic256Sha256", SecurityMode: "SignAndEncrypt", CertificateFile: certPEM, PrivateKeyFile: keyPEM})
+	srv.Update(sampleInfo())
+	c, err := NewClient(Config{Endpoint: srv.Endpoint(), SecurityPolicy: "Basic256Sha256", SecurityMode: "SignAndEncrypt", Nodes: []Node{snapshotNode("Host.Hostname")}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+	if values, err := c.Poll(context.Background()); err != nil || values[0].Text != "edge-01" {
+		t.Fatalf("Poll = %+v, %v", values, err)
+	}
+}
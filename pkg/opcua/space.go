@@ -0,0 +1,194 @@
+package opcua
+
+import (
+	"sync"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/ua"
+)
+
+// superTypes maps each reference type the address space uses to its super
+// type, for browse requests that include subtypes.
+var superTypes = map[uint32]uint32{
+	id.HasComponent:              id.Aggregates,
+	id.Aggregates:                id.HasChild,
+	id.HasChild:                  id.HierarchicalReferences,
+	id.Organizes:                 id.HierarchicalReferences,
+	id.HierarchicalReferences:    id.References,
+	id.HasTypeDefinition:         id.NonHierarchicalReferences,
+	id.NonHierarchicalReferences: id.References,
+}
+
+// addressSpace is the namespace of the embedded server. Unlike
+// server.NodeNameSpace it may grow while clients browse it: a node never
+// changes once added, and the references of every node are kept here under
+// one lock.
+type addressSpace struct {
+	name string
+	id   uint16
+
+	mu    sync.RWMutex
+	nodes map[string]*server.Node
+	refs  map[string][]*ua.ReferenceDescription
+}
+
+func newAddressSpace(srv *server.Server, name string) *addressSpace {
+	a := &addressSpace{
+		name:  name,
+		nodes: make(map[string]*server.Node),
+		refs:  make(map[string][]*ua.ReferenceDescription),
+	}
+	srv.AddNamespace(a)
+	return a
+}
+
+// addFolder adds an object of FolderType below parent. A parent outside this
+// namespace, such as the Objects folder, must reference the folder itself.
+func (a *addressSpace) addFolder(parent *server.Node, nodeID, name string) *server.Node {
+	typeDef := a.reference(id.HasTypeDefinition, true, ua.NewNumericNodeID(0, id.FolderType), &ua.QualifiedName{Name: "FolderType"}, ua.NodeClassObjectType, 0)
+	n := server.NewNode(ua.NewStringNodeID(a.id, nodeID), server.Attributes{
+		ua.AttributeIDNodeClass:     server.DataValueFromValue(int32(ua.NodeClassObject)),
+		ua.AttributeIDBrowseName:    server.DataValueFromValue(&ua.QualifiedName{NamespaceIndex: a.id, Name: name}),
+		ua.AttributeIDDisplayName:   server.DataValueFromValue(ua.NewLocalizedText(name)),
+		ua.AttributeIDEventNotifier: server.DataValueFromValue(byte(0)),
+	}, server.References{typeDef}, nil)
+	a.add(parent, n, id.FolderType, typeDef)
+	return n
+}
+
+// addVariable adds a read-only scalar of dataType, such as id.Double, whose
+// value comes from value.
+func (a *addressSpace) addVariable(parent *server.Node, nodeID, name string, dataType uint32, value func() *ua.DataValue) *server.Node {
+	typeDef := a.reference(id.HasTypeDefinition, true, ua.NewNumericNodeID(0, id.BaseDataVariableType), &ua.QualifiedName{Name: "BaseDataVariableType"}, ua.NodeClassVariableType, 0)
+	n := server.NewNode(ua.NewStringNodeID(a.id, nodeID), server.Attributes{
+		ua.AttributeIDNodeClass:               server.DataValueFromValue(int32(ua.NodeClassVariable)),
+		ua.AttributeIDBrowseName:              server.DataValueFromValue(&ua.QualifiedName{NamespaceIndex: a.id, Name: name}),
+		ua.AttributeIDDisplayName:             server.DataValueFromValue(ua.NewLocalizedText(name)),
+		ua.AttributeIDDataType:                server.DataValueFromValue(ua.NewNumericNodeID(0, dataType)),
+		ua.AttributeIDValueRank:               server.DataValueFromValue(int32(-1)),
+		ua.AttributeIDAccessLevel:             server.DataValueFromValue(byte(ua.AccessLevelTypeCurrentRead)),
+		ua.AttributeIDUserAccessLevel:         server.DataValueFromValue(byte(ua.AccessLevelTypeCurrentRead)),
+		ua.AttributeIDMinimumSamplingInterval: server.DataValueFromValue(float64(0)),
+		ua.AttributeIDHistorizing:             server.DataValueFromValue(false),
+	}, nil, value)
+	a.add(parent, n, id.BaseDataVariableType, typeDef)
+	return n
+}
+
+func (a *addressSpace) add(parent *server.Node, n *server.Node, typeDef uint32, typeRef *ua.ReferenceDescription) {
+	refType := uint32(id.HasComponent)
+	if parent.ID().Namespace() != a.id {
+		refType = id.Organizes
+	}
+	up := a.reference(refType, false, parent.ID(), parent.BrowseName(), parent.NodeClass(), id.FolderType)
+	down := a.reference(refType, true, n.ID(), n.BrowseName(), n.NodeClass(), typeDef)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := n.ID().String()
+	a.nodes[key] = n
+	a.refs[key] = []*ua.ReferenceDescription{typeRef, up}
+	if parent.ID().Namespace() == a.id {
+		a.refs[parent.ID().String()] = append(a.refs[parent.ID().String()], down)
+	}
+}
+
+func (a *addressSpace) reference(refType uint32, forward bool, target *ua.NodeID, name *ua.QualifiedName, class ua.NodeClass, typeDef uint32) *ua.ReferenceDescription {
+	return &ua.ReferenceDescription{
+		ReferenceTypeID: ua.NewNumericNodeID(0, refType),
+		IsForward:       forward,
+		NodeID:          ua.NewExpandedNodeID(target, "", 0),
+		BrowseName:      name,
+		DisplayName:     ua.NewLocalizedText(name.Name),
+		NodeClass:       class,
+		TypeDefinition:  ua.NewNumericExpandedNodeID(0, typeDef),
+	}
+}
+
+func (a *addressSpace) Name() string { return a.name }
+
+// AddNode is not used; nodes are added with addFolder and addVariable.
+func (a *addressSpace) AddNode(n *server.Node) *server.Node { return n }
+
+func (a *addressSpace) Node(nodeID *ua.NodeID) *server.Node {
+	if nodeID == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.nodes[nodeID.String()]
+}
+
+func (a *addressSpace) Objects() *server.Node { return nil }
+
+func (a *addressSpace) Root() *server.Node { return nil }
+
+func (a *addressSpace) Browse(bd *ua.BrowseDescription) *ua.BrowseResult {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	refs, ok := a.refs[bd.NodeID.String()]
+	if !ok {
+		return &ua.BrowseResult{StatusCode: ua.StatusBadNodeIDUnknown}
+	}
+	var matched []*ua.ReferenceDescription
+	for _, r := range refs {
+		if browseMatches(bd, r) {
+			matched = append(matched, r)
+		}
+	}
+	return &ua.BrowseResult{StatusCode: ua.StatusGood, References: matched}
+}
+
+func browseMatches(bd *ua.BrowseDescription, r *ua.ReferenceDescription) bool {
+	switch bd.BrowseDirection {
+	case ua.BrowseDirectionForward:
+		if !r.IsForward {
+			return false
+		}
+	case ua.BrowseDirectionInverse:
+		if r.IsForward {
+			return false
+		}
+	}
+	if bd.NodeClassMask != 0 && bd.NodeClassMask&uint32(r.NodeClass) == 0 {
+		return false
+	}
+	want := bd.ReferenceTypeID
+	if want == nil || (want.Namespace() == 0 && want.IntID() == 0) {
+		return true
+	}
+	for t := r.ReferenceTypeID.IntID(); t != 0; t = superTypes[t] {
+		if t == want.IntID() {
+			return true
+		}
+		if !bd.IncludeSubtypes {
+			break
+		}
+	}
+	return false
+}
+
+func (a *addressSpace) ID() uint16 { return a.id }
+
+func (a *addressSpace) SetID(id uint16) { a.id = id }
+
+func (a *addressSpace) Attribute(nodeID *ua.NodeID, attr ua.AttributeID) *ua.DataValue {
+	n := a.Node(nodeID)
+	if n == nil {
+		return &ua.DataValue{EncodingMask: ua.DataValueStatusCode, Status: ua.StatusBadNodeIDUnknown}
+	}
+	if attr == ua.AttributeIDNodeID {
+		return server.DataValueFromValue(nodeID)
+	}
+	v, err := n.Attribute(attr)
+	if err != nil {
+		return &ua.DataValue{EncodingMask: ua.DataValueStatusCode, Status: ua.StatusBadAttributeIDInvalid}
+	}
+	return v.Value
+}
+
+// SetAttribute refuses every write; the snapshot is read-only.
+func (a *addressSpace) SetAttribute(*ua.NodeID, ua.AttributeID, *ua.DataValue) ua.StatusCode {
+	return ua.StatusBadNotWritable
+}
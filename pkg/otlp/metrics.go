@@ -0,0 +1,248 @@
+package otlp
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// ScopeName identifies edgebeat as the instrumentation scope.
+const ScopeName = "github.com/jilanisayyad/edgebeat"
+
+// FromSnapshot maps a snapshot to the system and hardware metrics of the
+// OpenTelemetry semantic conventions. The resource describes the host;
+// attributes in extra are added to it and override attributes of the same
+// key. Cumulative sums start at boot time.
+func FromSnapshot(info utils.SystemInfo, extra map[string]string) Request {
+	ts, err := time.Parse(time.RFC3339Nano, info.Timestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+	req := Request{
+		Resource:  Resource(info.Host, extra),
+		ScopeName: ScopeName,
+		Time:      ts,
+	}
+	if info.Host.BootTime > 0 {
+		req.StartTime = time.Unix(int64(info.Host.BootTime), 0)
+	}
+
+	gauge := func(name, unit string, points ...Point) {
+		req.Metrics = append(req.Metrics, Metric{Name: name, Unit: unit, Kind: Gauge, Points: points})
+	}
+	sum := func(name, unit string, monotonic bool, points ...Point) {
+		req.Metrics = append(req.Metrics, Metric{Name: name, Unit: unit, Kind: Sum, Monotonic: monotonic, Points: points})
+	}
+	point := func(value any, kv ...any) Point {
+		p := Point{Value: value}
+		for i := 0; i+1 < len(kv); i += 2 {
+			p.Attributes = append(p.Attributes, Attribute{Key: kv[i].(string), Value: kv[i+1]})
+		}
+		return p
+	}
+
+	// Backends sum or average the points of a metric, so the total is only
+	// sent when there are no per-CPU values it would be counted with.
+	var cpu []Point
+	for i, percent := range info.CPU.PerCPUPercent {
+		cpu = append(cpu, point(percent/100, "cpu.logical_number", int64(i)))
+	}
+	if len(cpu) == 0 {
+		cpu = append(cpu, point(info.CPU.TotalPercent/100))
+	}
+	gauge("system.cpu.utilization", "1", cpu...)
+	times := info.CPU.TotalTimes
+	sum("system.cpu.time", "s", true,
+		point(times.User, "cpu.mode", "user"),
+		point(times.System, "cpu.mode", "system"),
+		point(times.Nice, "cpu.mode", "nice"),
+		point(times.Idle, "cpu.mode", "idle"),
+		point(times.Iowait, "cpu.mode", "iowait"),
+		point(times.Irq, "cpu.mode", "interrupt"),
+		point(times.SoftIrq, "cpu.mode", "softirq"),
+		point(times.Steal, "cpu.mode", "steal"),
+	)
+	gauge("system.cpu.load_average.1m", "{thread}", point(info.Load.Load1))
+	gauge("system.cpu.load_average.5m", "{thread}", point(info.Load.Load5))
+	gauge("system.cpu.load_average.15m", "{thread}", point(info.Load.Load15))
+
+	vm := info.Memory.Virtual
+	sum("system.memory.usage", "By", false,
+		point(integer(vm.Used), "system.memory.state", "used"),
+		point(integer(vm.Free), "system.memory.state", "free"),
+		point(integer(vm.Buffers), "system.memory.state", "buffers"),
+		point(integer(vm.Cached), "system.memory.state", "cached"),
+	)
+	sum("system.memory.limit", "By", false, point(integer(vm.Total)))
+	if vm.Total > 0 {
+		total := float64(vm.Total)
+		gauge("system.memory.utilization", "1",
+			point(float64(vm.Used)/total, "system.memory.state", "used"),
+			point(float64(vm.Free)/total, "system.memory.state", "free"),
+			point(float64(vm.Buffers)/total, "system.memory.state", "buffers"),
+			point(float64(vm.Cached)/total, "system.memory.state", "cached"),
+		)
+	}
+	swap := info.Memory.Swap
+	sum("system.paging.usage", "By", false,
+		point(integer(swap.Used), "system.paging.state", "used"),
+		point(integer(swap.Free), "system.paging.state", "free"),
+	)
+
+	var fsUsage, fsUtil []Point
+	for _, u := range info.Disk.Usage {
+		kv := []any{"system.device", u.Device, "system.filesystem.mountpoint", u.Mountpoint, "system.filesystem.type", u.FSType}
+		fsUsage = append(fsUsage,
+			point(integer(u.Used), append(kv, "system.filesystem.state", "used")...),
+			point(integer(u.Free), append(kv, "system.filesystem.state", "free")...),
+		)
+		fsUtil = append(fsUtil, point(u.UsedPercent/100, kv...))
+	}
+	if fsUsage != nil {
+		sum("system.filesystem.usage", "By", false, fsUsage...)
+		gauge("system.filesystem.utilization", "1", fsUtil...)
+	}
+
+	var diskIO, diskOps, diskTime []Point
+	for _, io := range info.Disk.IO {
+		diskIO = append(diskIO,
+			point(integer(io.ReadBytes), "system.device", io.Device, "disk.io.direction", "read"),
+			point(integer(io.WriteBytes), "system.device", io.Device, "disk.io.direction", "write"),
+		)
+		diskOps = append(diskOps,
+			point(integer(io.ReadCount), "system.device", io.Device, "disk.io.direction", "read"),
+			point(integer(io.WriteCount), "system.device", io.Device, "disk.io.direction", "write"),
+		)
+		diskTime = append(diskTime,
+			point(float64(io.ReadTimeMS)/1000, "system.device", io.Device, "disk.io.direction", "read"),
+			point(float64(io.WriteTimeMS)/1000, "system.device", io.Device, "disk.io.direction", "write"),
+		)
+	}
+	if diskIO != nil {
+		sum("system.disk.io", "By", true, diskIO...)
+		sum("system.disk.operations", "{operation}", true, diskOps...)
+		sum("system.disk.operation_time", "s", true, diskTime...)
+	}
+
+	net := info.Network.Totals
+	sum("system.network.io", "By", true,
+		point(integer(net.BytesSent), "network.io.direction", "transmit"),
+		point(integer(net.BytesRecv), "network.io.direction", "receive"),
+	)
+	sum("system.network.packets", "{packet}", true,
+		point(integer(net.PacketsSent), "network.io.direction", "transmit"),
+		point(integer(net.PacketsRecv), "network.io.direction", "receive"),
+	)
+	sum("system.network.errors", "{error}", true,
+		point(integer(net.Errout), "network.io.direction", "transmit"),
+		point(integer(net.Errin), "network.io.direction", "receive"),
+	)
+	sum("system.network.dropped", "{packet}", true,
+		point(integer(net.Dropout), "network.io.direction", "transmit"),
+		point(integer(net.Dropin), "network.io.direction", "receive"),
+	)
+
+	gauge("system.uptime", "s", point(integer(info.Host.UptimeSeconds)))
+	sum("system.process.count", "{process}", false, point(integer(info.Host.Procs)))
+
+	if len(info.Sensors.Temperatures) > 0 {
+		var temps []Point
+		for _, t := range info.Sensors.Temperatures {
+			temps = append(temps, point(t.Value, "hw.id", t.SensorKey, "hw.type", "temperature"))
+		}
+		gauge("hw.temperature", "Cel", temps...)
+	}
+	if len(info.Sensors.Fans) > 0 {
+		var fans []Point
+		for _, f := range info.Sensors.Fans {
+			fans = append(fans, point(f.Value, "hw.id", f.SensorKey, "hw.type", "fan"))
+		}
+		gauge("hw.fan.speed", "rpm", fans...)
+	}
+	// Other sensor values have no semantic convention. They get a metric per
+	// channel type, whose unit only depends on the type.
+	var types []string
+	readings := make(map[string][]Point)
+	units := make(map[string]string)
+	for _, r := range info.Sensors.Readings {
+		if _, ok := readings[r.Type]; !ok {
+			types = append(types, r.Type)
+		}
+		readings[r.Type] = append(readings[r.Type], point(r.Value, "hw.id", r.SensorKey, "hw.type", r.Type))
+		units[r.Type] = ucum(r.Unit)
+	}
+	for _, typ := range types {
+		gauge("edgebeat.sensor."+typ, units[typ], readings[typ]...)
+	}
+
+	return req
+}
+
+// Resource returns the attributes describing the host merged with extra,
+// sorted by key. Attributes with an empty value are left out, so an empty
+// value in extra removes a host attribute.
+func Resource(host utils.HostStats, extra map[string]string) []Attribute {
+	attrs := map[string]string{
+		"service.name":   "edgebeat",
+		"host.name":      host.Hostname,
+		"host.arch":      hostArch(host.KernelArch),
+		"os.type":        host.OS,
+		"os.name":        host.Platform,
+		"os.version":     host.PlatformVersion,
+		"os.description": host.KernelVersion,
+	}
+	for k, v := range extra {
+		attrs[k] = v
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k, v := range attrs {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	out := make([]Attribute, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, Attribute{Key: k, Value: attrs[k]})
+	}
+	return out
+}
+
+// hostArch maps uname machine names to the host.arch values of the semantic
+// conventions and passes unknown names through.
+func hostArch(machine string) string {
+	switch machine {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "i386", "i686", "x86":
+		return "x86"
+	case "ppc64le", "ppc64":
+		return "ppc64"
+	}
+	if len(machine) >= 4 && machine[:4] == "armv" {
+		return "arm32"
+	}
+	return machine
+}
+
+// integer converts a collected counter to an OTLP integer value. Real values
+// never reach the int64 limit.
+func integer(v uint64) int64 {
+	if v > 1<<63-1 {
+		return 1<<63 - 1
+	}
+	return int64(v)
+}
+
+// ucum returns the UCUM code of an IIO unit.
+func ucum(unit string) string {
+	if unit == "ohm" {
+		return "Ohm"
+	}
+	return unit
+}
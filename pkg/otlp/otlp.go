@@ -0,0 +1,413 @@
+// Package otlp encodes snapshots as OpenTelemetry OTLP metrics export
+// requests in the protobuf and JSON encodings of OTLP/HTTP.
+//
+// Only gauges and sums with number data points are implemented, which is all
+// edgebeat produces.
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Content types of the two OTLP/HTTP encodings.
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+// SchemaURL is the semantic conventions version the metric and attribute
+// names follow.
+const SchemaURL = "https://opentelemetry.io/schemas/1.26.0"
+
+// Protobuf field numbers from opentelemetry-proto metrics_service.proto,
+// metrics.proto, resource.proto and common.proto.
+const (
+	requestResourceMetrics protowire.Number = 1
+
+	resourceMetricsResource     protowire.Number = 1
+	resourceMetricsScopeMetrics protowire.Number = 2
+	resourceMetricsSchemaURL    protowire.Number = 3
+
+	resourceAttributes protowire.Number = 1
+
+	scopeMetricsScope     protowire.Number = 1
+	scopeMetricsMetrics   protowire.Number = 2
+	scopeMetricsSchemaURL protowire.Number = 3
+
+	scopeName    protowire.Number = 1
+	scopeVersion protowire.Number = 2
+
+	metricName        protowire.Number = 1
+	metricDescription protowire.Number = 2
+	metricUnit        protowire.Number = 3
+	metricGauge       protowire.Number = 5
+	metricSum         protowire.Number = 7
+
+	gaugeDataPoints protowire.Number = 1
+
+	sumDataPoints             protowire.Number = 1
+	sumAggregationTemporality protowire.Number = 2
+	sumIsMonotonic            protowire.Number = 3
+
+	pointStartTime  protowire.Number = 2
+	pointTime       protowire.Number = 3
+	pointAsDouble   protowire.Number = 4
+	pointAsInt      protowire.Number = 6
+	pointAttributes protowire.Number = 7
+
+	keyValueKey   protowire.Number = 1
+	keyValueValue protowire.Number = 2
+
+	anyString protowire.Number = 1
+	anyBool   protowire.Number = 2
+	anyInt    protowire.Number = 3
+	anyDouble protowire.Number = 4
+)
+
+// aggregationCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const aggregationCumulative = 2
+
+// Kind selects the OTLP metric data type.
+type Kind int
+
+const (
+	Gauge Kind = iota
+	Sum
+)
+
+// Attribute is a key value pair. Value is a string, bool, int64 or float64.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Point is one number data point. Value is an int64 or a float64.
+type Point struct {
+	Attributes []Attribute
+	Value      any
+}
+
+// Metric is a gauge or a cumulative sum. StartTime is only used for sums.
+type Metric struct {
+	Name        string
+	Description string
+	Unit        string
+	Kind        Kind
+	Monotonic   bool
+	Points      []Point
+}
+
+// Request is an export request for a single resource and scope. All points
+// share Time and, for sums, StartTime.
+type Request struct {
+	Resource     []Attribute
+	ScopeName    string
+	ScopeVersion string
+	Time         time.Time
+	StartTime    time.Time
+	Metrics      []Metric
+}
+
+// MarshalProto encodes r as an ExportMetricsServiceRequest. Points whose value
+// is NaN or infinite are left out, as in the JSON encoding.
+func (r Request) MarshalProto() ([]byte, error) {
+	var resource []byte
+	for _, a := range r.Resource {
+		kv, err := marshalKeyValue(a)
+		if err != nil {
+			return nil, fmt.Errorf("resource: %w", err)
+		}
+		resource = protowire.AppendTag(resource, resourceAttributes, protowire.BytesType)
+		resource = protowire.AppendBytes(resource, kv)
+	}
+
+	var scope []byte
+	if r.ScopeName != "" {
+		scope = protowire.AppendTag(scope, scopeName, protowire.BytesType)
+		scope = protowire.AppendString(scope, r.ScopeName)
+	}
+	if r.ScopeVersion != "" {
+		scope = protowire.AppendTag(scope, scopeVersion, protowire.BytesType)
+		scope = protowire.AppendString(scope, r.ScopeVersion)
+	}
+
+	var scopeMetrics []byte
+	scopeMetrics = protowire.AppendTag(scopeMetrics, scopeMetricsScope, protowire.BytesType)
+	scopeMetrics = protowire.AppendBytes(scopeMetrics, scope)
+	for _, m := range r.Metrics {
+		metric, err := r.marshalMetric(m)
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Name, err)
+		}
+		if metric == nil {
+			continue
+		}
+		scopeMetrics = protowire.AppendTag(scopeMetrics, scopeMetricsMetrics, protowire.BytesType)
+		scopeMetrics = protowire.AppendBytes(scopeMetrics, metric)
+	}
+	scopeMetrics = protowire.AppendTag(scopeMetrics, scopeMetricsSchemaURL, protowire.BytesType)
+	scopeMetrics = protowire.AppendString(scopeMetrics, SchemaURL)
+
+	var rm []byte
+	rm = protowire.AppendTag(rm, resourceMetricsResource, protowire.BytesType)
+	rm = protowire.AppendBytes(rm, resource)
+	rm = protowire.AppendTag(rm, resourceMetricsScopeMetrics, protowire.BytesType)
+	rm = protowire.AppendBytes(rm, scopeMetrics)
+	rm = protowire.AppendTag(rm, resourceMetricsSchemaURL, protowire.BytesType)
+	rm = protowire.AppendString(rm, SchemaURL)
+
+	var out []byte
+	out = protowire.AppendTag(out, requestResourceMetrics, protowire.BytesType)
+	out = protowire.AppendBytes(out, rm)
+	return out, nil
+}
+
+// marshalMetric returns nil for a metric without any representable point.
+func (r Request) marshalMetric(m Metric) ([]byte, error) {
+	var points []byte
+	field := gaugeDataPoints
+	if m.Kind == Sum {
+		field = sumDataPoints
+	}
+	for _, p := range m.Points {
+		if !representable(p.Value) {
+			continue
+		}
+		var point []byte
+		if m.Kind == Sum && !r.StartTime.IsZero() {
+			point = protowire.AppendTag(point, pointStartTime, protowire.Fixed64Type)
+			point = protowire.AppendFixed64(point, uint64(r.StartTime.UnixNano()))
+		}
+		point = protowire.AppendTag(point, pointTime, protowire.Fixed64Type)
+		point = protowire.AppendFixed64(point, uint64(r.Time.UnixNano()))
+		switch v := p.Value.(type) {
+		case float64:
+			point = protowire.AppendTag(point, pointAsDouble, protowire.Fixed64Type)
+			point = protowire.AppendFixed64(point, math.Float64bits(v))
+		case int64:
+			point = protowire.AppendTag(point, pointAsInt, protowire.Fixed64Type)
+			point = protowire.AppendFixed64(point, uint64(v))
+		default:
+			return nil, fmt.Errorf("unsupported point type %T", p.Value)
+		}
+		for _, a := range p.Attributes {
+			kv, err := marshalKeyValue(a)
+			if err != nil {
+				return nil, err
+			}
+			point = protowire.AppendTag(point, pointAttributes, protowire.BytesType)
+			point = protowire.AppendBytes(point, kv)
+		}
+		points = protowire.AppendTag(points, field, protowire.BytesType)
+		points = protowire.AppendBytes(points, point)
+	}
+	if points == nil {
+		return nil, nil
+	}
+
+	var out []byte
+	out = protowire.AppendTag(out, metricName, protowire.BytesType)
+	out = protowire.AppendString(out, m.Name)
+	if m.Description != "" {
+		out = protowire.AppendTag(out, metricDescription, protowire.BytesType)
+		out = protowire.AppendString(out, m.Description)
+	}
+	if m.Unit != "" {
+		out = protowire.AppendTag(out, metricUnit, protowire.BytesType)
+		out = protowire.AppendString(out, m.Unit)
+	}
+	if m.Kind == Sum {
+		points = protowire.AppendTag(points, sumAggregationTemporality, protowire.VarintType)
+		points = protowire.AppendVarint(points, aggregationCumulative)
+		if m.Monotonic {
+			points = protowire.AppendTag(points, sumIsMonotonic, protowire.VarintType)
+			points = protowire.AppendVarint(points, 1)
+		}
+		out = protowire.AppendTag(out, metricSum, protowire.BytesType)
+	} else {
+		out = protowire.AppendTag(out, metricGauge, protowire.BytesType)
+	}
+	out = protowire.AppendBytes(out, points)
+	return out, nil
+}
+
+func marshalKeyValue(a Attribute) ([]byte, error) {
+	var value []byte
+	switch v := a.Value.(type) {
+	case string:
+		value = protowire.AppendTag(value, anyString, protowire.BytesType)
+		value = protowire.AppendString(value, v)
+	case bool:
+		value = protowire.AppendTag(value, anyBool, protowire.VarintType)
+		value = protowire.AppendVarint(value, protowire.EncodeBool(v))
+	case int64:
+		value = protowire.AppendTag(value, anyInt, protowire.VarintType)
+		value = protowire.AppendVarint(value, uint64(v))
+	case float64:
+		value = protowire.AppendTag(value, anyDouble, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, math.Float64bits(v))
+	default:
+		return nil, fmt.Errorf("attribute %s: unsupported type %T", a.Key, a.Value)
+	}
+
+	var out []byte
+	out = protowire.AppendTag(out, keyValueKey, protowire.BytesType)
+	out = protowire.AppendString(out, a.Key)
+	out = protowire.AppendTag(out, keyValueValue, protowire.BytesType)
+	out = protowire.AppendBytes(out, value)
+	return out, nil
+}
+
+// The json* types mirror the OTLP/JSON mapping: lowerCamelCase field names,
+// 64 bit integers as decimal strings and enums as numbers.
+type (
+	jsonRequest struct {
+		ResourceMetrics []jsonResourceMetrics `json:"resourceMetrics"`
+	}
+	jsonResourceMetrics struct {
+		Resource     jsonResource       `json:"resource"`
+		ScopeMetrics []jsonScopeMetrics `json:"scopeMetrics"`
+		SchemaURL    string             `json:"schemaUrl"`
+	}
+	jsonResource struct {
+		Attributes []jsonKeyValue `json:"attributes"`
+	}
+	jsonScopeMetrics struct {
+		Scope     jsonScope    `json:"scope"`
+		Metrics   []jsonMetric `json:"metrics"`
+		SchemaURL string       `json:"schemaUrl"`
+	}
+	jsonScope struct {
+		Name    string `json:"name,omitempty"`
+		Version string `json:"version,omitempty"`
+	}
+	jsonMetric struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description,omitempty"`
+		Unit        string     `json:"unit,omitempty"`
+		Gauge       *jsonGauge `json:"gauge,omitempty"`
+		Sum         *jsonSum   `json:"sum,omitempty"`
+	}
+	jsonGauge struct {
+		DataPoints []jsonPoint `json:"dataPoints"`
+	}
+	jsonSum struct {
+		DataPoints             []jsonPoint `json:"dataPoints"`
+		AggregationTemporality int         `json:"aggregationTemporality"`
+		IsMonotonic            bool        `json:"isMonotonic,omitempty"`
+	}
+	jsonPoint struct {
+		Attributes        []jsonKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsDouble          *float64       `json:"asDouble,omitempty"`
+		AsInt             string         `json:"asInt,omitempty"`
+	}
+	jsonKeyValue struct {
+		Key   string       `json:"key"`
+		Value jsonAnyValue `json:"value"`
+	}
+	jsonAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    string   `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// MarshalJSON encodes r as an ExportMetricsServiceRequest in the OTLP/JSON
+// encoding.
+func (r Request) MarshalJSON() ([]byte, error) {
+	resource, err := jsonAttributes(r.Resource)
+	if err != nil {
+		return nil, fmt.Errorf("resource: %w", err)
+	}
+
+	ts := strconv.FormatInt(r.Time.UnixNano(), 10)
+	var start string
+	if !r.StartTime.IsZero() {
+		start = strconv.FormatInt(r.StartTime.UnixNano(), 10)
+	}
+
+	metrics := make([]jsonMetric, 0, len(r.Metrics))
+	for _, m := range r.Metrics {
+		var points []jsonPoint
+		for _, p := range m.Points {
+			if !representable(p.Value) {
+				continue
+			}
+			attrs, err := jsonAttributes(p.Attributes)
+			if err != nil {
+				return nil, fmt.Errorf("metric %s: %w", m.Name, err)
+			}
+			point := jsonPoint{Attributes: attrs, TimeUnixNano: ts}
+			if m.Kind == Sum {
+				point.StartTimeUnixNano = start
+			}
+			switch v := p.Value.(type) {
+			case float64:
+				point.AsDouble = &v
+			case int64:
+				point.AsInt = strconv.FormatInt(v, 10)
+			default:
+				return nil, fmt.Errorf("metric %s: unsupported point type %T", m.Name, p.Value)
+			}
+			points = append(points, point)
+		}
+		if points == nil {
+			continue
+		}
+
+		metric := jsonMetric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+		if m.Kind == Sum {
+			metric.Sum = &jsonSum{DataPoints: points, AggregationTemporality: aggregationCumulative, IsMonotonic: m.Monotonic}
+		} else {
+			metric.Gauge = &jsonGauge{DataPoints: points}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return json.Marshal(jsonRequest{ResourceMetrics: []jsonResourceMetrics{{
+		Resource: jsonResource{Attributes: resource},
+		ScopeMetrics: []jsonScopeMetrics{{
+			Scope:     jsonScope{Name: r.ScopeName, Version: r.ScopeVersion},
+			Metrics:   metrics,
+			SchemaURL: SchemaURL,
+		}},
+		SchemaURL: SchemaURL,
+	}}})
+}
+
+func jsonAttributes(attrs []Attribute) ([]jsonKeyValue, error) {
+	out := make([]jsonKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kv := jsonKeyValue{Key: a.Key}
+		switch v := a.Value.(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case bool:
+			kv.Value.BoolValue = &v
+		case int64:
+			kv.Value.IntValue = strconv.FormatInt(v, 10)
+		case float64:
+			kv.Value.DoubleValue = &v
+		default:
+			return nil, fmt.Errorf("attribute %s: unsupported type %T", a.Key, a.Value)
+		}
+		out = append(out, kv)
+	}
+	return out, nil
+}
+
+// representable reports whether v can be encoded; NaN and infinities have no
+// JSON representation and are dropped from both encodings alike.
+func representable(v any) bool {
+	f, ok := v.(float64)
+	return !ok || !(math.IsNaN(f) || math.IsInf(f, 0))
+}
@@ -0,0 +1,242 @@
+package otlp
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func testInfo() utils.SystemInfo {
+	return utils.SystemInfo{
+		Timestamp: "2024-02-15T10:31:45Z",
+		CPU:       utils.CPUStats{TotalPercent: 50, PerCPUPercent: []float64{25, 75}},
+		Memory:    utils.MemoryStats{Virtual: utils.VirtualMemory{Total: 1000, Used: 250, Free: 750}},
+		Disk:      utils.DiskStats{Usage: []utils.DiskUsage{{Device: "/dev/sda1", Mountpoint: "/", FSType: "ext4", Used: 10, Free: 30, UsedPercent: 25}}},
+		Network:   utils.NetworkStats{Totals: utils.NetIO{BytesSent: 100, BytesRecv: 200}},
+		Host:      utils.HostStats{Hostname: "edge-01", OS: "linux", Platform: "debian", PlatformVersion: "12", KernelArch: "aarch64", BootTime: 1707900000},
+		Sensors: utils.SensorsStats{
+			Temperatures: []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48.2}},
+			Readings: []utils.SensorReading{
+				{SensorKey: "bme280_pressure", Type: "pressure", Value: 101.3, Unit: "kPa"},
+				{SensorKey: "shunt", Type: "resistance", Value: 100, Unit: "ohm"},
+				{SensorKey: "outdoor_pressure", Type: "pressure", Value: 99.8, Unit: "kPa"},
+			},
+		},
+	}
+}
+
+func findMetric(t *testing.T, req Request, name string) Metric {
+	t.Helper()
+	for _, m := range req.Metrics {
+		if m.Name == name {
+			return m
+		}
+	}
+	t.Fatalf("missing metric %s", name)
+	return Metric{}
+}
+
+func attr(p Point, key string) any {
+	for _, a := range p.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestFromSnapshot(t *testing.T) {
+	req := FromSnapshot(testInfo(), map[string]string{"deployment.environment": "plant-a", "os.name": ""})
+
+	wantResource := []Attribute{
+		{"deployment.environment", "plant-a"},
+		{"host.arch", "arm64"},
+		{"host.name", "edge-01"},
+		{"os.type", "linux"},
+		{"os.version", "12"},
+		{"service.name", "edgebeat"},
+	}
+	if len(req.Resource) != len(wantResource) {
+		t.Fatalf("resource = %+v", req.Resource)
+	}
+	for i, a := range wantResource {
+		if req.Resource[i] != a {
+			t.Fatalf("resource = %+v, want %+v", req.Resource, wantResource)
+		}
+	}
+	if !req.StartTime.Equal(time.Unix(1707900000, 0)) {
+		t.Fatalf("start time = %v", req.StartTime)
+	}
+
+	cpu := findMetric(t, req, "system.cpu.utilization")
+	if cpu.Kind != Gauge || cpu.Unit != "1" || len(cpu.Points) != 2 || cpu.Points[0].Value != 0.25 || attr(cpu.Points[1], "cpu.logical_number") != int64(1) {
+		t.Fatalf("cpu = %+v", cpu)
+	}
+	info := testInfo()
+	info.CPU.PerCPUPercent = nil
+	cpu = findMetric(t, FromSnapshot(info, nil), "system.cpu.utilization")
+	if len(cpu.Points) != 1 || cpu.Points[0].Value != 0.5 || len(cpu.Points[0].Attributes) != 0 {
+		t.Fatalf("cpu without per-CPU values = %+v", cpu)
+	}
+
+	mem := findMetric(t, req, "system.memory.usage")
+	if mem.Kind != Sum || mem.Monotonic || mem.Unit != "By" || mem.Points[0].Value != int64(250) || attr(mem.Points[0], "system.memory.state") != "used" {
+		t.Fatalf("memory = %+v", mem)
+	}
+
+	fs := findMetric(t, req, "system.filesystem.usage")
+	if len(fs.Points) != 2 || attr(fs.Points[1], "system.filesystem.state") != "free" || attr(fs.Points[1], "system.filesystem.mountpoint") != "/" || fs.Points[1].Value != int64(30) {
+		t.Fatalf("filesystem = %+v", fs)
+	}
+
+	netIO := findMetric(t, req, "system.network.io")
+	if !netIO.Monotonic || attr(netIO.Points[1], "network.io.direction") != "receive" || netIO.Points[1].Value != int64(200) {
+		t.Fatalf("network = %+v", netIO)
+	}
+
+	temp := findMetric(t, req, "hw.temperature")
+	if temp.Unit != "Cel" || attr(temp.Points[0], "hw.id") != "cpu_thermal" {
+		t.Fatalf("temperature = %+v", temp)
+	}
+
+	pressure := findMetric(t, req, "edgebeat.sensor.pressure")
+	if pressure.Kind != Gauge || pressure.Unit != "kPa" || len(pressure.Points) != 2 || attr(pressure.Points[1], "hw.id") != "outdoor_pressure" || pressure.Points[1].Value != 99.8 {
+		t.Fatalf("pressure = %+v", pressure)
+	}
+	if resistance := findMetric(t, req, "edgebeat.sensor.resistance"); resistance.Unit != "Ohm" || len(resistance.Points) != 1 {
+		t.Fatalf("resistance = %+v", resistance)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	req := Request{
+		Resource:  []Attribute{{"host.name", "edge-01"}},
+		ScopeName: ScopeName,
+		Time:      time.Unix(2, 5),
+		StartTime: time.Unix(1, 0),
+		Metrics: []Metric{
+			{Name: "g", Unit: "1", Kind: Gauge, Points: []Point{{Value: 0.5, Attributes: []Attribute{{"cpu.logical_number", int64(3)}}}}},
+			{Name: "s", Unit: "By", Kind: Sum, Monotonic: true, Points: []Point{{Value: int64(0)}}},
+			{Name: "nan", Kind: Gauge, Points: []Point{{Value: math.NaN()}}},
+		},
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"resourceMetrics":[{"resource":{"attributes":[{"key":"host.name","value":{"stringValue":"edge-01"}}]},` +
+		`"scopeMetrics":[{"scope":{"name":"github.com/jilanisayyad/edgebeat"},"metrics":[` +
+		`{"name":"g","unit":"1","gauge":{"dataPoints":[{"attributes":[{"key":"cpu.logical_number","value":{"intValue":"3"}}],"timeUnixNano":"2000000005","asDouble":0.5}]}},` +
+		`{"name":"s","unit":"By","sum":{"dataPoints":[{"startTimeUnixNano":"1000000000","timeUnixNano":"2000000005","asInt":"0"}],"aggregationTemporality":2,"isMonotonic":true}}` +
+		`],"schemaUrl":"` + SchemaURL + `"}],"schemaUrl":"` + SchemaURL + `"}]}`
+	if string(b) != want {
+		t.Fatalf("json =\n%s\nwant\n%s", b, want)
+	}
+}
+
+// message decodes one protobuf message into its fields by number.
+type message map[protowire.Number][]field
+
+type field struct {
+	bytes []byte
+	num   uint64
+}
+
+func decode(t *testing.T, b []byte) message {
+	t.Helper()
+	m := message{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var f field
+		switch typ {
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			f.num, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.num, n = protowire.ConsumeFixed64(b)
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		if n < 0 {
+			t.Fatalf("field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		m[num] = append(m[num], f)
+	}
+	return m
+}
+
+func TestMarshalProto(t *testing.T) {
+	req := Request{
+		Resource:  []Attribute{{"host.name", "edge-01"}},
+		ScopeName: ScopeName,
+		Time:      time.Unix(2, 5),
+		StartTime: time.Unix(1, 0),
+		Metrics: []Metric{
+			{Name: "g", Unit: "1", Kind: Gauge, Points: []Point{{Value: 0.5, Attributes: []Attribute{{"cpu.logical_number", int64(3)}}}}},
+			{Name: "s", Unit: "By", Kind: Sum, Monotonic: true, Points: []Point{{Value: int64(-7)}}},
+			{Name: "nan", Kind: Gauge, Points: []Point{{Value: math.Inf(1)}}},
+		},
+	}
+
+	b, err := req.MarshalProto()
+	if err != nil {
+		t.Fatalf("MarshalProto: %v", err)
+	}
+
+	rm := decode(t, decode(t, b)[requestResourceMetrics][0].bytes)
+	resource := decode(t, rm[resourceMetricsResource][0].bytes)
+	kv := decode(t, resource[resourceAttributes][0].bytes)
+	if string(kv[keyValueKey][0].bytes) != "host.name" || string(decode(t, kv[keyValueValue][0].bytes)[anyString][0].bytes) != "edge-01" {
+		t.Fatalf("resource attribute = %v", kv)
+	}
+
+	sm := decode(t, rm[resourceMetricsScopeMetrics][0].bytes)
+	if string(decode(t, sm[scopeMetricsScope][0].bytes)[scopeName][0].bytes) != ScopeName {
+		t.Fatal("scope name not encoded")
+	}
+	metrics := sm[scopeMetricsMetrics]
+	if len(metrics) != 2 {
+		t.Fatalf("metrics = %d, want non-finite metric dropped", len(metrics))
+	}
+
+	gauge := decode(t, metrics[0].bytes)
+	if string(gauge[metricName][0].bytes) != "g" || string(gauge[metricUnit][0].bytes) != "1" {
+		t.Fatalf("gauge = %v", gauge)
+	}
+	gp := decode(t, decode(t, gauge[metricGauge][0].bytes)[gaugeDataPoints][0].bytes)
+	if math.Float64frombits(gp[pointAsDouble][0].num) != 0.5 || gp[pointTime][0].num != 2000000005 || gp[pointStartTime] != nil {
+		t.Fatalf("gauge point = %v", gp)
+	}
+	gpAttr := decode(t, gp[pointAttributes][0].bytes)
+	if decode(t, gpAttr[keyValueValue][0].bytes)[anyInt][0].num != 3 {
+		t.Fatalf("point attribute = %v", gpAttr)
+	}
+
+	sum := decode(t, decode(t, metrics[1].bytes)[metricSum][0].bytes)
+	if sum[sumAggregationTemporality][0].num != aggregationCumulative || sum[sumIsMonotonic][0].num != 1 {
+		t.Fatalf("sum = %v", sum)
+	}
+	sp := decode(t, sum[sumDataPoints][0].bytes)
+	if int64(sp[pointAsInt][0].num) != -7 || sp[pointStartTime][0].num != 1000000000 {
+		t.Fatalf("sum point = %v", sp)
+	}
+}
+
+func TestHostArch(t *testing.T) {
+	for in, want := range map[string]string{"x86_64": "amd64", "aarch64": "arm64", "armv7l": "arm32", "i686": "x86", "riscv64": "riscv64"} {
+		if got := hostArch(in); got != want {
+			t.Errorf("hostArch(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package remotewrite encodes snapshots as Prometheus remote write 1.0
+// WriteRequest messages.
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf field numbers from prometheus/prompb types.proto and remote.proto.
+const (
+	writeRequestTimeseries protowire.Number = 1
+
+	timeSeriesLabels  protowire.Number = 1
+	timeSeriesSamples protowire.Number = 2
+
+	labelName  protowire.Number = 1
+	labelValue protowire.Number = 2
+
+	sampleValue     protowire.Number = 1
+	sampleTimestamp protowire.Number = 2
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value     float64
+	Timestamp int64 // milliseconds since the epoch
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Series converts a snapshot into one series per metric and entity. Every
+// series carries the labels in base; a label in base overrides a label of the
+// same name set by the mapping.
+func Series(info utils.SystemInfo, base map[string]string) []TimeSeries {
+	ts, err := time.Parse(time.RFC3339Nano, info.Timestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+	ms := ts.UnixMilli()
+
+	var series []TimeSeries
+	add := func(name string, value float64, kv ...string) {
+		labels := make(map[string]string, len(base)+len(kv)/2+1)
+		for i := 0; i+1 < len(kv); i += 2 {
+			if kv[i+1] != "" {
+				labels[kv[i]] = kv[i+1]
+			}
+		}
+		for k, v := range base {
+			labels[k] = v
+		}
+		labels["__name__"] = name
+		series = append(series, TimeSeries{Labels: sortedLabels(labels), Samples: []Sample{{Value: value, Timestamp: ms}}})
+	}
+
+	add("edgebeat_cpu_usage_percent", info.CPU.TotalPercent, "cpu", "total")
+	for i, percent := range info.CPU.PerCPUPercent {
+		add("edgebeat_cpu_usage_percent", percent, "cpu", "cpu"+strconv.Itoa(i))
+	}
+	times := info.CPU.TotalTimes
+	for _, m := range []struct {
+		mode  string
+		value float64
+	}{
+		{"user", times.User}, {"system", times.System}, {"idle", times.Idle}, {"nice", times.Nice},
+		{"iowait", times.Iowait}, {"irq", times.Irq}, {"softirq", times.SoftIrq}, {"steal", times.Steal},
+	} {
+		add("edgebeat_cpu_seconds_total", m.value, "mode", m.mode)
+	}
+
+	add("edgebeat_load1", info.Load.Load1)
+	add("edgebeat_load5", info.Load.Load5)
+	add("edgebeat_load15", info.Load.Load15)
+
+	vm := info.Memory.Virtual
+	add("edgebeat_memory_total_bytes", float64(vm.Total))
+	add("edgebeat_memory_available_bytes", float64(vm.Available))
+	add("edgebeat_memory_used_bytes", float64(vm.Used))
+	add("edgebeat_memory_free_bytes", float64(vm.Free))
+	add("edgebeat_memory_buffers_bytes", float64(vm.Buffers))
+	add("edgebeat_memory_cached_bytes", float64(vm.Cached))
+	add("edgebeat_memory_used_percent", vm.UsedPercent)
+	add("edgebeat_swap_total_bytes", float64(info.Memory.Swap.Total))
+	add("edgebeat_swap_used_bytes", float64(info.Memory.Swap.Used))
+
+	for _, u := range info.Disk.Usage {
+		kv := []string{"device", u.Device, "mountpoint", u.Mountpoint, "fstype", u.FSType}
+		add("edgebeat_filesystem_size_bytes", float64(u.Total), kv...)
+		add("edgebeat_filesystem_used_bytes", float64(u.Used), kv...)
+		add("edgebeat_filesystem_free_bytes", float64(u.Free), kv...)
+		add("edgebeat_filesystem_used_percent", u.UsedPercent, kv...)
+	}
+	for _, io := range info.Disk.IO {
+		add("edgebeat_disk_read_bytes_total", float64(io.ReadBytes), "device", io.Device)
+		add("edgebeat_disk_written_bytes_total", float64(io.WriteBytes), "device", io.Device)
+		add("edgebeat_disk_reads_completed_total", float64(io.ReadCount), "device", io.Device)
+		add("edgebeat_disk_writes_completed_total", float64(io.WriteCount), "device", io.Device)
+	}
+
+	net := info.Network.Totals
+	add("edgebeat_network_transmit_bytes_total", float64(net.BytesSent))
+	add("edgebeat_network_receive_bytes_total", float64(net.BytesRecv))
+	add("edgebeat_network_transmit_packets_total", float64(net.PacketsSent))
+	add("edgebeat_network_receive_packets_total", float64(net.PacketsRecv))
+	add("edgebeat_network_transmit_errors_total", float64(net.Errout))
+	add("edgebeat_network_receive_errors_total", float64(net.Errin))
+	add("edgebeat_network_transmit_drop_total", float64(net.Dropout))
+	add("edgebeat_network_receive_drop_total", float64(net.Dropin))
+
+	add("edgebeat_uptime_seconds", float64(info.Host.UptimeSeconds))
+	add("edgebeat_boot_time_seconds", float64(info.Host.BootTime))
+	add("edgebeat_procs", float64(info.Host.Procs))
+	add("edgebeat_collect_errors", float64(len(info.Errors)))
+
+	for _, t := range info.Sensors.Temperatures {
+		add("edgebeat_temperature_celsius", t.Value, "sensor", t.SensorKey)
+	}
+	for _, f := range info.Sensors.Fans {
+		add("edgebeat_fan_rpm", f.Value, "sensor", f.SensorKey)
+	}
+	for _, r := range info.Sensors.Readings {
+		add("edgebeat_sensor_value", r.Value, "sensor", r.SensorKey, "type", r.Type, "unit", r.Unit)
+	}
+
+	return series
+}
+
+// sortedLabels returns the labels ordered by name, as remote write requires.
+func sortedLabels(labels map[string]string) []Label {
+	out := make([]Label, 0, len(labels))
+	for name, value := range labels {
+		out = append(out, Label{Name: name, Value: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Marshal encodes series as a WriteRequest. Concatenated WriteRequests decode
+// as a single request holding all of their series, which lets callers batch
+// encoded snapshots without re-encoding.
+func Marshal(series []TimeSeries) []byte {
+	var out []byte
+	for _, ts := range series {
+		out = protowire.AppendTag(out, writeRequestTimeseries, protowire.BytesType)
+		out = protowire.AppendBytes(out, marshalTimeSeries(ts))
+	}
+	return out
+}
+
+func marshalTimeSeries(ts TimeSeries) []byte {
+	var out []byte
+	for _, l := range ts.Labels {
+		var label []byte
+		label = protowire.AppendTag(label, labelName, protowire.BytesType)
+		label = protowire.AppendString(label, l.Name)
+		label = protowire.AppendTag(label, labelValue, protowire.BytesType)
+		label = protowire.AppendString(label, l.Value)
+
+		out = protowire.AppendTag(out, timeSeriesLabels, protowire.BytesType)
+		out = protowire.AppendBytes(out, label)
+	}
+	for _, s := range ts.Samples {
+		var sample []byte
+		sample = protowire.AppendTag(sample, sampleValue, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, sampleTimestamp, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+
+		out = protowire.AppendTag(out, timeSeriesSamples, protowire.BytesType)
+		out = protowire.AppendBytes(out, sample)
+	}
+	return out
+}
+
+// Unmarshal decodes a WriteRequest. Fields edgebeat does not write, such as
+// metadata and exemplars, are skipped.
+func Unmarshal(b []byte) ([]TimeSeries, error) {
+	var series []TimeSeries
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != writeRequestTimeseries || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := unmarshalTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func unmarshalTimeSeries(b []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch {
+		case num == timeSeriesLabels && typ == protowire.BytesType:
+			var l Label
+			err := walk(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				switch num {
+				case labelName:
+					l.Name = string(v)
+				case labelValue:
+					l.Value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case num == timeSeriesSamples && typ == protowire.BytesType:
+			var s Sample
+			err := walk(v, func(num protowire.Number, typ protowire.Type, _ []byte, n uint64) error {
+				switch num {
+				case sampleValue:
+					s.Value = math.Float64frombits(n)
+				case sampleTimestamp:
+					s.Timestamp = int64(n)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// walk calls fn for every field in b. Length delimited values are passed as
+// bytes, varint and fixed values as n.
+func walk(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var (
+			bytesVal []byte
+			numVal   uint64
+		)
+		switch typ {
+		case protowire.VarintType:
+			numVal, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			numVal, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			numVal = uint64(v)
+		case protowire.BytesType:
+			bytesVal, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, bytesVal, numVal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidLabelName reports whether name is a valid Prometheus label name that
+// is not reserved for internal use.
+func ValidLabelName(name string) bool {
+	if name == "" || (len(name) >= 2 && name[:2] == "__") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
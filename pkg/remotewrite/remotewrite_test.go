@@ -0,0 +1,97 @@
+package remotewrite
+
+import (
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func TestSeriesLabels(t *testing.T) {
+	info := utils.SystemInfo{
+		Timestamp: "2024-02-15T10:31:45Z",
+		CPU:       utils.CPUStats{TotalPercent: 12.5},
+		Disk:      utils.DiskStats{Usage: []utils.DiskUsage{{Device: "/dev/sda1", Mountpoint: "/", FSType: "ext4", Used: 10}}},
+		Sensors:   utils.SensorsStats{Readings: []utils.SensorReading{{SensorKey: "adc_voltage0", Type: "voltage", Value: 3300}}},
+	}
+
+	series := Series(info, map[string]string{"job": "edgebeat", "site": "plant-a", "device": "override"})
+	for _, ts := range series {
+		for i := 1; i < len(ts.Labels); i++ {
+			if ts.Labels[i-1].Name >= ts.Labels[i].Name {
+				t.Fatalf("labels not sorted: %+v", ts.Labels)
+			}
+		}
+		if len(ts.Samples) != 1 || ts.Samples[0].Timestamp != 1707993105000 {
+			t.Fatalf("samples = %+v", ts.Samples)
+		}
+	}
+
+	cpu := series[0]
+	want := []Label{{"__name__", "edgebeat_cpu_usage_percent"}, {"cpu", "total"}, {"device", "override"}, {"job", "edgebeat"}, {"site", "plant-a"}}
+	if len(cpu.Labels) != len(want) {
+		t.Fatalf("labels = %+v, want %+v", cpu.Labels, want)
+	}
+	for i := range want {
+		if cpu.Labels[i] != want[i] {
+			t.Fatalf("labels = %+v, want %+v", cpu.Labels, want)
+		}
+	}
+	if cpu.Samples[0].Value != 12.5 {
+		t.Fatalf("value = %v", cpu.Samples[0].Value)
+	}
+
+	var found bool
+	for _, ts := range series {
+		if ts.Labels[0].Value == "edgebeat_filesystem_used_bytes" {
+			found = true
+			if label(ts, "device") != "override" || label(ts, "mountpoint") != "/" {
+				t.Fatalf("filesystem labels = %+v", ts.Labels)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("missing edgebeat_filesystem_used_bytes")
+	}
+
+	// A reading without a unit has no unit label.
+	sensor := series[len(series)-1]
+	if sensor.Labels[0].Value != "edgebeat_sensor_value" || label(sensor, "sensor") != "adc_voltage0" ||
+		label(sensor, "type") != "voltage" || label(sensor, "unit") != "" || sensor.Samples[0].Value != 3300 {
+		t.Fatalf("sensor series = %+v", sensor)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	a := []TimeSeries{{Labels: []Label{{"__name__", "a"}}, Samples: []Sample{{Value: 1.5, Timestamp: 1000}}}}
+	b := []TimeSeries{{Labels: []Label{{"__name__", "b"}, {"x", "y"}}, Samples: []Sample{{Value: -2, Timestamp: 2000}}}}
+
+	// Concatenated requests merge into one.
+	got, err := Unmarshal(append(Marshal(a), Marshal(b)...))
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(got) != 2 || got[0].Labels[0].Value != "a" || got[1].Labels[1] != (Label{"x", "y"}) || got[1].Samples[0] != (Sample{-2, 2000}) {
+		t.Fatalf("round trip = %+v", got)
+	}
+
+	if _, err := Unmarshal([]byte{0x0a, 0x05}); err == nil {
+		t.Fatal("expected error for truncated message")
+	}
+}
+
+func TestValidLabelName(t *testing.T) {
+	for name, want := range map[string]bool{"site": true, "_x1": true, "Zone_2": true, "": false, "__name__": false, "1a": false, "a-b": false} {
+		if got := ValidLabelName(name); got != want {
+			t.Errorf("ValidLabelName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func label(ts TimeSeries, name string) string {
+	for _, l := range ts.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
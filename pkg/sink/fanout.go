@@ -0,0 +1,321 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Status reports the publish counters of one sink. Queued counts the
+// snapshots waiting for or being written; Dropped those discarded because
+// the queue was full. Batched counts the snapshots a batching sink holds
+// for its next request.
+type Status struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Published   uint64 `json:"published"`
+	Failed      uint64 `json:"failed"`
+	Retries     uint64 `json:"retries"`
+	Queued      int    `json:"queued"`
+	Dropped     uint64 `json:"dropped"`
+	Batched     int    `json:"batched"`
+	LastSuccess string `json:"last_success,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+	LastErrorAt string `json:"last_error_at,omitempty"`
+}
+
+// DefaultQueueSize is the number of snapshots a sink buffers while it is
+// busy when its policy sets none.
+const DefaultQueueSize = 16
+
+// closeTimeout bounds how long Close waits for the queued snapshots before
+// the writes in progress are cancelled.
+const closeTimeout = 5 * time.Second
+
+// Fanout implements controller.Publisher by handing every snapshot to all of
+// its sinks. Each sink has its own queue and worker that retries on its own,
+// so a slow or failing sink neither delays the collection nor keeps the
+// others from receiving the snapshot. A full queue drops its oldest
+// snapshot.
+type Fanout struct {
+	logger  *zap.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	entries []*entry
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type entry struct {
+	name  string
+	kind  string
+	sink  Sink
+	retry RetryPolicy
+	queue chan Snapshot
+	done  chan struct{}
+
+	mu          sync.Mutex
+	published   uint64
+	failed      uint64
+	retries     uint64
+	pending     int
+	dropped     uint64
+	batched     int
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func NewFanout(logger *zap.Logger) *Fanout {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Fanout{logger: logger, ctx: ctx, cancel: cancel}
+}
+
+// Add registers a sink under a unique name and starts its worker. A policy
+// with fewer than one attempt is treated as a single attempt without
+// retries.
+func (f *Fanout) Add(name, kind string, s Sink, retry RetryPolicy) {
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	if retry.QueueSize < 1 {
+		retry.QueueSize = DefaultQueueSize
+	}
+	e := &entry{
+		name:  name,
+		kind:  kind,
+		sink:  s,
+		retry: retry,
+		queue: make(chan Snapshot, retry.QueueSize),
+		done:  make(chan struct{}),
+	}
+	f.entries = append(f.entries, e)
+	go e.run(f.ctx, f.logger)
+}
+
+// Len returns the number of registered sinks.
+func (f *Fanout) Len() int {
+	return len(f.entries)
+}
+
+// Publish queues the snapshot for every sink and returns without waiting
+// for the writes; their outcome is reported by Status. Sinks only read the
+// snapshot, so they share info.
+func (f *Fanout) Publish(ctx context.Context, payload []byte, info *utils.SystemInfo) error {
+	if f == nil || len(f.entries) == 0 {
+		return fmt.Errorf("no sinks configured")
+	}
+	if info == nil {
+		return fmt.Errorf("no snapshot")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return fmt.Errorf("sinks closed")
+	}
+
+	snap := Snapshot{Payload: payload, Info: *info}
+	for _, e := range f.entries {
+		if e.enqueue(snap) {
+			f.logger.Warn("sink queue full, dropped oldest snapshot", zap.String("sink", e.name))
+		}
+	}
+	return nil
+}
+
+// enqueue adds snap to the queue, dropping the oldest snapshot when it is
+// full. It reports whether a snapshot was dropped.
+func (e *entry) enqueue(snap Snapshot) bool {
+	e.mu.Lock()
+	e.pending++
+	e.mu.Unlock()
+
+	dropped := false
+	for {
+		select {
+		case e.queue <- snap:
+			return dropped
+		default:
+		}
+		select {
+		case <-e.queue:
+			dropped = true
+			e.mu.Lock()
+			e.pending--
+			e.dropped++
+			e.mu.Unlock()
+		default:
+		}
+	}
+}
+
+// run writes the queued snapshots until the queue is closed.
+func (e *entry) run(ctx context.Context, logger *zap.Logger) {
+	defer close(e.done)
+	for snap := range e.queue {
+		if err := e.write(ctx, snap, logger); err != nil {
+			logger.Warn("sink write failed", zap.String("sink", e.name), zap.Error(err))
+		}
+		e.mu.Lock()
+		e.pending--
+		e.mu.Unlock()
+	}
+}
+
+// write sends snap with retries and records the outcome.
+func (e *entry) write(ctx context.Context, snap Snapshot, logger *zap.Logger) error {
+	backoff := e.retry.InitialBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = e.attempt(ctx, snap)
+		if err == nil || IsPermanent(err) || attempt >= e.retry.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		logger.Debug("sink write failed, retrying",
+			zap.String("sink", e.name),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+
+		e.mu.Lock()
+		e.retries++
+		e.mu.Unlock()
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+			backoff *= 2
+			if e.retry.MaxBackoff > 0 && backoff > e.retry.MaxBackoff {
+				backoff = e.retry.MaxBackoff
+			}
+		}
+	}
+
+	sent, failed := 0, 1
+	if err == nil {
+		sent, failed = 1, 0
+	}
+	batcher, batched := e.sink.(Batcher)
+	waiting := 0
+	if batched {
+		sent, failed, waiting = batcher.Settled()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.published += uint64(sent)
+	e.failed += uint64(failed)
+	e.batched = waiting
+	if sent > 0 {
+		e.lastSuccess = time.Now()
+	}
+	if err != nil {
+		e.lastError = err.Error()
+		e.lastErrorAt = time.Now()
+	}
+	return err
+}
+
+// attempt runs a single write, turning a panic into an error so that one
+// broken sink cannot take down the collection loop.
+func (e *entry) attempt(ctx context.Context, snap Snapshot) (err error) {
+	if e.retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.retry.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sink panic: %v", r)
+		}
+	}()
+
+	return e.sink.Write(ctx, snap)
+}
+
+// Status returns the counters of every sink in registration order.
+func (f *Fanout) Status() []Status {
+	statuses := make([]Status, 0, len(f.entries))
+	for _, e := range f.entries {
+		e.mu.Lock()
+		s := Status{
+			Name:      e.name,
+			Type:      e.kind,
+			Published: e.published,
+			Failed:    e.failed,
+			Retries:   e.retries,
+			Queued:    e.pending,
+			Dropped:   e.dropped,
+			Batched:   e.batched,
+			LastError: e.lastError,
+		}
+		if !e.lastSuccess.IsZero() {
+			s.LastSuccess = e.lastSuccess.UTC().Format(time.RFC3339)
+		}
+		if !e.lastErrorAt.IsZero() {
+			s.LastErrorAt = e.lastErrorAt.UTC().Format(time.RFC3339)
+		}
+		e.mu.Unlock()
+
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// Close stops accepting snapshots, waits up to closeTimeout for the queued
+// ones to be written, cancels the writes still in progress and closes every
+// sink.
+func (f *Fanout) Close() error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	for _, e := range f.entries {
+		close(e.queue)
+	}
+	f.mu.Unlock()
+
+	timer := time.NewTimer(closeTimeout)
+	defer timer.Stop()
+	for _, e := range f.entries {
+		select {
+		case <-e.done:
+		case <-timer.C:
+			f.cancel()
+			<-e.done
+		}
+	}
+	f.cancel()
+
+	var errs []error
+	for _, e := range f.entries {
+		if err := e.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", e.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,368 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/controller"
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// fakeSink fails the first failures writes and records every snapshot. A
+// write waits for block, when set, to be closed.
+type fakeSink struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	panics   bool
+	block    chan struct{}
+	writes   []Snapshot
+	attempts int
+	closed   bool
+}
+
+func (s *fakeSink) Write(ctx context.Context, snap Snapshot) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts++
+	if s.panics {
+		panic("boom")
+	}
+	if s.failures > 0 {
+		s.failures--
+		if s.err != nil {
+			return s.err
+		}
+		return errors.New("unavailable")
+	}
+	s.writes = append(s.writes, snap)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// testInfo is the snapshot testPayload encodes.
+var testInfo = utils.SystemInfo{Timestamp: "t0", Host: utils.HostStats{Hostname: "edge-01"}}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// flush waits until every sink of f has written its queued snapshots.
+func flush(t *testing.T, f *Fanout) {
+	t.Helper()
+	waitFor(t, func() bool {
+		for _, s := range f.Status() {
+			if s.Queued > 0 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func testPayload(t *testing.T) []byte {
+	t.Helper()
+	payload, err := json.Marshal(testInfo)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return payload
+}
+
+func TestFanoutDeliversToEverySink(t *testing.T) {
+	a, b := &fakeSink{}, &fakeSink{}
+	f := NewFanout(zap.NewNop())
+	f.Add("a", "fake", a, RetryPolicy{})
+	f.Add("b", "fake", b, RetryPolicy{})
+
+	payload := testPayload(t)
+	if err := f.Publish(context.Background(), payload, &testInfo); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	flush(t, f)
+
+	for name, s := range map[string]*fakeSink{"a": a, "b": b} {
+		if len(s.writes) != 1 {
+			t.Fatalf("sink %s writes = %d", name, len(s.writes))
+		}
+		if s.writes[0].Info.Host.Hostname != "edge-01" || string(s.writes[0].Payload) != string(payload) {
+			t.Fatalf("sink %s snapshot = %+v", name, s.writes[0])
+		}
+	}
+}
+
+func TestFanoutRetriesAndIsolatesFailures(t *testing.T) {
+	flaky := &fakeSink{failures: 2}
+	broken := &fakeSink{failures: 10}
+	healthy := &fakeSink{}
+
+	f := NewFanout(zap.NewNop())
+	f.Add("flaky", "fake", flaky, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	f.Add("broken", "fake", broken, RetryPolicy{MaxAttempts: 2})
+	f.Add("healthy", "fake", healthy, RetryPolicy{})
+
+	if err := f.Publish(context.Background(), testPayload(t), &testInfo); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	flush(t, f)
+	if len(flaky.writes) != 1 || flaky.attempts != 3 {
+		t.Fatalf("flaky writes = %d attempts = %d", len(flaky.writes), flaky.attempts)
+	}
+	if broken.attempts != 2 || len(healthy.writes) != 1 {
+		t.Fatalf("broken attempts = %d, healthy writes = %d", broken.attempts, len(healthy.writes))
+	}
+
+	status := f.Status()
+	if status[0].Published != 1 || status[0].Retries != 2 || status[0].Failed != 0 {
+		t.Fatalf("flaky status = %+v", status[0])
+	}
+	if status[1].Failed != 1 || status[1].LastError != "unavailable" || status[1].LastErrorAt == "" {
+		t.Fatalf("broken status = %+v", status[1])
+	}
+	if status[2].Published != 1 || status[2].LastSuccess == "" {
+		t.Fatalf("healthy status = %+v", status[2])
+	}
+}
+
+func TestFanoutPermanentErrorIsNotRetried(t *testing.T) {
+	s := &fakeSink{failures: 5, err: Permanent(errors.New("400 bad request"))}
+	f := NewFanout(zap.NewNop())
+	f.Add("s", "fake", s, RetryPolicy{MaxAttempts: 5})
+
+	if err := f.Publish(context.Background(), testPayload(t), &testInfo); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	flush(t, f)
+	if s.attempts != 1 || f.Status()[0].Failed != 1 {
+		t.Fatalf("attempts = %d, status = %+v, want one failed attempt", s.attempts, f.Status()[0])
+	}
+}
+
+func TestFanoutRecoversSinkPanic(t *testing.T) {
+	healthy := &fakeSink{}
+	f := NewFanout(zap.NewNop())
+	f.Add("panics", "fake", &fakeSink{panics: true}, RetryPolicy{})
+	f.Add("healthy", "fake", healthy, RetryPolicy{})
+
+	if err := f.Publish(context.Background(), testPayload(t), &testInfo); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	flush(t, f)
+	if status := f.Status()[0]; status.Failed != 1 || !strings.Contains(status.LastError, "sink panic") {
+		t.Fatalf("panicking sink status = %+v", status)
+	}
+	if len(healthy.writes) != 1 {
+		t.Fatal("expected healthy sink to receive the snapshot")
+	}
+}
+
+func TestFanoutRejectsMissingSnapshot(t *testing.T) {
+	f := NewFanout(zap.NewNop())
+	if err := f.Publish(context.Background(), testPayload(t), &testInfo); err == nil {
+		t.Fatal("expected error without sinks")
+	}
+
+	f.Add("s", "fake", &fakeSink{}, RetryPolicy{})
+	if err := f.Publish(context.Background(), testPayload(t), nil); err == nil {
+		t.Fatal("expected error without snapshot")
+	}
+}
+
+func TestFanoutQueuesPerSink(t *testing.T) {
+	slow := &fakeSink{block: make(chan struct{})}
+	fast := &fakeSink{}
+	f := NewFanout(zap.NewNop())
+	f.Add("slow", "fake", slow, RetryPolicy{QueueSize: 2})
+	f.Add("fast", "fake", fast, RetryPolicy{})
+
+	// Publish returns while the slow sink is stuck; its worker holds the
+	// first snapshot, and the full queue drops the oldest of the others.
+	for _, ts := range []string{"t1", "t2", "t3", "t4", "t5"} {
+		info := utils.SystemInfo{Timestamp: ts}
+		if err := f.Publish(context.Background(), nil, &info); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		if ts == "t1" {
+			waitFor(t, func() bool { return len(f.entries[0].queue) == 0 })
+		}
+	}
+	waitFor(t, func() bool {
+		fast.mu.Lock()
+		defer fast.mu.Unlock()
+		return len(fast.writes) == 5
+	})
+	if status := f.Status()[0]; status.Queued != 3 || status.Dropped != 2 {
+		t.Fatalf("slow status = %+v", status)
+	}
+
+	close(slow.block)
+	flush(t, f)
+	var got []string
+	for _, w := range slow.writes {
+		got = append(got, w.Info.Timestamp)
+	}
+	if strings.Join(got, ",") != "t1,t4,t5" {
+		t.Fatalf("slow sink wrote %v", got)
+	}
+	if status := f.Status()[0]; status.Published != 3 || status.Dropped != 2 {
+		t.Fatalf("slow status = %+v", status)
+	}
+}
+
+func TestFanoutCloseFlushesQueue(t *testing.T) {
+	s := &fakeSink{block: make(chan struct{})}
+	f := NewFanout(nil)
+	f.Add("s", "fake", s, RetryPolicy{})
+	for range 3 {
+		if err := f.Publish(context.Background(), nil, &testInfo); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	close(s.block)
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(s.writes) != 3 || !s.closed {
+		t.Fatalf("writes = %d, closed = %v", len(s.writes), s.closed)
+	}
+	if err := f.Publish(context.Background(), nil, &testInfo); err == nil {
+		t.Fatal("expected error after Close")
+	}
+}
+
+func TestFanoutClose(t *testing.T) {
+	a, b := &fakeSink{}, &fakeSink{}
+	f := NewFanout(nil)
+	f.Add("a", "fake", a, RetryPolicy{})
+	f.Add("b", "fake", b, RetryPolicy{})
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !a.closed || !b.closed {
+		t.Fatal("expected every sink to be closed")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	Register("test-registry", func(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+		return &fakeSink{}, nil
+	})
+
+	if _, err := New(context.Background(), config.SinkConfig{Name: "x", Type: "test-registry"}, nil); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := New(context.Background(), config.SinkConfig{Name: "x", Type: "missing"}, nil); err == nil {
+		t.Fatal("expected error for unknown type")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for duplicate registration")
+		}
+	}()
+	Register("test-registry", nil)
+}
+
+func TestPolicyFromConfig(t *testing.T) {
+	p := PolicyFromConfig(config.SinkConfig{
+		TimeoutSeconds: 2,
+		Retry:          config.RetryConfig{MaxAttempts: 4, InitialBackoffMS: 100, MaxBackoffMS: 1000},
+	})
+	if p.MaxAttempts != 4 || p.InitialBackoff != 100*time.Millisecond || p.MaxBackoff != time.Second || p.Timeout != 2*time.Second {
+		t.Fatalf("policy = %+v", p)
+	}
+}
+
+type recordingPublisher struct {
+	payloads [][]byte
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, payload []byte) error {
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+func TestFromPublisherEncodes(t *testing.T) {
+	payload := testPayload(t)
+	var info utils.SystemInfo
+	_ = json.Unmarshal(payload, &info)
+	snap := Snapshot{Payload: payload, Info: info}
+
+	pub := &recordingPublisher{}
+	enc, _ := encoding.Lookup(encoding.MsgPack)
+	for _, s := range []Sink{FromPublisher(pub, nil), FromPublisher(pub, enc)} {
+		if err := s.Write(context.Background(), snap); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	if string(pub.payloads[0]) != string(payload) {
+		t.Fatalf("json payload = %s", pub.payloads[0])
+	}
+	want, _ := enc.Encode(info)
+	if string(pub.payloads[1]) != string(want) {
+		t.Fatalf("msgpack payload = %x", pub.payloads[1])
+	}
+}
+
+func TestFanoutWithReportByException(t *testing.T) {
+	mqtt := &recordingPublisher{}
+	archive := &fakeSink{}
+	f := NewFanout(zap.NewNop())
+	f.Add("mqtt", "mqtt", FromPublisher(controller.NewExceptionPublisher(mqtt, controller.ExceptionConfig{AbsoluteDeadband: 5, Heartbeat: time.Hour}, nil), nil), RetryPolicy{})
+	f.Add("archive", "fake", archive, RetryPolicy{})
+
+	for _, cpu := range []float64{40, 42, 60} {
+		info := utils.SystemInfo{Timestamp: "t", CPU: utils.CPUStats{TotalPercent: cpu}, Memory: utils.MemoryStats{Virtual: utils.VirtualMemory{Total: 1024}}}
+		payload, _ := json.Marshal(info)
+		if err := f.Publish(context.Background(), payload, &info); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	flush(t, f)
+
+	// MQTT gets the first snapshot and the change beyond the deadband.
+	if len(mqtt.payloads) != 2 {
+		t.Fatalf("mqtt payloads = %d", len(mqtt.payloads))
+	}
+	var report controller.ExceptionReport
+	if err := json.Unmarshal(mqtt.payloads[1], &report); err != nil || len(report.Changes) != 1 || report.Changes["cpu.total_percent"] != 60.0 {
+		t.Fatalf("mqtt report = %s", mqtt.payloads[1])
+	}
+
+	// The other sink gets every full snapshot.
+	if len(archive.writes) != 3 {
+		t.Fatalf("archive writes = %d", len(archive.writes))
+	}
+	for i, want := range []float64{40, 42, 60} {
+		if info := archive.writes[i].Info; info.CPU.TotalPercent != want || info.Memory.Virtual.Total != 1024 {
+			t.Fatalf("archive snapshot %d = %+v", i, info)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	fileFormatJSONL = "jsonl"
+	fileFormatCSV   = "csv"
+
+	defaultFileMaxSizeMB  = 10
+	defaultFileMaxTotalMB = 1024
+
+	fileRotationLayout = "20060102T150405Z"
+)
+
+func init() {
+	Register("file", newFile)
+}
+
+// fileSink appends snapshots to a local file. The active file is rotated
+// when it would exceed its size limit, when it gets older than the rotation
+// interval and, for CSV, when the columns change. Rotated files are named
+// <name>-<UTC time><ext>[.gz] and are deleted oldest first to stay within the
+// total size cap.
+type fileSink struct {
+	path     string
+	dir      string
+	name     string // file name without extension
+	ext      string
+	format   string
+	maxSize  int64
+	maxTotal int64
+	interval time.Duration
+	compress bool
+	logger   *zap.Logger
+	now      func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	header string // CSV header of the active file
+}
+
+func newFile(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.File
+	if c.Path == "" {
+		return nil, fmt.Errorf("file.path is required")
+	}
+	ext := filepath.Ext(c.Path)
+	if c.Format == "" {
+		c.Format = fileFormatJSONL
+		if strings.EqualFold(ext, ".csv") {
+			c.Format = fileFormatCSV
+		}
+	}
+	if c.Format != fileFormatJSONL && c.Format != fileFormatCSV {
+		return nil, fmt.Errorf("file.format must be %s or %s, got %q", fileFormatJSONL, fileFormatCSV, c.Format)
+	}
+	if c.MaxSizeMB == 0 {
+		c.MaxSizeMB = defaultFileMaxSizeMB
+	}
+	if c.MaxTotalMB == 0 {
+		c.MaxTotalMB = defaultFileMaxTotalMB
+	}
+	if c.MaxSizeMB < 0 || c.MaxTotalMB < 0 || c.RotateIntervalMinutes < 0 {
+		return nil, fmt.Errorf("file size and rotation settings must not be negative")
+	}
+	if c.MaxTotalMB < c.MaxSizeMB {
+		return nil, fmt.Errorf("file.max_total_mb (%d) must be at least file.max_size_mb (%d)", c.MaxTotalMB, c.MaxSizeMB)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &fileSink{
+		path:     c.Path,
+		dir:      filepath.Dir(c.Path),
+		name:     strings.TrimSuffix(filepath.Base(c.Path), ext),
+		ext:      ext,
+		format:   c.Format,
+		maxSize:  int64(c.MaxSizeMB) << 20,
+		maxTotal: int64(c.MaxTotalMB) << 20,
+		interval: time.Duration(c.RotateIntervalMinutes) * time.Minute,
+		compress: c.Compress,
+		logger:   logger,
+		now:      time.Now,
+	}
+
+	// A file left over from an earlier run may have other CSV columns and an
+	// unknown age, so it is rotated rather than appended to.
+	if info, err := os.Stat(c.Path); err == nil && info.Size() > 0 {
+		if err := s.archive(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	s.enforceCap()
+	return s, nil
+}
+
+func (s *fileSink) Write(ctx context.Context, snap Snapshot) error {
+	record, header, err := s.encode(snap)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		// The last write failed, e.g. because the medium was removed.
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && (s.size+int64(len(record)) > s.maxSize ||
+		(s.interval > 0 && s.now().Sub(s.opened) >= s.interval) ||
+		header != s.header) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if s.size == 0 && header != "" {
+		record = append([]byte(header), record...)
+	}
+	n, err := s.file.Write(record)
+	s.size += int64(n)
+	if err != nil {
+		_ = s.file.Close()
+		s.file = nil
+		return fmt.Errorf("write %s: %w", s.path, err)
+	}
+	s.header = header
+	return nil
+}
+
+// encode returns the record for snap and, for CSV, the header line it
+// belongs to.
+func (s *fileSink) encode(snap Snapshot) ([]byte, string, error) {
+	if s.format == fileFormatJSONL {
+		var b bytes.Buffer
+		if err := json.Compact(&b, snap.Payload); err != nil {
+			return nil, "", err
+		}
+		b.WriteByte('\n')
+		return b.Bytes(), "", nil
+	}
+
+	var keys, values []string
+	flatten("", reflect.ValueOf(snap.Info), func(key, value string) {
+		keys = append(keys, key)
+		values = append(values, value)
+	})
+	header, err := csvLine(keys)
+	if err != nil {
+		return nil, "", err
+	}
+	row, err := csvLine(values)
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(row), header, nil
+}
+
+func csvLine(fields []string) (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(fields); err != nil {
+		return "", err
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
+
+// open opens the active file for appending. The caller holds s.mu or has
+// not shared s yet.
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	s.opened = s.now()
+	return nil
+}
+
+// rotate archives the active file and starts a new one. The caller holds
+// s.mu.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		s.logger.Warn("closing file before rotation failed", zap.Error(err))
+	}
+	s.file = nil
+	if err := s.archive(); err != nil {
+		return err
+	}
+	s.enforceCap()
+	s.header = ""
+	return s.open()
+}
+
+// archive moves the active file to its rotated name and compresses it.
+func (s *fileSink) archive() error {
+	stamp := s.now().UTC().Format(fileRotationLayout)
+	target := filepath.Join(s.dir, s.name+"-"+stamp+s.ext)
+	for i := 1; fileExists(target) || fileExists(target+".gz"); i++ {
+		target = filepath.Join(s.dir, fmt.Sprintf("%s-%s-%d%s", s.name, stamp, i, s.ext))
+	}
+	if err := os.Rename(s.path, target); err != nil {
+		return fmt.Errorf("rotate %s: %w", s.path, err)
+	}
+
+	if s.compress {
+		if err := gzipFile(target); err != nil {
+			// The uncompressed file is still a valid archive.
+			s.logger.Warn("compressing rotated file failed", zap.String("file", target), zap.Error(err))
+		}
+	}
+	s.logger.Debug("file rotated", zap.String("file", target))
+	return nil
+}
+
+// enforceCap deletes the oldest rotated files until they fit into maxTotal
+// next to a full active file.
+func (s *fileSink) enforceCap() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		s.logger.Warn("listing rotated files failed", zap.Error(err))
+		return
+	}
+
+	type rotated struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []rotated
+	total := s.maxSize
+	for _, e := range entries {
+		if e.IsDir() || !s.isRotated(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, rotated{path: filepath.Join(s.dir, e.Name()), size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.Before(files[j].modTime)
+		}
+		return files[i].path < files[j].path
+	})
+	for _, f := range files {
+		if total <= s.maxTotal {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			s.logger.Warn("deleting rotated file failed", zap.String("file", f.path), zap.Error(err))
+			continue
+		}
+		total -= f.size
+		s.logger.Info("deleted rotated file to stay within max_total_mb", zap.String("file", f.path))
+	}
+}
+
+// isRotated reports whether name is a file rotated by this sink.
+func (s *fileSink) isRotated(name string) bool {
+	rest, ok := strings.CutPrefix(name, s.name+"-")
+	if !ok || len(rest) < len(fileRotationLayout) {
+		return false
+	}
+	if _, err := time.Parse(fileRotationLayout, rest[:len(fileRotationLayout)]); err != nil {
+		return false
+	}
+	rest = strings.TrimSuffix(rest, ".gz")
+	return strings.HasSuffix(rest, s.ext)
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// gzipFile replaces path with path.gz.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// structField returns the string field of v tagged with the JSON name, or
+// "" when v is no struct or has no such field.
+func structField(v reflect.Value, name string) string {
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < v.NumField(); i++ {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if f := v.Field(i); tag == name && f.Kind() == reflect.String {
+			return f.String()
+		}
+	}
+	return ""
+}
+
+// flatten calls emit for every scalar in v with its dotted JSON path, in
+// struct field order. Elements of lists are keyed by their identity and
+// sorted by it, e.g. disk.usage./.used, so a column always holds the same
+// disk; lists without one, such as per-CPU values, are indexed. Slices of
+// strings are joined with ";" and nil pointers have no columns.
+func flatten(prefix string, v reflect.Value, emit func(key, value string)) {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			flatten(join(name), v.Field(i), emit)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			parts := make([]string, v.Len())
+			for i := range parts {
+				parts[i] = v.Index(i).String()
+			}
+			emit(prefix, strings.Join(parts, ";"))
+			return
+		}
+		keys := utils.ElementKeys(v.Len(), func(i int, name string) string { return structField(v.Index(i), name) })
+		if keys == nil {
+			for i := 0; i < v.Len(); i++ {
+				flatten(join(strconv.Itoa(i)), v.Index(i), emit)
+			}
+			return
+		}
+		order := make([]int, len(keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return keys[order[a]] < keys[order[b]] })
+		for _, i := range order {
+			flatten(join(keys[i]), v.Index(i), emit)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			flatten(prefix, v.Elem(), emit)
+		}
+	case reflect.String:
+		emit(prefix, v.String())
+	case reflect.Bool:
+		emit(prefix, strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		emit(prefix, strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		emit(prefix, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		emit(prefix, strconv.FormatFloat(v.Float(), 'f', -1, 64))
+	}
+}
@@ -0,0 +1,274 @@
+package sink
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// newTestFileSink creates a file sink in a temporary directory whose clock
+// advances by a minute on every call.
+func newTestFileSink(t *testing.T, c config.FileConfig) (*fileSink, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if c.Path == "" {
+		c.Path = filepath.Join(dir, "metrics.jsonl")
+	} else {
+		c.Path = filepath.Join(dir, c.Path)
+	}
+
+	s, err := newFile(context.Background(), config.SinkConfig{File: c}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newFile: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	fs := s.(*fileSink)
+	clock := time.Date(2024, 2, 15, 10, 0, 0, 0, time.UTC)
+	fs.now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	fs.opened = fs.now()
+	return fs, dir
+}
+
+func fileSnapshot(t *testing.T, info utils.SystemInfo) Snapshot {
+	t.Helper()
+	payload, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return Snapshot{Payload: payload, Info: info}
+}
+
+func dirFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFileJSONLines(t *testing.T) {
+	s, dir := newTestFileSink(t, config.FileConfig{})
+
+	for _, ts := range []string{"2024-02-15T10:31:45Z", "2024-02-15T10:31:50Z"} {
+		if err := s.Write(context.Background(), fileSnapshot(t, utils.SystemInfo{Timestamp: ts})); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "metrics.jsonl"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	var info utils.SystemInfo
+	if err := json.Unmarshal([]byte(lines[1]), &info); err != nil || info.Timestamp != "2024-02-15T10:31:50Z" {
+		t.Fatalf("line = %s, err = %v", lines[1], err)
+	}
+}
+
+func TestFileSizeRotationCompressionAndCap(t *testing.T) {
+	s, dir := newTestFileSink(t, config.FileConfig{Compress: true})
+	snap := fileSnapshot(t, utils.SystemInfo{Timestamp: "2024-02-15T10:31:45Z"})
+	record, _, _ := s.encode(snap)
+	compressed, err := gzipBody(append(record, record...))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	// Room for a full active file and two and a half rotated ones.
+	s.maxSize = int64(len(record)) * 2
+	s.maxTotal = s.maxSize + int64(len(compressed))*5/2
+
+	for i := 0; i < 9; i++ {
+		if err := s.Write(context.Background(), snap); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	files := dirFiles(t, dir)
+	var rotated []string
+	for _, name := range files {
+		if name != "metrics.jsonl" {
+			rotated = append(rotated, name)
+		}
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("files = %v, want the two newest of four rotated files", files)
+	}
+	for _, name := range rotated {
+		if !strings.HasPrefix(name, "metrics-20240215T") || !strings.HasSuffix(name, ".jsonl.gz") {
+			t.Fatalf("rotated file %s not named and compressed as expected", name)
+		}
+	}
+
+	// The newest rotated file is kept and holds two records.
+	f, err := os.Open(filepath.Join(dir, rotated[len(rotated)-1]))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	data, _ := io.ReadAll(zr)
+	if strings.Count(string(data), "\n") != 2 {
+		t.Fatalf("rotated file = %q", data)
+	}
+
+	var total int64
+	for _, name := range files {
+		info, _ := os.Stat(filepath.Join(dir, name))
+		total += info.Size()
+	}
+	if total > s.maxTotal {
+		t.Fatalf("total size %d exceeds cap %d", total, s.maxTotal)
+	}
+}
+
+func TestFileTimeRotation(t *testing.T) {
+	s, dir := newTestFileSink(t, config.FileConfig{RotateIntervalMinutes: 1})
+	snap := fileSnapshot(t, utils.SystemInfo{Timestamp: "2024-02-15T10:31:45Z"})
+
+	// The test clock advances a minute on every call, so the second write
+	// finds the file a minute old.
+	for i := 0; i < 2; i++ {
+		if err := s.Write(context.Background(), snap); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if files := dirFiles(t, dir); len(files) != 2 {
+		t.Fatalf("files = %v, want one rotated file", files)
+	}
+}
+
+func TestFileCSV(t *testing.T) {
+	s, dir := newTestFileSink(t, config.FileConfig{Path: "metrics.csv"})
+	if s.format != fileFormatCSV {
+		t.Fatalf("format = %s, want csv from extension", s.format)
+	}
+
+	info := utils.SystemInfo{
+		Timestamp: "2024-02-15T10:31:45Z",
+		CPU:       utils.CPUStats{TotalPercent: 12.5, PerCPUPercent: []float64{10, 15}},
+		Network:   utils.NetworkStats{Interfaces: []utils.NetInterface{{Name: "eth0", Flags: []string{"up", "broadcast"}}}},
+		Disk: utils.DiskStats{IO: []utils.DiskIO{
+			{Device: "sda", ReadBytes: 100},
+			{Device: "mmcblk0", ReadBytes: 200},
+		}},
+		Modbus: &utils.ModbusStats{Values: []utils.ModbusValue{{Name: "tank_level", Value: 42.5, Unit: "%"}}},
+		Errors: []string{"sensors: unsupported, retrying"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Write(context.Background(), fileSnapshot(t, info)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		// Disks come in random order; their columns stay the same.
+		info.Disk.IO[0], info.Disk.IO[1] = info.Disk.IO[1], info.Disk.IO[0]
+	}
+
+	readCSV := func(name string) [][]string {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatalf("csv: %v", err)
+		}
+		return records
+	}
+
+	records := readCSV("metrics.csv")
+	if len(records) != 3 {
+		t.Fatalf("records = %d, want header and two rows", len(records))
+	}
+	row := map[string]string{}
+	for i, key := range records[0] {
+		row[key] = records[1][i]
+	}
+	if records[0][0] != "timestamp" || row["cpu.total_percent"] != "12.5" || row["cpu.per_cpu_percent.1"] != "15" ||
+		row["network.interfaces.eth0.name"] != "eth0" || row["network.interfaces.eth0.flags"] != "up;broadcast" ||
+		row["disk.io.sda.read_bytes"] != "100" || row["disk.io.mmcblk0.read_bytes"] != "200" ||
+		row["modbus.values.tank_level.value"] != "42.5" || row["errors"] != "sensors: unsupported, retrying" {
+		t.Fatalf("row = %v", row)
+	}
+	for i, key := range records[0] {
+		if key == "disk.io.sda.read_bytes" && records[2][i] != "100" {
+			t.Fatalf("second row = %v", records[2])
+		}
+	}
+	if strings.Contains(strings.Join(records[0], ","), "opcua") {
+		t.Fatalf("header = %v, want no columns for absent sections", records[0])
+	}
+
+	// A new interface changes the columns and starts a new file.
+	info.Network.Interfaces = append(info.Network.Interfaces, utils.NetInterface{Name: "wlan0"})
+	if err := s.Write(context.Background(), fileSnapshot(t, info)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if files := dirFiles(t, dir); len(files) != 2 {
+		t.Fatalf("files = %v, want rotation on column change", files)
+	}
+	if records := readCSV("metrics.csv"); len(records) != 2 || len(records[0]) <= len(row) {
+		t.Fatalf("records = %v", records)
+	}
+}
+
+func TestFileRotatesLeftoverFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s, err := newFile(context.Background(), config.SinkConfig{File: config.FileConfig{Path: path}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newFile: %v", err)
+	}
+	defer s.Close()
+
+	if files := dirFiles(t, dir); len(files) != 2 {
+		t.Fatalf("files = %v, want leftover file rotated", files)
+	}
+}
+
+func TestFileConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	invalid := []config.FileConfig{
+		{},
+		{Path: filepath.Join(dir, "m.jsonl"), Format: "xml"},
+		{Path: filepath.Join(dir, "m.jsonl"), MaxSizeMB: -1},
+		{Path: filepath.Join(dir, "m.jsonl"), MaxSizeMB: 20, MaxTotalMB: 10},
+	}
+	for _, c := range invalid {
+		if _, err := newFile(context.Background(), config.SinkConfig{File: c}, zap.NewNop()); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+}
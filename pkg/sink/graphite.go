@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/graphite"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register("graphite", newGraphite)
+}
+
+// graphiteSink writes the plaintext protocol to a Carbon receiver over a
+// long lived TCP connection, which is re-established after a failed write.
+type graphiteSink struct {
+	address string
+	prefix  string
+	logger  *zap.Logger
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newGraphite(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.Graphite
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, fmt.Errorf("graphite.address must be host:port: %w", err)
+	}
+	if c.Prefix == "" {
+		c.Prefix = graphite.DefaultPrefix
+	}
+	return &graphiteSink{address: c.Address, prefix: c.Prefix, logger: logger}, nil
+}
+
+func (s *graphiteSink) Write(ctx context.Context, snap Snapshot) error {
+	ts, err := time.Parse(time.RFC3339Nano, snap.Info.Timestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+	body := graphite.Encode(graphite.Flatten(snap.Info), metricPrefix(s.prefix, snap.Info), ts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", s.address)
+		if err != nil {
+			return fmt.Errorf("graphite: %w", err)
+		}
+		s.conn = conn
+		s.logger.Debug("graphite connected", zap.String("address", s.address))
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = s.conn.SetWriteDeadline(deadline)
+	if _, err := s.conn.Write(body); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("graphite: %w", err)
+	}
+	return nil
+}
+
+func (s *graphiteSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// metricPrefix expands the configured prefix with the snapshot's host name,
+// falling back to the local one.
+func metricPrefix(template string, info utils.SystemInfo) string {
+	hostname := info.Host.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	return graphite.Prefix(template, hostname)
+}
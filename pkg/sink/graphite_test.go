@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+func TestGraphiteWriteAndReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 1000)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	s, err := newGraphite(context.Background(), config.SinkConfig{Graphite: config.GraphiteConfig{Address: ln.Addr().String(), Prefix: "plant.{hostname}"}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newGraphite: %v", err)
+	}
+	defer s.Close()
+
+	expect := func(want string) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case line := <-lines:
+				if line == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("did not receive %q", want)
+			}
+		}
+	}
+
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 12.5)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	expect("plant.edge-01.cpu.total.percent 12.5 1707993105")
+
+	// A dropped connection is replaced on the next write.
+	gs := s.(*graphiteSink)
+	gs.conn.Close()
+	_ = s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:50Z", 1))
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:55Z", 2)); err != nil {
+		t.Fatalf("Write after reconnect: %v", err)
+	}
+	expect("plant.edge-01.cpu.total.percent 2 1707993115")
+}
+
+func TestStatsDPackets(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer pc.Close()
+
+	s, err := newStatsD(context.Background(), config.SinkConfig{StatsD: config.StatsDConfig{Address: pc.LocalAddr().String(), MaxPacketSize: 200}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newStatsD: %v", err)
+	}
+	defer s.Close()
+
+	snap := influxSnapshot("2024-02-15T10:31:45Z", 12.5)
+	snap.Info.Sensors.Temperatures = []utils.Temperature{{SensorKey: "outdoor", Value: -4.5}}
+	if err := s.Write(context.Background(), snap); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var all []string
+	buf := make([]byte, 2048)
+	for !strings.Contains(strings.Join(all, "\n"), "outdoor:-4.5|g") {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom: %v, got %v", err, all)
+		}
+		if n > 200 {
+			t.Fatalf("packet of %d bytes exceeds max_packet_size", n)
+		}
+		all = append(all, strings.Split(string(buf[:n]), "\n")...)
+	}
+
+	joined := strings.Join(all, "\n")
+	if !strings.Contains(joined, "edgebeat.edge-01.cpu.total.percent:12.5|g") {
+		t.Fatalf("metrics = %v", all)
+	}
+	if !strings.Contains(joined, "edgebeat.edge-01.sensors.temperature.outdoor:0|g\nedgebeat.edge-01.sensors.temperature.outdoor:-4.5|g") {
+		t.Fatalf("negative gauge not reset first: %v", all)
+	}
+}
+
+func TestGraphiteStatsDConfigValidation(t *testing.T) {
+	if _, err := newGraphite(context.Background(), config.SinkConfig{Graphite: config.GraphiteConfig{Address: "carbon"}}, zap.NewNop()); err == nil {
+		t.Fatal("expected error for graphite address without port")
+	}
+	if _, err := newStatsD(context.Background(), config.SinkConfig{}, zap.NewNop()); err == nil {
+		t.Fatal("expected error for missing statsd address")
+	}
+}
@@ -0,0 +1,165 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/influx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInfluxPrecision = influx.PrecisionMilliseconds
+	defaultInfluxMaxLines  = 100000
+)
+
+func init() {
+	Register("influxdb", newInfluxDB)
+}
+
+// influxDBSink writes line protocol to an InfluxDB v2 compatible write
+// endpoint. Snapshots are queued until batch_size of them are pending; a failed
+// request keeps the queue so the data is sent with the next attempt. As a
+// Batcher it reports queued snapshots once they are sent or dropped.
+type influxDBSink struct {
+	client    *http.Client
+	writeURL  string
+	token     string
+	precision string
+	gzip      bool
+	logger    *zap.Logger
+
+	mu    sync.Mutex
+	queue snapshotQueue
+}
+
+func newInfluxDB(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.InfluxDB
+	if c.URL == "" || c.Bucket == "" {
+		return nil, fmt.Errorf("influxdb.url and influxdb.bucket are required")
+	}
+	if c.Precision == "" {
+		c.Precision = defaultInfluxPrecision
+	}
+	if err := influx.CheckPrecision(c.Precision); err != nil {
+		return nil, fmt.Errorf("influxdb.precision: %w", err)
+	}
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	if c.MaxLines < 1 {
+		c.MaxLines = defaultInfluxMaxLines
+	}
+
+	base, err := url.Parse(strings.TrimRight(c.URL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("influxdb.url must be an absolute http(s) url: %q", c.URL)
+	}
+	query := url.Values{}
+	query.Set("bucket", c.Bucket)
+	query.Set("precision", c.Precision)
+	if c.Org != "" {
+		query.Set("org", c.Org)
+	}
+	base.Path += "/api/v2/write"
+	base.RawQuery = query.Encode()
+
+	return &influxDBSink{
+		client:    &http.Client{},
+		writeURL:  base.String(),
+		token:     c.Token,
+		precision: c.Precision,
+		gzip:      c.Gzip,
+		logger:    logger,
+		queue:     snapshotQueue{batchSize: c.BatchSize, maxWeight: c.MaxLines},
+	}, nil
+}
+
+func (s *influxDBSink) Write(ctx context.Context, snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped, err := s.queue.add(snap.Info.Timestamp, func() ([]byte, int, error) {
+		lines, err := influx.Encode(influx.Points(snap.Info), s.precision)
+		return lines, bytes.Count(lines, []byte("\n")), err
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	if dropped > 0 {
+		s.logger.Warn("influxdb buffer full, dropped oldest snapshots", zap.Int("snapshots", dropped))
+	}
+
+	if !s.queue.ready() {
+		return nil
+	}
+	return s.flush(ctx)
+}
+
+// flush sends every queued snapshot in one request. The caller holds s.mu.
+func (s *influxDBSink) flush(ctx context.Context) error {
+	if s.queue.len() == 0 {
+		return nil
+	}
+
+	body := s.queue.body()
+	if s.gzip {
+		var err error
+		if body, err = gzipBody(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("influxdb write: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		if IsPermanent(err) {
+			// The server will never accept these lines; keep them from
+			// blocking newer data.
+			s.queue.settle(false)
+		}
+		return fmt.Errorf("influxdb write: %w", err)
+	}
+
+	s.logger.Debug("influxdb written", zap.Int("snapshots", s.queue.len()))
+	s.queue.settle(true)
+	return nil
+}
+
+func (s *influxDBSink) Settled() (sent, failed, waiting int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue.settled()
+}
+
+func (s *influxDBSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.flush(ctx)
+}
@@ -0,0 +1,230 @@
+package sink
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// influxStandIn records write requests and answers with the queued statuses.
+type influxStandIn struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (s *influxStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reader = zr
+	}
+	body, _ := io.ReadAll(reader)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, string(body))
+
+	status := http.StatusNoContent
+	if len(s.statuses) > 0 {
+		status = s.statuses[0]
+		s.statuses = s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestInfluxSink(t *testing.T, c config.InfluxDBConfig) (Sink, *influxStandIn) {
+	t.Helper()
+	standIn := &influxStandIn{}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	c.URL = server.URL
+	if c.Bucket == "" {
+		c.Bucket = "edge"
+	}
+	s, err := newInfluxDB(context.Background(), config.SinkConfig{Name: "historian", InfluxDB: c}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newInfluxDB: %v", err)
+	}
+	return s, standIn
+}
+
+func influxSnapshot(ts string, cpu float64) Snapshot {
+	return Snapshot{Info: utils.SystemInfo{Timestamp: ts, CPU: utils.CPUStats{TotalPercent: cpu}, Host: utils.HostStats{Hostname: "edge-01"}}}
+}
+
+func TestInfluxDBWrite(t *testing.T) {
+	s, standIn := newTestInfluxSink(t, config.InfluxDBConfig{Org: "plant", Token: "secret", Gzip: true})
+
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 12.5)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(standIn.requests) != 1 {
+		t.Fatalf("requests = %d", len(standIn.requests))
+	}
+
+	req := standIn.requests[0]
+	if req.URL.Path != "/api/v2/write" || req.URL.Query().Get("bucket") != "edge" || req.URL.Query().Get("org") != "plant" || req.URL.Query().Get("precision") != "ms" {
+		t.Fatalf("url = %s", req.URL)
+	}
+	if req.Header.Get("Authorization") != "Token secret" || req.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("headers = %v", req.Header)
+	}
+	if !strings.Contains(standIn.bodies[0], "cpu,cpu=cpu-total,host=edge-01 ") || !strings.Contains(standIn.bodies[0], "usage_percent=12.5") {
+		t.Fatalf("body = %s", standIn.bodies[0])
+	}
+}
+
+func TestInfluxDBBatching(t *testing.T) {
+	s, standIn := newTestInfluxSink(t, config.InfluxDBConfig{BatchSize: 2})
+	ctx := context.Background()
+
+	if err := s.Write(ctx, influxSnapshot("2024-02-15T10:31:45Z", 1)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(standIn.requests) != 0 {
+		t.Fatal("expected first snapshot to be queued")
+	}
+	if err := s.Write(ctx, influxSnapshot("2024-02-15T10:31:50Z", 2)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(standIn.requests) != 1 || strings.Count(standIn.bodies[0], "cpu,cpu=cpu-total") != 2 {
+		t.Fatalf("requests = %d, body = %s", len(standIn.requests), standIn.bodies)
+	}
+
+	// Close flushes whatever is still queued.
+	if err := s.Write(ctx, influxSnapshot("2024-02-15T10:31:55Z", 3)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(standIn.requests) != 2 {
+		t.Fatalf("requests = %d, want flush on close", len(standIn.requests))
+	}
+}
+
+func TestInfluxDBRetryKeepsQueue(t *testing.T) {
+	s, standIn := newTestInfluxSink(t, config.InfluxDBConfig{})
+	standIn.statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+
+	f := NewFanout(zap.NewNop())
+	f.Add("historian", "influxdb", s, RetryPolicy{MaxAttempts: 2})
+
+	payload := testPayload(t)
+	if err := f.Publish(context.Background(), payload, &testInfo); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	flush(t, f)
+	// The snapshot stays in the batch, so it has not failed yet.
+	if status := f.Status()[0]; status.Retries != 1 || status.Failed != 0 || status.Batched != 1 || len(standIn.requests) != 2 {
+		t.Fatalf("status = %+v, requests = %d, want 5xx retried", status, len(standIn.requests))
+	}
+
+	// The next snapshot carries the queued one along.
+	next := influxSnapshot("2024-02-15T10:32:00Z", 5)
+	if err := s.Write(context.Background(), next); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	last := standIn.bodies[len(standIn.bodies)-1]
+	if strings.Count(last, "cpu,cpu=cpu-total") != 2 {
+		t.Fatalf("body = %s, want queued snapshot re-sent once", last)
+	}
+}
+
+func TestInfluxDBClientErrorDropsQueue(t *testing.T) {
+	s, standIn := newTestInfluxSink(t, config.InfluxDBConfig{})
+	standIn.statuses = []int{http.StatusBadRequest}
+
+	err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 1))
+	if err == nil || !IsPermanent(err) {
+		t.Fatalf("err = %v, want permanent error", err)
+	}
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:50Z", 2)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if last := standIn.bodies[len(standIn.bodies)-1]; strings.Count(last, "cpu,cpu=cpu-total") != 1 {
+		t.Fatalf("body = %s, want rejected snapshot dropped", last)
+	}
+}
+
+func TestInfluxDBStatusCountsBatches(t *testing.T) {
+	s, standIn := newTestInfluxSink(t, config.InfluxDBConfig{BatchSize: 2})
+	f := NewFanout(zap.NewNop())
+	f.Add("historian", "influxdb", s, RetryPolicy{MaxAttempts: 1})
+	publish := func(ts string) {
+		t.Helper()
+		info := influxSnapshot(ts, 1).Info
+		if err := f.Publish(context.Background(), testPayload(t), &info); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		flush(t, f)
+	}
+
+	// A queued snapshot is neither published nor failed.
+	publish("2024-02-15T10:31:45Z")
+	if status := f.Status()[0]; status.Published != 0 || status.Failed != 0 || status.Batched != 1 || status.LastSuccess != "" {
+		t.Fatalf("status = %+v, want snapshot batched", status)
+	}
+	publish("2024-02-15T10:31:50Z")
+	if status := f.Status()[0]; status.Published != 2 || status.Batched != 0 {
+		t.Fatalf("status = %+v, want batch published", status)
+	}
+
+	// A rejected batch fails every snapshot in it.
+	standIn.statuses = []int{http.StatusBadRequest}
+	publish("2024-02-15T10:31:55Z")
+	publish("2024-02-15T10:32:00Z")
+	if status := f.Status()[0]; status.Published != 2 || status.Failed != 2 || status.Batched != 0 {
+		t.Fatalf("status = %+v, want batch failed", status)
+	}
+}
+
+func TestInfluxDBBufferLimit(t *testing.T) {
+	s, standIn := newTestInfluxSink(t, config.InfluxDBConfig{BatchSize: 100, MaxLines: 12})
+
+	for i, ts := range []string{"2024-02-15T10:31:45Z", "2024-02-15T10:31:50Z", "2024-02-15T10:31:55Z"} {
+		if err := s.Write(context.Background(), influxSnapshot(ts, float64(i))); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := strings.Count(standIn.bodies[0], "cpu,cpu=cpu-total"); got != 2 {
+		t.Fatalf("flushed %d snapshots, want oldest dropped", got)
+	}
+	if !strings.Contains(standIn.bodies[0], "usage_percent=2 ") {
+		t.Fatal("expected newest snapshot to be kept")
+	}
+}
+
+func TestInfluxDBConfigValidation(t *testing.T) {
+	invalid := []config.InfluxDBConfig{
+		{Bucket: "edge"},
+		{URL: "http://localhost:8086"},
+		{URL: "localhost:8086", Bucket: "edge"},
+		{URL: "http://localhost:8086", Bucket: "edge", Precision: "h"},
+	}
+	for _, c := range invalid {
+		if _, err := newInfluxDB(context.Background(), config.SinkConfig{InfluxDB: c}, zap.NewNop()); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
+	"github.com/jilanisayyad/edgebeat/pkg/nats"
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register("nats", newNATS)
+}
+
+func newNATS(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.NATS
+	enc, err := encoding.Lookup(cfg.Encoder)
+	if err != nil {
+		return nil, err
+	}
+	p, err := nats.NewPublisher(ctx, nats.Config{
+		URL:             c.URL,
+		Subject:         c.Subject,
+		Name:            "edgebeat-" + cfg.Name,
+		Username:        c.Username,
+		Password:        c.Password,
+		Token:           c.Token,
+		CredentialsFile: c.CredentialsFile,
+		JetStream:       c.JetStream,
+		Stream:          c.Stream,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	return FromPublisher(p, enc), nil
+}
@@ -0,0 +1,19 @@
+package sink
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"go.uber.org/zap"
+)
+
+func TestNATSConfigValidation(t *testing.T) {
+	if _, err := newNATS(context.Background(), config.SinkConfig{}, zap.NewNop()); err == nil {
+		t.Fatal("expected error for missing nats url")
+	}
+	cfg := config.SinkConfig{NATS: config.NATSConfig{URL: "nats://127.0.0.1:4222", Subject: "edge.>"}}
+	if _, err := newNATS(context.Background(), cfg, zap.NewNop()); err == nil {
+		t.Fatal("expected error for wildcard subject")
+	}
+}
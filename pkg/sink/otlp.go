@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/otlp"
+	"go.uber.org/zap"
+)
+
+const (
+	otlpProtobuf = "http/protobuf"
+	otlpJSON     = "http/json"
+)
+
+func init() {
+	Register("otlp", newOTLP)
+}
+
+// otlpSink exports every snapshot as one OTLP/HTTP metrics request. The OTLP
+// exporters in the collector queue and retry on their own, so the sink does
+// not batch.
+type otlpSink struct {
+	client   *http.Client
+	url      string
+	protocol string
+	headers  map[string]string
+	resource map[string]string
+	gzip     bool
+	logger   *zap.Logger
+}
+
+func newOTLP(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.OTLP
+	u, err := url.Parse(c.URL)
+	if c.URL == "" || err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("otlp.url must be an absolute http(s) url: %q", c.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	switch c.Protocol {
+	case "":
+		c.Protocol = otlpProtobuf
+	case otlpProtobuf, otlpJSON:
+	default:
+		return nil, fmt.Errorf("otlp.protocol must be %s or %s, got %q", otlpProtobuf, otlpJSON, c.Protocol)
+	}
+
+	return &otlpSink{
+		client:   &http.Client{},
+		url:      u.String(),
+		protocol: c.Protocol,
+		headers:  c.Headers,
+		resource: c.ResourceAttributes,
+		gzip:     c.Gzip,
+		logger:   logger,
+	}, nil
+}
+
+func (s *otlpSink) Write(ctx context.Context, snap Snapshot) error {
+	req := otlp.FromSnapshot(snap.Info, s.resource)
+
+	var (
+		body        []byte
+		err         error
+		contentType string
+	)
+	if s.protocol == otlpJSON {
+		body, err = req.MarshalJSON()
+		contentType = otlp.ContentTypeJSON
+	} else {
+		body, err = req.MarshalProto()
+		contentType = otlp.ContentTypeProtobuf
+	}
+	if err != nil {
+		return Permanent(err)
+	}
+
+	if s.gzip {
+		if body, err = gzipBody(body); err != nil {
+			return err
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	for k, v := range s.headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	if s.gzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("otlp export: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return fmt.Errorf("otlp export: %w", err)
+	}
+	s.logger.Debug("otlp exported", zap.String("url", s.url), zap.Int("metrics", len(req.Metrics)))
+	return nil
+}
+
+func (s *otlpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,128 @@
+package sink
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"go.uber.org/zap"
+)
+
+func TestOTLPExport(t *testing.T) {
+	var (
+		got    *http.Request
+		body   []byte
+		status = http.StatusOK
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			reader = zr
+		}
+		body, _ = io.ReadAll(reader)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	s, err := newOTLP(context.Background(), config.SinkConfig{OTLP: config.OTLPConfig{
+		URL:                server.URL,
+		Protocol:           "http/json",
+		Headers:            map[string]string{"X-Scope-OrgID": "plant", "Content-Type": "text/plain"},
+		ResourceAttributes: map[string]string{"deployment.environment": "prod"},
+		Gzip:               true,
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newOTLP: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 12.5)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got.URL.Path != "/v1/metrics" || got.Header.Get("Content-Type") != "application/json" || got.Header.Get("X-Scope-OrgID") != "plant" {
+		t.Fatalf("request = %s %v", got.URL, got.Header)
+	}
+
+	var req struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string `json:"key"`
+					Value struct {
+						StringValue string `json:"stringValue"`
+					} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string `json:"name"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("Unmarshal: %v\n%s", err, body)
+	}
+	resource := map[string]string{}
+	for _, a := range req.ResourceMetrics[0].Resource.Attributes {
+		resource[a.Key] = a.Value.StringValue
+	}
+	if resource["host.name"] != "edge-01" || resource["deployment.environment"] != "prod" || resource["service.name"] != "edgebeat" {
+		t.Fatalf("resource = %v", resource)
+	}
+	if name := req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name; name != "system.cpu.utilization" {
+		t.Fatalf("first metric = %s", name)
+	}
+
+	status = http.StatusBadRequest
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:50Z", 1)); err == nil || !IsPermanent(err) {
+		t.Fatalf("err = %v, want permanent error", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:55Z", 1)); err == nil || IsPermanent(err) {
+		t.Fatalf("err = %v, want retryable error", err)
+	}
+}
+
+func TestOTLPProtobufDefaults(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer server.Close()
+
+	s, err := newOTLP(context.Background(), config.SinkConfig{OTLP: config.OTLPConfig{URL: server.URL + "/otlp/v1/metrics"}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newOTLP: %v", err)
+	}
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 1)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got.URL.Path != "/otlp/v1/metrics" || got.Header.Get("Content-Type") != "application/x-protobuf" {
+		t.Fatalf("request = %s %v", got.URL, got.Header)
+	}
+}
+
+func TestOTLPConfigValidation(t *testing.T) {
+	invalid := []config.OTLPConfig{
+		{},
+		{URL: "collector:4318"},
+		{URL: "http://collector:4318", Protocol: "grpc"},
+	}
+	for _, c := range invalid {
+		if _, err := newOTLP(context.Background(), config.SinkConfig{OTLP: c}, zap.NewNop()); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+}
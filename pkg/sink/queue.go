@@ -0,0 +1,121 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// snapshotQueue buffers encoded snapshots for sinks that send batches. A
+// snapshot is only queued once even when a retry hands it in again, and the
+// oldest snapshots are dropped once the queued weight exceeds maxWeight.
+// sent and failed count the snapshots settled since settled was last called.
+type snapshotQueue struct {
+	batchSize int
+	maxWeight int
+
+	items      []queuedSnapshot
+	weight     int
+	lastQueued string
+	sent       int
+	failed     int
+}
+
+type queuedSnapshot struct {
+	data   []byte
+	weight int
+}
+
+// add queues the snapshot taken at timestamp unless it is already queued.
+// encode is only called for new snapshots and returns the encoded data and
+// its weight, e.g. the number of lines or samples. add returns how many old
+// snapshots were dropped to make room.
+func (q *snapshotQueue) add(timestamp string, encode func() ([]byte, int, error)) (int, error) {
+	if timestamp != "" && timestamp == q.lastQueued {
+		return 0, nil
+	}
+
+	data, weight, err := encode()
+	if err != nil {
+		q.failed++
+		return 0, err
+	}
+	q.items = append(q.items, queuedSnapshot{data: data, weight: weight})
+	q.weight += weight
+	q.lastQueued = timestamp
+
+	dropped := 0
+	for q.weight > q.maxWeight && len(q.items) > 1 {
+		q.weight -= q.items[0].weight
+		q.items = q.items[1:]
+		dropped++
+	}
+	q.failed += dropped
+	return dropped, nil
+}
+
+// ready reports whether a full batch is queued.
+func (q *snapshotQueue) ready() bool {
+	return len(q.items) >= q.batchSize
+}
+
+func (q *snapshotQueue) len() int {
+	return len(q.items)
+}
+
+// body concatenates all queued snapshots.
+func (q *snapshotQueue) body() []byte {
+	var b bytes.Buffer
+	for _, item := range q.items {
+		b.Write(item.data)
+	}
+	return b.Bytes()
+}
+
+// settle empties the queue after its snapshots were sent, or dropped
+// because the server rejected them for good.
+func (q *snapshotQueue) settle(sent bool) {
+	if sent {
+		q.sent += len(q.items)
+	} else {
+		q.failed += len(q.items)
+	}
+	q.items = nil
+	q.weight = 0
+}
+
+// settled implements Batcher.Settled for the sink owning the queue.
+func (q *snapshotQueue) settled() (sent, failed, waiting int) {
+	sent, failed = q.sent, q.failed
+	q.sent, q.failed = 0, 0
+	return sent, failed, len(q.items)
+}
+
+// checkResponse turns an HTTP error status into an error. Rate limiting and
+// server errors are worth retrying; any other client error is permanent.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return Permanent(err)
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(body)
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
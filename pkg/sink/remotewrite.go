@@ -0,0 +1,159 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/remotewrite"
+	"go.uber.org/zap"
+)
+
+const defaultRemoteWriteMaxSamples = 100000
+
+func init() {
+	Register("remote_write", newRemoteWrite)
+}
+
+// remoteWriteSink pushes snappy compressed WriteRequests to a Prometheus
+// remote write receiver. Batching and buffering follow the influxdb sink.
+type remoteWriteSink struct {
+	client      *http.Client
+	url         string
+	labels      map[string]string
+	username    string
+	password    string
+	bearerToken string
+	logger      *zap.Logger
+
+	mu    sync.Mutex
+	queue snapshotQueue
+}
+
+func newRemoteWrite(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.RemoteWrite
+	u, err := url.Parse(c.URL)
+	if c.URL == "" || err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("remote_write.url must be an absolute http(s) url: %q", c.URL)
+	}
+	if c.BearerToken != "" && c.Username != "" {
+		return nil, fmt.Errorf("remote_write.bearer_token and remote_write.username are mutually exclusive")
+	}
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	if c.MaxSamples < 1 {
+		c.MaxSamples = defaultRemoteWriteMaxSamples
+	}
+
+	labels := map[string]string{"job": "edgebeat"}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["instance"] = hostname
+	}
+	for name, value := range c.ExternalLabels {
+		if !remotewrite.ValidLabelName(name) {
+			return nil, fmt.Errorf("remote_write.external_labels: invalid label name %q", name)
+		}
+		if value == "" {
+			delete(labels, name)
+			continue
+		}
+		labels[name] = value
+	}
+
+	return &remoteWriteSink{
+		client:      &http.Client{},
+		url:         c.URL,
+		labels:      labels,
+		username:    c.Username,
+		password:    c.Password,
+		bearerToken: c.BearerToken,
+		logger:      logger,
+		queue:       snapshotQueue{batchSize: c.BatchSize, maxWeight: c.MaxSamples},
+	}, nil
+}
+
+func (s *remoteWriteSink) Write(ctx context.Context, snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped, err := s.queue.add(snap.Info.Timestamp, func() ([]byte, int, error) {
+		series := remotewrite.Series(snap.Info, s.labels)
+		return remotewrite.Marshal(series), len(series), nil
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	if dropped > 0 {
+		s.logger.Warn("remote_write buffer full, dropped oldest snapshots", zap.Int("snapshots", dropped))
+	}
+
+	if !s.queue.ready() {
+		return nil
+	}
+	return s.flush(ctx)
+}
+
+// flush sends every queued snapshot in one WriteRequest. The caller holds
+// s.mu.
+func (s *remoteWriteSink) flush(ctx context.Context) error {
+	if s.queue.len() == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, s.queue.body())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case s.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	case s.username != "":
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote write: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		if IsPermanent(err) {
+			// Receivers reject out of order or malformed samples for good;
+			// retrying them would only block newer data.
+			s.queue.settle(false)
+		}
+		return fmt.Errorf("remote write: %w", err)
+	}
+
+	s.logger.Debug("remote write sent", zap.Int("snapshots", s.queue.len()))
+	s.queue.settle(true)
+	return nil
+}
+
+func (s *remoteWriteSink) Settled() (sent, failed, waiting int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue.settled()
+}
+
+func (s *remoteWriteSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.flush(ctx)
+}
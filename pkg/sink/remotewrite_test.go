@@ -0,0 +1,175 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/remotewrite"
+	"go.uber.org/zap"
+)
+
+// remoteWriteStandIn decodes remote write requests and answers with the
+// queued statuses.
+type remoteWriteStandIn struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	writes   [][]remotewrite.TimeSeries
+}
+
+func (s *remoteWriteStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	compressed, _ := io.ReadAll(r.Body)
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := remotewrite.Unmarshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	s.writes = append(s.writes, series)
+
+	status := http.StatusNoContent
+	if len(s.statuses) > 0 {
+		status = s.statuses[0]
+		s.statuses = s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestRemoteWriteSink(t *testing.T, c config.RemoteWriteConfig) (Sink, *remoteWriteStandIn) {
+	t.Helper()
+	standIn := &remoteWriteStandIn{}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	c.URL = server.URL + "/api/v1/write"
+	s, err := newRemoteWrite(context.Background(), config.SinkConfig{Name: "prometheus", RemoteWrite: c}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newRemoteWrite: %v", err)
+	}
+	return s, standIn
+}
+
+func countSeries(series []remotewrite.TimeSeries, name string) int {
+	n := 0
+	for _, ts := range series {
+		for _, l := range ts.Labels {
+			if l.Name == "__name__" && l.Value == name {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestRemoteWrite(t *testing.T) {
+	s, standIn := newTestRemoteWriteSink(t, config.RemoteWriteConfig{
+		ExternalLabels: map[string]string{"site": "plant-a", "instance": "edge-01"},
+		BearerToken:    "secret",
+	})
+
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 12.5)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(standIn.requests) != 1 {
+		t.Fatalf("requests = %d", len(standIn.requests))
+	}
+
+	req := standIn.requests[0]
+	if req.URL.Path != "/api/v1/write" || req.Header.Get("Content-Encoding") != "snappy" || req.Header.Get("Content-Type") != "application/x-protobuf" {
+		t.Fatalf("request = %s %v", req.URL, req.Header)
+	}
+	if req.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" || req.Header.Get("Authorization") != "Bearer secret" {
+		t.Fatalf("headers = %v", req.Header)
+	}
+
+	cpu := standIn.writes[0][0]
+	want := map[string]string{"__name__": "edgebeat_cpu_usage_percent", "cpu": "total", "instance": "edge-01", "job": "edgebeat", "site": "plant-a"}
+	if len(cpu.Labels) != len(want) {
+		t.Fatalf("labels = %+v", cpu.Labels)
+	}
+	for _, l := range cpu.Labels {
+		if want[l.Name] != l.Value {
+			t.Fatalf("labels = %+v, want %v", cpu.Labels, want)
+		}
+	}
+	if cpu.Samples[0].Value != 12.5 || cpu.Samples[0].Timestamp != 1707993105000 {
+		t.Fatalf("samples = %+v", cpu.Samples)
+	}
+}
+
+func TestRemoteWriteBatchingAndRetry(t *testing.T) {
+	s, standIn := newTestRemoteWriteSink(t, config.RemoteWriteConfig{BatchSize: 2, Username: "edge", Password: "pw"})
+	standIn.statuses = []int{http.StatusInternalServerError}
+
+	f := NewFanout(zap.NewNop())
+	f.Add("prometheus", "remote_write", s, RetryPolicy{MaxAttempts: 2})
+	ctx := context.Background()
+
+	if err := s.Write(ctx, influxSnapshot("2024-02-15T10:31:45Z", 1)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(standIn.requests) != 0 {
+		t.Fatal("expected first snapshot to be queued")
+	}
+
+	// The 500 is retried by the fanout and the retry must not queue the
+	// snapshot twice.
+	if err := f.Publish(ctx, testPayload(t), &testInfo); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	flush(t, f)
+	if len(standIn.requests) != 2 || f.Status()[0].Retries != 1 {
+		t.Fatalf("requests = %d, status = %+v", len(standIn.requests), f.Status()[0])
+	}
+	if got := countSeries(standIn.writes[1], "edgebeat_cpu_usage_percent"); got != 2 {
+		t.Fatalf("sent %d snapshots, want 2", got)
+	}
+	if user, pass, ok := standIn.requests[1].BasicAuth(); !ok || user != "edge" || pass != "pw" {
+		t.Fatalf("basic auth = %q %q %v", user, pass, ok)
+	}
+}
+
+func TestRemoteWriteClientErrorDropsQueue(t *testing.T) {
+	s, standIn := newTestRemoteWriteSink(t, config.RemoteWriteConfig{})
+	standIn.statuses = []int{http.StatusBadRequest}
+
+	err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 1))
+	if err == nil || !IsPermanent(err) {
+		t.Fatalf("err = %v, want permanent error", err)
+	}
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:50Z", 2)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := countSeries(standIn.writes[1], "edgebeat_cpu_usage_percent"); got != 1 {
+		t.Fatalf("sent %d snapshots, want rejected snapshot dropped", got)
+	}
+}
+
+func TestRemoteWriteConfigValidation(t *testing.T) {
+	invalid := []config.RemoteWriteConfig{
+		{},
+		{URL: "prometheus:9090/api/v1/write"},
+		{URL: "http://prometheus:9090/api/v1/write", ExternalLabels: map[string]string{"__name__": "x"}},
+		{URL: "http://prometheus:9090/api/v1/write", ExternalLabels: map[string]string{"bad-name": "x"}},
+		{URL: "http://prometheus:9090/api/v1/write", BearerToken: "t", Username: "u"},
+	}
+	for _, c := range invalid {
+		if _, err := newRemoteWrite(context.Background(), config.SinkConfig{RemoteWrite: c}, zap.NewNop()); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+}
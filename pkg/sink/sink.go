@@ -0,0 +1,174 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Snapshot is one collected payload as handed to every sink. Payload is the
+// JSON published by the controller and Info the snapshot it encodes.
+type Snapshot struct {
+	Payload []byte
+	Info    utils.SystemInfo
+}
+
+// Encode returns the snapshot in enc's format. JSON reuses the collected
+// payload so a sink sends exactly what the REST API serves.
+func (s Snapshot) Encode(enc encoding.Encoder) ([]byte, error) {
+	if enc == nil || enc.Name() == encoding.JSON {
+		return s.Payload, nil
+	}
+	return enc.Encode(s.Info)
+}
+
+// Sink is one output. Write is retried by the fan-out publisher according to
+// the sink's retry policy unless it returns a Permanent error.
+type Sink interface {
+	Write(ctx context.Context, snap Snapshot) error
+	Close() error
+}
+
+// Batcher is implemented by sinks that send snapshots in batches. Their
+// Write succeeds once a snapshot is queued, so a snapshot counts as
+// published or failed only when its batch is sent or dropped. Settled
+// returns the snapshots sent and failed since the last call, and the number
+// still waiting for a batch.
+type Batcher interface {
+	Settled() (sent, failed, waiting int)
+}
+
+// Factory creates a sink from its configuration.
+type Factory func(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a sink type available to New. It panics when the type is
+// registered twice, which is a programming error.
+func Register(kind string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[kind]; ok {
+		panic("sink: type registered twice: " + kind)
+	}
+	registry[kind] = factory
+}
+
+// Types lists the registered sink types in sorted order.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	kinds := make([]string, 0, len(registry))
+	for kind := range registry {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// New creates the sink described by cfg.
+func New(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	registryMu.RLock()
+	factory, ok := registry[cfg.Type]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("sink %s: unknown type %q, supported: %v", cfg.Name, cfg.Type, Types())
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	s, err := factory(ctx, cfg, logger.With(zap.String("sink", cfg.Name)))
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: %w", cfg.Name, err)
+	}
+	return s, nil
+}
+
+// RetryPolicy controls how often a failed write is attempted again.
+// MaxAttempts counts the first attempt; Timeout bounds each attempt.
+// QueueSize is the number of snapshots buffered meanwhile.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	QueueSize      int
+}
+
+// PolicyFromConfig converts the retry settings of a configured sink.
+func PolicyFromConfig(cfg config.SinkConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    cfg.Retry.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.Retry.InitialBackoffMS) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.Retry.MaxBackoffMS) * time.Millisecond,
+		Timeout:        time.Duration(cfg.TimeoutSeconds) * time.Second,
+		QueueSize:      cfg.QueueSize,
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. a request the receiver
+// rejected as malformed.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// PayloadPublisher is implemented by publishers that only need the collected
+// payload, such as mqtt.Group.
+type PayloadPublisher interface {
+	Publish(ctx context.Context, payload []byte) error
+	Close() error
+}
+
+type publisherSink struct {
+	publisher PayloadPublisher
+	encoder   encoding.Encoder
+}
+
+// FromPublisher adapts a payload publisher to a Sink that publishes every
+// snapshot as encoded by enc; nil publishes the JSON payload.
+func FromPublisher(p PayloadPublisher, enc encoding.Encoder) Sink {
+	return publisherSink{publisher: p, encoder: enc}
+}
+
+func (s publisherSink) Write(ctx context.Context, snap Snapshot) error {
+	payload, err := snap.Encode(s.encoder)
+	if err != nil {
+		return Permanent(fmt.Errorf("encode snapshot: %w", err))
+	}
+	return s.publisher.Publish(ctx, payload)
+}
+
+func (s publisherSink) Close() error {
+	return s.publisher.Close()
+}
@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/graphite"
+	"go.uber.org/zap"
+)
+
+// defaultStatsDPacketSize keeps datagrams below the usual Ethernet MTU.
+const defaultStatsDPacketSize = 1432
+
+func init() {
+	Register("statsd", newStatsD)
+}
+
+// statsdSink sends every metric as a StatsD gauge over UDP, packing as many
+// metrics into a datagram as fit. Counters are sent as gauges of their
+// running total, since StatsD counters expect per interval increments.
+type statsdSink struct {
+	conn       net.Conn
+	prefix     string
+	packetSize int
+	logger     *zap.Logger
+}
+
+func newStatsD(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.StatsD
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return nil, fmt.Errorf("statsd.address must be host:port: %w", err)
+	}
+	if c.Prefix == "" {
+		c.Prefix = graphite.DefaultPrefix
+	}
+	if c.MaxPacketSize < 1 {
+		c.MaxPacketSize = defaultStatsDPacketSize
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return &statsdSink{conn: conn, prefix: c.Prefix, packetSize: c.MaxPacketSize, logger: logger}, nil
+}
+
+func (s *statsdSink) Write(ctx context.Context, snap Snapshot) error {
+	prefix := metricPrefix(s.prefix, snap.Info)
+	deadline, _ := ctx.Deadline()
+	_ = s.conn.SetWriteDeadline(deadline)
+
+	var packet bytes.Buffer
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := s.conn.Write(packet.Bytes())
+		packet.Reset()
+		if err != nil {
+			return fmt.Errorf("statsd: %w", err)
+		}
+		return nil
+	}
+
+	for _, m := range graphite.Flatten(snap.Info) {
+		path := graphite.Join(prefix, m.Path)
+		line := path + ":" + strconv.FormatFloat(m.Value, 'f', -1, 64) + "|g"
+		if m.Value < 0 {
+			// A signed gauge value is an increment; reset the gauge first
+			// to set a negative value.
+			line = path + ":0|g\n" + line
+		}
+		if packet.Len() > 0 && packet.Len()+1+len(line) > s.packetSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return send()
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
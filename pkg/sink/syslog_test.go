@@ -0,0 +1,150 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"go.uber.org/zap"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer pc.Close()
+
+	s, err := newSyslog(context.Background(), config.SinkConfig{Syslog: config.SyslogConfig{Address: pc.LocalAddr().String(), Facility: "local0"}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newSyslog: %v", err)
+	}
+	defer s.Close()
+
+	snap := influxSnapshot("2024-02-15T10:31:45Z", 12.5)
+	snap.Info.Errors = []string{"host.Users: not supported"}
+	if err := s.Write(context.Background(), snap); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	var got []string
+	for i := 0; i < 2; i++ {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+
+	// local0 is facility 16: warning is 132, error is 131.
+	if !strings.HasPrefix(got[0], "<132>1 2024-02-15T10:31:45.000000Z edge-01 edgebeat ") ||
+		!strings.Contains(got[0], ` snapshot [edgebeat@32473 cpu_percent="12.5" `) ||
+		!strings.HasSuffix(got[0], "] cpu 12.5% memory 0.0% disk 0.0% load1 0.00 errors 1") {
+		t.Fatalf("summary = %q", got[0])
+	}
+	if !strings.HasPrefix(got[1], "<131>1 ") || !strings.HasSuffix(got[1], " collect_error - host.Users: not supported") {
+		t.Fatalf("error message = %q", got[1])
+	}
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	frames := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSuffix(length, " "))
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				return
+			}
+			frames <- string(frame)
+		}
+	}()
+
+	s, err := newSyslog(context.Background(), config.SinkConfig{Syslog: config.SyslogConfig{Network: "tcp", Address: ln.Addr().String()}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newSyslog: %v", err)
+	}
+	defer s.Close()
+
+	snap := influxSnapshot("2024-02-15T10:31:45Z", 12.5)
+	snap.Info.Errors = []string{"a", "b"}
+	if err := s.Write(context.Background(), snap); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for _, suffix := range []string{"errors 2", "collect_error - a", "collect_error - b"} {
+		select {
+		case frame := <-frames:
+			if !strings.HasSuffix(frame, suffix) {
+				t.Fatalf("frame = %q, want suffix %q", frame, suffix)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("frame ending in %q not received", suffix)
+		}
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	pc, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("unixgram not available: %v", err)
+	}
+	defer pc.Close()
+
+	s, err := newSyslog(context.Background(), config.SinkConfig{Syslog: config.SyslogConfig{Network: "unix", Address: path}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newSyslog: %v", err)
+	}
+	defer s.Close()
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 1)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	// daemon is facility 3, informational severity 6.
+	if !strings.HasPrefix(string(buf[:n]), "<30>1 ") {
+		t.Fatalf("message = %q", buf[:n])
+	}
+}
+
+func TestSyslogConfigValidation(t *testing.T) {
+	for _, c := range []config.SyslogConfig{
+		{Address: "loghost"},
+		{Network: "tls", Address: "loghost:6514"},
+		{Address: "loghost:514", Facility: "local9"},
+	} {
+		if _, err := newSyslog(context.Background(), config.SinkConfig{Syslog: c}, zap.NewNop()); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+}
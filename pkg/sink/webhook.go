@@ -0,0 +1,229 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"github.com/jilanisayyad/edgebeat/pkg/encoding"
+	"go.uber.org/zap"
+)
+
+const defaultWebhookHMACHeader = "X-Edgebeat-Signature"
+
+func init() {
+	Register("webhook", newWebhook)
+}
+
+// webhookFuncs are available in webhook templates in addition to the
+// text/template builtins.
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// webhookSink sends every snapshot to one or more HTTP endpoints. When a
+// retry follows a partial failure, only the endpoints that have not accepted
+// the snapshot yet are called again.
+type webhookSink struct {
+	client      *http.Client
+	urls        []string
+	method      string
+	headers     map[string]string
+	tmpl        *template.Template
+	encoder     encoding.Encoder
+	contentType string
+	bearerToken string
+	username    string
+	password    string
+	hmacSecret  []byte
+	hmacHeader  string
+	logger      *zap.Logger
+
+	mu        sync.Mutex
+	delivered map[string]string // url -> timestamp of the last accepted snapshot
+}
+
+func newWebhook(ctx context.Context, cfg config.SinkConfig, logger *zap.Logger) (Sink, error) {
+	c := cfg.Webhook
+	if len(c.URLs) == 0 {
+		return nil, fmt.Errorf("webhook.urls is required")
+	}
+	for _, raw := range c.URLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook.urls: %q is not an absolute http(s) url", raw)
+		}
+	}
+
+	switch c.Method = strings.ToUpper(c.Method); c.Method {
+	case "":
+		c.Method = http.MethodPost
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, fmt.Errorf("webhook.method must be POST, PUT or PATCH, got %q", c.Method)
+	}
+	if c.BearerToken != "" && c.Username != "" {
+		return nil, fmt.Errorf("webhook.bearer_token and webhook.username are mutually exclusive")
+	}
+
+	enc, err := encoding.Lookup(cfg.Encoder)
+	if err != nil {
+		return nil, err
+	}
+	s := &webhookSink{
+		client:      &http.Client{},
+		urls:        c.URLs,
+		method:      c.Method,
+		headers:     c.Headers,
+		encoder:     enc,
+		contentType: c.ContentType,
+		bearerToken: c.BearerToken,
+		username:    c.Username,
+		password:    c.Password,
+		hmacHeader:  c.HMACHeader,
+		logger:      logger,
+		delivered:   make(map[string]string),
+	}
+
+	if c.Template != "" {
+		s.tmpl, err = template.New(cfg.Name).Funcs(webhookFuncs).Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook.template: %w", err)
+		}
+		if s.contentType == "" {
+			s.contentType = "application/json"
+		}
+	} else if s.contentType == "" {
+		s.contentType = enc.ContentType()
+	}
+	if c.HMACSecret != "" {
+		s.hmacSecret = []byte(c.HMACSecret)
+		if s.hmacHeader == "" {
+			s.hmacHeader = defaultWebhookHMACHeader
+		}
+	}
+	return s, nil
+}
+
+func (s *webhookSink) Write(ctx context.Context, snap Snapshot) error {
+	body, err := s.body(snap)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	var signature string
+	if s.hmacSecret != nil {
+		mac := hmac.New(sha256.New, s.hmacSecret)
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, u := range s.urls {
+		if s.wasDelivered(u, snap.Info.Timestamp) {
+			continue
+		}
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			if err := s.send(ctx, u, body, signature); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+			s.markDelivered(u, snap.Info.Timestamp)
+		}(u)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	err = errors.Join(errs...)
+	for _, e := range errs {
+		if !IsPermanent(e) {
+			return err
+		}
+	}
+	return Permanent(err)
+}
+
+// body renders the template or encodes the snapshot.
+func (s *webhookSink) body(snap Snapshot) ([]byte, error) {
+	if s.tmpl == nil {
+		return snap.Encode(s.encoder)
+	}
+	var b bytes.Buffer
+	if err := s.tmpl.Execute(&b, snap.Info); err != nil {
+		return nil, fmt.Errorf("webhook template: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+func (s *webhookSink) send(ctx context.Context, u string, body []byte, signature string) error {
+	req, err := http.NewRequestWithContext(ctx, s.method, u, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", s.contentType)
+	switch {
+	case s.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	case s.username != "":
+		req.SetBasicAuth(s.username, s.password)
+	}
+	if signature != "" {
+		req.Header.Set(s.hmacHeader, signature)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", req.URL.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return fmt.Errorf("webhook %s: %w", req.URL.Redacted(), err)
+	}
+	s.logger.Debug("webhook delivered", zap.String("url", req.URL.Redacted()), zap.Int("status", resp.StatusCode))
+	return nil
+}
+
+func (s *webhookSink) wasDelivered(u, timestamp string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return timestamp != "" && s.delivered[u] == timestamp
+}
+
+func (s *webhookSink) markDelivered(u, timestamp string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered[u] = timestamp
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
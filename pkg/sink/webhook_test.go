@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/config"
+	"go.uber.org/zap"
+)
+
+// webhookReceiver records requests and answers with the queued statuses.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status = r.statuses[0]
+		r.statuses = r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newWebhookReceiver(t *testing.T) (*webhookReceiver, string) {
+	t.Helper()
+	r := &webhookReceiver{}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server.URL
+}
+
+func TestWebhookTemplateAndSignature(t *testing.T) {
+	receiver, url := newWebhookReceiver(t)
+	s, err := newWebhook(context.Background(), config.SinkConfig{Name: "ingest", Webhook: config.WebhookConfig{
+		URLs:        []string{url + "/ingest"},
+		Method:      "put",
+		Headers:     map[string]string{"X-Tenant": "plant-a"},
+		Template:    `{"device":{{json .Host.Hostname}},"cpu":{{.CPU.TotalPercent}}}`,
+		BearerToken: "secret",
+		HMACSecret:  "shared",
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newWebhook: %v", err)
+	}
+
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 12.5)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	req, body := receiver.requests[0], receiver.bodies[0]
+	if want := `{"device":"edge-01","cpu":12.5}`; body != want {
+		t.Fatalf("body = %s, want %s", body, want)
+	}
+	if req.Method != http.MethodPut || req.URL.Path != "/ingest" || req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("request = %s %s %v", req.Method, req.URL, req.Header)
+	}
+	if req.Header.Get("Authorization") != "Bearer secret" || req.Header.Get("X-Tenant") != "plant-a" {
+		t.Fatalf("headers = %v", req.Header)
+	}
+
+	mac := hmac.New(sha256.New, []byte("shared"))
+	mac.Write([]byte(body))
+	if got, want := req.Header.Get("X-Edgebeat-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookRetriesOnlyFailedURLs(t *testing.T) {
+	ok, okURL := newWebhookReceiver(t)
+	flaky, flakyURL := newWebhookReceiver(t)
+	flaky.statuses = []int{http.StatusServiceUnavailable}
+
+	s, err := newWebhook(context.Background(), config.SinkConfig{Webhook: config.WebhookConfig{
+		URLs:     []string{okURL, flakyURL},
+		Username: "edge",
+		Password: "pw",
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newWebhook: %v", err)
+	}
+
+	f := NewFanout(zap.NewNop())
+	f.Add("ingest", "webhook", s, RetryPolicy{MaxAttempts: 2})
+	payload := testPayload(t)
+	if err := f.Publish(context.Background(), payload, &testInfo); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	flush(t, f)
+
+	if len(ok.requests) != 1 || len(flaky.requests) != 2 {
+		t.Fatalf("requests ok = %d, flaky = %d", len(ok.requests), len(flaky.requests))
+	}
+	if ok.bodies[0] != string(payload) {
+		t.Fatalf("body = %s, want the collected payload", ok.bodies[0])
+	}
+	if user, pass, set := flaky.requests[1].BasicAuth(); !set || user != "edge" || pass != "pw" {
+		t.Fatalf("basic auth = %q %q %v", user, pass, set)
+	}
+}
+
+func TestWebhookClientErrorIsPermanent(t *testing.T) {
+	receiver, url := newWebhookReceiver(t)
+	receiver.statuses = []int{http.StatusUnprocessableEntity}
+
+	s, err := newWebhook(context.Background(), config.SinkConfig{Webhook: config.WebhookConfig{URLs: []string{url}}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newWebhook: %v", err)
+	}
+	if err := s.Write(context.Background(), influxSnapshot("2024-02-15T10:31:45Z", 1)); err == nil || !IsPermanent(err) {
+		t.Fatalf("err = %v, want permanent error", err)
+	}
+}
+
+func TestWebhookConfigValidation(t *testing.T) {
+	invalid := []config.SinkConfig{
+		{},
+		{Webhook: config.WebhookConfig{URLs: []string{"ftp://example.com"}}},
+		{Webhook: config.WebhookConfig{URLs: []string{"http://example.com"}, Method: "GET"}},
+		{Webhook: config.WebhookConfig{URLs: []string{"http://example.com"}, Template: "{{.Missing"}},
+		{Webhook: config.WebhookConfig{URLs: []string{"http://example.com"}, BearerToken: "t", Username: "u"}},
+		{Encoder: "xml", Webhook: config.WebhookConfig{URLs: []string{"http://example.com"}}},
+	}
+	for _, c := range invalid {
+		if _, err := newWebhook(context.Background(), c, zap.NewNop()); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package snmp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxMessageSize is the largest UDP payload.
+	maxMessageSize = 65507
+	// minMessageSize is the size every SNMP engine must accept.
+	minMessageSize = 484
+	// maxBulkVarbinds caps the variable bindings of a GetBulk response.
+	maxBulkVarbinds = 512
+)
+
+type AgentConfig struct {
+	Address string
+	// Community grants SNMPv2c read access; empty disables SNMPv2c.
+	Community string
+	Users     []User
+	// EngineID is the hex snmpEngineID; it is derived from the host name
+	// when empty.
+	EngineID string
+	// BootsFile stores snmpEngineBoots, which grows by one on every start.
+	// SNMPv3 users need it.
+	BootsFile string
+	Contact   string
+	Location  string
+	// Version is the edgebeat version shown in sysDescr.
+	Version string
+}
+
+// Agent is a read-only SNMPv2c and SNMPv3 agent that serves the snapshot as
+// HOST-RESOURCES-MIB, IF-MIB and EDGEBEAT-MIB objects. The view is replaced
+// on every Update.
+type Agent struct {
+	conn      net.PacketConn
+	community []byte
+	usm       *usm
+	sys       system
+	disks     *indexRegistry
+	logger    *zap.Logger
+
+	mu   sync.RWMutex
+	view *view
+	wg   sync.WaitGroup
+}
+
+// NewAgent validates the users, listens on cfg.Address and answers requests
+// until Close. Until the first Update only the system group is served.
+func NewAgent(cfg AgentConfig, logger *zap.Logger) (*Agent, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Community == "" && len(cfg.Users) == 0 {
+		return nil, fmt.Errorf("snmp agent needs a community or at least one user")
+	}
+	hostname, _ := os.Hostname()
+	start := time.Now()
+
+	a := &Agent{
+		sys: system{
+			version:  cfg.Version,
+			contact:  cfg.Contact,
+			location: cfg.Location,
+			hostname: hostname,
+			start:    start,
+		},
+		disks:  newIndexRegistry(storageIndexDisk),
+		logger: logger,
+	}
+	if cfg.Community != "" {
+		a.community = []byte(cfg.Community)
+	}
+	if len(cfg.Users) > 0 {
+		u, err := newUSM(cfg.EngineID, hostname, cfg.Users, cfg.BootsFile, start)
+		if err != nil {
+			return nil, err
+		}
+		a.usm = u
+	}
+	a.view = buildView(a.sys, a.disks, nil)
+
+	conn, err := net.ListenPacket("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("snmp agent listen: %w", err)
+	}
+	a.conn = conn
+	a.wg.Add(1)
+	go a.serve()
+	return a, nil
+}
+
+// Addr returns the address the agent listens on.
+func (a *Agent) Addr() net.Addr {
+	return a.conn.LocalAddr()
+}
+
+// Update rebuilds the view from info.
+func (a *Agent) Update(info *utils.SystemInfo) {
+	v := buildView(a.sys, a.disks, info)
+	a.mu.Lock()
+	a.view = v
+	a.mu.Unlock()
+}
+
+func (a *Agent) serve() {
+	defer a.wg.Done()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			a.logger.Warn("snmp agent read", zap.Error(err))
+			continue
+		}
+		resp := a.handle(slices.Clone(buf[:n]))
+		if resp == nil {
+			continue
+		}
+		if _, err := a.conn.WriteTo(resp, addr); err != nil {
+			a.logger.Debug("snmp agent write", zap.String("peer", addr.String()), zap.Error(err))
+		}
+	}
+}
+
+// handle answers one message. Messages that cannot be answered, such as
+// SNMPv1 requests or a wrong community, are dropped.
+func (a *Agent) handle(msg []byte) (resp []byte) {
+	// The decoder works on untrusted input.
+	defer func() {
+		if r := recover(); r != nil {
+			a.logger.Debug("snmp agent dropped malformed message", zap.Any("panic", r))
+			resp = nil
+		}
+	}()
+
+	probe, err := (&gosnmp.GoSNMP{Version: gosnmp.Version2c}).SnmpDecodePacket(slices.Clone(msg))
+	switch probe.Version {
+	case gosnmp.Version2c:
+		if err != nil || a.community == nil {
+			return nil
+		}
+		if subtle.ConstantTimeCompare([]byte(probe.Community), a.community) != 1 {
+			a.logger.Debug("snmp agent dropped request with wrong community")
+			return nil
+		}
+		out := a.respond(probe)
+		if out == nil {
+			return nil
+		}
+		out.Version = gosnmp.Version2c
+		out.Community = probe.Community
+		return a.marshal(out, maxMessageSize, probe.PDUType == gosnmp.GetBulkRequest)
+	case gosnmp.Version3:
+		if a.usm == nil {
+			return nil
+		}
+		return a.handleV3(msg, probe)
+	}
+	return nil
+}
+
+// respond runs a request PDU against the view and returns the response
+// PDU, or nil for PDUs an agent does not answer.
+func (a *Agent) respond(req *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+	resp := &gosnmp.SnmpPacket{PDUType: gosnmp.GetResponse, RequestID: req.RequestID}
+
+	oids := make([]OID, len(req.Variables))
+	for i, v := range req.Variables {
+		oid, err := ParseOID(v.Name)
+		if err != nil {
+			return nil
+		}
+		oids[i] = oid
+	}
+
+	a.mu.RLock()
+	v := a.view
+	a.mu.RUnlock()
+	now := time.Now()
+
+	switch req.PDUType {
+	case gosnmp.GetRequest:
+		for _, oid := range oids {
+			resp.Variables = append(resp.Variables, v.get(oid, now))
+		}
+	case gosnmp.GetNextRequest:
+		for _, oid := range oids {
+			resp.Variables = append(resp.Variables, v.next(oid, now))
+		}
+	case gosnmp.GetBulkRequest:
+		resp.Variables = bulk(v, oids, int(req.NonRepeaters), int(req.MaxRepetitions), now)
+	case gosnmp.SetRequest:
+		resp.Variables = req.Variables
+		resp.Error = gosnmp.NotWritable
+		resp.ErrorIndex = 1
+	default:
+		return nil
+	}
+	return resp
+}
+
+// bulk answers a GetBulk request as RFC 3416 describes. Repetitions stop
+// early once every repeater has reached the end of the view.
+func bulk(v *view, oids []OID, nonRepeaters, maxRepetitions int, now time.Time) []gosnmp.SnmpPDU {
+	nonRepeaters = min(max(nonRepeaters, 0), len(oids))
+	var vars []gosnmp.SnmpPDU
+	for _, oid := range oids[:nonRepeaters] {
+		vars = append(vars, v.next(oid, now))
+	}
+
+	repeaters := slices.Clone(oids[nonRepeaters:])
+	if len(repeaters) == 0 {
+		return vars
+	}
+	maxRepetitions = min(maxRepetitions, (maxBulkVarbinds-len(vars))/len(repeaters))
+	for range maxRepetitions {
+		done := true
+		for i, oid := range repeaters {
+			pdu := v.next(oid, now)
+			vars = append(vars, pdu)
+			if pdu.Type != gosnmp.EndOfMibView {
+				repeaters[i] = mustOID(pdu.Name)
+				done = false
+			}
+		}
+		if done {
+			break
+		}
+	}
+	return vars
+}
+
+// marshal encodes a response within limit bytes. A GetBulk response is
+// shortened from the end; any other response that does not fit becomes a
+// tooBig error.
+func (a *Agent) marshal(resp *gosnmp.SnmpPacket, limit int, bulk bool) []byte {
+	for {
+		data, err := resp.MarshalMsg()
+		if err != nil {
+			a.logger.Debug("snmp agent encode response", zap.Error(err))
+			return nil
+		}
+		if len(data) <= limit {
+			return data
+		}
+		n := len(resp.Variables)
+		if !bulk || n <= 1 {
+			if resp.Error == gosnmp.TooBig {
+				return nil
+			}
+			resp.Error = gosnmp.TooBig
+			resp.ErrorIndex = 0
+			resp.Variables = nil
+			continue
+		}
+		// Drop about as many bindings as the overflow takes.
+		drop := max(1, n*(len(data)-limit)/len(data))
+		resp.Variables = resp.Variables[:n-drop]
+	}
+}
+
+// Close stops listening and waits for the agent to finish.
+func (a *Agent) Close() error {
+	err := a.conn.Close()
+	a.wg.Wait()
+	return err
+}
@@ -0,0 +1,357 @@
+package snmp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func testInfo() *utils.SystemInfo {
+	info := &utils.SystemInfo{}
+	info.Host.Hostname = "gw-01"
+	info.Host.OS = "linux"
+	info.Host.BootTime = uint64(time.Now().Add(-time.Hour).Unix())
+	info.Host.Procs = 123
+	info.CPU.Info = []utils.CPUInfo{{ModelName: "Cortex-A72"}}
+	info.CPU.PerCPUPercent = []float64{12.4, 80.6}
+	info.Memory.Virtual.Total = 4 << 30
+	info.Memory.Virtual.Used = 1 << 30
+	info.Disk.Usage = []utils.DiskUsage{{Mountpoint: "/", Total: 32 << 40, Used: 8 << 40}}
+	info.Network.Interfaces = []utils.NetInterface{
+		{Index: 1, Name: "lo", MTU: 65536, Flags: []string{"up", "loopback"}},
+		{Index: 3, Name: "eth0", MTU: 1500, HardwareAddr: "dc:a6:32:01:02:03", Flags: []string{"up", "broadcast"},
+			IO: utils.NetIO{BytesRecv: 1<<32 + 5, BytesSent: 4096, PacketsRecv: 70, Errin: 2}},
+	}
+	info.Sensors.Temperatures = []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48.25, High: 80, Critical: 85}}
+	info.Sensors.Fans = []utils.Fan{{SensorKey: "fan1", Value: 2400}}
+	info.Sensors.Readings = []utils.SensorReading{{SensorKey: "bme280_pressure", Type: "pressure", Value: 101.325, Unit: "kPa"}}
+	return info
+}
+
+func newTestAgent(t *testing.T, cfg AgentConfig) *Agent {
+	t.Helper()
+	cfg.Address = "127.0.0.1:0"
+	if cfg.BootsFile == "" {
+		cfg.BootsFile = filepath.Join(t.TempDir(), "boots")
+	}
+	a, err := NewAgent(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func newTestClient(t *testing.T, a *Agent) *gosnmp.GoSNMP {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(a.Addr().String())
+	p, _ := strconv.Atoi(port)
+	c := &gosnmp.GoSNMP{
+		Target:  host,
+		Port:    uint16(p),
+		Version: gosnmp.Version2c,
+		Timeout: 500 * time.Millisecond,
+		MaxOids: gosnmp.MaxOids,
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestAgentV2c(t *testing.T) {
+	a := newTestAgent(t, AgentConfig{Community: "edge", Contact: "ops@example.com"})
+	c := newTestClient(t, a)
+	c.Community = "edge"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	// Before the first snapshot only the system group is served.
+	res, err := c.Get([]string{".1.3.6.1.2.1.1.4.0", ".1.3.6.1.2.1.25.2.2.0"})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if v := res.Variables[0]; v.Type != gosnmp.OctetString || string(v.Value.([]byte)) != "ops@example.com" {
+		t.Errorf("sysContact = %v %v", v.Type, v.Value)
+	}
+	if v := res.Variables[1]; v.Type != gosnmp.NoSuchObject {
+		t.Errorf("hrMemorySize before update = %v", v.Type)
+	}
+
+	a.Update(testInfo())
+	res, err = c.Get([]string{
+		".1.3.6.1.2.1.1.5.0",
+		".1.3.6.1.2.1.1.2.0",
+		".1.3.6.1.2.1.25.2.2.0",
+		".1.3.6.1.2.1.2.2.1.2.9",
+		".1.3.6.1.2.1.99.0",
+		".1.3.6.1.4.1.8072.9999.9999.1.1.2.1.3.1",
+		".1.3.6.1.4.1.8072.9999.9999.1.1.6.1.4.1",
+		".1.3.6.1.4.1.8072.9999.9999.1.1.6.1.5.1",
+	})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	v := res.Variables
+	if string(v[0].Value.([]byte)) != "gw-01" {
+		t.Errorf("sysName = %v", v[0].Value)
+	}
+	if v[1].Value != EdgebeatMIB.String() {
+		t.Errorf("sysObjectID = %v", v[1].Value)
+	}
+	if v[2].Value != 4<<20 {
+		t.Errorf("hrMemorySize = %v", v[2].Value)
+	}
+	if v[3].Type != gosnmp.NoSuchInstance || v[4].Type != gosnmp.NoSuchObject {
+		t.Errorf("missing instances = %v, %v", v[3].Type, v[4].Type)
+	}
+	if v[5].Type != gosnmp.Integer || v[5].Value != 48250 {
+		t.Errorf("ebTempValue = %v %v", v[5].Type, v[5].Value)
+	}
+	if v[6].Type != gosnmp.Integer || v[6].Value != 101325 || string(v[7].Value.([]byte)) != "kPa" {
+		t.Errorf("ebReadingValue = %v %v, ebReadingUnit = %v", v[6].Type, v[6].Value, v[7].Value)
+	}
+
+	ifTable, err := c.WalkAll(".1.3.6.1.2.1.2.2.1")
+	if err != nil {
+		t.Fatalf("WalkAll: %v", err)
+	}
+	// Fifteen columns for two interfaces.
+	if len(ifTable) != 30 {
+		t.Fatalf("ifTable has %d instances", len(ifTable))
+	}
+	ifXTable, err := c.BulkWalkAll(".1.3.6.1.2.1.31.1.1.1")
+	if err != nil {
+		t.Fatalf("BulkWalkAll: %v", err)
+	}
+	want := map[string]any{
+		".1.3.6.1.2.1.2.2.1.1.3":     3,
+		".1.3.6.1.2.1.2.2.1.2.3":     "eth0",
+		".1.3.6.1.2.1.2.2.1.3.1":     24,
+		".1.3.6.1.2.1.2.2.1.3.3":     6,
+		".1.3.6.1.2.1.2.2.1.6.3":     string([]byte{0xdc, 0xa6, 0x32, 1, 2, 3}),
+		".1.3.6.1.2.1.2.2.1.8.3":     1,
+		".1.3.6.1.2.1.2.2.1.10.3":    uint(5),
+		".1.3.6.1.2.1.2.2.1.11.3":    uint(70),
+		".1.3.6.1.2.1.2.2.1.14.3":    uint(2),
+		".1.3.6.1.2.1.2.2.1.16.3":    uint(4096),
+		".1.3.6.1.2.1.31.1.1.1.1.3":  "eth0",
+		".1.3.6.1.2.1.31.1.1.1.6.3":  uint64(1<<32 + 5),
+		".1.3.6.1.2.1.31.1.1.1.10.3": uint64(4096),
+	}
+	for _, pdu := range append(ifTable, ifXTable...) {
+		w, ok := want[pdu.Name]
+		if !ok {
+			continue
+		}
+		got := pdu.Value
+		if b, ok := got.([]byte); ok {
+			got = string(b)
+		}
+		if got != w {
+			t.Errorf("%s = %v, want %v", pdu.Name, got, w)
+		}
+	}
+
+	storage, err := c.BulkWalkAll(".1.3.6.1.2.1.25.2.3.1")
+	if err != nil {
+		t.Fatalf("BulkWalkAll: %v", err)
+	}
+	values := make(map[string]any)
+	for _, pdu := range storage {
+		values[pdu.Name] = pdu.Value
+	}
+	// 32 TiB needs an allocation unit of 32 KiB to fit Integer32.
+	if values[".1.3.6.1.2.1.25.2.3.1.4.31"] != 32768 || values[".1.3.6.1.2.1.25.2.3.1.5.31"] != 1<<30 {
+		t.Errorf("disk storage = %v units of %v", values[".1.3.6.1.2.1.25.2.3.1.5.31"], values[".1.3.6.1.2.1.25.2.3.1.4.31"])
+	}
+	if values[".1.3.6.1.2.1.25.2.3.1.6.1"] != (1<<30)/1024 {
+		t.Errorf("hrStorageUsed of RAM = %v", values[".1.3.6.1.2.1.25.2.3.1.6.1"])
+	}
+
+	res, err = c.GetBulk([]string{".1.3.6.1.2.1.25.3.3.1.2"}, 0, 10)
+	if err != nil {
+		t.Fatalf("GetBulk: %v", err)
+	}
+	if v := res.Variables; v[0].Name != ".1.3.6.1.2.1.25.3.3.1.2.768" || v[0].Value != 12 || v[1].Value != 81 {
+		t.Errorf("hrProcessorLoad = %+v", v[:2])
+	}
+
+	res, err = c.Set([]gosnmp.SnmpPDU{{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: "x"}})
+	if err != nil || res.Error != gosnmp.NotWritable {
+		t.Errorf("Set = %v, %v", res, err)
+	}
+
+	c.Community = "public"
+	if _, err := c.Get([]string{".1.3.6.1.2.1.1.5.0"}); err == nil {
+		t.Error("request with wrong community was answered")
+	}
+}
+
+func TestAgentStorageIndexes(t *testing.T) {
+	a := newTestAgent(t, AgentConfig{Community: "edge"})
+	descr := func(index int) any {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		pdu := a.view.get(mustOID("1.3.6.1.2.1.25.2.3.1.3").Append(uint32(index)), time.Now())
+		if pdu.Type != gosnmp.OctetString {
+			return pdu.Type
+		}
+		return pdu.Value
+	}
+
+	info := testInfo()
+	info.Disk.Usage = []utils.DiskUsage{{Mountpoint: "/", Total: 1 << 30}, {Mountpoint: "/data", Total: 1 << 30}}
+	a.Update(info)
+	if descr(31) != "/" || descr(32) != "/data" {
+		t.Fatalf("hrStorageDescr = %v, %v", descr(31), descr(32))
+	}
+
+	// /data keeps its index when / disappears or moves behind it, and a
+	// new mountpoint gets the next free index.
+	info.Disk.Usage = []utils.DiskUsage{{Mountpoint: "/media/usb", Total: 1 << 30}, {Mountpoint: "/data", Total: 1 << 30}}
+	a.Update(info)
+	if descr(31) != gosnmp.NoSuchInstance || descr(32) != "/data" || descr(33) != "/media/usb" {
+		t.Fatalf("hrStorageDescr = %v, %v, %v", descr(31), descr(32), descr(33))
+	}
+}
+
+func TestAgentV3(t *testing.T) {
+	a := newTestAgent(t, AgentConfig{Users: []User{
+		{Name: "noc", AuthProtocol: "sha256", AuthPassword: "authpass1", PrivProtocol: "aes", PrivPassword: "privpass1"},
+		{Name: "mon", AuthProtocol: "MD5", AuthPassword: "authpass2"},
+	}})
+	a.Update(testInfo())
+
+	get := func(user *gosnmp.UsmSecurityParameters, flags gosnmp.SnmpV3MsgFlags) (*gosnmp.SnmpPacket, error) {
+		c := newTestClient(t, a)
+		c.Version = gosnmp.Version3
+		c.SecurityModel = gosnmp.UserSecurityModel
+		c.MsgFlags = flags
+		c.SecurityParameters = user
+		if err := c.Connect(); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		return c.Get([]string{".1.3.6.1.2.1.1.5.0"})
+	}
+
+	res, err := get(&gosnmp.UsmSecurityParameters{
+		UserName:                 "noc",
+		AuthenticationProtocol:   gosnmp.SHA256,
+		AuthenticationPassphrase: "authpass1",
+		PrivacyProtocol:          gosnmp.AES,
+		PrivacyPassphrase:        "privpass1",
+	}, gosnmp.AuthPriv)
+	if err != nil {
+		t.Fatalf("authPriv Get: %v", err)
+	}
+	if string(res.Variables[0].Value.([]byte)) != "gw-01" {
+		t.Errorf("sysName = %v", res.Variables[0].Value)
+	}
+
+	res, err = get(&gosnmp.UsmSecurityParameters{
+		UserName:                 "mon",
+		AuthenticationProtocol:   gosnmp.MD5,
+		AuthenticationPassphrase: "authpass2",
+		PrivacyProtocol:          gosnmp.NoPriv,
+	}, gosnmp.AuthNoPriv)
+	if err != nil || string(res.Variables[0].Value.([]byte)) != "gw-01" {
+		t.Fatalf("authNoPriv Get = %v, %v", res, err)
+	}
+
+	_, err = get(&gosnmp.UsmSecurityParameters{
+		UserName:                 "ghost",
+		AuthenticationProtocol:   gosnmp.MD5,
+		AuthenticationPassphrase: "authpass2",
+		PrivacyProtocol:          gosnmp.NoPriv,
+	}, gosnmp.AuthNoPriv)
+	if err == nil {
+		t.Error("unknown user was answered")
+	}
+
+	_, err = get(&gosnmp.UsmSecurityParameters{
+		UserName:                 "noc",
+		AuthenticationProtocol:   gosnmp.SHA256,
+		AuthenticationPassphrase: "wrongpass",
+		PrivacyProtocol:          gosnmp.AES,
+		PrivacyPassphrase:        "privpass1",
+	}, gosnmp.AuthPriv)
+	if err == nil {
+		t.Error("wrong password was answered")
+	}
+	if n := a.usm.counters[usmStats.wrongDigests.String()].Load(); n == 0 {
+		t.Error("usmStatsWrongDigests not counted")
+	}
+}
+
+func TestAgentEngineBoots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "boots")
+	users := []User{{Name: "noc", AuthProtocol: "SHA", AuthPassword: "authpass1"}}
+	for want := uint32(1); want <= 2; want++ {
+		a := newTestAgent(t, AgentConfig{Users: users, BootsFile: path})
+		if a.usm.boots != want || a.usm.users["noc"].params.AuthoritativeEngineBoots != want {
+			t.Fatalf("boots = %d, want %d", a.usm.boots, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("2147483647\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if a := newTestAgent(t, AgentConfig{Users: users, BootsFile: path}); a.usm.boots != maxBoots {
+		t.Fatalf("boots = %d, want %d", a.usm.boots, maxBoots)
+	}
+
+	for _, content := range []string{"garbage", "4294967296"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if a, err := NewAgent(AgentConfig{Address: "127.0.0.1:0", Users: users, BootsFile: path}, nil); err == nil {
+			a.Close()
+			t.Errorf("boots file %q accepted", content)
+		}
+	}
+}
+
+func TestNewAgentValidates(t *testing.T) {
+	cases := []AgentConfig{
+		{},
+		{Users: []User{{Name: "u", AuthProtocol: "SHA", AuthPassword: "short"}}},
+		{Users: []User{{Name: "u", AuthProtocol: "SHA1", AuthPassword: "longenough"}}},
+		{Users: []User{{Name: "u", AuthProtocol: "SHA", AuthPassword: "longenough", PrivProtocol: "3DES", PrivPassword: "longenough"}}},
+		{Users: []User{{Name: "u", AuthProtocol: "SHA", AuthPassword: "longenough"}, {Name: "u", AuthProtocol: "MD5", AuthPassword: "longenough"}}},
+		{Users: []User{{Name: "u", AuthProtocol: "SHA", AuthPassword: "longenough"}}, EngineID: "zz"},
+		{Users: []User{{Name: "u", AuthProtocol: "SHA", AuthPassword: "longenough"}}},
+	}
+	for _, cfg := range cases {
+		cfg.Address = "127.0.0.1:0"
+		if a, err := NewAgent(cfg, nil); err == nil {
+			a.Close()
+			t.Errorf("NewAgent(%+v) accepted an invalid config", cfg)
+		}
+	}
+}
+
+func TestAgentDropsGarbage(t *testing.T) {
+	a := newTestAgent(t, AgentConfig{Community: "edge"})
+	conn, err := net.Dial("udp", a.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	for _, msg := range [][]byte{{0x30}, {0x30, 0x03, 0x02, 0x01, 0x03}, []byte("hello")} {
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var ne net.Error
+	if _, err := conn.Read(make([]byte, 64)); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("garbage was answered: %v", err)
+	}
+}
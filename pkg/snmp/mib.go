@@ -0,0 +1,371 @@
+package snmp
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// EdgebeatMIB is the root of EDGEBEAT-MIB, shipped in mibs/EDGEBEAT-MIB.txt.
+// edgebeat has no enterprise number of its own, so the module lives below
+// netSnmpPlaypen; sysObjectID points here as well.
+var EdgebeatMIB = mustOID("1.3.6.1.4.1.8072.9999.9999.1")
+
+var (
+	oidSystem         = mustOID("1.3.6.1.2.1.1")
+	oidInterfaces     = mustOID("1.3.6.1.2.1.2")
+	oidIfXEntry       = mustOID("1.3.6.1.2.1.31.1.1.1")
+	oidHrSystem       = mustOID("1.3.6.1.2.1.25.1")
+	oidHrStorage      = mustOID("1.3.6.1.2.1.25.2")
+	oidHrStorageTypes = oidHrStorage.Append(1)
+	oidHrDevice       = mustOID("1.3.6.1.2.1.25.3")
+	oidHrProcessor    = oidHrDevice.Append(1, 3)
+	oidEdgebeatObject = EdgebeatMIB.Append(1)
+
+	// zeroDotZero is the OID used when no better identifier is known.
+	zeroDotZero = OID{0, 0}
+)
+
+// Storage and device indexes follow the numbering of net-snmp.
+const (
+	storageIndexRAM  = 1
+	storageIndexSwap = 10
+	storageIndexDisk = 31
+	deviceIndexCPU   = 768
+)
+
+// entry is one object instance. Values of entries with get are computed when
+// a request reads them, such as sysUpTime.
+type entry struct {
+	oid   OID
+	typ   gosnmp.Asn1BER
+	value any
+	get   func(now time.Time) any
+}
+
+func (e entry) pdu(now time.Time) gosnmp.SnmpPDU {
+	v := e.value
+	if e.get != nil {
+		v = e.get(now)
+	}
+	return gosnmp.SnmpPDU{Name: e.oid.String(), Type: e.typ, Value: v}
+}
+
+// view is the sorted set of instances the agent serves. objects holds the
+// OIDs of the object types, to tell noSuchObject from noSuchInstance.
+type view struct {
+	entries []entry
+	objects map[string]bool
+}
+
+// system holds the values of the system group that do not come from the
+// snapshot.
+type system struct {
+	version  string
+	contact  string
+	location string
+	hostname string
+	start    time.Time
+}
+
+// indexRegistry hands out table indexes by name, such as hrStorageIndex by
+// mountpoint, so a row keeps its index while other rows come and go.
+// Indexes are assigned in order of first sight and never reused.
+type indexRegistry struct {
+	mu     sync.Mutex
+	next   uint32
+	byName map[string]uint32
+}
+
+func newIndexRegistry(first uint32) *indexRegistry {
+	return &indexRegistry{next: first, byName: make(map[string]uint32)}
+}
+
+func (r *indexRegistry) index(name string) uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.byName[name]
+	if !ok {
+		i = r.next
+		r.byName[name] = i
+		r.next++
+	}
+	return i
+}
+
+// buildView maps a snapshot to the MIB view. Without a snapshot only the
+// system group is served. disks numbers the hrStorageTable disk rows.
+func buildView(sys system, disks *indexRegistry, info *utils.SystemInfo) *view {
+	b := &viewBuilder{objects: make(map[string]bool)}
+	b.system(sys, info)
+	if info != nil {
+		b.hostResources(info, disks)
+		b.interfaces(info)
+		b.sensors(info)
+	}
+	slices.SortFunc(b.entries, func(x, y entry) int { return x.oid.Compare(y.oid) })
+	return &view{entries: b.entries, objects: b.objects}
+}
+
+// get returns the instance at oid or the matching exception.
+func (v *view) get(oid OID, now time.Time) gosnmp.SnmpPDU {
+	if i, ok := v.search(oid); ok {
+		return v.entries[i].pdu(now)
+	}
+	for n := len(oid) - 1; n > 0; n-- {
+		if v.objects[oid[:n].String()] {
+			return gosnmp.SnmpPDU{Name: oid.String(), Type: gosnmp.NoSuchInstance}
+		}
+	}
+	return gosnmp.SnmpPDU{Name: oid.String(), Type: gosnmp.NoSuchObject}
+}
+
+// next returns the first instance after oid, or endOfMibView.
+func (v *view) next(oid OID, now time.Time) gosnmp.SnmpPDU {
+	i, ok := v.search(oid)
+	if ok {
+		i++
+	}
+	if i == len(v.entries) {
+		return gosnmp.SnmpPDU{Name: oid.String(), Type: gosnmp.EndOfMibView}
+	}
+	return v.entries[i].pdu(now)
+}
+
+func (v *view) search(oid OID) (int, bool) {
+	return slices.BinarySearchFunc(v.entries, oid, func(e entry, t OID) int { return e.oid.Compare(t) })
+}
+
+type viewBuilder struct {
+	entries []entry
+	objects map[string]bool
+}
+
+func (b *viewBuilder) add(object OID, index uint32, typ gosnmp.Asn1BER, value any) {
+	b.objects[object.String()] = true
+	b.entries = append(b.entries, entry{oid: object.Append(index), typ: typ, value: value})
+}
+
+func (b *viewBuilder) scalar(object OID, typ gosnmp.Asn1BER, value any) {
+	b.add(object, 0, typ, value)
+}
+
+func (b *viewBuilder) dynamic(object OID, typ gosnmp.Asn1BER, get func(now time.Time) any) {
+	b.objects[object.String()] = true
+	b.entries = append(b.entries, entry{oid: object.Append(0), typ: typ, get: get})
+}
+
+// system adds the SNMPv2-MIB system group.
+func (b *viewBuilder) system(sys system, info *utils.SystemInfo) {
+	descr := "edgebeat " + sys.version
+	name := sys.hostname
+	if info != nil {
+		if h := info.Host; h.OS != "" {
+			descr += fmt.Sprintf(" on %s %s %s", h.OS, h.KernelVersion, h.KernelArch)
+		}
+		if info.Host.Hostname != "" {
+			name = info.Host.Hostname
+		}
+	}
+	b.scalar(oidSystem.Append(1), gosnmp.OctetString, descr)
+	b.scalar(oidSystem.Append(2), gosnmp.ObjectIdentifier, EdgebeatMIB.String())
+	b.dynamic(oidSystem.Append(3), gosnmp.TimeTicks, func(now time.Time) any {
+		return ticks(now.Sub(sys.start))
+	})
+	b.scalar(oidSystem.Append(4), gosnmp.OctetString, sys.contact)
+	b.scalar(oidSystem.Append(5), gosnmp.OctetString, name)
+	b.scalar(oidSystem.Append(6), gosnmp.OctetString, sys.location)
+	// Internet and end-to-end services.
+	b.scalar(oidSystem.Append(7), gosnmp.Integer, 72)
+}
+
+// hostResources adds hrSystem, hrStorage, hrDeviceTable and
+// hrProcessorTable of HOST-RESOURCES-MIB.
+func (b *viewBuilder) hostResources(info *utils.SystemInfo, disks *indexRegistry) {
+	if boot := int64(info.Host.BootTime); boot > 0 {
+		b.dynamic(oidHrSystem.Append(1), gosnmp.TimeTicks, func(now time.Time) any {
+			return ticks(now.Sub(time.Unix(boot, 0)))
+		})
+	}
+	b.dynamic(oidHrSystem.Append(2), gosnmp.OctetString, func(now time.Time) any {
+		return dateAndTime(now.UTC())
+	})
+	b.scalar(oidHrSystem.Append(5), gosnmp.Gauge32, uint32(len(info.Host.Users)))
+	b.scalar(oidHrSystem.Append(6), gosnmp.Gauge32, clampUint32(float64(info.Host.Procs)))
+
+	mem := info.Memory
+	b.scalar(oidHrStorage.Append(2), gosnmp.Integer, clampInt32(float64(mem.Virtual.Total/1024)))
+	b.storage(storageIndexRAM, 2, "Physical memory", mem.Virtual.Total, mem.Virtual.Used)
+	if mem.Swap.Total > 0 {
+		b.storage(storageIndexSwap, 3, "Swap space", mem.Swap.Total, mem.Swap.Used)
+	}
+	for _, u := range info.Disk.Usage {
+		b.storage(disks.index(u.Mountpoint), 4, u.Mountpoint, u.Total, u.Used)
+	}
+
+	deviceEntry := oidHrDevice.Append(2, 1)
+	processorEntry := oidHrDevice.Append(3, 1)
+	for i, pct := range info.CPU.PerCPUPercent {
+		index := uint32(deviceIndexCPU + i)
+		descr := "CPU"
+		if n := len(info.CPU.Info); n > 0 {
+			descr = info.CPU.Info[min(i, n-1)].ModelName
+		}
+		b.add(deviceEntry.Append(1), index, gosnmp.Integer, int(index))
+		b.add(deviceEntry.Append(2), index, gosnmp.ObjectIdentifier, oidHrProcessor.String())
+		b.add(deviceEntry.Append(3), index, gosnmp.OctetString, descr)
+		b.add(deviceEntry.Append(4), index, gosnmp.ObjectIdentifier, zeroDotZero.String())
+		// running(2)
+		b.add(deviceEntry.Append(5), index, gosnmp.Integer, 2)
+		b.add(processorEntry.Append(1), index, gosnmp.ObjectIdentifier, zeroDotZero.String())
+		b.add(processorEntry.Append(2), index, gosnmp.Integer, clampInt32(math.Round(pct)))
+	}
+}
+
+// storage adds one row of hrStorageTable. The allocation unit is the
+// smallest power of two from 1 KiB that keeps the size within Integer32.
+func (b *viewBuilder) storage(index, storageType uint32, descr string, total, used uint64) {
+	unit := uint64(1024)
+	for total/unit > math.MaxInt32 {
+		unit *= 2
+	}
+	row := oidHrStorage.Append(3, 1)
+	b.add(row.Append(1), index, gosnmp.Integer, int(index))
+	b.add(row.Append(2), index, gosnmp.ObjectIdentifier, oidHrStorageTypes.Append(storageType).String())
+	b.add(row.Append(3), index, gosnmp.OctetString, descr)
+	b.add(row.Append(4), index, gosnmp.Integer, int(unit))
+	b.add(row.Append(5), index, gosnmp.Integer, int(total/unit))
+	b.add(row.Append(6), index, gosnmp.Integer, int(min(used, total)/unit))
+}
+
+// interfaces adds ifNumber, the ifTable columns the snapshot can fill and
+// the ifXTable names and 64-bit counters. ifIndex is the kernel interface
+// index. The kernel counts packets without telling unicast apart, so the
+// unicast columns hold all packets.
+func (b *viewBuilder) interfaces(info *utils.SystemInfo) {
+	var ifaces []utils.NetInterface
+	for _, iface := range info.Network.Interfaces {
+		if iface.Index > 0 {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	b.scalar(oidInterfaces.Append(1), gosnmp.Integer, len(ifaces))
+	row := oidInterfaces.Append(2, 1)
+	for _, iface := range ifaces {
+		index := uint32(iface.Index)
+		mac, _ := net.ParseMAC(iface.HardwareAddr)
+		// up(1) or down(2). The snapshot only has the administrative up
+		// flag, which also stands for the operational state.
+		status := 2
+		if slices.Contains(iface.Flags, "up") {
+			status = 1
+		}
+		b.add(row.Append(1), index, gosnmp.Integer, int(index))
+		b.add(row.Append(2), index, gosnmp.OctetString, iface.Name)
+		b.add(row.Append(3), index, gosnmp.Integer, ifType(iface, mac))
+		b.add(row.Append(4), index, gosnmp.Integer, iface.MTU)
+		b.add(row.Append(6), index, gosnmp.OctetString, []byte(mac))
+		b.add(row.Append(7), index, gosnmp.Integer, status)
+		b.add(row.Append(8), index, gosnmp.Integer, status)
+
+		// Counter32 columns wrap at 2^32 like the counters of any agent.
+		io := iface.IO
+		b.add(row.Append(10), index, gosnmp.Counter32, uint32(io.BytesRecv))
+		b.add(row.Append(11), index, gosnmp.Counter32, uint32(io.PacketsRecv))
+		b.add(row.Append(13), index, gosnmp.Counter32, uint32(io.Dropin))
+		b.add(row.Append(14), index, gosnmp.Counter32, uint32(io.Errin))
+		b.add(row.Append(16), index, gosnmp.Counter32, uint32(io.BytesSent))
+		b.add(row.Append(17), index, gosnmp.Counter32, uint32(io.PacketsSent))
+		b.add(row.Append(19), index, gosnmp.Counter32, uint32(io.Dropout))
+		b.add(row.Append(20), index, gosnmp.Counter32, uint32(io.Errout))
+
+		b.add(oidIfXEntry.Append(1), index, gosnmp.OctetString, iface.Name)
+		b.add(oidIfXEntry.Append(6), index, gosnmp.Counter64, io.BytesRecv)
+		b.add(oidIfXEntry.Append(7), index, gosnmp.Counter64, io.PacketsRecv)
+		b.add(oidIfXEntry.Append(10), index, gosnmp.Counter64, io.BytesSent)
+		b.add(oidIfXEntry.Append(11), index, gosnmp.Counter64, io.PacketsSent)
+	}
+}
+
+// ifType returns softwareLoopback(24), ethernetCsmacd(6) for interfaces
+// with a MAC address, or other(1).
+func ifType(iface utils.NetInterface, mac net.HardwareAddr) int {
+	switch {
+	case slices.Contains(iface.Flags, "loopback"):
+		return 24
+	case len(mac) == 6:
+		return 6
+	}
+	return 1
+}
+
+// sensors adds the temperature, fan and reading tables of EDGEBEAT-MIB.
+// Temperatures are in millidegrees Celsius, readings in thousandths of
+// their unit.
+func (b *viewBuilder) sensors(info *utils.SystemInfo) {
+	temps := info.Sensors.Temperatures
+	b.scalar(oidEdgebeatObject.Append(1), gosnmp.Integer, len(temps))
+	row := oidEdgebeatObject.Append(2, 1)
+	for i, t := range temps {
+		index := uint32(i + 1)
+		b.add(row.Append(2), index, gosnmp.OctetString, t.SensorKey)
+		b.add(row.Append(3), index, gosnmp.Integer, clampInt32(math.Round(t.Value*1000)))
+		b.add(row.Append(4), index, gosnmp.Integer, clampInt32(math.Round(t.High*1000)))
+		b.add(row.Append(5), index, gosnmp.Integer, clampInt32(math.Round(t.Critical*1000)))
+	}
+
+	fans := info.Sensors.Fans
+	b.scalar(oidEdgebeatObject.Append(3), gosnmp.Integer, len(fans))
+	row = oidEdgebeatObject.Append(4, 1)
+	for i, f := range fans {
+		index := uint32(i + 1)
+		b.add(row.Append(2), index, gosnmp.OctetString, f.SensorKey)
+		b.add(row.Append(3), index, gosnmp.Gauge32, clampUint32(math.Round(f.Value)))
+	}
+
+	readings := info.Sensors.Readings
+	b.scalar(oidEdgebeatObject.Append(5), gosnmp.Integer, len(readings))
+	row = oidEdgebeatObject.Append(6, 1)
+	for i, r := range readings {
+		index := uint32(i + 1)
+		b.add(row.Append(2), index, gosnmp.OctetString, r.SensorKey)
+		b.add(row.Append(3), index, gosnmp.OctetString, r.Type)
+		b.add(row.Append(4), index, gosnmp.Integer, clampInt32(math.Round(r.Value*1000)))
+		b.add(row.Append(5), index, gosnmp.OctetString, r.Unit)
+	}
+}
+
+// ticks converts d to TimeTicks, which wrap after about 497 days.
+func ticks(d time.Duration) uint32 {
+	return uint32(d / (10 * time.Millisecond))
+}
+
+// dateAndTime encodes t as an 11 octet DateAndTime.
+func dateAndTime(t time.Time) []byte {
+	year := t.Year()
+	return []byte{
+		byte(year >> 8), byte(year), byte(t.Month()), byte(t.Day()),
+		byte(t.Hour()), byte(t.Minute()), byte(t.Second()), byte(t.Nanosecond() / 1e8),
+		'+', 0, 0,
+	}
+}
+
+func clampInt32(v float64) int {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return int(max(math.MinInt32, min(math.MaxInt32, v)))
+}
+
+func clampUint32(v float64) uint32 {
+	if math.IsNaN(v) || v < 0 {
+		return 0
+	}
+	return uint32(min(math.MaxUint32, v))
+}
@@ -0,0 +1,63 @@
+package snmp
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OID is an object identifier as a list of arcs.
+type OID []uint32
+
+// ParseOID parses a dotted OID such as 1.3.6.1.2.1.1.1.0; a leading dot is
+// allowed.
+func ParseOID(s string) (OID, error) {
+	s = strings.TrimPrefix(s, ".")
+	if s == "" {
+		return nil, fmt.Errorf("empty oid")
+	}
+	parts := strings.Split(s, ".")
+	oid := make(OID, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid %q", s)
+		}
+		oid[i] = uint32(v)
+	}
+	return oid, nil
+}
+
+func mustOID(s string) OID {
+	oid, err := ParseOID(s)
+	if err != nil {
+		panic(err)
+	}
+	return oid
+}
+
+// String formats the OID with a leading dot, as gosnmp does.
+func (o OID) String() string {
+	var b strings.Builder
+	for _, arc := range o {
+		b.WriteByte('.')
+		b.WriteString(strconv.FormatUint(uint64(arc), 10))
+	}
+	return b.String()
+}
+
+// Append returns a new OID with arcs added to o.
+func (o OID) Append(arcs ...uint32) OID {
+	return append(o[:len(o):len(o)], arcs...)
+}
+
+// HasPrefix reports whether o lies in the subtree of prefix.
+func (o OID) HasPrefix(prefix OID) bool {
+	return len(o) >= len(prefix) && slices.Equal(o[:len(prefix)], prefix)
+}
+
+// Compare orders OIDs lexicographically, the order of GetNext.
+func (o OID) Compare(other OID) int {
+	return slices.Compare(o, other)
+}
@@ -0,0 +1,459 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Defaults for settings left zero in PollerConfig and Target.
+const (
+	DefaultPort    = 161
+	DefaultTimeout = 2 * time.Second
+	DefaultRetries = 1
+)
+
+// maxWalkValues caps the instances of one walk, so that a walk of a large
+// subtree cannot flood the snapshot.
+const maxWalkValues = 1000
+
+var errWalkLimit = errors.New("walk limit reached")
+
+// Object is one value polled from a target. A scalar OID, such as
+// 1.3.6.1.2.1.33.1.2.4.0, is read with Get. With Walk set, every instance
+// below OID is read and named Name.<index>, where the index is the rest of
+// the instance OID, such as if_in_octets.3.
+type Object struct {
+	Name string
+	OID  string
+	Walk bool
+	// Scale multiplies numeric values; 0 means 1.
+	Scale float64
+	Unit  string
+}
+
+// Target is one SNMP device. Version is 2c (the default), which uses
+// Community, or 3, which uses User.
+type Target struct {
+	Name      string
+	Host      string
+	Port      int
+	Version   string
+	Community string
+	User      User
+	Objects   []Object
+}
+
+type PollerConfig struct {
+	Targets []Target
+	// Timeout bounds every request, which is sent Retries more times when
+	// it goes unanswered.
+	Timeout time.Duration
+	Retries int
+}
+
+type object struct {
+	name string
+	oid  OID
+	// id is oid without the leading dot, as in the snapshot.
+	id    string
+	walk  bool
+	scale float64
+	unit  string
+}
+
+type target struct {
+	name      string
+	host      string
+	port      uint16
+	version   gosnmp.SnmpVersion
+	community string
+	params    *gosnmp.UsmSecurityParameters
+	flags     gosnmp.SnmpV3MsgFlags
+	objects   []object
+	timeout   time.Duration
+	retries   int
+
+	// mu guards client; a GoSNMP sends one request at a time.
+	mu     sync.Mutex
+	client *gosnmp.GoSNMP
+}
+
+// Poller reads the configured objects of every target on every collection
+// and adds them to the snapshot. Targets are polled concurrently, so an
+// unreachable device delays a collection by its own timeout only.
+type Poller struct {
+	targets []*target
+	logger  *zap.Logger
+
+	mu     sync.Mutex
+	status utils.IntegrationStatus
+}
+
+// NewPoller validates the targets and their objects. Sockets are opened on
+// the first poll.
+func NewPoller(cfg PollerConfig, logger *zap.Logger) (*Poller, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("snmp retries must not be negative: %d", cfg.Retries)
+	}
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("snmp target list is empty")
+	}
+
+	p := &Poller{logger: logger}
+	names := make(map[string]bool, len(cfg.Targets))
+	for _, tc := range cfg.Targets {
+		t, err := newTarget(tc, cfg.Timeout, cfg.Retries)
+		if err != nil {
+			return nil, err
+		}
+		if names[t.name] {
+			return nil, fmt.Errorf("snmp target %s is defined twice", t.name)
+		}
+		names[t.name] = true
+		p.targets = append(p.targets, t)
+	}
+	return p, nil
+}
+
+func newTarget(tc Target, timeout time.Duration, retries int) (*target, error) {
+	if tc.Name == "" || tc.Host == "" {
+		return nil, fmt.Errorf("snmp target %q needs a name and a host", tc.Name+tc.Host)
+	}
+	if tc.Port == 0 {
+		tc.Port = DefaultPort
+	}
+	if tc.Port < 1 || tc.Port > 65535 {
+		return nil, fmt.Errorf("snmp target %s: port out of range: %d", tc.Name, tc.Port)
+	}
+	t := &target{
+		name:    tc.Name,
+		host:    tc.Host,
+		port:    uint16(tc.Port),
+		timeout: timeout,
+		retries: retries,
+	}
+	switch tc.Version {
+	case "", "2c":
+		if tc.Community == "" {
+			return nil, fmt.Errorf("snmp target %s: community is required for version 2c", tc.Name)
+		}
+		t.version = gosnmp.Version2c
+		t.community = tc.Community
+	case "3":
+		sp, flags, err := tc.User.securityParameters()
+		if err != nil {
+			return nil, fmt.Errorf("snmp target %s: %w", tc.Name, err)
+		}
+		t.version = gosnmp.Version3
+		t.params, t.flags = sp, flags
+	default:
+		return nil, fmt.Errorf("snmp target %s: version must be 2c or 3: %q", tc.Name, tc.Version)
+	}
+
+	if len(tc.Objects) == 0 {
+		return nil, fmt.Errorf("snmp target %s: object list is empty", tc.Name)
+	}
+	names := make(map[string]bool, len(tc.Objects))
+	for _, o := range tc.Objects {
+		if o.Name == "" || o.OID == "" {
+			return nil, fmt.Errorf("snmp target %s: object %q needs a name and an oid", tc.Name, o.Name+o.OID)
+		}
+		if names[o.Name] {
+			return nil, fmt.Errorf("snmp target %s: object %s is defined twice", tc.Name, o.Name)
+		}
+		names[o.Name] = true
+		oid, err := ParseOID(o.OID)
+		if err != nil {
+			return nil, fmt.Errorf("snmp target %s: object %s: %w", tc.Name, o.Name, err)
+		}
+		if len(oid) < 2 {
+			return nil, fmt.Errorf("snmp target %s: object %s: oid %s is too short", tc.Name, o.Name, o.OID)
+		}
+		scale := o.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		t.objects = append(t.objects, object{name: o.Name, oid: oid, id: oid.String()[1:], walk: o.Walk, scale: scale, unit: o.Unit})
+	}
+	return t, nil
+}
+
+// connect returns a new client for the target. SNMPv3 clients discover the
+// engine ID and time of the agent with their first request.
+func (t *target) connect(ctx context.Context) (*gosnmp.GoSNMP, error) {
+	x := &gosnmp.GoSNMP{
+		Target:    t.host,
+		Port:      t.port,
+		Transport: "udp",
+		Community: t.community,
+		Version:   t.version,
+		Context:   ctx,
+		Timeout:   t.timeout,
+		Retries:   t.retries,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if t.version == gosnmp.Version3 {
+		x.SecurityModel = gosnmp.UserSecurityModel
+		x.MsgFlags = t.flags
+		x.SecurityParameters = t.params.Copy()
+	}
+	if err := x.Connect(); err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", x.Target, err)
+	}
+	return x, nil
+}
+
+// poll reads every object of the target in configuration order. An object
+// the agent does not have is skipped; any other error, such as a timeout,
+// ends the poll and is returned as the last error with connected false.
+func (t *target) poll(ctx context.Context) (values []utils.SNMPValue, errs []error, connected bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == nil {
+		x, err := t.connect(ctx)
+		if err != nil {
+			return nil, []error{err}, false
+		}
+		t.client = x
+	}
+	t.client.Context = ctx
+
+	for _, o := range t.objects {
+		vs, err := t.read(t.client, o)
+		values = append(values, vs...)
+		if err == nil {
+			continue
+		}
+		var objErr *objectError
+		if errors.As(err, &objErr) {
+			errs = append(errs, fmt.Errorf("object %s: %w", o.name, err))
+			continue
+		}
+		// The next poll starts over with a new socket and, for SNMPv3, a
+		// new engine discovery, in case the agent restarted.
+		_ = t.client.Conn.Close()
+		t.client = nil
+		return values, append(errs, fmt.Errorf("object %s: %w", o.name, err)), false
+	}
+	return values, errs, true
+}
+
+// objectError is an answer of the agent without a value for an object,
+// such as noSuchObject.
+type objectError struct {
+	msg string
+}
+
+func (e *objectError) Error() string {
+	return e.msg
+}
+
+func (t *target) read(x *gosnmp.GoSNMP, o object) ([]utils.SNMPValue, error) {
+	if !o.walk {
+		pkt, err := x.Get([]string{o.oid.String()})
+		if err != nil {
+			return nil, err
+		}
+		if pkt.Error != gosnmp.NoError {
+			return nil, &objectError{fmt.Sprintf("agent returned %s", pkt.Error)}
+		}
+		if len(pkt.Variables) != 1 {
+			return nil, fmt.Errorf("agent returned %d values for 1 oid", len(pkt.Variables))
+		}
+		pdu := pkt.Variables[0]
+		switch pdu.Type {
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+			return nil, &objectError{fmt.Sprintf("%s: %s", o.id, pdu.Type)}
+		}
+		return []utils.SNMPValue{t.value(o, o.name, pdu)}, nil
+	}
+
+	var values []utils.SNMPValue
+	err := x.BulkWalk(o.oid.String(), func(pdu gosnmp.SnmpPDU) error {
+		switch pdu.Type {
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+			return nil
+		}
+		oid, err := ParseOID(pdu.Name)
+		if err != nil || !oid.HasPrefix(o.oid) || len(oid) == len(o.oid) {
+			return nil
+		}
+		if len(values) == maxWalkValues {
+			return errWalkLimit
+		}
+		values = append(values, t.value(o, o.name+"."+oid[len(o.oid):].String()[1:], pdu))
+		return nil
+	})
+	if errors.Is(err, errWalkLimit) {
+		return values, &objectError{fmt.Sprintf("more than %d instances, kept the first ones", maxWalkValues)}
+	}
+	if err != nil {
+		return values, err
+	}
+	if len(values) == 0 {
+		return nil, &objectError{"no instances below " + o.id}
+	}
+	return values, nil
+}
+
+// value converts a variable binding. Numbers, including numeric strings
+// such as "230.5", are scaled into Value; strings, OIDs and addresses are
+// in Text, binary strings as colon separated hex.
+func (t *target) value(o object, name string, pdu gosnmp.SnmpPDU) utils.SNMPValue {
+	v := utils.SNMPValue{
+		Target: t.name,
+		Name:   name,
+		OID:    strings.TrimPrefix(pdu.Name, "."),
+		Type:   pdu.Type.String(),
+		Unit:   o.unit,
+	}
+	switch val := pdu.Value.(type) {
+	case int:
+		v.Value = float64(val) * o.scale
+	case uint:
+		v.Value = float64(val) * o.scale
+	case uint32:
+		v.Value = float64(val) * o.scale
+	case uint64:
+		v.Value = float64(val) * o.scale
+	case float32:
+		v.Value = float64(val) * o.scale
+	case float64:
+		v.Value = val * o.scale
+	case []byte:
+		v.Text = text(val)
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v.Text), 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			v.Value = f * o.scale
+		}
+	case string:
+		v.Text = strings.TrimPrefix(val, ".")
+	}
+	return v
+}
+
+// text returns printable strings as they are and anything else, such as a
+// MAC address, as colon separated hex.
+func text(b []byte) string {
+	s := strings.TrimRight(string(b), "\x00")
+	if utf8.ValidString(s) && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) && !unicode.IsSpace(r) }) < 0 {
+		return s
+	}
+	hex := make([]string, len(b))
+	for i, c := range b {
+		hex[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(hex, ":")
+}
+
+// Poll reads every target and returns the values in configuration order,
+// prefixed with the target name. connected reports whether every target
+// answered.
+func (p *Poller) Poll(ctx context.Context) (values []utils.SNMPValue, errs []error, connected bool) {
+	type result struct {
+		values    []utils.SNMPValue
+		errs      []error
+		connected bool
+	}
+	results := make([]result, len(p.targets))
+	var wg sync.WaitGroup
+	for i, t := range p.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &results[i]
+			r.values, r.errs, r.connected = t.poll(ctx)
+		}()
+	}
+	wg.Wait()
+
+	connected = true
+	for i, r := range results {
+		values = append(values, r.values...)
+		for _, err := range r.errs {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i].name, err))
+		}
+		connected = connected && r.connected
+	}
+	return values, errs, connected
+}
+
+// Collect polls the targets and stores the values in info.SNMP. Errors are
+// added to info.Errors.
+func (p *Poller) Collect(ctx context.Context, info *utils.SystemInfo) {
+	start := time.Now()
+	values, errs, connected := p.Poll(ctx)
+	var err error
+	if len(errs) > 0 {
+		err = errs[0]
+	}
+	p.mu.Lock()
+	p.status.Record(start, err)
+	p.status.Connected = connected
+	p.mu.Unlock()
+	info.SNMP = &utils.SNMPStats{Values: values}
+	for _, err := range errs {
+		info.Errors = append(info.Errors, "snmp: "+err.Error())
+	}
+	if len(errs) > 0 {
+		p.logger.Warn("snmp poll incomplete", zap.Int("values", len(values)), zap.Error(errs[0]))
+	}
+}
+
+// Status returns the state of the targets as seen by the last collections.
+// Connected is false when any target did not answer.
+func (p *Poller) Status() utils.IntegrationStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// Test reads the first object of every target with a new client, which
+// for SNMPv3 also checks the credentials, independent of collections.
+func (p *Poller) Test(ctx context.Context) error {
+	var errs []error
+	for _, t := range p.targets {
+		x, err := t.connect(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", t.name, err))
+			continue
+		}
+		o := t.objects[0]
+		if _, err := t.read(x, o); err != nil {
+			errs = append(errs, fmt.Errorf("target %s: object %s: %w", t.name, o.name, err))
+		}
+		_ = x.Conn.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases the sockets of the targets.
+func (p *Poller) Close() error {
+	for _, t := range p.targets {
+		t.mu.Lock()
+		if t.client != nil {
+			_ = t.client.Conn.Close()
+			t.client = nil
+		}
+		t.mu.Unlock()
+	}
+	return nil
+}
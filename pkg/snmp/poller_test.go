@@ -0,0 +1,167 @@
+package snmp
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func agentTarget(t *testing.T, a *Agent, tc Target) Target {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(a.Addr().String())
+	tc.Host = host
+	tc.Port, _ = strconv.Atoi(port)
+	return tc
+}
+
+func TestPollerV2cAndV3(t *testing.T) {
+	user := User{Name: "poller", AuthProtocol: "SHA256", AuthPassword: "auth-secret", PrivProtocol: "AES", PrivPassword: "priv-secret"}
+	a := newTestAgent(t, AgentConfig{Community: "edge", Users: []User{user}})
+	a.Update(testInfo())
+
+	objects := []Object{
+		{Name: "sys_name", OID: "1.3.6.1.2.1.1.5.0"},
+		{Name: "memory", OID: ".1.3.6.1.2.1.25.2.2.0", Scale: 1.0 / 1024, Unit: "MiB"},
+		{Name: "if_descr", OID: "1.3.6.1.2.1.2.2.1.2", Walk: true},
+		{Name: "if_mac", OID: "1.3.6.1.2.1.2.2.1.6.3"},
+		{Name: "missing", OID: "1.3.6.1.2.1.99.0"},
+	}
+	p, err := NewPoller(PollerConfig{
+		Timeout: time.Second,
+		Targets: []Target{
+			agentTarget(t, a, Target{Name: "switch", Community: "edge", Objects: objects}),
+			agentTarget(t, a, Target{Name: "ups", Version: "3", User: user, Objects: objects[:1]}),
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	defer p.Close()
+
+	// Two collections, the second reusing the sockets.
+	for range 2 {
+		info := &utils.SystemInfo{}
+		p.Collect(context.Background(), info)
+		if info.SNMP == nil {
+			t.Fatal("no snmp section")
+		}
+		got := make(map[string]utils.SNMPValue)
+		for _, v := range info.SNMP.Values {
+			got[v.Target+"/"+v.Name] = v
+		}
+		if len(got) != 6 {
+			t.Fatalf("values = %+v", info.SNMP.Values)
+		}
+		if v := got["switch/sys_name"]; v.Text != "gw-01" || v.Type != "OctetString" || v.OID != "1.3.6.1.2.1.1.5.0" {
+			t.Errorf("sys_name = %+v", v)
+		}
+		if v := got["switch/memory"]; v.Value != 4096 || v.Unit != "MiB" || v.Type != "Integer" {
+			t.Errorf("memory = %+v", v)
+		}
+		if v := got["switch/if_descr.3"]; v.Text != "eth0" || v.OID != "1.3.6.1.2.1.2.2.1.2.3" {
+			t.Errorf("if_descr.3 = %+v", v)
+		}
+		if v := got["switch/if_mac"]; v.Text != "dc:a6:32:01:02:03" {
+			t.Errorf("if_mac = %+v", v)
+		}
+		if v := got["ups/sys_name"]; v.Text != "gw-01" {
+			t.Errorf("ups sys_name = %+v", v)
+		}
+		if len(info.Errors) != 1 || !strings.Contains(info.Errors[0], "target switch: object missing: 1.3.6.1.2.1.99.0: NoSuchObject") {
+			t.Errorf("errors = %v", info.Errors)
+		}
+	}
+
+	status := p.Status()
+	if !status.Connected || status.Polls != 2 {
+		t.Errorf("status = %+v", status)
+	}
+	if err := p.Test(context.Background()); err != nil {
+		t.Errorf("Test: %v", err)
+	}
+}
+
+func TestPollerUnreachable(t *testing.T) {
+	a := newTestAgent(t, AgentConfig{Community: "edge"})
+	wrong := User{Name: "nobody", AuthProtocol: "SHA", AuthPassword: "not-a-user"}
+	p, err := NewPoller(PollerConfig{
+		Timeout: 200 * time.Millisecond,
+		Targets: []Target{
+			agentTarget(t, a, Target{Name: "good", Community: "edge", Objects: []Object{{Name: "contact", OID: "1.3.6.1.2.1.1.4.0"}}}),
+			agentTarget(t, a, Target{Name: "bad-community", Community: "public", Objects: []Object{{Name: "contact", OID: "1.3.6.1.2.1.1.4.0"}}}),
+			agentTarget(t, a, Target{Name: "bad-user", Version: "3", User: wrong, Objects: []Object{{Name: "contact", OID: "1.3.6.1.2.1.1.4.0"}}}),
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	defer p.Close()
+
+	info := &utils.SystemInfo{}
+	p.Collect(context.Background(), info)
+	if len(info.SNMP.Values) != 1 || info.SNMP.Values[0].Target != "good" {
+		t.Errorf("values = %+v", info.SNMP.Values)
+	}
+	if len(info.Errors) != 2 || !strings.HasPrefix(info.Errors[0], "snmp: target bad-community: object contact: ") ||
+		!strings.HasPrefix(info.Errors[1], "snmp: target bad-user: ") {
+		t.Errorf("errors = %q", info.Errors)
+	}
+	status := p.Status()
+	if status.Connected || status.FailedPolls != 1 || status.LastError == "" {
+		t.Errorf("status = %+v", status)
+	}
+	if err := p.Test(context.Background()); err == nil || strings.Contains(err.Error(), "target good") {
+		t.Errorf("Test = %v", err)
+	}
+}
+
+func TestNewPollerValidates(t *testing.T) {
+	obj := []Object{{Name: "a", OID: "1.3.6.1.2.1.1.5.0"}}
+	cases := map[string]PollerConfig{
+		"no targets":       {},
+		"no host":          {Targets: []Target{{Name: "a", Community: "c", Objects: obj}}},
+		"no community":     {Targets: []Target{{Name: "a", Host: "h", Objects: obj}}},
+		"version 1":        {Targets: []Target{{Name: "a", Host: "h", Version: "1", Community: "c", Objects: obj}}},
+		"weak user":        {Targets: []Target{{Name: "a", Host: "h", Version: "3", User: User{Name: "u", AuthProtocol: "SHA", AuthPassword: "short"}, Objects: obj}}},
+		"no objects":       {Targets: []Target{{Name: "a", Host: "h", Community: "c"}}},
+		"bad oid":          {Targets: []Target{{Name: "a", Host: "h", Community: "c", Objects: []Object{{Name: "a", OID: "1.3.x"}}}}},
+		"duplicate object": {Targets: []Target{{Name: "a", Host: "h", Community: "c", Objects: append(obj, obj...)}}},
+		"duplicate target": {Targets: []Target{{Name: "a", Host: "h", Community: "c", Objects: obj}, {Name: "a", Host: "h", Community: "c", Objects: obj}}},
+		"port":             {Targets: []Target{{Name: "a", Host: "h", Port: 70000, Community: "c", Objects: obj}}},
+	}
+	for name, cfg := range cases {
+		if _, err := NewPoller(cfg, nil); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestPollerValue(t *testing.T) {
+	tg := &target{name: "ups"}
+	o := object{scale: 0.1, unit: "V"}
+	cases := []struct {
+		pdu   gosnmp.SnmpPDU
+		value float64
+		text  string
+	}{
+		{gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 2305}, 230.5, ""},
+		{gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(10)}, 1, ""},
+		{gosnmp.SnmpPDU{Type: gosnmp.Gauge32, Value: uint(20)}, 2, ""},
+		{gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte(" 2305 ")}, 230.5, " 2305 "},
+		{gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte{0x00, 0x1b, 0xff}}, 0, "00:1b:ff"},
+		{gosnmp.SnmpPDU{Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.318"}, 0, "1.3.6.1.4.1.318"},
+		{gosnmp.SnmpPDU{Type: gosnmp.IPAddress, Value: "10.0.0.2"}, 0, "10.0.0.2"},
+	}
+	for _, c := range cases {
+		v := tg.value(o, "x", c.pdu)
+		if diff := v.Value - c.value; diff > 1e-9 || diff < -1e-9 || v.Text != c.text || v.Unit != "V" || v.Target != "ups" {
+			t.Errorf("value(%v %v) = %+v", c.pdu.Type, c.pdu.Value, v)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package snmp serves edgebeat metrics to SNMP managers and polls
+// neighbouring SNMP devices, such as switches and UPS units.
+package snmp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// minPasswordLen is the shortest USM password RFC 3414 allows.
+const minPasswordLen = 8
+
+// User is an SNMPv3 user of the user-based security model. AuthProtocol is
+// MD5, SHA, SHA224, SHA256, SHA384 or SHA512. PrivProtocol is DES, AES,
+// AES192, AES256, AES192C or AES256C; without it the user authenticates
+// but does not encrypt.
+type User struct {
+	Name         string
+	AuthProtocol string
+	AuthPassword string
+	PrivProtocol string
+	PrivPassword string
+}
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// securityParameters validates u and returns its USM parameters and the
+// message flags of its security level.
+func (u User) securityParameters() (*gosnmp.UsmSecurityParameters, gosnmp.SnmpV3MsgFlags, error) {
+	if u.Name == "" {
+		return nil, 0, fmt.Errorf("snmp user name is required")
+	}
+	auth, ok := authProtocols[strings.ToUpper(u.AuthProtocol)]
+	if !ok {
+		return nil, 0, fmt.Errorf("snmp user %s: auth_protocol must be MD5, SHA, SHA224, SHA256, SHA384 or SHA512: %q", u.Name, u.AuthProtocol)
+	}
+	if len(u.AuthPassword) < minPasswordLen {
+		return nil, 0, fmt.Errorf("snmp user %s: auth_password must have at least %d characters", u.Name, minPasswordLen)
+	}
+	sp := &gosnmp.UsmSecurityParameters{
+		UserName:                 u.Name,
+		AuthenticationProtocol:   auth,
+		AuthenticationPassphrase: u.AuthPassword,
+		PrivacyProtocol:          gosnmp.NoPriv,
+	}
+	if u.PrivProtocol == "" {
+		return sp, gosnmp.AuthNoPriv, nil
+	}
+	priv, ok := privProtocols[strings.ToUpper(u.PrivProtocol)]
+	if !ok {
+		return nil, 0, fmt.Errorf("snmp user %s: priv_protocol must be DES, AES, AES192, AES256, AES192C or AES256C: %q", u.Name, u.PrivProtocol)
+	}
+	if len(u.PrivPassword) < minPasswordLen {
+		return nil, 0, fmt.Errorf("snmp user %s: priv_password must have at least %d characters", u.Name, minPasswordLen)
+	}
+	sp.PrivacyProtocol = priv
+	sp.PrivacyPassphrase = u.PrivPassword
+	return sp, gosnmp.AuthPriv, nil
+}
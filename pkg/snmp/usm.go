@@ -0,0 +1,290 @@
+package snmp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"go.uber.org/zap"
+)
+
+// timeWindow is the number of seconds an authenticated message may be off
+// from the engine time (RFC 3414 section 3.2).
+const timeWindow = 150
+
+// maxBoots is the last snmpEngineBoots value. An engine that reaches it
+// keeps it until its engine ID is changed (RFC 3414 section 2.2.2).
+const maxBoots = 2147483647
+
+// usmStats are the usmStats counters reported back to managers.
+var usmStats = struct {
+	unsupportedSecLevels, notInTimeWindows, unknownUserNames, unknownEngineIDs, wrongDigests, decryptionErrors OID
+}{
+	mustOID("1.3.6.1.6.3.15.1.1.1.0"),
+	mustOID("1.3.6.1.6.3.15.1.1.2.0"),
+	mustOID("1.3.6.1.6.3.15.1.1.3.0"),
+	mustOID("1.3.6.1.6.3.15.1.1.4.0"),
+	mustOID("1.3.6.1.6.3.15.1.1.5.0"),
+	mustOID("1.3.6.1.6.3.15.1.1.6.0"),
+}
+
+// digestLengths are the lengths of msgAuthenticationParameters (RFC 3414
+// and RFC 7860).
+var digestLengths = map[gosnmp.SnmpV3AuthProtocol]int{
+	gosnmp.MD5:    12,
+	gosnmp.SHA:    12,
+	gosnmp.SHA224: 16,
+	gosnmp.SHA256: 24,
+	gosnmp.SHA384: 32,
+	gosnmp.SHA512: 48,
+}
+
+// usm is the authoritative engine of the user-based security model.
+// engineBoots counts the starts of the agent in a file, as a board without
+// a real-time clock cannot tell them apart by time.
+type usm struct {
+	engineID string
+	boots    uint32
+	start    time.Time
+	users    map[string]*usmUser
+	counters map[string]*atomic.Uint32
+}
+
+type usmUser struct {
+	// params hold the keys localized to the engine ID and the salt counter
+	// of encrypted responses.
+	params *gosnmp.UsmSecurityParameters
+	flags  gosnmp.SnmpV3MsgFlags
+}
+
+func newUSM(engineID, hostname string, users []User, bootsFile string, start time.Time) (*usm, error) {
+	id, err := parseEngineID(engineID, hostname)
+	if err != nil {
+		return nil, err
+	}
+	u := &usm{
+		engineID: id,
+		start:    start,
+		users:    make(map[string]*usmUser, len(users)),
+		counters: make(map[string]*atomic.Uint32),
+	}
+	for _, oid := range []OID{usmStats.unsupportedSecLevels, usmStats.notInTimeWindows, usmStats.unknownUserNames,
+		usmStats.unknownEngineIDs, usmStats.wrongDigests, usmStats.decryptionErrors} {
+		u.counters[oid.String()] = new(atomic.Uint32)
+	}
+	for _, user := range users {
+		sp, flags, err := user.securityParameters()
+		if err != nil {
+			return nil, err
+		}
+		if u.users[user.Name] != nil {
+			return nil, fmt.Errorf("snmp user %s is defined twice", user.Name)
+		}
+		sp.AuthoritativeEngineID = id
+		if err := sp.InitSecurityKeys(); err != nil {
+			return nil, fmt.Errorf("snmp user %s: %w", user.Name, err)
+		}
+		u.users[user.Name] = &usmUser{params: sp, flags: flags}
+	}
+	if u.boots, err = nextBoots(bootsFile); err != nil {
+		return nil, err
+	}
+	for _, user := range u.users {
+		user.params.AuthoritativeEngineBoots = u.boots
+	}
+	return u, nil
+}
+
+// nextBoots increments the snmpEngineBoots counter stored in path and
+// returns it. A missing file starts the count at 1.
+func nextBoots(path string) (uint32, error) {
+	if path == "" {
+		return 0, fmt.Errorf("snmp agent needs a boots file for SNMPv3 users")
+	}
+	var boots uint64
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if boots, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32); err != nil {
+			return 0, fmt.Errorf("snmp boots file %s: %w", path, err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return 0, fmt.Errorf("snmp boots file: %w", err)
+	}
+	boots = min(boots+1, maxBoots)
+
+	// The counter is replaced by a rename, so a crash leaves the old value.
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("snmp boots file: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(boots, 10)+"\n"), 0o644); err != nil {
+		return 0, fmt.Errorf("snmp boots file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("snmp boots file: %w", err)
+	}
+	return uint32(boots), nil
+}
+
+// parseEngineID decodes a configured hex engine ID, or derives a text
+// format ID (RFC 3411) from the host name under the net-snmp enterprise.
+func parseEngineID(s, hostname string) (string, error) {
+	if s == "" {
+		if hostname == "" {
+			hostname = "edgebeat"
+		}
+		return string([]byte{0x80, 0x00, 0x1f, 0x88, 0x04}) + hostname[:min(len(hostname), 27)], nil
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("snmp engine_id must be hex: %w", err)
+	}
+	if len(id) < 5 || len(id) > 32 {
+		return "", fmt.Errorf("snmp engine_id must have 5 to 32 octets, got %d", len(id))
+	}
+	return string(id), nil
+}
+
+// engineTime returns the seconds since the engine started.
+func (u *usm) engineTime(now time.Time) uint32 {
+	return uint32(now.Sub(u.start) / time.Second)
+}
+
+// handleV3 authenticates, decrypts and answers an SNMPv3 message. probe is
+// the message decoded without keys, which yields the header and security
+// parameters. Failures are reported as RFC 3414 describes, and only when
+// the manager asks for reports.
+func (a *Agent) handleV3(msg []byte, probe *gosnmp.SnmpPacket) []byte {
+	sp, ok := probe.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if probe.SecurityModel != gosnmp.UserSecurityModel || !ok {
+		return nil
+	}
+	u := a.usm
+	user := u.users[sp.UserName]
+	switch {
+	case sp.AuthoritativeEngineID != u.engineID:
+		// Engine discovery ends up here.
+		return a.report(probe, nil, usmStats.unknownEngineIDs)
+	case user == nil:
+		a.logger.Debug("snmp agent unknown user", zap.String("user", sp.UserName))
+		return a.report(probe, nil, usmStats.unknownUserNames)
+	case probe.MsgFlags&gosnmp.AuthPriv != user.flags:
+		return a.report(probe, nil, usmStats.unsupportedSecLevels)
+	case !user.authentic(msg, sp.AuthenticationParameters):
+		a.logger.Debug("snmp agent wrong digest", zap.String("user", sp.UserName))
+		return a.report(probe, nil, usmStats.wrongDigests)
+	case !u.inTimeWindow(sp, time.Now()):
+		return a.report(probe, user, usmStats.notInTimeWindows)
+	}
+
+	x := &gosnmp.GoSNMP{
+		Version:            gosnmp.Version3,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		MsgFlags:           probe.MsgFlags,
+		SecurityParameters: user.params,
+	}
+	req, err := x.UnmarshalTrap(slices.Clone(msg), true)
+	if err != nil {
+		return a.report(probe, nil, usmStats.decryptionErrors)
+	}
+	out := a.respond(req)
+	if out == nil {
+		return nil
+	}
+	if err := u.secure(out, req, user); err != nil {
+		a.logger.Debug("snmp agent secure response", zap.Error(err))
+		return nil
+	}
+	limit := maxMessageSize
+	if size := int(req.MsgMaxSize); size >= minMessageSize {
+		limit = min(size, limit)
+	}
+	return a.marshal(out, limit, req.PDUType == gosnmp.GetBulkRequest)
+}
+
+// authentic checks the HMAC of msg, computed with the digest field zeroed.
+func (user *usmUser) authentic(msg []byte, digest string) bool {
+	n := digestLengths[user.params.AuthenticationProtocol]
+	if len(digest) != n {
+		return false
+	}
+	field := append([]byte{byte(gosnmp.OctetString), byte(n)}, digest...)
+	i := bytes.Index(msg, field)
+	if i < 0 {
+		return false
+	}
+	zeroed := slices.Clone(msg)
+	clear(zeroed[i+2 : i+len(field)])
+	mac := hmac.New(user.params.AuthenticationProtocol.HashType().New, user.params.SecretKey)
+	mac.Write(zeroed)
+	return hmac.Equal(mac.Sum(nil)[:n], []byte(digest))
+}
+
+func (u *usm) inTimeWindow(sp *gosnmp.UsmSecurityParameters, now time.Time) bool {
+	diff := int64(sp.AuthoritativeEngineTime) - int64(u.engineTime(now))
+	return sp.AuthoritativeEngineBoots == u.boots && diff >= -timeWindow && diff <= timeWindow
+}
+
+// secure turns out into an SNMPv3 message for user at the security level
+// of req.
+func (u *usm) secure(out, req *gosnmp.SnmpPacket, user *usmUser) error {
+	sp := user.params.Copy().(*gosnmp.UsmSecurityParameters)
+	sp.AuthoritativeEngineTime = u.engineTime(time.Now())
+	out.Version = gosnmp.Version3
+	out.MsgFlags = req.MsgFlags &^ gosnmp.Reportable
+	out.SecurityModel = gosnmp.UserSecurityModel
+	out.SecurityParameters = sp
+	out.MsgID = req.MsgID
+	out.ContextEngineID = u.engineID
+	out.ContextName = req.ContextName
+	return user.params.InitPacket(out)
+}
+
+// report answers a failed message with the usmStats counter at stat.
+// Reports are authenticated with the keys of user when it is set, which
+// managers need to resynchronize their clock.
+func (a *Agent) report(req *gosnmp.SnmpPacket, user *usmUser, stat OID) []byte {
+	u := a.usm
+	count := u.counters[stat.String()].Add(1)
+	if req.MsgFlags&gosnmp.Reportable == 0 {
+		return nil
+	}
+	out := &gosnmp.SnmpPacket{
+		Version:         gosnmp.Version3,
+		MsgFlags:        gosnmp.NoAuthNoPriv,
+		SecurityModel:   gosnmp.UserSecurityModel,
+		MsgID:           req.MsgID,
+		ContextEngineID: u.engineID,
+		ContextName:     req.ContextName,
+		PDUType:         gosnmp.Report,
+		RequestID:       req.RequestID,
+		Variables:       []gosnmp.SnmpPDU{{Name: stat.String(), Type: gosnmp.Counter32, Value: count}},
+	}
+	sp := &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID:    u.engineID,
+		AuthoritativeEngineBoots: u.boots,
+		AuthoritativeEngineTime:  u.engineTime(time.Now()),
+		UserName:                 req.SecurityParameters.(*gosnmp.UsmSecurityParameters).UserName,
+		AuthenticationProtocol:   gosnmp.NoAuth,
+		PrivacyProtocol:          gosnmp.NoPriv,
+	}
+	if user != nil {
+		sp = user.params.Copy().(*gosnmp.UsmSecurityParameters)
+		sp.AuthoritativeEngineTime = u.engineTime(time.Now())
+		out.MsgFlags = gosnmp.AuthNoPriv
+	}
+	out.SecurityParameters = sp
+	return a.marshal(out, maxMessageSize, false)
+}
@@ -0,0 +1,83 @@
+package sparkplug
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// FromSystemInfo flattens a snapshot into node metrics. Names use "/" as the
+// folder separator so SCADA hosts show them grouped by section.
+func FromSystemInfo(info utils.SystemInfo) []Metric {
+	metrics := []Metric{
+		String("Properties/Hostname", info.Host.Hostname),
+		String("Properties/OS", info.Host.OS),
+		String("Properties/Platform", info.Host.Platform),
+		String("Properties/PlatformVersion", info.Host.PlatformVersion),
+		String("Properties/KernelVersion", info.Host.KernelVersion),
+		String("Properties/KernelArch", info.Host.KernelArch),
+		UInt64("Host/UptimeSeconds", info.Host.UptimeSeconds),
+		UInt64("Host/BootTime", info.Host.BootTime),
+		UInt64("Host/Procs", info.Host.Procs),
+
+		Double("CPU/TotalPercent", info.CPU.TotalPercent),
+	}
+
+	for i, pct := range info.CPU.PerCPUPercent {
+		metrics = append(metrics, Double("CPU/Core"+strconv.Itoa(i)+"/Percent", pct))
+	}
+
+	metrics = append(metrics,
+		Double("Load/Load1", info.Load.Load1),
+		Double("Load/Load5", info.Load.Load5),
+		Double("Load/Load15", info.Load.Load15),
+
+		UInt64("Memory/Virtual/Total", info.Memory.Virtual.Total),
+		UInt64("Memory/Virtual/Available", info.Memory.Virtual.Available),
+		UInt64("Memory/Virtual/Used", info.Memory.Virtual.Used),
+		Double("Memory/Virtual/UsedPercent", info.Memory.Virtual.UsedPercent),
+		UInt64("Memory/Swap/Total", info.Memory.Swap.Total),
+		UInt64("Memory/Swap/Used", info.Memory.Swap.Used),
+		Double("Memory/Swap/UsedPercent", info.Memory.Swap.UsedPercent),
+	)
+
+	for _, u := range info.Disk.Usage {
+		prefix := "Disk/" + mountName(u.Mountpoint) + "/"
+		metrics = append(metrics,
+			UInt64(prefix+"Total", u.Total),
+			UInt64(prefix+"Used", u.Used),
+			UInt64(prefix+"Free", u.Free),
+			Double(prefix+"UsedPercent", u.UsedPercent),
+		)
+	}
+
+	metrics = append(metrics,
+		UInt64("Network/BytesSent", info.Network.Totals.BytesSent),
+		UInt64("Network/BytesRecv", info.Network.Totals.BytesRecv),
+		UInt64("Network/PacketsSent", info.Network.Totals.PacketsSent),
+		UInt64("Network/PacketsRecv", info.Network.Totals.PacketsRecv),
+		UInt64("Network/ErrIn", info.Network.Totals.Errin),
+		UInt64("Network/ErrOut", info.Network.Totals.Errout),
+		UInt64("Network/DropIn", info.Network.Totals.Dropin),
+		UInt64("Network/DropOut", info.Network.Totals.Dropout),
+	)
+
+	for _, t := range info.Sensors.Temperatures {
+		metrics = append(metrics, Double("Sensors/"+t.SensorKey+"/Temperature", t.Value))
+	}
+	for _, r := range info.Sensors.Readings {
+		metrics = append(metrics, Double("Sensors/"+r.SensorKey+"/"+r.Type, r.Value))
+	}
+
+	return metrics
+}
+
+// mountName turns a mountpoint into a single metric path segment.
+func mountName(mountpoint string) string {
+	name := strings.Trim(mountpoint, "/\\")
+	if name == "" {
+		return "root"
+	}
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "").Replace(name)
+}
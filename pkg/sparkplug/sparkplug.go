@@ -0,0 +1,244 @@
+// Package sparkplug encodes Eclipse Sparkplug B payloads.
+//
+// Only the subset of the specification that edgebeat needs is implemented:
+// scalar metrics on node-level NBIRTH, NDATA, NDEATH and NCMD messages.
+package sparkplug
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Namespace is the topic namespace for Sparkplug B.
+const Namespace = "spBv1.0"
+
+// Node level message types.
+const (
+	NBIRTH = "NBIRTH"
+	NDEATH = "NDEATH"
+	NDATA  = "NDATA"
+	NCMD   = "NCMD"
+)
+
+// Well known node metric names.
+const (
+	MetricBdSeq   = "bdSeq"
+	MetricRebirth = "Node Control/Rebirth"
+)
+
+// DataType is the Sparkplug B metric data type.
+type DataType uint32
+
+const (
+	TypeUnknown DataType = 0
+	TypeInt8    DataType = 1
+	TypeInt16   DataType = 2
+	TypeInt32   DataType = 3
+	TypeInt64   DataType = 4
+	TypeUInt8   DataType = 5
+	TypeUInt16  DataType = 6
+	TypeUInt32  DataType = 7
+	TypeUInt64  DataType = 8
+	TypeFloat   DataType = 9
+	TypeDouble  DataType = 10
+	TypeBoolean DataType = 11
+	TypeString  DataType = 12
+)
+
+// Protobuf field numbers from sparkplug_b.proto.
+const (
+	payloadTimestamp protowire.Number = 1
+	payloadMetrics   protowire.Number = 2
+	payloadSeq       protowire.Number = 3
+
+	metricName         protowire.Number = 1
+	metricTimestamp    protowire.Number = 3
+	metricDatatype     protowire.Number = 4
+	metricIsNull       protowire.Number = 7
+	metricIntValue     protowire.Number = 10
+	metricLongValue    protowire.Number = 11
+	metricFloatValue   protowire.Number = 12
+	metricDoubleValue  protowire.Number = 13
+	metricBooleanValue protowire.Number = 14
+	metricStringValue  protowire.Number = 15
+)
+
+// Metric is a single named value. Value holds an int64, uint64, float64,
+// bool or string matching DataType; nil encodes as a null metric.
+type Metric struct {
+	Name      string
+	Timestamp uint64
+	DataType  DataType
+	Value     any
+}
+
+// Payload is a Sparkplug B payload.
+type Payload struct {
+	Timestamp uint64
+	Seq       uint64
+	Metrics   []Metric
+}
+
+// Topic builds a node level topic, e.g. spBv1.0/group/NDATA/node.
+func Topic(groupID, messageType, edgeNodeID string) string {
+	return Namespace + "/" + groupID + "/" + messageType + "/" + edgeNodeID
+}
+
+func Double(name string, v float64) Metric {
+	return Metric{Name: name, DataType: TypeDouble, Value: v}
+}
+
+func UInt64(name string, v uint64) Metric {
+	return Metric{Name: name, DataType: TypeUInt64, Value: v}
+}
+
+func Int64(name string, v int64) Metric {
+	return Metric{Name: name, DataType: TypeInt64, Value: v}
+}
+
+func Boolean(name string, v bool) Metric {
+	return Metric{Name: name, DataType: TypeBoolean, Value: v}
+}
+
+func String(name string, v string) Metric {
+	return Metric{Name: name, DataType: TypeString, Value: v}
+}
+
+// Marshal encodes the payload in protobuf wire format.
+func (p Payload) Marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, payloadTimestamp, protowire.VarintType)
+	b = protowire.AppendVarint(b, p.Timestamp)
+	for _, m := range p.Metrics {
+		b = protowire.AppendTag(b, payloadMetrics, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.marshal())
+	}
+	b = protowire.AppendTag(b, payloadSeq, protowire.VarintType)
+	b = protowire.AppendVarint(b, p.Seq)
+	return b
+}
+
+func (m Metric) marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, metricName, protowire.BytesType)
+	b = protowire.AppendString(b, m.Name)
+	if m.Timestamp != 0 {
+		b = protowire.AppendTag(b, metricTimestamp, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.Timestamp)
+	}
+	b = protowire.AppendTag(b, metricDatatype, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(m.DataType))
+
+	switch v := m.Value.(type) {
+	case nil:
+		b = protowire.AppendTag(b, metricIsNull, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	case int64:
+		b = protowire.AppendTag(b, metricLongValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case uint64:
+		b = protowire.AppendTag(b, metricLongValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, v)
+	case float64:
+		b = protowire.AppendTag(b, metricDoubleValue, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case bool:
+		b = protowire.AppendTag(b, metricBooleanValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case string:
+		b = protowire.AppendTag(b, metricStringValue, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	}
+	return b
+}
+
+// Unmarshal decodes a payload. Fields edgebeat does not use are skipped.
+func Unmarshal(b []byte) (Payload, error) {
+	var p Payload
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return Payload{}, fmt.Errorf("sparkplug payload: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch {
+		case num == payloadTimestamp && typ == protowire.VarintType:
+			p.Timestamp, n = protowire.ConsumeVarint(b)
+		case num == payloadSeq && typ == protowire.VarintType:
+			p.Seq, n = protowire.ConsumeVarint(b)
+		case num == payloadMetrics && typ == protowire.BytesType:
+			var raw []byte
+			raw, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				m, err := unmarshalMetric(raw)
+				if err != nil {
+					return Payload{}, err
+				}
+				p.Metrics = append(p.Metrics, m)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return Payload{}, fmt.Errorf("sparkplug payload: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return p, nil
+}
+
+func unmarshalMetric(b []byte) (Metric, error) {
+	var m Metric
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return Metric{}, fmt.Errorf("sparkplug metric: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v uint64
+		switch {
+		case num == metricName && typ == protowire.BytesType:
+			m.Name, n = protowire.ConsumeString(b)
+		case num == metricTimestamp && typ == protowire.VarintType:
+			m.Timestamp, n = protowire.ConsumeVarint(b)
+		case num == metricDatatype && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.DataType = DataType(v)
+		case num == metricIntValue && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.Value = uint64(uint32(v))
+		case num == metricLongValue && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.Value = v
+		case num == metricFloatValue && typ == protowire.Fixed32Type:
+			var f uint32
+			f, n = protowire.ConsumeFixed32(b)
+			m.Value = float64(math.Float32frombits(f))
+		case num == metricDoubleValue && typ == protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+			m.Value = math.Float64frombits(v)
+		case num == metricBooleanValue && typ == protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+			m.Value = protowire.DecodeBool(v)
+		case num == metricStringValue && typ == protowire.BytesType:
+			m.Value, n = protowire.ConsumeString(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return Metric{}, fmt.Errorf("sparkplug metric: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+
+	if m.DataType == TypeInt64 {
+		if v, ok := m.Value.(uint64); ok {
+			m.Value = int64(v)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,89 @@
+package sparkplug
+
+import (
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func TestTopic(t *testing.T) {
+	if got := Topic("plant", NDATA, "edge-01"); got != "spBv1.0/plant/NDATA/edge-01" {
+		t.Fatalf("Topic = %q", got)
+	}
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	in := Payload{
+		Timestamp: 1700000000000,
+		Seq:       42,
+		Metrics: []Metric{
+			Double("CPU/TotalPercent", 12.5),
+			UInt64("Memory/Virtual/Total", 1<<33),
+			Int64(MetricBdSeq, 7),
+			Boolean(MetricRebirth, true),
+			String("Properties/Hostname", "edge-01"),
+			{Name: "Missing", DataType: TypeDouble},
+		},
+	}
+	in.Metrics[0].Timestamp = 1700000000001
+
+	out, err := Unmarshal(in.Marshal())
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if out.Timestamp != in.Timestamp || out.Seq != in.Seq || len(out.Metrics) != len(in.Metrics) {
+		t.Fatalf("payload = %+v", out)
+	}
+	for i, m := range in.Metrics {
+		if out.Metrics[i] != m {
+			t.Fatalf("metric %d = %+v, want %+v", i, out.Metrics[i], m)
+		}
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	data := Payload{Metrics: []Metric{String("a", "b")}}.Marshal()
+	if _, err := Unmarshal(data[:len(data)-4]); err == nil {
+		t.Fatal("expected error for truncated payload")
+	}
+}
+
+func TestFromSystemInfo(t *testing.T) {
+	info := utils.SystemInfo{
+		CPU:  utils.CPUStats{TotalPercent: 50, PerCPUPercent: []float64{40, 60}},
+		Disk: utils.DiskStats{Usage: []utils.DiskUsage{{Mountpoint: "/", UsedPercent: 10}, {Mountpoint: "/var/log", UsedPercent: 20}}},
+		Host: utils.HostStats{Hostname: "edge-01", UptimeSeconds: 99},
+		Sensors: utils.SensorsStats{
+			Temperatures: []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48.5}},
+			Readings:     []utils.SensorReading{{SensorKey: "bme280_humidity", Type: "humidityrelative", Value: 41.5, Unit: "%"}},
+		},
+	}
+
+	byName := make(map[string]Metric)
+	for _, m := range FromSystemInfo(info) {
+		if _, dup := byName[m.Name]; dup {
+			t.Fatalf("duplicate metric %q", m.Name)
+		}
+		byName[m.Name] = m
+	}
+
+	checks := map[string]any{
+		"CPU/TotalPercent":                         50.0,
+		"CPU/Core1/Percent":                        60.0,
+		"Disk/root/UsedPercent":                    10.0,
+		"Disk/var_log/UsedPercent":                 20.0,
+		"Host/UptimeSeconds":                       uint64(99),
+		"Properties/Hostname":                      "edge-01",
+		"Sensors/cpu_thermal/Temperature":          48.5,
+		"Sensors/bme280_humidity/humidityrelative": 41.5,
+	}
+	for name, want := range checks {
+		m, ok := byName[name]
+		if !ok {
+			t.Fatalf("metric %q missing", name)
+		}
+		if m.Value != want {
+			t.Fatalf("metric %q = %v, want %v", name, m.Value, want)
+		}
+	}
+}
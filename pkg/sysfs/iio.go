@@ -0,0 +1,227 @@
+package sysfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// iioUnits are the units of IIO channel types after scaling, as defined by
+// the sysfs-bus-iio ABI. Temperatures and relative humidity are converted
+// from milli units to °C and %.
+var iioUnits = map[string]string{
+	"humidityrelative": "%",
+	"pressure":         "kPa",
+	"voltage":          "mV",
+	"current":          "mA",
+	"power":            "mW",
+	"resistance":       "ohm",
+	"illuminance":      "lx",
+	"concentration":    "%",
+}
+
+// IIOSensor names one channel of an IIO device.
+type IIOSensor struct {
+	Name string
+	// Device is the name attribute of the device, such as bme280, or its
+	// directory, such as iio:device0. Device numbers can change between
+	// boots, names do not.
+	Device string
+	// Channel is the attribute name between in_ and _raw or _input, such as
+	// temp, humidityrelative, pressure or voltage0.
+	Channel string
+}
+
+type IIOConfig struct {
+	Root string
+	// Sensors are the channels to read. Without sensors every channel of
+	// every device is read and named <device>_<channel>.
+	Sensors []IIOSensor
+}
+
+// IIOCollector adds the channels of IIO devices to the snapshot sensors:
+// temperatures to the temperatures, other values to the readings.
+type IIOCollector struct {
+	dir     string
+	sensors []IIOSensor
+}
+
+// NewIIOCollector validates cfg.
+func NewIIOCollector(cfg IIOConfig) (*IIOCollector, error) {
+	if cfg.Root == "" {
+		cfg.Root = DefaultRoot
+	}
+	names := make([]string, len(cfg.Sensors))
+	for i, s := range cfg.Sensors {
+		if s.Name != "" && (s.Device == "" || s.Channel == "") {
+			return nil, fmt.Errorf("iio sensor %s needs a device and a channel", s.Name)
+		}
+		names[i] = s.Name
+	}
+	if err := checkNames(names); err != nil {
+		return nil, fmt.Errorf("iio: %w", err)
+	}
+	return &IIOCollector{
+		dir:     filepath.Join(cfg.Root, "bus", "iio", "devices"),
+		sensors: cfg.Sensors,
+	}, nil
+}
+
+// Collect appends every sensor that could be read. The others are reported
+// in info.Errors.
+func (c *IIOCollector) Collect(ctx context.Context, info *utils.SystemInfo) {
+	devices, err := c.devices()
+	if err != nil {
+		info.Errors = append(info.Errors, "iio: "+err.Error())
+		return
+	}
+	sensors := c.sensors
+	if len(sensors) == 0 {
+		sensors = discover(devices)
+	}
+	for _, s := range sensors {
+		dir, ok := devices[s.Device]
+		if !ok {
+			info.Errors = append(info.Errors, fmt.Sprintf("iio: sensor %s: device %s not found", s.Name, s.Device))
+			continue
+		}
+		value, err := readChannel(dir, s.Channel)
+		if err != nil {
+			info.Errors = append(info.Errors, fmt.Sprintf("iio: sensor %s: %v", s.Name, err))
+			continue
+		}
+		switch typ := channelType(s.Channel); typ {
+		case "temp":
+			info.Sensors.Temperatures = append(info.Sensors.Temperatures, utils.Temperature{SensorKey: s.Name, Value: value / 1000})
+		case "humidityrelative":
+			value /= 1000
+			fallthrough
+		default:
+			info.Sensors.Readings = append(info.Sensors.Readings, utils.SensorReading{
+				SensorKey: s.Name,
+				Type:      typ,
+				Value:     value,
+				Unit:      iioUnits[typ],
+			})
+		}
+	}
+}
+
+// devices maps device directories and device names to the directory. When
+// two devices share a name, the name refers to the first.
+func (c *IIOCollector) devices() (map[string]string, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string]string, 2*len(entries))
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "iio:device") {
+			continue
+		}
+		dir := filepath.Join(c.dir, e.Name())
+		devices[e.Name()] = dir
+		data, err := os.ReadFile(filepath.Join(dir, "name"))
+		if name := strings.TrimSpace(string(data)); err == nil && name != "" {
+			if _, ok := devices[name]; !ok {
+				devices[name] = dir
+			}
+		}
+	}
+	return devices, nil
+}
+
+// discover lists the input channels of all devices, named after the device
+// name where it has one.
+func discover(devices map[string]string) []IIOSensor {
+	var sensors []IIOSensor
+	for device, dir := range devices {
+		if !strings.HasPrefix(device, "iio:device") {
+			continue
+		}
+		prefix := device
+		data, err := os.ReadFile(filepath.Join(dir, "name"))
+		if name := strings.TrimSpace(string(data)); err == nil && name != "" {
+			prefix = name
+		}
+		for _, channel := range channels(dir) {
+			sensors = append(sensors, IIOSensor{Name: prefix + "_" + channel, Device: device, Channel: channel})
+		}
+	}
+	slices.SortFunc(sensors, func(a, b IIOSensor) int { return strings.Compare(a.Name, b.Name) })
+	return sensors
+}
+
+// channels returns the input channels of a device directory.
+func channels(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var channels []string
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), "in_")
+		if !ok {
+			continue
+		}
+		channel, ok := strings.CutSuffix(name, "_raw")
+		if !ok {
+			channel, ok = strings.CutSuffix(name, "_input")
+		}
+		if ok && channel != "" && !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// readChannel returns a channel value in the units of the IIO ABI: the
+// processed _input attribute when the driver has one, else
+// (_raw + _offset) * _scale.
+func readChannel(dir, channel string) (float64, error) {
+	prefix := filepath.Join(dir, "in_"+channel)
+	if v, err := readFloat(prefix + "_input"); !errors.Is(err, fs.ErrNotExist) {
+		return v, err
+	}
+	raw, err := readFloat(prefix + "_raw")
+	if err != nil {
+		return 0, err
+	}
+	offset, err := channelAttr(dir, channel, "offset", 0)
+	if err != nil {
+		return 0, err
+	}
+	scale, err := channelAttr(dir, channel, "scale", 1)
+	if err != nil {
+		return 0, err
+	}
+	return (raw + offset) * scale, nil
+}
+
+// channelAttr reads the offset or scale of a channel. Drivers may share it
+// by all channels of a type, such as in_voltage_scale for in_voltage0_raw.
+func channelAttr(dir, channel, attr string, def float64) (float64, error) {
+	for _, ch := range []string{channel, channelType(channel)} {
+		v, err := readFloat(filepath.Join(dir, "in_"+ch+"_"+attr))
+		if !errors.Is(err, fs.ErrNotExist) {
+			return v, err
+		}
+	}
+	return def, nil
+}
+
+// channelType strips the index and modifiers of a channel, such as voltage
+// for voltage0 or temp for temp_ambient.
+func channelType(channel string) string {
+	if i := strings.IndexFunc(channel, func(r rune) bool { return r < 'a' || r > 'z' }); i >= 0 {
+		return channel[:i]
+	}
+	return channel
+}
@@ -0,0 +1,121 @@
+package sysfs
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+func TestIIOCollector(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		// A BME280 reports processed values.
+		"bus/iio/devices/iio:device0/name":                                   "bme280\n",
+		"bus/iio/devices/iio:device0/in_temp_input":                          "23870\n",
+		"bus/iio/devices/iio:device0/in_humidityrelative_input":              "41523\n",
+		"bus/iio/devices/iio:device0/in_pressure_input":                      "101.325\n",
+		"bus/iio/devices/iio:device0/in_humidityrelative_oversampling_ratio": "1\n",
+		// An ADS1115 ADC has raw values and a shared scale, the unnamed device an
+		// offset.
+		"bus/iio/devices/iio:device1/name":                    "ads1115\n",
+		"bus/iio/devices/iio:device1/in_voltage0_raw":         "16000\n",
+		"bus/iio/devices/iio:device1/in_voltage0_scale":       "0.125000\n",
+		"bus/iio/devices/iio:device1/in_voltage1_raw":         "800\n",
+		"bus/iio/devices/iio:device1/in_voltage_scale":        "0.187500\n",
+		"bus/iio/devices/iio:device2/in_temp_raw":             "6000\n",
+		"bus/iio/devices/iio:device2/in_temp_offset":          "-4685\n",
+		"bus/iio/devices/iio:device2/in_temp_scale":           "10\n",
+		"bus/iio/devices/iio:device2/in_humidityrelative_raw": "bad\n",
+		"bus/iio/devices/trigger0/name":                       "sysfstrig0\n",
+	})
+
+	c, err := NewIIOCollector(IIOConfig{Root: root, Sensors: []IIOSensor{
+		{Name: "enclosure", Device: "bme280", Channel: "temp"},
+		{Name: "enclosure_humidity", Device: "bme280", Channel: "humidityrelative"},
+		{Name: "enclosure_pressure", Device: "bme280", Channel: "pressure"},
+		{Name: "supply", Device: "ads1115", Channel: "voltage0"},
+		{Name: "battery", Device: "iio:device1", Channel: "voltage1"},
+		{Name: "cabinet", Device: "iio:device2", Channel: "temp"},
+		{Name: "cabinet_humidity", Device: "iio:device2", Channel: "humidityrelative"},
+		{Name: "outdoor", Device: "sht31", Channel: "temp"},
+	}})
+	if err != nil {
+		t.Fatalf("NewIIOCollector: %v", err)
+	}
+	info := &utils.SystemInfo{}
+	c.Collect(context.Background(), info)
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	temps := info.Sensors.Temperatures
+	if len(temps) != 2 || temps[0].SensorKey != "enclosure" || !near(temps[0].Value, 23.87) ||
+		temps[1].SensorKey != "cabinet" || !near(temps[1].Value, 13.15) {
+		t.Fatalf("temperatures = %+v", temps)
+	}
+	want := []utils.SensorReading{
+		{SensorKey: "enclosure_humidity", Type: "humidityrelative", Value: 41.523, Unit: "%"},
+		{SensorKey: "enclosure_pressure", Type: "pressure", Value: 101.325, Unit: "kPa"},
+		{SensorKey: "supply", Type: "voltage", Value: 2000, Unit: "mV"},
+		{SensorKey: "battery", Type: "voltage", Value: 150, Unit: "mV"},
+	}
+	readings := info.Sensors.Readings
+	if len(readings) != len(want) {
+		t.Fatalf("readings = %+v", readings)
+	}
+	for i, r := range readings {
+		if r.SensorKey != want[i].SensorKey || r.Type != want[i].Type || r.Unit != want[i].Unit || !near(r.Value, want[i].Value) {
+			t.Errorf("reading %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+	if len(info.Errors) != 2 || !strings.HasPrefix(info.Errors[0], "iio: sensor cabinet_humidity: read ") ||
+		info.Errors[1] != "iio: sensor outdoor: device sht31 not found" {
+		t.Fatalf("errors = %v", info.Errors)
+	}
+
+	// Without sensors every input channel is read.
+	c, _ = NewIIOCollector(IIOConfig{Root: root})
+	info = &utils.SystemInfo{}
+	c.Collect(context.Background(), info)
+	var keys []string
+	for _, temp := range info.Sensors.Temperatures {
+		keys = append(keys, temp.SensorKey)
+	}
+	for _, r := range info.Sensors.Readings {
+		keys = append(keys, r.SensorKey)
+	}
+	if got := strings.Join(keys, " "); got != "bme280_temp iio:device2_temp ads1115_voltage0 ads1115_voltage1 bme280_humidityrelative bme280_pressure" {
+		t.Errorf("discovered = %s", got)
+	}
+	if len(info.Errors) != 1 || !strings.HasPrefix(info.Errors[0], "iio: sensor iio:device2_humidityrelative: ") {
+		t.Errorf("errors = %v", info.Errors)
+	}
+}
+
+func TestChannelType(t *testing.T) {
+	for channel, want := range map[string]string{
+		"temp":              "temp",
+		"temp_ambient":      "temp",
+		"voltage0":          "voltage",
+		"voltage0-voltage1": "voltage",
+		"humidityrelative":  "humidityrelative",
+	} {
+		if got := channelType(channel); got != want {
+			t.Errorf("channelType(%q) = %q, want %q", channel, got, want)
+		}
+	}
+}
+
+func TestNewIIOCollectorValidates(t *testing.T) {
+	for name, sensors := range map[string][]IIOSensor{
+		"no name":    {{Device: "bme280", Channel: "temp"}},
+		"no device":  {{Name: "enclosure", Channel: "temp"}},
+		"no channel": {{Name: "enclosure", Device: "bme280"}},
+		"twice":      {{Name: "enclosure", Device: "bme280", Channel: "temp"}, {Name: "enclosure", Device: "bme280", Channel: "pressure"}},
+	} {
+		if _, err := NewIIOCollector(IIOConfig{Sensors: sensors}); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
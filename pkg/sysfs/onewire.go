@@ -0,0 +1,202 @@
+package sysfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// oneWireTimeout bounds a collection. A conversion takes at most 750 ms, so
+// a read that has not returned by then is hung, for example on a bus with a
+// shorted data line.
+const oneWireTimeout = time.Second
+
+// thermometerFamilies are the 1-Wire family codes the w1_therm driver reads:
+// DS18S20, DS1822, DS18B20, DS1825 and DS28EA00.
+var thermometerFamilies = []string{"10", "22", "28", "3b", "42"}
+
+// OneWireSensor names a thermometer by its device id, such as
+// 28-0316a2794aff.
+type OneWireSensor struct {
+	Name string
+	ID   string
+}
+
+type OneWireConfig struct {
+	Root string
+	// Sensors are the thermometers to read. Without sensors every
+	// thermometer on the bus is read and named by its device id.
+	Sensors []OneWireSensor
+}
+
+// OneWireCollector adds 1-Wire thermometers to the snapshot temperatures.
+// A reading starts a conversion, which takes up to 750 ms at the default
+// 12 bit resolution, so the sensors are read concurrently. A read of the
+// kernel attribute cannot be cancelled, so a sensor is not read again while
+// its previous read is still pending.
+type OneWireCollector struct {
+	dir     string
+	sensors []OneWireSensor
+	timeout time.Duration
+	// read reads one w1_slave attribute; tests replace it.
+	read func(path string) (float64, error)
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// NewOneWireCollector validates cfg.
+func NewOneWireCollector(cfg OneWireConfig) (*OneWireCollector, error) {
+	if cfg.Root == "" {
+		cfg.Root = DefaultRoot
+	}
+	names := make([]string, len(cfg.Sensors))
+	for i, s := range cfg.Sensors {
+		if s.Name != "" && s.ID == "" {
+			return nil, fmt.Errorf("onewire sensor %s has no device id", s.Name)
+		}
+		names[i] = s.Name
+	}
+	if err := checkNames(names); err != nil {
+		return nil, fmt.Errorf("onewire: %w", err)
+	}
+	return &OneWireCollector{
+		dir:     filepath.Join(cfg.Root, "bus", "w1", "devices"),
+		sensors: cfg.Sensors,
+		timeout: oneWireTimeout,
+		read:    readW1Slave,
+		pending: make(map[string]bool),
+	}, nil
+}
+
+// Collect appends a temperature for every sensor that could be read, in
+// sensor order. The others are reported in info.Errors, as are sensors
+// still converting after a second or when ctx is done.
+func (c *OneWireCollector) Collect(ctx context.Context, info *utils.SystemInfo) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	sensors := c.sensors
+	if len(sensors) == 0 {
+		var err error
+		if sensors, err = c.discover(); err != nil {
+			info.Errors = append(info.Errors, "onewire: "+err.Error())
+			return
+		}
+	}
+
+	type reading struct {
+		i     int
+		value float64
+		err   error
+	}
+	// The channel holds every reading, so reads that finish after ctx is
+	// done do not block.
+	readings := make(chan reading, len(sensors))
+	results := make([]*reading, len(sensors))
+	started := 0
+	for i, s := range sensors {
+		if !c.start(s.ID) {
+			results[i] = &reading{i: i, err: fmt.Errorf("previous read still pending")}
+			continue
+		}
+		started++
+		go func() {
+			defer c.finish(s.ID)
+			value, err := c.read(filepath.Join(c.dir, s.ID, "w1_slave"))
+			readings <- reading{i: i, value: value, err: err}
+		}()
+	}
+
+wait:
+	for range started {
+		select {
+		case r := <-readings:
+			results[r.i] = &r
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	for i, s := range sensors {
+		r := results[i]
+		switch {
+		case r == nil:
+			info.Errors = append(info.Errors, fmt.Sprintf("onewire: sensor %s: %v", s.Name, ctx.Err()))
+		case r.err != nil:
+			info.Errors = append(info.Errors, fmt.Sprintf("onewire: sensor %s: %v", s.Name, r.err))
+		default:
+			info.Sensors.Temperatures = append(info.Sensors.Temperatures, utils.Temperature{SensorKey: s.Name, Value: r.value})
+		}
+	}
+}
+
+// start marks a read of the sensor as pending and reports whether none was.
+func (c *OneWireCollector) start(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[id] {
+		return false
+	}
+	c.pending[id] = true
+	return true
+}
+
+func (c *OneWireCollector) finish(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// discover lists the thermometers on the bus.
+func (c *OneWireCollector) discover() ([]OneWireSensor, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	var sensors []OneWireSensor
+	for _, e := range entries {
+		family, _, ok := strings.Cut(e.Name(), "-")
+		if ok && slices.Contains(thermometerFamilies, strings.ToLower(family)) {
+			sensors = append(sensors, OneWireSensor{Name: e.Name(), ID: e.Name()})
+		}
+	}
+	return sensors, nil
+}
+
+// readW1Slave returns the temperature in °C from the w1_slave attribute:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+//
+// Readings that fail the CRC check, common on long cables, are rejected.
+func readW1Slave(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("incomplete reading: %q", data)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), "YES") {
+		return 0, fmt.Errorf("crc check failed: %q", lines[0])
+	}
+	_, t, ok := strings.Cut(lines[1], "t=")
+	if !ok {
+		return 0, fmt.Errorf("no temperature: %q", lines[1])
+	}
+	milli, err := strconv.Atoi(strings.TrimSpace(t))
+	if err != nil {
+		return 0, fmt.Errorf("bad temperature: %q", lines[1])
+	}
+	return float64(milli) / 1000, nil
+}
@@ -0,0 +1,135 @@
+package sysfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jilanisayyad/edgebeat/pkg/utils"
+)
+
+// writeTree creates files below root from paths relative to it.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+func TestOneWireCollector(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"bus/w1/devices/28-0316a2794aff/w1_slave": "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n",
+		"bus/w1/devices/28-0416a27a3bff/w1_slave": "fe ff 4b 46 7f ff 0c 10 1c : crc=1c YES\nfe ff 4b 46 7f ff 0c 10 1c t=-125\n",
+		"bus/w1/devices/28-0516a2806cff/w1_slave": "ff ff ff ff ff ff ff ff ff : crc=c9 NO\nff ff ff ff ff ff ff ff ff t=-62\n",
+		"bus/w1/devices/w1_bus_master1/uevent":    "",
+	})
+
+	c, err := NewOneWireCollector(OneWireConfig{Root: root, Sensors: []OneWireSensor{
+		{Name: "tank_inlet", ID: "28-0316a2794aff"},
+		{Name: "tank_outlet", ID: "28-0516a2806cff"},
+		{Name: "freezer", ID: "28-0416a27a3bff"},
+		{Name: "unplugged", ID: "28-0616a2811aff"},
+	}})
+	if err != nil {
+		t.Fatalf("NewOneWireCollector: %v", err)
+	}
+	info := &utils.SystemInfo{Sensors: utils.SensorsStats{Temperatures: []utils.Temperature{{SensorKey: "cpu_thermal", Value: 48.2}}}}
+	c.Collect(context.Background(), info)
+
+	temps := info.Sensors.Temperatures
+	if len(temps) != 3 || temps[1] != (utils.Temperature{SensorKey: "tank_inlet", Value: 23.125}) || temps[2] != (utils.Temperature{SensorKey: "freezer", Value: -0.125}) {
+		t.Fatalf("temperatures = %+v", temps)
+	}
+	if len(info.Errors) != 2 || !strings.HasPrefix(info.Errors[0], "onewire: sensor tank_outlet: crc check failed") ||
+		!strings.HasPrefix(info.Errors[1], "onewire: sensor unplugged: open ") {
+		t.Fatalf("errors = %v", info.Errors)
+	}
+
+	// Without sensors the thermometers are found on the bus.
+	c, _ = NewOneWireCollector(OneWireConfig{Root: root})
+	info = &utils.SystemInfo{}
+	c.Collect(context.Background(), info)
+	if temps := info.Sensors.Temperatures; len(temps) != 2 || temps[0].SensorKey != "28-0316a2794aff" || len(info.Errors) != 1 {
+		t.Fatalf("temperatures = %+v, errors = %v", temps, info.Errors)
+	}
+
+	c, _ = NewOneWireCollector(OneWireConfig{Root: t.TempDir()})
+	info = &utils.SystemInfo{}
+	c.Collect(context.Background(), info)
+	if len(info.Errors) != 1 || !strings.HasPrefix(info.Errors[0], "onewire: open ") {
+		t.Fatalf("errors = %v", info.Errors)
+	}
+}
+
+func TestOneWireCollectorConcurrent(t *testing.T) {
+	c, err := NewOneWireCollector(OneWireConfig{Sensors: []OneWireSensor{
+		{Name: "a", ID: "28-0316a2794aff"},
+		{Name: "stuck", ID: "28-0416a27a3bff"},
+		{Name: "b", ID: "28-0516a2806cff"},
+	}})
+	if err != nil {
+		t.Fatalf("NewOneWireCollector: %v", err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	var mu sync.Mutex
+	reads := make(map[string]int)
+	c.read = func(path string) (float64, error) {
+		mu.Lock()
+		reads[filepath.Base(filepath.Dir(path))]++
+		mu.Unlock()
+		if strings.Contains(path, "28-0416a27a3bff") {
+			<-release
+		}
+		time.Sleep(200 * time.Millisecond)
+		return 21.5, nil
+	}
+
+	// Both conversions finish within the timeout only when they overlap.
+	c.timeout = 350 * time.Millisecond
+	info := &utils.SystemInfo{}
+	c.Collect(context.Background(), info)
+
+	temps := info.Sensors.Temperatures
+	if len(temps) != 2 || temps[0].SensorKey != "a" || temps[1].SensorKey != "b" {
+		t.Fatalf("temperatures = %+v", temps)
+	}
+	if len(info.Errors) != 1 || info.Errors[0] != "onewire: sensor stuck: context deadline exceeded" {
+		t.Fatalf("errors = %v", info.Errors)
+	}
+
+	// The hung read is not started a second time.
+	info = &utils.SystemInfo{}
+	c.Collect(context.Background(), info)
+	if len(info.Sensors.Temperatures) != 2 || len(info.Errors) != 1 || info.Errors[0] != "onewire: sensor stuck: previous read still pending" {
+		t.Fatalf("temperatures = %+v, errors = %v", info.Sensors.Temperatures, info.Errors)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if reads["28-0416a27a3bff"] != 1 || reads["28-0316a2794aff"] != 2 {
+		t.Fatalf("reads = %v", reads)
+	}
+}
+
+func TestNewOneWireCollectorValidates(t *testing.T) {
+	for name, sensors := range map[string][]OneWireSensor{
+		"no name": {{ID: "28-0316a2794aff"}},
+		"no id":   {{Name: "tank_inlet"}},
+		"twice":   {{Name: "tank", ID: "28-0316a2794aff"}, {Name: "tank", ID: "28-0416a27a3bff"}},
+	} {
+		if _, err := NewOneWireCollector(OneWireConfig{Sensors: sensors}); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package sysfs reads sensors that the kernel exposes in sysfs but not as
+// hwmon devices, which host metrics already cover: 1-Wire thermometers and
+// IIO devices, such as I2C environmental sensors.
+package sysfs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultRoot is where sysfs is mounted. A container that bind-mounts the
+// host's sysfs elsewhere sets its own root.
+const DefaultRoot = "/sys"
+
+// readFloat reads an attribute holding one number.
+func readFloat(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// checkNames rejects sensors without a name and names used twice, since the
+// name is the sensor key in the snapshot.
+func checkNames(names []string) error {
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		if name == "" {
+			return fmt.Errorf("sensor %d has no name", i)
+		}
+		if seen[name] {
+			return fmt.Errorf("sensor %s is defined twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package syslog formats RFC 5424 syslog messages and frames them for the
+// transports defined in RFC 5426 (UDP) and RFC 6587 (TCP).
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severity is the RFC 5424 message severity, lower values are more severe.
+type Severity int
+
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Informational
+	Debug
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Facility returns the numeric facility for a name such as "daemon" or
+// "local0".
+func Facility(name string) (int, error) {
+	f, ok := facilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return f, nil
+}
+
+// Param is one SD-PARAM of a structured data element.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Element is one SD-ELEMENT. Custom IDs have the form name@<enterprise number>.
+type Element struct {
+	ID     string
+	Params []Param
+}
+
+// Message is one syslog message. Empty header fields are sent as the NILVALUE.
+type Message struct {
+	Facility  int
+	Severity  Severity
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	Data      []Element
+	Text      string
+}
+
+// Format renders m in the RFC 5424 syslog message format. Header fields are
+// reduced to printable ASCII and cut to their maximum length.
+func (m Message) Format() []byte {
+	var b strings.Builder
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(m.Facility*8 + int(m.Severity)))
+	b.WriteString(">1 ")
+	if m.Timestamp.IsZero() {
+		b.WriteByte('-')
+	} else {
+		b.WriteString(m.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00"))
+	}
+	for _, field := range []struct {
+		value string
+		max   int
+	}{{m.Hostname, 255}, {m.AppName, 48}, {m.ProcID, 128}, {m.MsgID, 32}} {
+		b.WriteByte(' ')
+		b.WriteString(headerField(field.value, field.max))
+	}
+
+	b.WriteByte(' ')
+	if len(m.Data) == 0 {
+		b.WriteByte('-')
+	}
+	for _, e := range m.Data {
+		b.WriteByte('[')
+		b.WriteString(sdName(e.ID))
+		for _, p := range e.Params {
+			b.WriteByte(' ')
+			b.WriteString(sdName(p.Name))
+			b.WriteString(`="`)
+			b.WriteString(sdValue.Replace(p.Value))
+			b.WriteByte('"')
+		}
+		b.WriteByte(']')
+	}
+
+	if m.Text != "" {
+		b.WriteByte(' ')
+		b.WriteString(m.Text)
+	}
+	return []byte(b.String())
+}
+
+// OctetCounted frames msg for a stream transport as "<length> <msg>", see
+// RFC 6587 section 3.4.1.
+func OctetCounted(msg []byte) []byte {
+	out := make([]byte, 0, len(msg)+8)
+	out = strconv.AppendInt(out, int64(len(msg)), 10)
+	out = append(out, ' ')
+	return append(out, msg...)
+}
+
+var sdValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func headerField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+// sdName drops the characters not allowed in SD-IDs and PARAM-NAMEs. The '@'
+// of an enterprise ID is kept.
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' || r == ' ' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
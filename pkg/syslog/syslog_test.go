@@ -0,0 +1,40 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	m := Message{
+		Facility:  3,
+		Severity:  Warning,
+		Timestamp: time.Date(2024, 2, 15, 10, 31, 45, 123456789, time.UTC),
+		Hostname:  "edge 01",
+		AppName:   "edgebeat",
+		ProcID:    "42",
+		MsgID:     "snapshot",
+		Data:      []Element{{ID: "edgebeat@32473", Params: []Param{{Name: "path", Value: `C:\a "b" [c]`}}}},
+		Text:      "cpu 12.5%",
+	}
+	want := `<28>1 2024-02-15T10:31:45.123456Z edge01 edgebeat 42 snapshot [edgebeat@32473 path="C:\\a \"b\" [c\]"] cpu 12.5%`
+	if got := string(m.Format()); got != want {
+		t.Fatalf("Format =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := string((Message{Severity: Debug}).Format()); got != "<7>1 - - - - - -" {
+		t.Fatalf("empty Format = %q", got)
+	}
+}
+
+func TestOctetCountedAndFacility(t *testing.T) {
+	if got := string(OctetCounted([]byte("<14>1 - - - - - -"))); got != "17 <14>1 - - - - - -" {
+		t.Fatalf("OctetCounted = %q", got)
+	}
+	if f, err := Facility("LOCAL3"); err != nil || f != 19 {
+		t.Fatalf("Facility = %d, %v", f, err)
+	}
+	if _, err := Facility("local8"); err == nil {
+		t.Fatal("expected error for unknown facility")
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+// identityFields name the field that identifies a list element, such as a
+// disk by its mountpoint, in order of preference. SNMP values are named per
+// target, so their target is prepended.
+var identityFields = []string{"mountpoint", "sensor_key", "name", "device"}
+
+// ElementKeys returns the identity of each of n list elements, or nil when
+// an element has none or two share one. Such lists, like per-CPU values,
+// are keyed by position instead. field returns the string field of element
+// i with the given JSON name, or "" when it has none.
+func ElementKeys(n int, field func(i int, name string) string) []string {
+	keys := make([]string, n)
+	seen := make(map[string]bool, n)
+	for i := range keys {
+		for _, name := range identityFields {
+			if id := field(i, name); id != "" {
+				keys[i] = id
+				break
+			}
+		}
+		if target := field(i, "target"); target != "" && keys[i] != "" {
+			keys[i] = target + "/" + keys[i]
+		}
+		if keys[i] == "" || seen[keys[i]] {
+			return nil
+		}
+		seen[keys[i]] = true
+	}
+	return keys
+}
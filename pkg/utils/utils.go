@@ -1,15 +1,25 @@
 package utils
 
+import "time"
+
+// SchemaVersion identifies the layout of SystemInfo as published to consumers.
+// Bump it whenever a field is renamed or removed.
+const SchemaVersion = "1"
+
 type SystemInfo struct {
-	Timestamp string       `json:"timestamp"`
-	CPU       CPUStats     `json:"cpu"`
-	Load      LoadStats    `json:"load"`
-	Memory    MemoryStats  `json:"memory"`
-	Disk      DiskStats    `json:"disk"`
-	Network   NetworkStats `json:"network"`
-	Host      HostStats    `json:"host"`
-	Sensors   SensorsStats `json:"sensors"`
-	Errors    []string     `json:"errors,omitempty"`
+	Timestamp string         `json:"timestamp"`
+	CPU       CPUStats       `json:"cpu"`
+	Load      LoadStats      `json:"load"`
+	Memory    MemoryStats    `json:"memory"`
+	Disk      DiskStats      `json:"disk"`
+	Network   NetworkStats   `json:"network"`
+	Host      HostStats      `json:"host"`
+	Sensors   SensorsStats   `json:"sensors"`
+	Modbus    *ModbusStats   `json:"modbus,omitempty"`
+	OPCUA     *OPCUAStats    `json:"opcua,omitempty"`
+	SNMP      *SNMPStats     `json:"snmp,omitempty"`
+	Location  *LocationStats `json:"location,omitempty"`
+	Errors    []string       `json:"errors,omitempty"`
 }
 
 type CPUStats struct {
@@ -108,11 +118,13 @@ type NetworkStats struct {
 }
 
 type NetInterface struct {
+	Index        int      `json:"index"`
 	Name         string   `json:"name"`
 	MTU          int      `json:"mtu"`
 	HardwareAddr string   `json:"hardware_addr"`
 	Flags        []string `json:"flags"`
 	Addrs        []string `json:"addrs"`
+	IO           NetIO    `json:"io"`
 }
 
 type NetIO struct {
@@ -152,6 +164,9 @@ type HostUser struct {
 type SensorsStats struct {
 	Temperatures []Temperature `json:"temperatures"`
 	Fans         []Fan         `json:"fans"`
+	// Readings holds the other values of IIO sensors, such as humidity or
+	// pressure; it is only present when the IIO collector is enabled.
+	Readings []SensorReading `json:"readings,omitempty"`
 }
 
 type Temperature struct {
@@ -165,3 +180,111 @@ type Fan struct {
 	SensorKey string  `json:"sensor_key"`
 	Value     float64 `json:"value"`
 }
+
+// SensorReading is a value other than a temperature. Type is the IIO channel
+// type, such as humidityrelative, pressure or voltage.
+type SensorReading struct {
+	SensorKey string  `json:"sensor_key"`
+	Type      string  `json:"type"`
+	Value     float64 `json:"value"`
+	Unit      string  `json:"unit,omitempty"`
+}
+
+// ModbusStats holds the values polled from the configured register map; it
+// is only present when Modbus polling is enabled.
+type ModbusStats struct {
+	Values []ModbusValue `json:"values"`
+}
+
+type ModbusValue struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+// OPCUAStats holds the values of the configured OPC UA nodes; it is only
+// present when the OPC UA client is enabled.
+type OPCUAStats struct {
+	Values []OPCUAValue `json:"values"`
+}
+
+// OPCUAValue is the last value of one node. Numeric and boolean values are
+// in Value; other values, such as strings, are in Text. Status is good,
+// uncertain or bad, StatusCode the OPC UA status code it derives from.
+type OPCUAValue struct {
+	Name            string  `json:"name"`
+	NodeID          string  `json:"node_id"`
+	Value           float64 `json:"value"`
+	Text            string  `json:"text,omitempty"`
+	Status          string  `json:"status"`
+	StatusCode      uint32  `json:"status_code"`
+	SourceTimestamp string  `json:"source_timestamp,omitempty"`
+}
+
+// SNMPStats holds the values polled from the configured SNMP targets; it is
+// only present when the SNMP poller is enabled.
+type SNMPStats struct {
+	Values []SNMPValue `json:"values"`
+}
+
+// SNMPValue is one object instance of a target. Numbers, including numeric
+// strings, are in Value after scaling; strings, OIDs and addresses are in
+// Text. Type is the ASN.1 type, such as Counter32 or OctetString.
+type SNMPValue struct {
+	Target string  `json:"target"`
+	Name   string  `json:"name"`
+	OID    string  `json:"oid"`
+	Value  float64 `json:"value"`
+	Text   string  `json:"text,omitempty"`
+	Type   string  `json:"type"`
+	Unit   string  `json:"unit,omitempty"`
+}
+
+// LocationStats is the position reported by the GPS receiver; it is only
+// present when the GPS collector is enabled. Fix is false while the
+// receiver has no valid position or has stopped sending; the position
+// fields then keep their last known values. FixQuality is the GGA quality
+// indicator (1 GPS, 2 DGPS, 4 RTK fixed, 5 RTK float), FixMode the GSA
+// mode: none, 2d or 3d. Time is the UTC time of the receiver.
+type LocationStats struct {
+	Fix        bool    `json:"fix"`
+	FixQuality int     `json:"fix_quality"`
+	FixMode    string  `json:"fix_mode,omitempty"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	AltitudeM  float64 `json:"altitude_m"`
+	SpeedKmh   float64 `json:"speed_kmh"`
+	CourseDeg  float64 `json:"course_deg"`
+	Satellites int     `json:"satellites"`
+	HDOP       float64 `json:"hdop"`
+	PDOP       float64 `json:"pdop,omitempty"`
+	VDOP       float64 `json:"vdop,omitempty"`
+	Time       string  `json:"time,omitempty"`
+}
+
+// IntegrationStatus is the live state of a polled integration. Connected
+// reports whether the last poll reached the device; LatencyMS is the
+// duration of that poll.
+type IntegrationStatus struct {
+	Connected   bool    `json:"connected"`
+	Polls       uint64  `json:"polls"`
+	FailedPolls uint64  `json:"failed_polls"`
+	LatencyMS   float64 `json:"latency_ms"`
+	LastSuccess string  `json:"last_success,omitempty"`
+	LastError   string  `json:"last_error,omitempty"`
+	LastErrorAt string  `json:"last_error_at,omitempty"`
+}
+
+// Record counts a poll that started at start and just ended with err.
+func (s *IntegrationStatus) Record(start time.Time, err error) {
+	now := time.Now()
+	s.Polls++
+	s.LatencyMS = float64(now.Sub(start).Microseconds()) / 1000
+	if err != nil {
+		s.FailedPolls++
+		s.LastError = err.Error()
+		s.LastErrorAt = now.UTC().Format(time.RFC3339)
+		return
+	}
+	s.LastSuccess = now.UTC().Format(time.RFC3339)
+}